@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/archive"
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+)
+
+// aggregateInternetArchiveHandler searches the Internet Archive for a book's
+// title and author and stores matching PDFs and audio as draft proposals.
+// POST /v1/books/{id}/proposals/internet-archive
+func (app *application) aggregateInternetArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	book, err := app.models.Books.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	var input struct {
+		Title           string `json:"title"`
+		Author          string `json:"author"`
+		MaxItems        int    `json:"max_items"`
+		MaxFilesPerItem int    `json:"max_files_per_item"`
+	}
+	// The body is optional; an empty POST searches with the book's details.
+	if err := app.readJSON(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Default to the book's own title and author
+	if input.Title == "" {
+		input.Title = book.Title
+	}
+	if input.Author == "" {
+		input.Author = book.OriginalAuthor
+	}
+	if input.MaxItems == 0 {
+		input.MaxItems = 5
+	}
+	if input.MaxFilesPerItem == 0 {
+		input.MaxFilesPerItem = 40
+	}
+
+	v := validator.New()
+	v.Check(input.MaxItems > 0 && input.MaxItems <= 20, "max_items", "must be between 1 and 20")
+	v.Check(input.MaxFilesPerItem > 0 && input.MaxFilesPerItem <= 200, "max_files_per_item", "must be between 1 and 200")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 90*time.Second)
+	defer cancel()
+
+	results, err := app.archive.Search(ctx, input.Title, input.Author, input.MaxItems)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorResponse(w, http.StatusBadGateway, "Internet Archive search failed")
+		return
+	}
+
+	query := strings.TrimSpace(input.Title + " / " + input.Author)
+	proposals := []*data.Proposal{}
+	skipped := 0
+
+	for _, res := range results {
+		item, err := app.archive.Metadata(ctx, res.Identifier)
+		if err != nil {
+			// One broken item shouldn't lose the rest of the search
+			app.logger.Printf("archive: metadata %s: %v", res.Identifier, err)
+			continue
+		}
+
+		files := 0
+		for _, f := range item.Files {
+			kind := f.Kind()
+			if kind == "" {
+				continue
+			}
+			if files++; files > input.MaxFilesPerItem {
+				break
+			}
+
+			p := app.newArchiveProposal(book.ID, userID, query, item, f, kind, files)
+			created, err := app.models.Proposals.Insert(p)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !created {
+				skipped++
+				continue
+			}
+			proposals = append(proposals, p)
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"proposals":     proposals,
+		"items_scanned": len(results),
+		"skipped":       skipped,
+	}, nil)
+}
+
+// newArchiveProposal builds a draft resource for one archive.org file.
+func (app *application) newArchiveProposal(bookID, userID, query string, item *archive.Item, f archive.File, kind string, position int) *data.Proposal {
+	title := f.Title
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+	}
+	if item.Title != "" && !strings.Contains(title, item.Title) {
+		title = item.Title + " – " + title
+	}
+
+	sequence := position
+	if f.Track > 0 {
+		sequence = f.Track
+	}
+
+	p := &data.Proposal{
+		Resource: data.Resource{
+			BookID:        bookID,
+			Type:          kind,
+			Title:         title,
+			URL:           app.archive.DownloadURL(item.Identifier, f.Name),
+			SequenceIndex: sequence,
+			CreatedBy:     &userID,
+		},
+		Provenance: data.Provenance{
+			Source:     "internet_archive",
+			Identifier: item.Identifier,
+			File:       f.Name,
+			DetailsURL: app.archive.DetailsURL(item.Identifier),
+			ItemTitle:  item.Title,
+			Creator:    item.Creator,
+			License:    item.License,
+			Query:      query,
+			FetchedAt:  time.Now().UTC(),
+		},
+	}
+
+	mime := "application/pdf"
+	if kind == "audio" {
+		mime = "audio/mpeg"
+		if strings.EqualFold(path.Ext(f.Name), ".m4a") {
+			mime = "audio/mp4"
+		}
+	}
+	p.MimeType = &mime
+	if f.SizeBytes > 0 {
+		p.FileSizeBytes = &f.SizeBytes
+	}
+	if f.DurationSeconds > 0 {
+		p.DurationSeconds = &f.DurationSeconds
+	}
+	return p
+}
+
+// listProposalsHandler returns a book's undecided aggregator proposals.
+// GET /v1/books/{id}/proposals
+func (app *application) listProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	proposals, err := app.models.Proposals.GetPending(r.PathValue("id"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"proposals": proposals}, nil)
+}
+
+// decideProposalHandler accepts or rejects a proposal. Accepted proposals
+// follow the usual workflow: published for super admins, pending review otherwise.
+// POST /v1/resources/{id}/proposal
+func (app *application) decideProposalHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Action string `json:"action"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Action, "accept", "reject"), "action", "must be accept or reject")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	status := "rejected"
+	if input.Action == "accept" {
+		status = "pending_review"
+		if user.Role == "super_admin" {
+			status = "published"
+		}
+	}
+
+	res, err := app.models.Proposals.Decide(r.PathValue("id"), status, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Proposal not found or already decided")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if res.ProcessingStatus == "pending" {
+		app.processor.enqueue(res.ID)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"resource": res}, nil)
+}
@@ -24,6 +24,7 @@ func (app *application) trackActivityHandler(w http.ResponseWriter, r *http.Requ
 
 	go func() {
 		app.models.Analytics.LogStudyHeartbeat(userID, input.BookID)
+		app.applyActivityRules(userID, input.BookID)
 	}()
 
 	w.WriteHeader(http.StatusOK)
@@ -58,6 +59,7 @@ func (app *application) getSystemStatsHandler(w http.ResponseWriter, r *http.Req
 		app.errorResponse(w, http.StatusInternalServerError, "Failed to fetch system stats")
 		return
 	}
+	app.hideStorageURLs(stats.RecentResources...)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
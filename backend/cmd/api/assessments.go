@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+)
+
+// nodeAssessment loads the assessment of the {node_id} path value. It writes
+// the error response itself and returns nil on failure.
+func (app *application) nodeAssessment(w http.ResponseWriter, r *http.Request) *data.Assessment {
+	a, err := app.models.Assessments.GetForNode(r.PathValue("node_id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "This step has no assessment")
+			return nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	return a
+}
+
+// getNodeAssessmentHandler shows a node's assessment and the current user's
+// attempts, including whether a retake is cooling down. The question bank is
+// only shown to staff; students get their questions when starting a quiz.
+// GET /v1/roadmaps/nodes/{node_id}/assessment
+func (app *application) getNodeAssessmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	a := app.nodeAssessment(w, r)
+	if a == nil {
+		return
+	}
+
+	attempts, err := app.models.Assessments.GetAttempts(a.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	status := a.Status(attempts, time.Now())
+
+	resp := envelope{"assessment": a, "status": status, "attempts": attempts}
+	if status.Open != nil && status.Open.Status == "in_progress" {
+		questions, err := app.models.Assessments.GetQuestions(status.Open)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		resp["questions"] = questions
+	}
+
+	if !isStaff(app.contextGetUser(r)) {
+		if a.Kind == data.AssessmentQuiz && (a.QuestionCount == 0 || a.QuestionCount > len(a.Questions)) {
+			a.QuestionCount = len(a.Questions)
+		}
+		a.Questions = nil
+	}
+
+	app.writeJSON(w, http.StatusOK, resp, nil)
+}
+
+// saveNodeAssessmentHandler attaches an assessment to a node, or replaces
+// the existing one. Once attached, the node can only be completed after a
+// passing attempt.
+// PUT /v1/roadmaps/nodes/{node_id}/assessment
+func (app *application) saveNodeAssessmentHandler(w http.ResponseWriter, r *http.Request) {
+	nodeID := r.PathValue("node_id")
+
+	var input struct {
+		Kind          string `json:"kind"`
+		Title         string `json:"title"`
+		Instructions  string `json:"instructions"`
+		PassScore     *int   `json:"pass_score"`
+		QuestionCount int    `json:"question_count"`
+		CooldownHours *int   `json:"cooldown_hours"`
+		Questions     []struct {
+			Prompt       string   `json:"prompt"`
+			Choices      []string `json:"choices"`
+			CorrectIndex *int     `json:"correct_index"`
+		} `json:"questions"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	a := &data.Assessment{
+		NodeID:        nodeID,
+		Kind:          input.Kind,
+		Title:         strings.TrimSpace(input.Title),
+		Instructions:  input.Instructions,
+		PassScore:     70,
+		QuestionCount: input.QuestionCount,
+		CooldownHours: 24,
+	}
+	if input.PassScore != nil {
+		a.PassScore = *input.PassScore
+	}
+	if input.CooldownHours != nil {
+		a.CooldownHours = *input.CooldownHours
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(a.Kind, data.AssessmentQuiz, data.AssessmentRecitation, data.AssessmentSignoff),
+		"kind", "must be quiz, recitation or signoff")
+	v.Check(a.Title != "", "title", "must be provided")
+	v.Check(a.PassScore >= 0 && a.PassScore <= 100, "pass_score", "must be between 0 and 100")
+	v.Check(a.CooldownHours >= 0, "cooldown_hours", "must not be negative")
+	if a.Kind == data.AssessmentQuiz {
+		v.Check(len(input.Questions) > 0, "questions", "a quiz needs at least one question")
+		v.Check(a.QuestionCount >= 0 && a.QuestionCount <= len(input.Questions), "question_count",
+			"must be between 0 (all questions) and the number of questions")
+		for i, q := range input.Questions {
+			key := fmt.Sprintf("questions[%d]", i)
+			v.Check(strings.TrimSpace(q.Prompt) != "", key+".prompt", "must be provided")
+			v.Check(len(q.Choices) >= 2, key+".choices", "must offer at least two choices")
+			v.Check(q.CorrectIndex != nil && *q.CorrectIndex >= 0 && *q.CorrectIndex < len(q.Choices),
+				key+".correct_index", "must point at one of the choices")
+			a.Questions = append(a.Questions, &data.AssessmentQuestion{
+				Prompt: q.Prompt, Choices: q.Choices, CorrectIndex: q.CorrectIndex,
+			})
+		}
+	} else {
+		v.Check(len(input.Questions) == 0, "questions", "only quizzes have questions")
+		a.QuestionCount = 0
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err := app.models.Roadmaps.GetNodeRoadmapID(nodeID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Node not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.models.Assessments.Save(a); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"assessment": a}, nil)
+}
+
+// deleteNodeAssessmentHandler removes a node's assessment and its attempts.
+// DELETE /v1/roadmaps/nodes/{node_id}/assessment
+func (app *application) deleteNodeAssessmentHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Assessments.Delete(r.PathValue("node_id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "This step has no assessment")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "assessment removed"}, nil)
+}
+
+// startAssessmentAttemptHandler starts an attempt at a node's assessment.
+// A quiz returns the questions drawn for this attempt (an unfinished quiz is
+// resumed rather than redrawn). Recitations and sign-offs are submitted for
+// review straight away; a recitation needs a link to the recording.
+// POST /v1/roadmaps/nodes/{node_id}/assessment/attempts
+func (app *application) startAssessmentAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+	nodeID := r.PathValue("node_id")
+
+	var input struct {
+		Submission string `json:"submission"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.Submission = strings.TrimSpace(input.Submission)
+
+	a := app.nodeAssessment(w, r)
+	if a == nil {
+		return
+	}
+
+	locked, err := app.models.Roadmaps.IsNodeLocked(userID, nodeID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if locked {
+		app.errorResponse(w, http.StatusForbidden, "Complete the prerequisites for this step first.")
+		return
+	}
+
+	attempts, err := app.models.Assessments.GetAttempts(a.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	status := a.Status(attempts, time.Now())
+
+	switch {
+	case status.Passed:
+		app.errorResponse(w, http.StatusConflict, "You have already passed this assessment")
+		return
+	case status.Open != nil && status.Open.Status == "in_progress":
+		app.writeAttempt(w, r, http.StatusOK, status.Open)
+		return
+	case status.Open != nil:
+		app.errorResponse(w, http.StatusConflict, "Your last attempt is still awaiting review")
+		return
+	case status.RetryAt != nil:
+		wait := int(math.Ceil(time.Until(*status.RetryAt).Seconds()))
+		headers := http.Header{"Retry-After": []string{strconv.Itoa(wait)}}
+		app.writeJSON(w, http.StatusTooManyRequests, envelope{
+			"error":    "You can retake this assessment once the cool-down has passed",
+			"retry_at": status.RetryAt,
+		}, headers)
+		return
+	}
+
+	if a.Kind == data.AssessmentRecitation && input.Submission == "" {
+		app.failedValidationResponse(w, r, map[string]string{"submission": "must link to your recitation"})
+		return
+	}
+
+	attempt, err := app.models.Assessments.StartAttempt(a, userID, input.Submission)
+	if err != nil {
+		if errors.Is(err, data.ErrAttemptOpen) {
+			app.errorResponse(w, http.StatusConflict, "You already have an open attempt")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeAttempt(w, r, http.StatusCreated, attempt)
+}
+
+// writeAttempt responds with an attempt and, for an unfinished quiz, its
+// questions.
+func (app *application) writeAttempt(w http.ResponseWriter, r *http.Request, status int, attempt *data.AssessmentAttempt) {
+	resp := envelope{"attempt": attempt}
+	if attempt.Status == "in_progress" {
+		questions, err := app.models.Assessments.GetQuestions(attempt)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		resp["questions"] = questions
+	}
+	app.writeJSON(w, status, resp, nil)
+}
+
+// submitAssessmentAttemptHandler submits the answers to a quiz attempt and
+// grades it immediately.
+// POST /v1/assessments/attempts/{id}/submit
+func (app *application) submitAssessmentAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Answers map[string]int `json:"answers"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attempt, err := app.models.Assessments.SubmitQuiz(r.PathValue("id"), userID, input.Answers)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Attempt not found")
+		case errors.Is(err, data.ErrAttemptClosed):
+			app.errorResponse(w, http.StatusConflict, "This attempt has already been submitted")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempt": attempt, "passed": attempt.Status == "passed"}, nil)
+}
+
+// listPendingAssessmentAttemptsHandler is the review queue of recitations and
+// sign-off requests for teachers.
+// GET /v1/assessments/attempts/pending
+func (app *application) listPendingAssessmentAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isStaff(app.contextGetUser(r)) {
+		app.errorResponse(w, http.StatusForbidden, "Only teachers can review assessments")
+		return
+	}
+
+	pending, err := app.models.Assessments.GetPending()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempts": pending}, nil)
+}
+
+// reviewAssessmentAttemptHandler grades a recitation or answers a sign-off
+// request, and notifies the student. Either a score (0-100) or a plain
+// passed flag is accepted.
+// POST /v1/assessments/attempts/{id}/review
+func (app *application) reviewAssessmentAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	reviewer := app.contextGetUser(r)
+	if !isStaff(reviewer) {
+		app.errorResponse(w, http.StatusForbidden, "Only teachers can review assessments")
+		return
+	}
+
+	var input struct {
+		Score    *int   `json:"score"`
+		Passed   *bool  `json:"passed"`
+		Feedback string `json:"feedback"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	score := 0
+	switch {
+	case input.Score != nil:
+		score = *input.Score
+	case input.Passed != nil && *input.Passed:
+		score = 100
+	case input.Passed == nil:
+		app.failedValidationResponse(w, r, map[string]string{"score": "provide a score or passed"})
+		return
+	}
+	if score < 0 || score > 100 {
+		app.failedValidationResponse(w, r, map[string]string{"score": "must be between 0 and 100"})
+		return
+	}
+
+	attemptID := r.PathValue("id")
+	existing, err := app.models.Assessments.GetAttempt(attemptID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Attempt not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if existing.UserID == reviewer.ID {
+		app.errorResponse(w, http.StatusForbidden, "You cannot review your own attempt")
+		return
+	}
+
+	attempt, err := app.models.Assessments.Review(attemptID, reviewer.ID, score, input.Feedback)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Attempt not found")
+		case errors.Is(err, data.ErrAttemptClosed):
+			app.errorResponse(w, http.StatusConflict, "This attempt has already been reviewed")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	title, message := "Assessment not passed yet", "Your teacher reviewed your attempt. You can try again after the cool-down."
+	if attempt.Status == "passed" {
+		title, message = "Assessment passed", "Your teacher approved your attempt. You can now complete this step."
+	}
+	payload, _ := json.Marshal(map[string]any{"attempt_id": attempt.ID, "score": attempt.Score})
+	app.models.Notifications.Insert(&data.Notification{
+		UserID:  attempt.UserID,
+		Type:    "assessment_reviewed",
+		Title:   title,
+		Message: message,
+		Data:    payload,
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempt": attempt}, nil)
+}
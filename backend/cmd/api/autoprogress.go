@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+)
+
+// completionBlocker explains why a user cannot complete a node yet, or
+// returns "" if they can: prerequisites, a published reflection on the book,
+// and a passed assessment are all required.
+func (app *application) completionBlocker(userID, nodeID string) (string, error) {
+	locked, err := app.models.Roadmaps.IsNodeLocked(userID, nodeID)
+	if err != nil {
+		return "", err
+	}
+	if locked {
+		return "Complete the prerequisites for this step first.", nil
+	}
+
+	bookID, err := app.models.Roadmaps.GetNodeBookID(nodeID)
+	if err != nil {
+		return "", err
+	}
+	hasNote, err := app.models.Notes.HasPublishedNote(userID, bookID)
+	if err != nil {
+		return "", err
+	}
+	if !hasNote {
+		return "You must publish a reflection for this book before marking it as complete.", nil
+	}
+
+	passed, err := app.models.Assessments.IsGateOpen(userID, nodeID)
+	if err != nil {
+		return "", err
+	}
+	if !passed {
+		return "You must pass this step's assessment before marking it as complete.", nil
+	}
+	return "", nil
+}
+
+// afterProgressChange keeps cohort standings current and, when the change
+// completed the roadmap, issues its certificate.
+func (app *application) afterProgressChange(userID, roadmapID, status string) *data.Certificate {
+	if err := app.models.Social.RefreshCohortProgress(userID, roadmapID); err != nil {
+		app.logger.Printf("refreshing cohort progress for roadmap %s: %v", roadmapID, err)
+	}
+
+	// Finishing the last step issues the roadmap's certificate.
+	if status != "completed" {
+		return nil
+	}
+	cert, err := app.issueCertificate(userID, roadmapID)
+	switch {
+	case err == nil:
+		return cert
+	case !errors.Is(err, errRoadmapIncomplete) && !errors.Is(err, data.ErrRecordNotFound):
+		app.logger.Printf("issuing certificate for roadmap %s: %v", roadmapID, err)
+	}
+	return nil
+}
+
+// applyActivityRules starts the not-yet-started nodes for a book once the
+// user studies it. Heartbeats arrive every minute, so the lookup runs at most
+// once an hour per user and book.
+func (app *application) applyActivityRules(userID, bookID string) {
+	if bookID == "" {
+		return
+	}
+	guard := fmt.Sprintf("roadmap:autoprogress:activity:%s:%s", userID, bookID)
+	if app.models.Roadmaps.Cache.Exists(context.Background(), guard) {
+		return
+	}
+	app.models.Roadmaps.Cache.Set(context.Background(), guard, "1", time.Hour)
+
+	nodes, err := app.models.Roadmaps.GetAutoProgressNodes(userID, bookID)
+	if err != nil {
+		app.logger.Printf("auto progress for book %s: %v", bookID, err)
+		return
+	}
+	for _, n := range nodes {
+		if !n.StartOnActivity || n.Status != "not_started" {
+			continue
+		}
+		if locked, err := app.models.Roadmaps.IsNodeLocked(userID, n.NodeID); err != nil || locked {
+			continue
+		}
+		err := app.models.Roadmaps.SetProgress(userID, n.NodeID, "in_progress", data.ProgressSourceActivity,
+			map[string]any{"book_id": bookID})
+		if err != nil {
+			app.logger.Printf("auto progress for node %s: %v", n.NodeID, err)
+			continue
+		}
+		app.afterProgressChange(userID, n.RoadmapID, "in_progress")
+	}
+}
+
+// applyReadingRules acts on a finished book: nodes of roadmaps set to "auto"
+// are completed when nothing blocks them, otherwise the user is asked to
+// complete them (or told what is missing).
+func (app *application) applyReadingRules(userID, bookID string, currentPage, totalPages int) {
+	if totalPages <= 0 || currentPage < totalPages {
+		return
+	}
+
+	nodes, err := app.models.Roadmaps.GetAutoProgressNodes(userID, bookID)
+	if err != nil {
+		app.logger.Printf("auto progress for book %s: %v", bookID, err)
+		return
+	}
+	detail := map[string]any{"book_id": bookID, "current_page": currentPage, "total_pages": totalPages}
+
+	for _, n := range nodes {
+		if n.CompleteOnFinish == "off" || n.Status == "completed" {
+			continue
+		}
+
+		blocker, err := app.completionBlocker(userID, n.NodeID)
+		if err != nil {
+			app.logger.Printf("auto progress for node %s: %v", n.NodeID, err)
+			continue
+		}
+
+		if n.CompleteOnFinish == "auto" && blocker == "" {
+			err := app.models.Roadmaps.SetProgress(userID, n.NodeID, "completed", data.ProgressSourceReading, detail)
+			if err != nil {
+				app.logger.Printf("auto progress for node %s: %v", n.NodeID, err)
+				continue
+			}
+			app.afterProgressChange(userID, n.RoadmapID, "completed")
+			continue
+		}
+
+		suggestion := map[string]any{"blocked_by": blocker}
+		for k, v := range detail {
+			suggestion[k] = v
+		}
+		created, err := app.models.Roadmaps.SuggestProgress(userID, n.NodeID, n.Status, "completed",
+			data.ProgressSourceReading, suggestion)
+		if err != nil {
+			app.logger.Printf("suggesting progress for node %s: %v", n.NodeID, err)
+			continue
+		}
+		if created {
+			message := "You finished this book. Mark the roadmap step as complete?"
+			if blocker != "" {
+				message = "You finished this book. " + blocker
+			}
+			payload, _ := json.Marshal(map[string]string{"node_id": n.NodeID, "roadmap_id": n.RoadmapID})
+			app.models.Notifications.Insert(&data.Notification{
+				UserID:  userID,
+				Type:    "roadmap_progress_suggestion",
+				Title:   "Ready to complete this step?",
+				Message: message,
+				Data:    payload,
+			})
+		}
+	}
+}
+
+// readProgressRules decodes and validates a rules update on top of the
+// current rules. It writes the error response itself and returns false on
+// failure.
+func (app *application) readProgressRules(w http.ResponseWriter, r *http.Request, rules *data.ProgressRules) bool {
+	var input struct {
+		StartOnActivity  *bool   `json:"start_on_activity"`
+		CompleteOnFinish *string `json:"complete_on_finish"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+	if input.StartOnActivity != nil {
+		rules.StartOnActivity = *input.StartOnActivity
+	}
+	if input.CompleteOnFinish != nil {
+		rules.CompleteOnFinish = *input.CompleteOnFinish
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(rules.CompleteOnFinish, "off", "suggest", "auto"),
+		"complete_on_finish", "must be off, suggest or auto")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
+
+// getRoadmapProgressRulesHandler shows how a roadmap's nodes move on their own.
+// GET /v1/roadmaps/{id}/progress/rules
+func (app *application) getRoadmapProgressRulesHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap, err := app.models.Roadmaps.GetByID(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return
+	}
+
+	rules, err := app.models.Roadmaps.GetProgressRules(roadmap.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"rules": rules}, nil)
+}
+
+// updateRoadmapProgressRulesHandler configures a curated roadmap's rules.
+// PUT /v1/roadmaps/{id}/progress/rules
+func (app *application) updateRoadmapProgressRulesHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap, err := app.models.Roadmaps.GetByID(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return
+	}
+	app.saveProgressRules(w, r, roadmap.ID)
+}
+
+// updateMyRoadmapProgressRulesHandler configures the rules of a personal roadmap.
+// PUT /v1/users/me/roadmaps/{id}/progress/rules
+func (app *application) updateMyRoadmapProgressRulesHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+	app.saveProgressRules(w, r, roadmap.ID)
+}
+
+func (app *application) saveProgressRules(w http.ResponseWriter, r *http.Request, roadmapID string) {
+	rules, err := app.models.Roadmaps.GetProgressRules(roadmapID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !app.readProgressRules(w, r, rules) {
+		return
+	}
+
+	if err := app.models.Roadmaps.SetProgressRules(rules); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"rules": rules}, nil)
+}
+
+// listProgressEventsHandler is the user's roadmap progress history with the
+// source of every change. ?roadmap_id= narrows it to one roadmap and
+// ?suggestions=true returns only open suggestions.
+// GET /v1/users/me/roadmap-progress
+func (app *application) listProgressEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+	query := r.URL.Query()
+
+	events, err := app.models.Roadmaps.GetProgressEvents(userID, query.Get("roadmap_id"), query.Get("suggestions") == "true")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"events": events}, nil)
+}
+
+// dismissProgressSuggestionHandler dismisses a suggested progress change.
+// DELETE /v1/users/me/roadmap-progress/suggestions/{id}
+func (app *application) dismissProgressSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	err := app.models.Roadmaps.DismissSuggestion(r.PathValue("id"), userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Suggestion not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "suggestion dismissed"}, nil)
+}
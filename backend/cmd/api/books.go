@@ -20,6 +20,7 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		TitleAr        *string `json:"title_ar"`
 		OriginalAuthorAr *string `json:"author_ar"`
 		Status         *string `json:"status"`
+		Slug           *string `json:"slug"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&input)
@@ -28,6 +29,14 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if input.Slug != nil && *input.Slug == "" {
+		input.Slug = nil
+	}
+	if input.Slug != nil && !validator.Matches(*input.Slug, validator.SlugRX) {
+		app.failedValidationResponse(w, r, map[string]string{"slug": "must be lowercase letters, digits and hyphens"})
+		return
+	}
+
 	userID, ok := r.Context().Value(UserContextKey).(string)
 	if !ok || userID == "" {
 		app.errorResponse(w, http.StatusUnauthorized, "Unauthorized")
@@ -49,6 +58,7 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		TitleAr:        input.TitleAr,
 		OriginalAuthorAr: input.OriginalAuthorAr,
 		Status:         "draft", // Default to draft
+		Slug:           input.Slug,
 	}
 
 	if input.Status != nil && user.Role == "super_admin" {
@@ -64,6 +74,10 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	err = app.models.Books.Insert(book)
+	if errors.Is(err, data.ErrDuplicateSlug) {
+		app.errorResponse(w, http.StatusConflict, "A book with this slug already exists")
+		return
+	}
 	if err != nil {
 		app.logger.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -163,6 +177,7 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		TitleAr        *string `json:"title_ar"`
 		OriginalAuthorAr *string `json:"author_ar"`
 		Status         *string `json:"status"`
+		Slug           *string `json:"slug"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -170,6 +185,17 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if input.Slug != nil {
+		if *input.Slug == "" {
+			book.Slug = nil
+		} else if validator.Matches(*input.Slug, validator.SlugRX) {
+			book.Slug = input.Slug
+		} else {
+			app.failedValidationResponse(w, r, map[string]string{"slug": "must be lowercase letters, digits and hyphens"})
+			return
+		}
+	}
+
     userID, ok := r.Context().Value(UserContextKey).(string)
     var userRole string
     if ok && userID != "" {
@@ -230,6 +256,10 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	err = app.models.Books.Update(book)
+	if errors.Is(err, data.ErrDuplicateSlug) {
+		app.errorResponse(w, http.StatusConflict, "A book with this slug already exists")
+		return
+	}
 	if err != nil {
 		app.errorResponse(w, http.StatusInternalServerError, "Failed to update book")
 		return
@@ -286,6 +316,8 @@ func (app *application) saveProgressHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.applyReadingRules(userID, bookID, input.CurrentPage, input.TotalPages)
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "progress saved"}`))
 }
\ No newline at end of file
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/certificate"
+	"github.com/draqist/iqraa/backend/internal/data"
+)
+
+// errRoadmapIncomplete is returned when a certificate is requested for a
+// roadmap the user has not finished.
+var errRoadmapIncomplete = errors.New("roadmap not completed")
+
+// requireCertificates answers 503 for routes that sign or verify documents
+// when no certificate secret is configured.
+func (app *application) requireCertificates(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.certificates == nil {
+			app.errorResponse(w, http.StatusServiceUnavailable, "Certificates are not available")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// issueCertificate signs and stores a certificate once every node of the
+// roadmap is completed. Issuing is idempotent: a user who already holds a
+// certificate for the roadmap gets the existing one back.
+func (app *application) issueCertificate(userID, roadmapID string) (*data.Certificate, error) {
+	if existing, err := app.models.Certificates.GetForRoadmap(userID, roadmapID); err == nil {
+		return existing, nil
+	} else if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	title, nodes, err := app.models.Certificates.GetCompletion(userID, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, errRoadmapIncomplete
+	}
+	books := make([]certificate.Book, 0, len(nodes))
+	for _, n := range nodes {
+		if !n.Completed {
+			return nil, errRoadmapIncomplete
+		}
+		books = append(books, certificate.Book{BookID: n.BookID, Title: n.BookTitle, CompletedAt: n.CompletedAt.UTC()})
+	}
+
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	name := user.Name
+	if name == "" {
+		name = user.Username
+	}
+
+	codeBytes := make([]byte, 8)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return nil, err
+	}
+
+	payload := &certificate.Payload{
+		Code:         strings.ToUpper(hex.EncodeToString(codeBytes)),
+		Name:         name,
+		RoadmapID:    roadmapID,
+		RoadmapTitle: title,
+		IssuedAt:     time.Now().UTC().Truncate(time.Second),
+		Books:        books,
+	}
+	signed, signature, err := app.certificates.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.models.Certificates.Insert(&data.Certificate{
+		Code:      payload.Code,
+		UserID:    userID,
+		RoadmapID: roadmapID,
+		Payload:   string(signed),
+		Signature: signature,
+		KeyID:     app.certificates.KeyID(),
+		IssuedAt:  payload.IssuedAt,
+	})
+}
+
+// claimCertificateHandler issues (or returns) the current user's certificate
+// for a completed roadmap.
+// POST /v1/roadmaps/{id}/certificate
+func (app *application) claimCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	cert, err := app.issueCertificate(userID, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		case errors.Is(err, errRoadmapIncomplete):
+			app.errorResponse(w, http.StatusConflict, "Complete every step of the roadmap to earn its certificate")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"certificate": cert, "verify_url": certificateURL(cert.Code)}, nil)
+}
+
+// listMyCertificatesHandler lists the current user's certificates.
+// GET /v1/users/me/certificates
+func (app *application) listMyCertificatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	certificates, err := app.models.Certificates.GetForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"certificates": certificates}, nil)
+}
+
+// loadCertificate loads a certificate by the {code} path value and checks
+// its signature. The payload is nil when the signature does not hold. It
+// writes the error response itself and returns a nil certificate on failure.
+func (app *application) loadCertificate(w http.ResponseWriter, r *http.Request) (*data.Certificate, *certificate.Payload) {
+	cert, err := app.models.Certificates.GetByCode(strings.ToUpper(r.PathValue("code")))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Certificate not found")
+			return nil, nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, nil
+	}
+
+	payload, err := app.certificates.Verify([]byte(cert.Payload), cert.Signature, cert.KeyID)
+	if err != nil || payload.Code != cert.Code {
+		app.logger.Printf("certificate %s failed verification: %v", cert.Code, err)
+		return cert, nil
+	}
+	return cert, payload
+}
+
+// verifyCertificateHandler publicly verifies a certificate and shows who
+// completed which roadmap, when, and the completion date of every book.
+// GET /v1/certificates/{code}
+func (app *application) verifyCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	cert, payload := app.loadCertificate(w, r)
+	if cert == nil {
+		return
+	}
+	if payload == nil {
+		app.writeJSON(w, http.StatusOK, envelope{"valid": false, "code": cert.Code}, nil)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"valid":       true,
+		"certificate": payload,
+		"payload":     cert.Payload,
+		"signature":   cert.Signature,
+		"algorithm":   "Ed25519",
+		"key_id":      cert.KeyID,
+		"public_key":  app.certificates.PublicKey(cert.KeyID),
+	}, nil)
+}
+
+// downloadCertificateHandler renders a certificate as printable HTML
+// (default) or SVG.
+// GET /v1/certificates/{code}/download
+func (app *application) downloadCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "svg" {
+		app.errorResponse(w, http.StatusBadRequest, "format must be html or svg")
+		return
+	}
+
+	cert, payload := app.loadCertificate(w, r)
+	if cert == nil {
+		return
+	}
+	if payload == nil {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Certificate could not be verified")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := certificate.Render(&buf, payload, format, certificateURL(cert.Code)); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := "text/html; charset=utf-8"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `inline; filename="certificate-`+cert.Code+`.`+format+`"`)
+	w.Write(buf.Bytes())
+}
+
+func certificateURL(code string) string {
+	return apiURL("/v1/certificates/" + code)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Room events and presence are shared between API instances through Redis.
+// Every hub publishes its room events on one channel and relays what it
+// receives to its own clients. Presence is one hash per room, with a field
+// per instance and user; each instance keeps re-stamping its own fields, so
+// the fields of a crashed instance go stale and are ignored, then pruned.
+//
+// All presence I/O runs in presenceLoop, never in Hub.run, so a slow Redis
+// cannot hold up message delivery.
+const (
+	chatEventsChannel = "chat:events"
+
+	// How often an instance re-stamps its presence fields, and how long they
+	// count after an instance stopped doing so.
+	presenceRefresh = 30 * time.Second
+	presenceTTL     = 3 * presenceRefresh
+
+	// Presence changes waiting for presenceLoop. When it falls this far
+	// behind, changes are dropped; the next refresh repairs presence.
+	presenceQueueSize = 256
+)
+
+func presenceKey(roomID string) string {
+	return "chat:presence:" + roomID
+}
+
+func (h *Hub) presenceField(userID string) string {
+	return h.instanceID + ":" + userID
+}
+
+// presenceEntry is the value of a presence field.
+type presenceEntry struct {
+	User chatUser `json:"user"`
+	Seen int64    `json:"seen"`
+}
+
+// presenceOp is a client joining or leaving a room, for presenceLoop.
+type presenceOp struct {
+	client *Client
+	joined bool
+}
+
+// queuePresence hands a presence change to presenceLoop without blocking.
+// h.mu must be held.
+func (h *Hub) queuePresence(op presenceOp) {
+	select {
+	case h.presence <- op:
+	default:
+		h.app.logger.Printf("chat presence: queue full, dropped update for room %s", op.client.roomID)
+	}
+}
+
+// presenceLoop records who is in which room in Redis, tells newcomers who
+// is there and announces joins and leaves.
+func (h *Hub) presenceLoop() {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case op := <-h.presence:
+			if op.joined {
+				h.joined(op.client)
+			} else {
+				h.left(op.client)
+			}
+		case <-ticker.C:
+			h.refreshPresence()
+		}
+	}
+}
+
+// joined marks a new client's user present, sends the client the room's
+// members and, unless the user was already there in another tab or on
+// another instance, tells the room they joined.
+func (h *Hub) joined(client *Client) {
+	remote := h.remotePresence(client.roomID)
+	_, already := remote[client.user.ID]
+
+	h.mu.RLock()
+	for other := range h.rooms[client.roomID] {
+		if other != client && other.user.ID == client.user.ID {
+			already = true
+		}
+	}
+	h.mu.RUnlock()
+
+	h.markPresent(client.roomID, client.user)
+
+	users := h.localPresence(client.roomID)
+	for id, u := range remote {
+		users[id] = u
+	}
+	users[client.user.ID] = client.user
+	list := sortedUsers(users)
+
+	h.mu.Lock()
+	if h.clients[client] {
+		h.deliverLocked(client, encodeEvent(eventPresence, "", map[string]any{"users": list, "count": len(list)}))
+	}
+	h.mu.Unlock()
+
+	if !already {
+		h.send(roomEvent{RoomID: client.roomID, Payload: encodeEvent(eventJoin, "", client.user), SkipID: client.id})
+	}
+}
+
+// left marks a user absent from this instance once their last local
+// connection to the room has closed, and tells the room they left unless
+// they are still connected elsewhere.
+func (h *Hub) left(client *Client) {
+	h.mu.RLock()
+	reconnected := h.inRoomLocked(client.roomID, client.user.ID)
+	h.mu.RUnlock()
+	if reconnected {
+		return
+	}
+
+	h.markAbsent(client.roomID, client.user.ID)
+	if _, still := h.remotePresence(client.roomID)[client.user.ID]; !still {
+		h.send(roomEvent{RoomID: client.roomID, Payload: encodeEvent(eventLeave, "", client.user)})
+	}
+}
+
+// listen relays the events published by every instance to the local
+// clients, resubscribing whenever the subscription ends. Events go through
+// Redis only while Redis has confirmed the subscription; before that they
+// would be published without this instance receiving them back.
+func (h *Hub) listen() {
+	for {
+		ready := func() { h.subscribed.Store(true) }
+		err := h.cache.Subscribe(context.Background(), chatEventsChannel, ready, func(payload []byte) {
+			var event roomEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				h.app.logger.Printf("chat relay: bad event: %v", err)
+				return
+			}
+			h.broadcast <- event
+		})
+		h.subscribed.Store(false)
+		h.app.logger.Printf("chat relay: subscription ended: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// relay publishes an event for every instance, including this one. It
+// returns false when the event could not go through Redis and must be
+// delivered locally instead.
+func (h *Hub) relay(event roomEvent) bool {
+	if h.cache == nil || !h.subscribed.Load() {
+		return false
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.cache.Publish(ctx, chatEventsChannel, payload); err != nil {
+		h.app.logger.Printf("chat relay: publish: %v", err)
+		return false
+	}
+	return true
+}
+
+// markPresent records a user in this instance's presence for a room.
+func (h *Hub) markPresent(roomID string, user chatUser) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	entry := presenceEntry{User: user, Seen: time.Now().Unix()}
+	err := h.cache.HashSet(ctx, presenceKey(roomID), map[string]interface{}{h.presenceField(user.ID): entry}, presenceTTL)
+	if err != nil {
+		h.app.logger.Printf("chat presence: %v", err)
+	}
+}
+
+// markAbsent removes a user from this instance's presence for a room.
+func (h *Hub) markAbsent(roomID, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.cache.HashDelete(ctx, presenceKey(roomID), h.presenceField(userID)); err != nil {
+		h.app.logger.Printf("chat presence: %v", err)
+	}
+}
+
+// refreshPresence re-stamps this instance's presence fields. The rooms are
+// copied under the lock and written after it is released.
+func (h *Hub) refreshPresence() {
+	if h.cache == nil {
+		return
+	}
+
+	h.mu.RLock()
+	rooms := make(map[string]map[string]chatUser, len(h.rooms))
+	for roomID := range h.rooms {
+		rooms[roomID] = h.localPresenceLocked(roomID)
+	}
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	now := time.Now().Unix()
+	for roomID, users := range rooms {
+		fields := make(map[string]interface{}, len(users))
+		for _, u := range users {
+			fields[h.presenceField(u.ID)] = presenceEntry{User: u, Seen: now}
+		}
+		if err := h.cache.HashSet(ctx, presenceKey(roomID), fields, presenceTTL); err != nil {
+			h.app.logger.Printf("chat presence: %v", err)
+			return
+		}
+	}
+}
+
+// remotePresence returns the users present in a room according to Redis,
+// keyed by ID. It covers every instance, this one included. Fields that
+// were not re-stamped in time belong to instances that went away and are
+// pruned.
+func (h *Hub) remotePresence(roomID string) map[string]chatUser {
+	users := make(map[string]chatUser)
+	if h.cache == nil {
+		return users
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	fields, err := h.cache.HashGetAll(ctx, presenceKey(roomID))
+	if err != nil {
+		h.app.logger.Printf("chat presence: %v", err)
+		return users
+	}
+
+	cutoff := time.Now().Add(-presenceTTL).Unix()
+	var stale []string
+	for field, raw := range fields {
+		var entry presenceEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil || entry.Seen < cutoff {
+			stale = append(stale, field)
+			continue
+		}
+		users[entry.User.ID] = entry.User
+	}
+	if err := h.cache.HashDelete(ctx, presenceKey(roomID), stale...); err != nil {
+		h.app.logger.Printf("chat presence: %v", err)
+	}
+	return users
+}
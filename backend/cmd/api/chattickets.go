@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/google/uuid"
+)
+
+// chatTicketTTL is how long a websocket ticket can wait to be redeemed.
+const chatTicketTTL = 30 * time.Second
+
+// checkChatOrigin lets browsers open chat websockets only from the
+// configured frontend origins. Requests without an Origin header come from
+// native clients, which another site cannot drive.
+func (app *application) checkChatOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || app.trustedOrigin(origin)
+}
+
+// authorizeChatRoom checks that the room's discussion exists and that the
+// user may join it: hidden threads are limited to their author and
+// moderators, circle rooms to the circle's members, and banned users are
+// kept out. It writes the error response
+// itself and returns false when the user may not join.
+func (app *application) authorizeChatRoom(w http.ResponseWriter, r *http.Request, user *data.User, roomID string) bool {
+	if _, err := uuid.Parse(roomID); err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+		return false
+	}
+
+	discussion, err := app.models.Community.GetDiscussion(roomID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return false
+		}
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if discussion.Hidden && discussion.UserID != user.ID && !isStaff(user) {
+		app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+		return false
+	}
+
+	// A circle's room is open only to the circle's members.
+	if discussion.ContextType == "circle" {
+		role, err := app.models.Circles.RoomRole(discussion.ID, user.ID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+		if role == "" && !isStaff(user) {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return false
+		}
+	}
+
+	// Banned users cannot join chat rooms; muted users can still read them.
+	sanction, err := app.models.Moderation.ActiveSanction(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if sanction != nil && sanction.Kind == "ban" {
+		app.errorResponse(w, http.StatusForbidden, sanctionMessage(sanction))
+		return false
+	}
+	return true
+}
+
+// createChatTicketHandler issues a one-time ticket for opening the chat
+// websocket of a discussion. It expires after 30 seconds, so unlike the
+// login token it is harmless if the URL ends up in a log.
+// POST /v1/ws/tickets
+func (app *application) createChatTicketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var input struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.RoomID == "" {
+		app.failedValidationResponse(w, r, map[string]string{"room_id": "must be provided"})
+		return
+	}
+	if !app.authorizeChatRoom(w, r, user, input.RoomID) {
+		return
+	}
+
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	ticket := hex.EncodeToString(tokenBytes)
+	hash := sha256.Sum256([]byte(ticket))
+
+	expiresAt, err := app.models.Community.CreateChatTicket(hash[:], user.ID, input.RoomID, chatTicketTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+		"url":        fmt.Sprintf("/v1/ws/chat/%s?ticket=%s", input.RoomID, ticket),
+	}, nil)
+}
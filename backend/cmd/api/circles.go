@@ -0,0 +1,615 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+// inviteCodeAttempts bounds the retries when a new invite code collides.
+const inviteCodeAttempts = 3
+
+// newInviteCode returns a random 8 character code for joining a circle.
+func newInviteCode() (string, error) {
+	codeBytes := make([]byte, 4)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(codeBytes)), nil
+}
+
+// withInviteCode runs save with fresh invite codes until one is not taken.
+func withInviteCode(save func(code string) error) error {
+	var err error
+	for range inviteCodeAttempts {
+		var code string
+		if code, err = newInviteCode(); err != nil {
+			return err
+		}
+		if err = save(code); !errors.Is(err, data.ErrDuplicateInviteCode) {
+			return err
+		}
+	}
+	return err
+}
+
+// circleStaff reports whether a circle role can manage students.
+func circleStaff(role string) bool {
+	return role == data.CircleTeacher || role == data.CircleAssistant
+}
+
+// loadCircle fetches the {id} circle for the current user. Only members and
+// site moderators can see a circle; everyone else gets a 404. The invite
+// code is only shown to the teacher and assistants. It writes the error
+// response itself and returns nil on failure.
+func (app *application) loadCircle(w http.ResponseWriter, r *http.Request) *data.Circle {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	circle, err := app.models.Circles.Get(r.PathValue("id"), userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Circle not found")
+			return nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	if circle.Role == "" && !isStaff(app.contextGetUser(r)) {
+		app.errorResponse(w, http.StatusNotFound, "Circle not found")
+		return nil
+	}
+	if !circleStaff(circle.Role) {
+		circle.InviteCode = ""
+	}
+	return circle
+}
+
+// validateCircleAssignment checks that the book or roadmap a teacher
+// assigns exists and, for a personal roadmap, that it is the teacher's own.
+func (app *application) validateCircleAssignment(v *validator.Validator, userID, bookID, roadmapID string) error {
+	v.Check(bookID == "" || roadmapID == "", "book_id", "a circle studies either a book or a roadmap, not both")
+
+	if bookID != "" {
+		if _, err := uuid.Parse(bookID); err != nil {
+			v.AddError("book_id", "must be a valid id")
+		} else if _, err := app.models.Books.Get(bookID); err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return err
+			}
+			v.AddError("book_id", "book not found")
+		}
+	}
+
+	if roadmapID != "" {
+		if _, err := uuid.Parse(roadmapID); err != nil {
+			v.AddError("roadmap_id", "must be a valid id")
+		} else if roadmap, err := app.models.Roadmaps.GetByID(roadmapID); err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return err
+			}
+			v.AddError("roadmap_id", "roadmap not found")
+		} else if roadmap.OwnerID != "" && roadmap.OwnerID != userID {
+			v.AddError("roadmap_id", "roadmap not found")
+		}
+	}
+	return nil
+}
+
+// createCircleHandler creates a study circle led by the current user, with
+// its own private discussion room and an invite code for students. Only
+// teachers approved by staff can open circles.
+// POST /v1/circles
+func (app *application) createCircleHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	teacher, err := app.models.Circles.IsTeacher(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !teacher {
+		app.errorResponse(w, http.StatusForbidden, "Only approved teachers can create circles")
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		BookID      string `json:"book_id"`
+		RoadmapID   string `json:"roadmap_id"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 100, "name", "must not be more than 100 characters")
+	v.Check(len(input.Description) <= 2000, "description", "must not be more than 2000 characters")
+	if err := app.validateCircleAssignment(v, userID, input.BookID, input.RoadmapID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	circle := &data.Circle{
+		Name:        input.Name,
+		Description: input.Description,
+		TeacherID:   userID,
+		BookID:      input.BookID,
+		RoadmapID:   input.RoadmapID,
+	}
+	err = withInviteCode(func(code string) error {
+		circle.InviteCode = code
+		return app.models.Circles.Insert(circle)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Reload for the teacher's name and the assignment's title.
+	circle, err = app.models.Circles.Get(circle.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"circle": circle}, nil)
+}
+
+// listCirclesHandler lists the circles the current user teaches or studies in.
+// GET /v1/circles
+func (app *application) listCirclesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	circles, err := app.models.Circles.GetForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, c := range circles {
+		if !circleStaff(c.Role) {
+			c.InviteCode = ""
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"circles": circles}, nil)
+}
+
+// showCircleHandler returns a circle to one of its members.
+// GET /v1/circles/{id}
+func (app *application) showCircleHandler(w http.ResponseWriter, r *http.Request) {
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"circle": circle}, nil)
+}
+
+// updateCircleHandler lets the teacher rename a circle or change what it
+// studies. Omitted fields are left as they are; an empty book_id or
+// roadmap_id clears the assignment.
+// PATCH /v1/circles/{id}
+func (app *application) updateCircleHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+	if circle.Role != data.CircleTeacher {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher can edit this circle")
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		BookID      *string `json:"book_id"`
+		RoadmapID   *string `json:"roadmap_id"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		circle.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		circle.Description = *input.Description
+	}
+	// Assigning one kind of material replaces the other.
+	if input.BookID != nil {
+		circle.BookID = *input.BookID
+		if input.RoadmapID == nil && circle.BookID != "" {
+			circle.RoadmapID = ""
+		}
+	}
+	if input.RoadmapID != nil {
+		circle.RoadmapID = *input.RoadmapID
+		if input.BookID == nil && circle.RoadmapID != "" {
+			circle.BookID = ""
+		}
+	}
+
+	v := validator.New()
+	v.Check(circle.Name != "", "name", "must be provided")
+	v.Check(len(circle.Name) <= 100, "name", "must not be more than 100 characters")
+	v.Check(len(circle.Description) <= 2000, "description", "must not be more than 2000 characters")
+	if err := app.validateCircleAssignment(v, userID, circle.BookID, circle.RoadmapID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Circles.Update(circle); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	circle, err := app.models.Circles.Get(circle.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"circle": circle}, nil)
+}
+
+// deleteCircleHandler deletes a circle along with its discussion room.
+// DELETE /v1/circles/{id}
+func (app *application) deleteCircleHandler(w http.ResponseWriter, r *http.Request) {
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+	if circle.Role != data.CircleTeacher {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher can delete this circle")
+		return
+	}
+
+	if err := app.models.Circles.Delete(circle.ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "circle deleted"}, nil)
+}
+
+// resetInviteCodeHandler gives a circle a new invite code. The old code
+// stops working; existing members stay.
+// POST /v1/circles/{id}/invite-code
+func (app *application) resetInviteCodeHandler(w http.ResponseWriter, r *http.Request) {
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+	if !circleStaff(circle.Role) {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher or an assistant can reset the invite code")
+		return
+	}
+
+	err := withInviteCode(func(code string) error {
+		circle.InviteCode = code
+		return app.models.Circles.SetInviteCode(circle.ID, code)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"invite_code": circle.InviteCode}, nil)
+}
+
+// joinCircleHandler adds the current user to a circle as a student.
+// POST /v1/circles/join
+func (app *application) joinCircleHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var input struct {
+		InviteCode string `json:"invite_code"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(input.InviteCode))
+	if code == "" {
+		app.failedValidationResponse(w, r, map[string]string{"invite_code": "must be provided"})
+		return
+	}
+
+	circle, err := app.models.Circles.GetByInviteCode(code, user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Invalid invite code")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	joined, err := app.models.Circles.AddMember(circle.ID, user.ID, data.CircleStudent)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if joined {
+		circle.Role = data.CircleStudent
+		circle.MemberCount++
+
+		payload, _ := json.Marshal(map[string]string{"circle_id": circle.ID, "user_id": user.ID})
+		app.models.Notifications.Insert(&data.Notification{
+			UserID:  circle.TeacherID,
+			Type:    "circle_join",
+			Title:   "New Student",
+			Message: fmt.Sprintf("%s joined %s", user.Name, circle.Name),
+			Data:    payload,
+		})
+	}
+	if !circleStaff(circle.Role) {
+		circle.InviteCode = ""
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"circle": circle, "joined": joined}, nil)
+}
+
+// circleRosterHandler shows the teacher and assistants every member's
+// progress through the assigned material, study streak and last activity.
+// GET /v1/circles/{id}/roster
+func (app *application) circleRosterHandler(w http.ResponseWriter, r *http.Request) {
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+	if !circleStaff(circle.Role) && !isStaff(app.contextGetUser(r)) {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher or an assistant can see the roster")
+		return
+	}
+
+	roster, err := app.models.Circles.GetRoster(circle.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"circle": circle, "members": roster}, nil)
+}
+
+// setCircleRoleHandler lets the teacher make a member an assistant or
+// return them to being a student.
+// PUT /v1/circles/{id}/members/{user_id}
+func (app *application) setCircleRoleHandler(w http.ResponseWriter, r *http.Request) {
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+	if circle.Role != data.CircleTeacher {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher can change roles")
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !validator.PermittedValue(input.Role, data.CircleAssistant, data.CircleStudent) {
+		app.failedValidationResponse(w, r, map[string]string{"role": "must be assistant or student"})
+		return
+	}
+
+	memberID := r.PathValue("user_id")
+	if memberID == circle.TeacherID {
+		app.errorResponse(w, http.StatusConflict, "The teacher's role cannot be changed")
+		return
+	}
+
+	err := app.models.Circles.SetMemberRole(circle.ID, memberID, input.Role)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Member not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.Role == data.CircleAssistant {
+		payload, _ := json.Marshal(map[string]string{"circle_id": circle.ID})
+		app.models.Notifications.Insert(&data.Notification{
+			UserID:  memberID,
+			Type:    "circle_role",
+			Title:   "You're an Assistant",
+			Message: fmt.Sprintf("You can now help run %s", circle.Name),
+			Data:    payload,
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"user_id": memberID, "role": input.Role}, nil)
+}
+
+// removeCircleMemberHandler takes a member out of a circle. Members can
+// leave on their own, assistants can remove students and the teacher can
+// remove anyone but themselves.
+// DELETE /v1/circles/{id}/members/{user_id}
+func (app *application) removeCircleMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	circle := app.loadCircle(w, r)
+	if circle == nil {
+		return
+	}
+
+	memberID := r.PathValue("user_id")
+	if memberID == circle.TeacherID {
+		app.errorResponse(w, http.StatusConflict, "The teacher cannot leave their own circle; delete it instead")
+		return
+	}
+
+	if memberID != userID {
+		switch circle.Role {
+		case data.CircleTeacher:
+		case data.CircleAssistant:
+			role, err := app.models.Circles.MemberRole(circle.ID, memberID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if role != data.CircleStudent {
+				app.errorResponse(w, http.StatusForbidden, "Assistants can only remove students")
+				return
+			}
+		default:
+			app.errorResponse(w, http.StatusForbidden, "Only the teacher or an assistant can remove members")
+			return
+		}
+	}
+
+	err := app.models.Circles.RemoveMember(circle.ID, memberID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Member not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "member removed"}, nil)
+}
+
+// requireCircleRoomAccess keeps the {id} discussion private when it is a
+// circle's room: only the circle's members and site moderators can read it
+// or post in it. Other threads pass straight through.
+func (app *application) requireCircleRoomAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, err := app.canAccessRoom(r, r.PathValue("id"))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// canAccessRoom reports whether the requesting user may read the discussion.
+// Ordinary threads are open to everyone.
+func (app *application) canAccessRoom(r *http.Request, discussionID string) (bool, error) {
+	userID, _ := r.Context().Value(UserContextKey).(string)
+
+	role, err := app.models.Circles.RoomRole(discussionID, userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	return role != "" || isStaff(app.contextGetUser(r)), nil
+}
+
+// listTeachersHandler lists the users approved as teachers.
+// GET /v1/admin/teachers
+func (app *application) listTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	teachers, err := app.models.Circles.GetTeachers()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"teachers": teachers}, nil)
+}
+
+// approveTeacherHandler approves a user as a teacher, so they can open
+// circles and grant ijazat.
+// PUT /v1/admin/teachers/{id}
+func (app *application) approveTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Note string `json:"note"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Note) <= 500, "note", "must not be more than 500 characters")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByID(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.models.Circles.ApproveTeacher(user.ID, adminID, input.Note); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]string{"user_id": user.ID})
+	app.models.Notifications.Insert(&data.Notification{
+		UserID:  user.ID,
+		Type:    "teacher_approved",
+		Title:   "Teacher Approved",
+		Message: "You can now create study circles and grant ijazat",
+		Data:    payload,
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"user_id": user.ID, "teacher": true}, nil)
+}
+
+// revokeTeacherHandler withdraws a teacher's approval.
+// DELETE /v1/admin/teachers/{id}
+func (app *application) revokeTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Circles.RevokeTeacher(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Teacher not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "teacher approval revoked"}, nil)
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
 )
 
+// reactionEmojis are the reactions replies accept.
+var reactionEmojis = []string{"👍", "❤️", "🤲", "💡", "😂", "😮", "🙏", "✅"}
+
 // contextGetUser retrieves the User from the request context.
 // It assumes the user has already been authenticated and the ID is in the context.
 func (app *application) contextGetUser(r *http.Request) *data.User {
@@ -36,6 +43,20 @@ func (app *application) listDiscussionsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// A circle's room is only listed to its members and moderators.
+	if contextType == "circle" {
+		userID, _ := r.Context().Value(UserContextKey).(string)
+		role, err := app.models.Circles.MemberRole(contextID, userID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if role == "" && !isStaff(app.contextGetUser(r)) {
+			app.errorResponse(w, http.StatusNotFound, "Circle not found")
+			return
+		}
+	}
+
 	discussions, err := app.models.Community.GetContextDiscussions(contextType, contextID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -57,6 +78,7 @@ func (app *application) createDiscussionHandler(w http.ResponseWriter, r *http.R
 	var input struct {
 		ContextType string `json:"context_type"`
 		ContextID   string `json:"context_id"`
+		Kind        string `json:"kind"`
 		Title       string `json:"title"`
 		Body        string `json:"body"`
 	}
@@ -66,16 +88,34 @@ func (app *application) createDiscussionHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if input.Kind == "" {
+		input.Kind = "discussion"
+	}
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Kind, "discussion", "question"), "kind", "must be discussion or question")
+	v.Check(strings.TrimSpace(input.Body) != "", "body", "must be provided")
+	v.Check(input.ContextType != "circle", "context_type", "circle rooms are created with their circle")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	user := app.contextGetUser(r)
 	if user == nil {
 		app.serverErrorResponse(w, r, nil)
 		return
 	}
 
+	held, ok := app.screenPost(w, r, user.ID, map[string]string{"title": input.Title, "body": input.Body})
+	if !ok {
+		return
+	}
+
 	d := &data.Discussion{
 		UserID:      user.ID,
 		ContextType: input.ContextType,
 		ContextID:   input.ContextID,
+		Kind:        input.Kind,
 		Title:       input.Title,
 		Body:        input.Body,
 	}
@@ -85,37 +125,84 @@ func (app *application) createDiscussionHandler(w http.ResponseWriter, r *http.R
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	if held != nil {
+		app.holdForReview(data.ContentDiscussion, d.ID, user.ID, held)
+		d.Hidden = true
+	}
 
 	app.writeJSON(w, http.StatusCreated, envelope{"discussion": d}, nil)
 }
 
 // -------------------------------------------------------------------------
-// 3. Get Replies (GET /v1/discussions/:id/replies)
+// 3. Get Discussion (GET /v1/discussions/:id)
 // -------------------------------------------------------------------------
-func (app *application) listRepliesHandler(w http.ResponseWriter, r *http.Request) {
-	discussionID := r.PathValue("id")
-	
-	replies, err := app.models.Community.GetReplies(discussionID)
+func (app *application) showDiscussionHandler(w http.ResponseWriter, r *http.Request) {
+	discussion, err := app.models.Community.GetDiscussion(r.PathValue("id"))
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return
+		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if replies == nil {
-		replies = []*data.Reply{}
+	// Hidden threads are only visible to their author and moderators.
+	if discussion.Hidden {
+		userID, _ := r.Context().Value(UserContextKey).(string)
+		if userID != discussion.UserID && !isStaff(app.contextGetUser(r)) {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"discussion": discussion}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 4. Get Replies (GET /v1/discussions/:id/replies?parent_id=&cursor=&limit=)
+// Returns one page of the direct replies to parent_id (top-level replies
+// when omitted). Each reply carries child_count; clients expand a branch by
+// requesting it as parent_id.
+// -------------------------------------------------------------------------
+func (app *application) listRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	discussionID := r.PathValue("id")
+	qs := r.URL.Query()
+
+	limit := 20
+	if raw := qs.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 100 {
+			app.errorResponse(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	userID, _ := r.Context().Value(UserContextKey).(string)
+
+	replies, next, err := app.models.Community.GetReplies(discussionID, qs.Get("parent_id"), userID, qs.Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidCursor) {
+			app.errorResponse(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"replies": replies}, nil)
+	app.writeJSON(w, http.StatusOK, envelope{"replies": replies, "next_cursor": next}, nil)
 }
 
 // -------------------------------------------------------------------------
-// 4. Create Reply (POST /v1/discussions/:id/replies)
+// 5. Create Reply (POST /v1/discussions/:id/replies)
 // -------------------------------------------------------------------------
 func (app *application) createReplyHandler(w http.ResponseWriter, r *http.Request) {
 	discussionID := r.PathValue("id")
 
 	var input struct {
-		Body string `json:"body"`
+		Body     string `json:"body"`
+		ParentID string `json:"parent_id"`
 	}
 
 	if err := app.readJSON(w, r, &input); err != nil {
@@ -123,23 +210,311 @@ func (app *application) createReplyHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if strings.TrimSpace(input.Body) == "" {
+		app.failedValidationResponse(w, r, map[string]string{"body": "must be provided"})
+		return
+	}
+
 	user := app.contextGetUser(r)
 	if user == nil {
 		app.serverErrorResponse(w, r, nil)
 		return
 	}
 
+	held, ok := app.screenPost(w, r, user.ID, map[string]string{"body": input.Body})
+	if !ok {
+		return
+	}
+
 	reply := &data.Reply{
 		DiscussionID: discussionID,
+		ParentID:     input.ParentID,
 		UserID:       user.ID,
+		UserName:     user.Name,
+		UserRole:     user.Role,
 		Body:         input.Body,
 	}
 
 	err := app.models.Community.CreateReply(reply)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Discussion or parent reply not found")
+		case errors.Is(err, data.ErrReplyDeleted):
+			app.errorResponse(w, http.StatusConflict, "You cannot reply to a deleted reply")
+		case errors.Is(err, data.ErrReplyTooDeep):
+			app.failedValidationResponse(w, r, map[string]string{"parent_id": "replies cannot be nested any deeper"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+	if held != nil {
+		app.holdForReview(data.ContentReply, reply.ID, user.ID, held)
+		reply.Hidden = true
+	}
+	if !reply.Hidden {
+		// Readers of the thread's chat room see it live.
+		app.hub.publish(reply.DiscussionID, eventMessage, reply)
+	}
 
 	app.writeJSON(w, http.StatusCreated, envelope{"reply": reply}, nil)
-}
\ No newline at end of file
+}
+
+// threadReply loads the {reply_id} reply of the {id} discussion. It writes
+// the error response itself and returns nil on failure.
+func (app *application) threadReply(w http.ResponseWriter, r *http.Request) *data.Reply {
+	reply, err := app.models.Community.GetReply(r.PathValue("id"), r.PathValue("reply_id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Reply not found")
+			return nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	return reply
+}
+
+// -------------------------------------------------------------------------
+// 6. Edit Reply (PATCH /v1/discussions/:id/replies/:reply_id)
+// Only the author can edit; the previous body is kept in the history.
+// -------------------------------------------------------------------------
+func (app *application) editReplyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if strings.TrimSpace(input.Body) == "" {
+		app.failedValidationResponse(w, r, map[string]string{"body": "must be provided"})
+		return
+	}
+
+	reply := app.threadReply(w, r)
+	if reply == nil {
+		return
+	}
+	if reply.UserID != userID {
+		app.errorResponse(w, http.StatusForbidden, "You can only edit your own replies")
+		return
+	}
+
+	held, ok := app.screenPost(w, r, userID, map[string]string{"body": input.Body})
+	if !ok {
+		return
+	}
+
+	err := app.models.Community.EditReply(reply.ID, userID, input.Body)
+	if err != nil {
+		if errors.Is(err, data.ErrReplyDeleted) {
+			app.errorResponse(w, http.StatusConflict, "This reply has been deleted")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if held != nil && !reply.Hidden {
+		app.holdForReview(data.ContentReply, reply.ID, userID, held)
+	}
+
+	if reply = app.threadReply(w, r); reply == nil {
+		return
+	}
+	if err := app.models.Community.GetReactions(reply, userID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"reply": reply}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 7. Delete Reply (DELETE /v1/discussions/:id/replies/:reply_id)
+// Authors and moderators can delete. The reply stays as a tombstone so its
+// own replies keep their place in the thread.
+// -------------------------------------------------------------------------
+func (app *application) deleteReplyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	reply := app.threadReply(w, r)
+	if reply == nil {
+		return
+	}
+	if reply.UserID != user.ID && !isStaff(user) {
+		app.errorResponse(w, http.StatusForbidden, "You can only delete your own replies")
+		return
+	}
+
+	err := app.models.Community.DeleteReply(reply.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Reply not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A moderator deleting someone else's reply is a moderation action.
+	if reply.UserID != user.ID {
+		err := app.models.Moderation.Record(&data.ModerationAction{
+			ModeratorID:  user.ID,
+			Action:       data.ActionDelete,
+			ContentType:  data.ContentReply,
+			ContentID:    reply.ID,
+			TargetUserID: reply.UserID,
+		}, "actioned")
+		if err != nil {
+			app.logger.Printf("recording deletion of reply %s: %v", reply.ID, err)
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "reply deleted"}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 8. Reply History (GET /v1/discussions/:id/replies/:reply_id/history)
+// -------------------------------------------------------------------------
+func (app *application) replyHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	reply := app.threadReply(w, r)
+	if reply == nil {
+		return
+	}
+	// The history of a removed reply would reveal what was removed.
+	if (reply.Hidden || reply.Deleted) && !isStaff(app.contextGetUser(r)) {
+		app.errorResponse(w, http.StatusNotFound, "Reply not found")
+		return
+	}
+
+	revisions, err := app.models.Community.GetReplyRevisions(reply.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"reply": reply, "revisions": revisions}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 9. Toggle Reaction (POST /v1/discussions/:id/replies/:reply_id/reactions)
+// -------------------------------------------------------------------------
+func (app *application) toggleReactionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !validator.PermittedValue(input.Emoji, reactionEmojis...) {
+		app.failedValidationResponse(w, r, map[string]string{"emoji": "must be one of " + strings.Join(reactionEmojis, " ")})
+		return
+	}
+
+	reply := app.threadReply(w, r)
+	if reply == nil {
+		return
+	}
+	if reply.Deleted {
+		app.errorResponse(w, http.StatusConflict, "This reply has been deleted")
+		return
+	}
+
+	reacted, err := app.models.Community.ToggleReaction(reply.ID, userID, input.Emoji)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.models.Community.GetReactions(reply, userID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"reacted": reacted, "reactions": reply.Reactions}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 10. Accepted Answer (PUT/DELETE /v1/discussions/:id/accepted-reply)
+// The asker (or a moderator) marks one reply of a question thread as the
+// accepted answer. DELETE unmarks it.
+// -------------------------------------------------------------------------
+func (app *application) setAcceptedReplyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	discussion, err := app.models.Community.GetDiscussion(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Discussion not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if discussion.UserID != user.ID && !isStaff(user) {
+		app.errorResponse(w, http.StatusForbidden, "Only the author of the question can accept an answer")
+		return
+	}
+	if discussion.Kind != "question" {
+		app.errorResponse(w, http.StatusConflict, "Only question threads have accepted answers")
+		return
+	}
+
+	replyID := ""
+	if r.Method == http.MethodPut {
+		var input struct {
+			ReplyID string `json:"reply_id"`
+		}
+		if err := app.readJSON(w, r, &input); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		reply, err := app.models.Community.GetReply(discussion.ID, input.ReplyID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.errorResponse(w, http.StatusNotFound, "Reply not found")
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if reply.Deleted {
+			app.errorResponse(w, http.StatusConflict, "This reply has been deleted")
+			return
+		}
+		replyID = reply.ID
+	}
+
+	if err := app.models.Community.SetAcceptedReply(discussion.ID, replyID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	discussion.AcceptedReplyID = replyID
+
+	app.writeJSON(w, http.StatusOK, envelope{"discussion": discussion}, nil)
+}
+
+// -------------------------------------------------------------------------
+// 11. Chat Presence (GET /v1/discussions/:id/presence)
+// Who is in the thread's chat room right now, across all API instances.
+// -------------------------------------------------------------------------
+func (app *application) chatPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	users := app.hub.Presence(r.PathValue("id"))
+
+	app.writeJSON(w, http.StatusOK, envelope{"users": users, "count": len(users)}, nil)
+}
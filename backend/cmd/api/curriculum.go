@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/draqist/iqraa/backend/internal/curriculum"
+	"github.com/draqist/iqraa/backend/internal/data"
+)
+
+// maxCurriculumBytes bounds uploaded curriculum documents.
+const maxCurriculumBytes = 1 << 20
+
+// exportRoadmapHandler downloads a curated roadmap as a curriculum document,
+// in YAML (default) or JSON.
+// GET /v1/roadmaps/{id}/export
+func (app *application) exportRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "yaml"
+	}
+	if format != "yaml" && format != "json" {
+		app.errorResponse(w, http.StatusBadRequest, "format must be yaml or json")
+		return
+	}
+
+	doc, err := app.models.Roadmaps.Export(r.PathValue("id"))
+	if err != nil {
+		var invalid curriculum.ValidationError
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+			return
+		case errors.As(err, &invalid):
+			app.failedValidationResponse(w, r, invalid)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := curriculum.Encode(&buf, doc, format); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := "application/yaml; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+doc.Slug+`.`+format+`"`)
+	w.Write(buf.Bytes())
+}
+
+// importRoadmapHandler creates or updates a curated roadmap from a YAML or
+// JSON curriculum document sent as the request body. ?dry_run=true reports
+// the changes without applying them; ?prune=true deletes nodes that are not
+// in the document.
+// POST /v1/roadmaps/import
+func (app *application) importRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCurriculumBytes))
+	if err != nil {
+		app.errorResponse(w, http.StatusRequestEntityTooLarge, "Document must not be larger than 1MB")
+		return
+	}
+
+	doc, err := curriculum.Parse(body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var invalid curriculum.ValidationError
+	if err := doc.Validate(); errors.As(err, &invalid) {
+		app.failedValidationResponse(w, r, invalid)
+		return
+	}
+
+	query := r.URL.Query()
+	result, err := app.models.Roadmaps.Import(doc, query.Get("dry_run") == "true", query.Get("prune") == "true")
+	if err != nil {
+		if errors.As(err, &invalid) {
+			app.failedValidationResponse(w, r, invalid)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.RoadmapCreated && !result.DryRun {
+		status = http.StatusCreated
+	}
+	app.writeJSON(w, status, envelope{"result": result}, nil)
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+// forkRoadmapHandler copies a public curated roadmap into a private roadmap
+// owned by the current user.
+// POST /v1/roadmaps/{id}/fork
+func (app *application) forkRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+	param := r.PathValue("id")
+
+	var source *data.Roadmap
+	var err error
+	if _, uuidErr := uuid.Parse(param); uuidErr == nil {
+		source, err = app.models.Roadmaps.GetByID(param)
+	} else {
+		source, err = app.models.Roadmaps.GetBySlug(param, "")
+	}
+	if err != nil || source.OwnerID != "" || !source.IsPublic {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	fork := &data.Roadmap{Slug: source.Slug + "-" + hex.EncodeToString(suffix)}
+	err = app.models.Roadmaps.Fork(source.ID, userID, fork)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roadmap, err := app.models.Roadmaps.GetBySlug(fork.Slug, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"roadmap": roadmap}, nil)
+}
+
+// ownedRoadmap loads the personal roadmap named by the {id} path value. It
+// writes a 404 and returns nil if the roadmap does not belong to the user.
+func (app *application) ownedRoadmap(w http.ResponseWriter, r *http.Request) *data.Roadmap {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	roadmap, err := app.models.Roadmaps.GetByID(r.PathValue("id"))
+	if err != nil || roadmap.OwnerID != userID {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return nil
+	}
+	return roadmap
+}
+
+// ownedRoadmapNode checks that the {node_id} path value is a node of the
+// user's personal roadmap {id}.
+func (app *application) ownedRoadmapNode(w http.ResponseWriter, r *http.Request) (*data.Roadmap, string) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return nil, ""
+	}
+
+	nodeID := r.PathValue("node_id")
+	roadmapID, err := app.models.Roadmaps.GetNodeRoadmapID(nodeID)
+	if err != nil || roadmapID != roadmap.ID {
+		app.errorResponse(w, http.StatusNotFound, "Node not found")
+		return nil, ""
+	}
+	return roadmap, nodeID
+}
+
+// listMyRoadmapsHandler lists the current user's personal roadmaps.
+// GET /v1/users/me/roadmaps
+func (app *application) listMyRoadmapsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	roadmaps, err := app.models.Roadmaps.GetOwned(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"roadmaps": roadmaps}, nil)
+}
+
+// showMyRoadmapHandler returns a personal roadmap with the user's progress.
+// GET /v1/users/me/roadmaps/{id}
+func (app *application) showMyRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	owned := app.ownedRoadmap(w, r)
+	if owned == nil {
+		return
+	}
+
+	roadmap, err := app.models.Roadmaps.GetBySlug(owned.Slug, owned.OwnerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"roadmap": roadmap}, nil)
+}
+
+// updateMyRoadmapHandler edits the title, description or cover of a
+// personal roadmap.
+// PUT /v1/users/me/roadmaps/{id}
+func (app *application) updateMyRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	var input struct {
+		Title         *string `json:"title"`
+		Description   *string `json:"description"`
+		CoverImageURL *string `json:"cover_image_url"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		roadmap.Title = *input.Title
+	}
+	if input.Description != nil {
+		roadmap.Description = *input.Description
+	}
+	if input.CoverImageURL != nil {
+		roadmap.CoverImageURL = *input.CoverImageURL
+	}
+
+	v := validator.New()
+	v.Check(roadmap.Title != "", "title", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Roadmaps.Update(roadmap); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"roadmap": roadmap}, nil)
+}
+
+// deleteMyRoadmapHandler deletes a personal roadmap.
+// DELETE /v1/users/me/roadmaps/{id}
+func (app *application) deleteMyRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	if err := app.models.Roadmaps.Delete(roadmap.ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "roadmap deleted"}, nil)
+}
+
+type myRoadmapNodeInput struct {
+	BookID        string `json:"book_id"`
+	SequenceIndex int    `json:"sequence_index"`
+	Level         string `json:"level"`
+	Description   string `json:"description"`
+}
+
+// validateNode checks the node input and that the book exists.
+func (app *application) validateNode(w http.ResponseWriter, r *http.Request, input myRoadmapNodeInput) bool {
+	v := validator.New()
+	v.Check(input.BookID != "", "book_id", "must be provided")
+	v.Check(input.Level != "", "level", "must be provided")
+	if v.Valid() {
+		_, err := app.models.Books.Get(input.BookID)
+		v.Check(err == nil, "book_id", "must be an existing book")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
+
+// addMyRoadmapNodeHandler adds a book to a personal roadmap.
+// POST /v1/users/me/roadmaps/{id}/nodes
+func (app *application) addMyRoadmapNodeHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	var input myRoadmapNodeInput
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.validateNode(w, r, input) {
+		return
+	}
+
+	node := &data.RoadmapNode{
+		RoadmapID:     roadmap.ID,
+		BookID:        input.BookID,
+		SequenceIndex: input.SequenceIndex,
+		Level:         input.Level,
+		Description:   input.Description,
+	}
+	if err := app.models.Roadmaps.InsertNode(node); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"node": node}, nil)
+}
+
+// updateMyRoadmapNodeHandler edits a node of a personal roadmap, for example
+// to swap its book.
+// PUT /v1/users/me/roadmaps/{id}/nodes/{node_id}
+func (app *application) updateMyRoadmapNodeHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap, nodeID := app.ownedRoadmapNode(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	var input myRoadmapNodeInput
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.validateNode(w, r, input) {
+		return
+	}
+
+	node := &data.RoadmapNode{
+		ID:            nodeID,
+		RoadmapID:     roadmap.ID,
+		BookID:        input.BookID,
+		SequenceIndex: input.SequenceIndex,
+		Level:         input.Level,
+		Description:   input.Description,
+	}
+	if err := app.models.Roadmaps.UpdateNode(node); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"node": node}, nil)
+}
+
+// deleteMyRoadmapNodeHandler removes a node from a personal roadmap.
+// DELETE /v1/users/me/roadmaps/{id}/nodes/{node_id}
+func (app *application) deleteMyRoadmapNodeHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap, nodeID := app.ownedRoadmapNode(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	if err := app.models.Roadmaps.DeleteNode(nodeID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "node deleted"}, nil)
+}
+
+// setMyRoadmapNodePrerequisitesHandler replaces the prerequisites of a node
+// of a personal roadmap.
+// PUT /v1/users/me/roadmaps/{id}/nodes/{node_id}/prerequisites
+func (app *application) setMyRoadmapNodePrerequisitesHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap, _ := app.ownedRoadmapNode(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	app.setRoadmapNodePrerequisitesHandler(w, r)
+}
+
+// shareMyRoadmapHandler creates (or rotates) a link that lets anyone view
+// the personal roadmap.
+// POST /v1/users/me/roadmaps/{id}/share
+func (app *application) shareMyRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	if err := app.models.Roadmaps.SetShareToken(roadmap.ID, token); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"share_token": token,
+		"url":         apiURL("/v1/shared/roadmaps/" + token),
+	}, nil)
+}
+
+// unshareMyRoadmapHandler revokes the share link of a personal roadmap.
+// DELETE /v1/users/me/roadmaps/{id}/share
+func (app *application) unshareMyRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	if err := app.models.Roadmaps.SetShareToken(roadmap.ID, ""); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "share link revoked"}, nil)
+}
+
+// showSharedRoadmapHandler returns a personal roadmap by its share link.
+// Signed-in viewers see their own progress.
+// GET /v1/shared/roadmaps/{token}
+func (app *application) showSharedRoadmapHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(UserContextKey).(string)
+
+	slug, err := app.models.Roadmaps.GetSlugByShareToken(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roadmap, err := app.models.Roadmaps.GetBySlug(slug, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The token only grants read access; don't hand it on.
+	roadmap.ShareToken = ""
+
+	app.writeJSON(w, http.StatusOK, envelope{"roadmap": roadmap}, nil)
+}
+
+// upstreamDiffHandler lists changes made to the original roadmap since the
+// personal roadmap was forked or last merged.
+// GET /v1/users/me/roadmaps/{id}/upstream
+func (app *application) upstreamDiffHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	changes, err := app.models.Roadmaps.UpstreamDiff(roadmap.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrNoUpstream) {
+			app.errorResponse(w, http.StatusConflict, "The original roadmap no longer exists")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"forked_from_id": roadmap.ForkedFromID, "changes": changes}, nil)
+}
+
+// mergeUpstreamHandler applies upstream changes to a personal roadmap.
+// Without upstream_node_ids every pending change is merged.
+// POST /v1/users/me/roadmaps/{id}/upstream/merge
+func (app *application) mergeUpstreamHandler(w http.ResponseWriter, r *http.Request) {
+	roadmap := app.ownedRoadmap(w, r)
+	if roadmap == nil {
+		return
+	}
+
+	var input struct {
+		UpstreamNodeIDs []string `json:"upstream_node_ids"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	merged, err := app.models.Roadmaps.MergeUpstream(roadmap.ID, input.UpstreamNodeIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoUpstream):
+			app.errorResponse(w, http.StatusConflict, "The original roadmap no longer exists")
+		case errors.Is(err, data.ErrPrerequisiteCycle):
+			app.errorResponse(w, http.StatusConflict, "Merging would create a prerequisite cycle with your changes")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	updated, err := app.models.Roadmaps.GetBySlug(roadmap.Slug, roadmap.OwnerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"merged": merged, "roadmap": updated}, nil)
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/certificate"
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/google/uuid"
+)
+
+// maxRecordedSanad bounds how many teachers a user can record above their own.
+const maxRecordedSanad = 60
+
+// ijazahInput is the description of an ijazah shared by granting one and
+// recording one's own sanad.
+type ijazahInput struct {
+	BookID     string `json:"book_id"`
+	TextTitle  string `json:"text_title"`
+	Type       string `json:"type"`
+	Completion string `json:"completion"`
+	GrantedOn  string `json:"granted_on"`
+	Notes      string `json:"notes"`
+}
+
+// validateIjazah checks the input and fills in the text title from the book.
+// It returns the parsed grant date.
+func (app *application) validateIjazah(v *validator.Validator, input *ijazahInput) (time.Time, error) {
+	input.TextTitle = strings.TrimSpace(input.TextTitle)
+
+	if input.BookID != "" {
+		if _, err := uuid.Parse(input.BookID); err != nil {
+			v.AddError("book_id", "must be a valid id")
+		} else if book, err := app.models.Books.Get(input.BookID); err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return time.Time{}, err
+			}
+			v.AddError("book_id", "book not found")
+		} else if input.TextTitle == "" {
+			input.TextTitle = book.Title
+		}
+	}
+	v.Check(input.TextTitle != "", "text_title", "must be provided when there is no book_id")
+	v.Check(len(input.TextTitle) <= 200, "text_title", "must not be more than 200 characters")
+	v.Check(validator.PermittedValue(input.Type, data.IjazahTypes...), "type", "must be one of "+strings.Join(data.IjazahTypes, ", "))
+	v.Check(validator.PermittedValue(input.Completion, data.IjazahCompletions...), "completion", "must be one of "+strings.Join(data.IjazahCompletions, ", "))
+	v.Check(len(input.Notes) <= 2000, "notes", "must not be more than 2000 characters")
+
+	grantedOn, err := time.Parse(time.DateOnly, input.GrantedOn)
+	if err != nil {
+		v.AddError("granted_on", "must be a date like 2006-01-02")
+	} else {
+		v.Check(!grantedOn.After(time.Now().UTC()), "granted_on", "must not be in the future")
+	}
+	return grantedOn, nil
+}
+
+// sameText reports whether an ijazah covers the text being granted: the same
+// book when either names one, otherwise the same title.
+func sameText(parent *data.Ijazah, input *ijazahInput) bool {
+	if parent.BookID != "" || input.BookID != "" {
+		return parent.BookID == input.BookID
+	}
+	return strings.EqualFold(strings.TrimSpace(parent.TextTitle), input.TextTitle)
+}
+
+// displayName is how a user is named on ijazat.
+func displayName(user *data.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Username
+}
+
+// grantIjazahHandler lets a teacher approved by staff attest that a student
+// in one of their circles completed a text. The ijazah links to the teacher's own ijazah
+// for the text (sanad_id), and is signed together with the sanad as it
+// stands, so its public page can be verified.
+// POST /v1/ijazat
+func (app *application) grantIjazahHandler(w http.ResponseWriter, r *http.Request) {
+	teacher := app.contextGetUser(r)
+	if teacher == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var input struct {
+		ijazahInput
+		StudentID string `json:"student_id"`
+		SanadID   string `json:"sanad_id"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.StudentID != "", "student_id", "must be provided")
+	v.Check(input.StudentID != teacher.ID, "student_id", "you cannot grant yourself an ijazah")
+	grantedOn, err := app.validateIjazah(v, &input.ijazahInput)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	approved, err := app.models.Circles.IsTeacher(teacher.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !approved {
+		app.errorResponse(w, http.StatusForbidden, "Only approved teachers can grant ijazat")
+		return
+	}
+
+	teaches, err := app.models.Circles.TeachesStudent(teacher.ID, input.StudentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !teaches {
+		app.errorResponse(w, http.StatusForbidden, "You can only grant ijazat to students in your circles")
+		return
+	}
+
+	student, err := app.models.Users.GetByID(input.StudentID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The sanad is the teacher's own ijazah and everything above it.
+	sanad := []certificate.Teacher{}
+	if input.SanadID != "" {
+		parent, err := app.models.Ijazat.Get(input.SanadID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if parent == nil || parent.StudentID != teacher.ID || parent.RevokedAt != nil {
+			app.failedValidationResponse(w, r, map[string]string{"sanad_id": "must be one of your own ijazat"})
+			return
+		}
+		if !sameText(parent, &input.ijazahInput) {
+			app.failedValidationResponse(w, r, map[string]string{"sanad_id": "must be your ijazah for the same text"})
+			return
+		}
+
+		chain, err := app.models.Ijazat.GetChain(parent.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, link := range chain {
+			sanad = append(sanad, certificate.Teacher{
+				Name:      link.TeacherName,
+				GrantedOn: link.GrantedOn.Format(time.DateOnly),
+				Verified:  link.Verified && !link.Revoked,
+			})
+		}
+	}
+
+	codeBytes := make([]byte, 8)
+	if _, err := rand.Read(codeBytes); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	payload := &certificate.Ijazah{
+		Code:        strings.ToUpper(hex.EncodeToString(codeBytes)),
+		StudentID:   student.ID,
+		StudentName: displayName(student),
+		TeacherID:   teacher.ID,
+		TeacherName: displayName(teacher),
+		BookID:      input.BookID,
+		TextTitle:   input.TextTitle,
+		Type:        input.Type,
+		Completion:  input.Completion,
+		GrantedOn:   grantedOn.Format(time.DateOnly),
+		IssuedAt:    time.Now().UTC().Truncate(time.Second),
+		Sanad:       sanad,
+	}
+	signed, signature, err := app.certificates.SignIjazah(payload)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ijazah := &data.Ijazah{
+		Code:        payload.Code,
+		StudentID:   student.ID,
+		StudentName: payload.StudentName,
+		TeacherID:   teacher.ID,
+		TeacherName: payload.TeacherName,
+		ParentID:    input.SanadID,
+		BookID:      input.BookID,
+		TextTitle:   input.TextTitle,
+		Type:        input.Type,
+		Completion:  input.Completion,
+		GrantedOn:   grantedOn,
+		Notes:       input.Notes,
+		Payload:     string(signed),
+		Signature:   signature,
+		KeyID:       app.certificates.KeyID(),
+	}
+	if err := app.models.Ijazat.Insert(ijazah); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	notification, _ := json.Marshal(map[string]string{"ijazah_id": ijazah.ID, "code": ijazah.Code})
+	app.models.Notifications.Insert(&data.Notification{
+		UserID:  student.ID,
+		Type:    "ijazah_granted",
+		Title:   "Ijazah Granted",
+		Message: fmt.Sprintf("%s granted you an ijazah in %s", payload.TeacherName, ijazah.TextTitle),
+		Data:    notification,
+	})
+
+	app.writeJSON(w, http.StatusCreated, envelope{"ijazah": ijazah, "verify_url": ijazahURL(ijazah.Code)}, nil)
+}
+
+// recordSanadHandler records an ijazah the user received from a teacher who
+// is not on the platform, optionally with that teacher's own chain. Such
+// links are shown as unverified. Teachers record their sanad this way
+// before linking the ijazat they grant to it.
+// POST /v1/users/me/sanad
+func (app *application) recordSanadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var input struct {
+		ijazahInput
+		TeacherName string   `json:"teacher_name"`
+		Chain       []string `json:"chain"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.TeacherName = strings.TrimSpace(input.TeacherName)
+
+	v := validator.New()
+	v.Check(input.TeacherName != "", "teacher_name", "must be provided")
+	v.Check(len(input.Chain) <= maxRecordedSanad, "chain", fmt.Sprintf("must not have more than %d teachers", maxRecordedSanad))
+	for k, name := range input.Chain {
+		input.Chain[k] = strings.TrimSpace(name)
+		if input.Chain[k] == "" {
+			v.AddError("chain", "must not contain empty names")
+		}
+	}
+	grantedOn, err := app.validateIjazah(v, &input.ijazahInput)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ijazah := &data.Ijazah{
+		StudentID:   user.ID,
+		StudentName: displayName(user),
+		TeacherName: input.TeacherName,
+		BookID:      input.BookID,
+		TextTitle:   input.TextTitle,
+		Type:        input.Type,
+		Completion:  input.Completion,
+		GrantedOn:   grantedOn,
+		Notes:       input.Notes,
+		RecordedBy:  user.ID,
+	}
+	if err := app.models.Ijazat.InsertSanad(ijazah, input.Chain); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	chain, err := app.models.Ijazat.GetChain(ijazah.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"ijazah": ijazah, "chain": chain}, nil)
+}
+
+// deleteSanadHandler deletes a sanad link the user recorded, together with
+// the chain recorded above it. Links that granted ijazat build on stay.
+// DELETE /v1/users/me/sanad/{id}
+func (app *application) deleteSanadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	err := app.models.Ijazat.DeleteSanad(r.PathValue("id"), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Sanad not found")
+		case errors.Is(err, data.ErrSanadInUse):
+			app.errorResponse(w, http.StatusConflict, "Ijazat you granted build on this sanad, so it cannot be deleted")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "sanad deleted"}, nil)
+}
+
+// listMyIjazatHandler lists the ijazat the user holds, including recorded
+// sanad links, and those they have granted.
+// GET /v1/users/me/ijazat
+func (app *application) listMyIjazatHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	received, err := app.models.Ijazat.GetForStudent(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	granted, err := app.models.Ijazat.GetGrantedBy(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"received": received, "granted": granted}, nil)
+}
+
+// ijazahChainHandler shows the full chain of one of the user's ijazat, from
+// their teacher back to the earliest recorded teacher.
+// GET /v1/users/me/ijazat/{id}/chain
+func (app *application) ijazahChainHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	ijazah, err := app.models.Ijazat.Get(r.PathValue("id"))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if ijazah == nil || (ijazah.StudentID != userID && ijazah.TeacherID != userID) {
+		app.errorResponse(w, http.StatusNotFound, "Ijazah not found")
+		return
+	}
+
+	chain, err := app.models.Ijazat.GetChain(ijazah.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"ijazah": ijazah, "chain": chain}, nil)
+}
+
+// loadIjazah loads an ijazah by the {code} path value and checks its
+// signature. The payload is nil when the signature does not hold. It writes
+// the error response itself and returns a nil ijazah on failure.
+func (app *application) loadIjazah(w http.ResponseWriter, r *http.Request) (*data.Ijazah, *certificate.Ijazah) {
+	ijazah, err := app.models.Ijazat.GetByCode(strings.ToUpper(r.PathValue("code")))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Ijazah not found")
+			return nil, nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, nil
+	}
+
+	payload, err := app.certificates.VerifyIjazah([]byte(ijazah.Payload), ijazah.Signature, ijazah.KeyID)
+	if err != nil || payload.Code != ijazah.Code {
+		app.logger.Printf("ijazah %s failed verification: %v", ijazah.Code, err)
+		return ijazah, nil
+	}
+	return ijazah, payload
+}
+
+// verifyIjazahHandler publicly verifies an ijazah: who granted it to whom,
+// for which text, and the signed sanad. Revoked ijazat still verify but
+// report valid: false.
+// GET /v1/ijazat/{code}
+func (app *application) verifyIjazahHandler(w http.ResponseWriter, r *http.Request) {
+	ijazah, payload := app.loadIjazah(w, r)
+	if ijazah == nil {
+		return
+	}
+	if payload == nil {
+		app.writeJSON(w, http.StatusOK, envelope{"valid": false, "code": ijazah.Code}, nil)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"valid":      ijazah.RevokedAt == nil,
+		"revoked_at": ijazah.RevokedAt,
+		"ijazah":     payload,
+		"payload":    ijazah.Payload,
+		"signature":  ijazah.Signature,
+		"algorithm":  "Ed25519",
+		"key_id":     ijazah.KeyID,
+		"public_key": app.certificates.PublicKey(ijazah.KeyID),
+	}, nil)
+}
+
+// downloadIjazahHandler renders an ijazah and its sanad as a printable
+// HTML page.
+// GET /v1/ijazat/{code}/download
+func (app *application) downloadIjazahHandler(w http.ResponseWriter, r *http.Request) {
+	ijazah, payload := app.loadIjazah(w, r)
+	if ijazah == nil {
+		return
+	}
+	if payload == nil {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Ijazah could not be verified")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := certificate.RenderIjazah(&buf, payload, ijazahURL(ijazah.Code), ijazah.RevokedAt != nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="ijazah-`+ijazah.Code+`.html"`)
+	w.Write(buf.Bytes())
+}
+
+// revokeIjazahHandler lets the granting teacher (or a moderator) revoke an
+// ijazah.
+// DELETE /v1/ijazat/{code}
+func (app *application) revokeIjazahHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ijazah, err := app.models.Ijazat.GetByCode(strings.ToUpper(r.PathValue("code")))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Ijazah not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if ijazah.TeacherID != user.ID && !isStaff(user) {
+		app.errorResponse(w, http.StatusForbidden, "Only the teacher who granted this ijazah can revoke it")
+		return
+	}
+
+	if err := app.models.Ijazat.Revoke(ijazah.ID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusConflict, "This ijazah is already revoked")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "ijazah revoked"}, nil)
+}
+
+func ijazahURL(code string) string {
+	return apiURL("/v1/ijazat/" + code)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/linkcheck"
+)
+
+const (
+	// How often the checker wakes up to look for due resources.
+	linkCheckTick = 30 * time.Minute
+
+	// Minimum time between two probes of the same resource.
+	linkCheckInterval = 24 * time.Hour
+
+	// Resources probed per tick, to stay polite with YouTube and small hosts.
+	linkCheckBatch = 50
+
+	// Consecutive failures before a resource is marked broken.
+	linkFailureThreshold = 3
+)
+
+// linkChecker periodically probes external resource URLs and flags dead ones.
+type linkChecker struct {
+	app     *application
+	checker *linkcheck.Checker
+}
+
+func newLinkChecker(app *application, client linkcheck.HTTPClient) *linkChecker {
+	return &linkChecker{
+		app:     app,
+		checker: linkcheck.New(client),
+	}
+}
+
+func (lc *linkChecker) run() {
+	ticker := time.NewTicker(linkCheckTick)
+	defer ticker.Stop()
+
+	// Don't leave links unchecked for a full tick after every deploy.
+	lc.checkDue()
+
+	for range ticker.C {
+		lc.checkDue()
+	}
+}
+
+// checkDue probes one batch of resources that are due for a check.
+func (lc *linkChecker) checkDue() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			lc.app.logger.Printf("link checker: panic: %v", rec)
+		}
+	}()
+
+	// Our own uploads are served from R2 and don't need probing.
+	skipPrefix := ""
+	if lc.app.storage != nil {
+		skipPrefix = lc.app.storage.PublicDomain
+	}
+
+	resources, err := lc.app.models.LinkChecks.GetDue(linkCheckInterval, skipPrefix, linkCheckBatch)
+	if err != nil {
+		lc.app.logger.Printf("link checker: %v", err)
+		return
+	}
+
+	for _, res := range resources {
+		lc.check(res)
+	}
+}
+
+// check probes a single resource, records the result and notifies the
+// creating admin when the resource has just been marked broken.
+func (lc *linkChecker) check(res *data.Resource) *data.LinkCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result := lc.checker.Check(ctx, res.URL)
+
+	check := &data.LinkCheck{
+		ResourceID: res.ID,
+		OK:         result.OK,
+		LatencyMs:  int(result.Latency.Milliseconds()),
+	}
+	if result.StatusCode != 0 {
+		check.StatusCode = &result.StatusCode
+	}
+	if result.Error != "" {
+		check.Error = &result.Error
+	}
+
+	becameBroken, err := lc.app.models.LinkChecks.Record(res, check, linkFailureThreshold)
+	if err != nil {
+		lc.app.logger.Printf("link checker: record %s: %v", res.ID, err)
+		return check
+	}
+
+	if becameBroken && res.CreatedBy != nil {
+		payload, _ := json.Marshal(map[string]string{"resource_id": res.ID, "book_id": res.BookID})
+		lc.app.models.Notifications.Insert(&data.Notification{
+			UserID:  *res.CreatedBy,
+			Type:    "resource_broken",
+			Title:   "Broken resource link",
+			Message: fmt.Sprintf("\"%s\" has failed %d checks in a row and was marked as broken.", res.Title, linkFailureThreshold),
+			Data:    payload,
+		})
+	}
+
+	return check
+}
+
+// listBrokenLinksHandler returns the broken-links report for the admin dashboard.
+// GET /v1/admin/broken-links
+func (app *application) listBrokenLinksHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.models.LinkChecks.GetBrokenReport()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"broken_links": report}, nil)
+}
+
+// listLinkChecksHandler returns the probe history of a single resource.
+// GET /v1/resources/{id}/link-checks
+func (app *application) listLinkChecksHandler(w http.ResponseWriter, r *http.Request) {
+	checks, err := app.models.LinkChecks.GetHistory(r.PathValue("id"), 50)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"link_checks": checks}, nil)
+}
+
+// checkResourceLinkHandler probes a resource immediately, e.g. after an admin fixed its URL.
+// POST /v1/resources/{id}/link-checks
+func (app *application) checkResourceLinkHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	check := app.linkChecker.check(res)
+
+	app.writeJSON(w, http.StatusOK, envelope{"link_check": check}, nil)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,10 +18,13 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draqist/iqraa/backend/internal/archive"
 	"github.com/draqist/iqraa/backend/internal/cache"
+	"github.com/draqist/iqraa/backend/internal/certificate"
 	"github.com/draqist/iqraa/backend/internal/data"
 	"github.com/draqist/iqraa/backend/internal/mailer"
 	"github.com/draqist/iqraa/backend/internal/storage"
+	"github.com/draqist/iqraa/backend/internal/youtube"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
@@ -44,17 +48,27 @@ type config struct {
 		password string
 		sender   string
 	}
+	cors struct {
+		trustedOrigins []string
+	}
 }
 
 // Application holds the dependencies for our HTTP handlers, helpers, and middleware.
 type application struct {
-	config  config
-	logger  *log.Logger
-	db      *sql.DB
-	models  data.Models
-	mailer  mailer.Mailer
-	hub     *Hub
-	storage *storage.R2Service
+	config         config
+	logger         *log.Logger
+	db             *sql.DB
+	models         data.Models
+	mailer         mailer.Mailer
+	hub            *Hub
+	storage        *storage.R2Service
+	youtube        youtube.Client
+	archive        *archive.Client
+	certificates   *certificate.Signer
+	processor      *mediaProcessor
+	linkChecker    *linkChecker
+	playlistSyncer *playlistSyncer
+	partnerNudger  *partnerNudger
 }
 
 // main is the entry point of the application.
@@ -118,6 +132,16 @@ func main() {
 	cfg.smtp.password = os.Getenv("SMTP_PASSWORD")
 	cfg.smtp.sender = os.Getenv("SMTP_SENDER")
 
+	// Browsers may call the API and open chat websockets from these origins:
+	// the frontend, any extra FRONTEND_ORIGINS (comma-separated) and the
+	// local development servers.
+	cfg.cors.trustedOrigins = []string{"http://localhost:3000", "http://localhost:8081"}
+	for _, origin := range append([]string{os.Getenv("FRONTEND_URL")}, strings.Split(os.Getenv("FRONTEND_ORIGINS"), ",")...) {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			cfg.cors.trustedOrigins = append(cfg.cors.trustedOrigins, origin)
+		}
+	}
+
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
 	// Fix 3: Redis failure is a warning, not a fatal crash.
@@ -143,12 +167,47 @@ func main() {
 		models: models,
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 		storage: r2Service,
+		youtube: youtube.NewClient(os.Getenv("YOUTUBE_API_KEY"), cacheSvc),
+		archive: archive.New(nil),
+	}
+
+	// Certificates and ijazat are signed with a key derived from a dedicated
+	// secret, given directly or as a file. Secrets rotated out are listed in
+	// CERTIFICATE_PREVIOUS_SECRETS so documents signed with them still verify.
+	certificateSecret := os.Getenv("CERTIFICATE_SECRET")
+	if file := os.Getenv("CERTIFICATE_SECRET_FILE"); file != "" {
+		secret, err := os.ReadFile(file)
+		if err != nil {
+			logger.Fatalf("reading CERTIFICATE_SECRET_FILE: %v", err)
+		}
+		certificateSecret = strings.TrimSpace(string(secret))
+	}
+	if certificateSecret != "" {
+		app.certificates = certificate.NewSigner(certificateSecret, strings.Split(os.Getenv("CERTIFICATE_PREVIOUS_SECRETS"), ",")...)
+	} else {
+		logger.Printf("WARNING: CERTIFICATE_SECRET not set, certificates and ijazat disabled")
 	}
 
 	// Initialize and run WebSocket Hub
 	app.hub = newHub(app)
 	go app.hub.run()
 
+	// Start the background media processor for uploaded PDFs and audio
+	app.processor = newMediaProcessor(app)
+	go app.processor.run()
+
+	// Start the periodic link health checker for external resources
+	app.linkChecker = newLinkChecker(app, nil)
+	go app.linkChecker.run()
+
+	// Keep linked playlists in sync with YouTube
+	app.playlistSyncer = newPlaylistSyncer(app)
+	go app.playlistSyncer.run()
+
+	// Nudge accountability partners who missed yesterday's goal
+	app.partnerNudger = newPartnerNudger(app)
+	go app.partnerNudger.run()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
 		Handler:      app.routes(),
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/storage"
+)
+
+// How long a signed media URL stays valid. Long enough to listen through a
+// lecture after a pause, short enough that shared links die quickly.
+const signedMediaTTL = 15 * time.Minute
+
+// authorizeMedia loads the resource behind a media request and checks that
+// user, nil when signed out, may read it. Drafts and pending content are
+// visible to staff and their creator only, and answer 404 to everyone else
+// so their existence isn't leaked. On failure the response has been written.
+func (app *application) authorizeMedia(w http.ResponseWriter, r *http.Request, user *data.User) (*data.Resource, bool) {
+	res, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return nil, false
+	}
+
+	if !app.canAccessResource(user, res) {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return nil, false
+	}
+
+	return res, true
+}
+
+// canAccessResource reports whether user may read the resource's content.
+// Published resources of public books are open to everyone; members-only
+// books (is_public = false) need a signed-in user.
+func (app *application) canAccessResource(user *data.User, res *data.Resource) bool {
+	if user != nil {
+		if isStaff(user) {
+			return true
+		}
+		if res.CreatedBy != nil && *res.CreatedBy == user.ID {
+			return true
+		}
+	}
+	if res.Status != "published" {
+		return false
+	}
+
+	book, err := app.models.Books.Get(res.BookID)
+	if err != nil || book.Status != "published" {
+		return false
+	}
+	return book.IsPublic || user != nil
+}
+
+// storageKey returns the object key of a URL in our bucket.
+func (app *application) storageKey(url string) (string, bool) {
+	if app.storage == nil {
+		return "", false
+	}
+	return app.storage.KeyFromURL(url)
+}
+
+// hideStorageURLs replaces the bucket URLs of hosted files with their API
+// routes, which check access before serving the bytes. The bucket itself is
+// private, so its URLs must never reach clients.
+func (app *application) hideStorageURLs(resources ...*data.Resource) {
+	for _, res := range resources {
+		if res == nil {
+			continue
+		}
+		if _, ok := app.storageKey(res.URL); ok {
+			res.URL = mediaURL(res.ID)
+		}
+		if res.ThumbnailURL != nil {
+			if _, ok := app.storageKey(*res.ThumbnailURL); ok {
+				thumbnail := apiURL("/v1/resources/" + res.ID + "/thumbnail")
+				res.ThumbnailURL = &thumbnail
+			}
+		}
+	}
+}
+
+// hideStorageURLsInTree applies hideStorageURLs to a resource tree.
+func (app *application) hideStorageURLsInTree(nodes []*data.ResourceNode) {
+	for _, n := range nodes {
+		app.hideStorageURLs(n.Resource)
+		app.hideStorageURLs(n.Segments...)
+		app.hideStorageURLsInTree(n.Children)
+	}
+}
+
+// mediaURL is the API route that streams a hosted resource.
+func mediaURL(resourceID string) string {
+	return apiURL("/v1/resources/" + resourceID + "/media")
+}
+
+// streamMediaHandler serves the bytes of an uploaded resource after an access
+// check, passing Range requests through to storage so players can seek.
+// GET /v1/resources/{id}/media
+func (app *application) streamMediaHandler(w http.ResponseWriter, r *http.Request) {
+	res, ok := app.authorizeMedia(w, r, app.contextGetUser(r))
+	if !ok {
+		return
+	}
+	key, ok := app.storageKey(res.URL)
+	if !ok {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Resource is not hosted media")
+		return
+	}
+
+	if r.URL.Query().Get("mode") == "redirect" {
+		app.redirectToSignedMedia(w, r, key)
+		return
+	}
+	app.serveObject(w, r, key)
+}
+
+// thumbnailHandler serves the thumbnail the media processor extracted, with
+// the same access check as the media itself.
+// GET /v1/resources/{id}/thumbnail
+func (app *application) thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	res, ok := app.authorizeMedia(w, r, app.contextGetUser(r))
+	if !ok {
+		return
+	}
+	if res.ThumbnailURL == nil {
+		app.errorResponse(w, http.StatusNotFound, "Thumbnail not found")
+		return
+	}
+	key, ok := app.storageKey(*res.ThumbnailURL)
+	if !ok {
+		app.errorResponse(w, http.StatusNotFound, "Thumbnail not found")
+		return
+	}
+
+	app.serveObject(w, r, key)
+}
+
+// podcastEpisodeHandler streams an episode of a private feed. Podcast apps
+// cannot sign in, so the feed token stands in for the user.
+// GET /v1/podcast/{token}/episodes/{id}
+func (app *application) podcastEpisodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.podcastTokenUser(w, r)
+	if !ok {
+		return
+	}
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+
+	res, ok := app.authorizeMedia(w, r, user)
+	if !ok {
+		return
+	}
+	key, ok := app.storageKey(res.URL)
+	if !ok {
+		app.errorResponse(w, http.StatusNotFound, "Episode not found")
+		return
+	}
+
+	app.serveObject(w, r, key)
+}
+
+// serveObject copies an object from storage to the client.
+func (app *application) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	// Storage only supports a single range; per RFC 9110 we may ignore the rest.
+	// If-Range would need the current ETag first, so we take the always-safe
+	// route of sending the full body.
+	byteRange := r.Header.Get("Range")
+	if !strings.HasPrefix(byteRange, "bytes=") || strings.Contains(byteRange, ",") || r.Header.Get("If-Range") != "" {
+		byteRange = ""
+	}
+
+	obj, err := app.storage.GetObject(r.Context(), key, byteRange)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidRange):
+			w.Header().Set("Content-Range", "bytes */*")
+			app.errorResponse(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+		case errors.Is(err, storage.ErrNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Media file not found")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer obj.Body.Close()
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Cache-Control", "private, max-age=3600")
+	h.Set("Content-Length", strconv.FormatInt(obj.ContentLength, 10))
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	}
+	if obj.ETag != "" {
+		h.Set("ETag", obj.ETag)
+	}
+	if !obj.LastModified.IsZero() {
+		h.Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	status := http.StatusOK
+	if obj.ContentRange != "" {
+		h.Set("Content-Range", obj.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	// A large file outlasts the server's WriteTimeout, so the deadline is
+	// pushed back whenever a chunk goes out: only a stalled client times out.
+	rc := http.NewResponseController(w)
+	if _, err := io.Copy(stallWriter{w, rc}, obj.Body); err != nil {
+		// Clients abort mid-stream whenever the listener seeks; not worth logging.
+		return
+	}
+}
+
+// mediaStallTimeout is how long a media download may go without progress.
+const mediaStallTimeout = 30 * time.Second
+
+// stallWriter extends the connection's write deadline before every write.
+type stallWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (s stallWriter) Write(p []byte) (int, error) {
+	s.rc.SetWriteDeadline(time.Now().Add(mediaStallTimeout))
+	return s.w.Write(p)
+}
+
+// signMediaHandler returns a short-lived signed URL for an uploaded resource,
+// for players that can't send an Authorization header (e.g. <audio src>).
+// POST /v1/resources/{id}/media/sign
+func (app *application) signMediaHandler(w http.ResponseWriter, r *http.Request) {
+	res, ok := app.authorizeMedia(w, r, app.contextGetUser(r))
+	if !ok {
+		return
+	}
+	key, ok := app.storageKey(res.URL)
+	if !ok {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Resource is not hosted media")
+		return
+	}
+
+	url, err := app.storage.PresignGet(r.Context(), key, signedMediaTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"url":        url,
+		"expires_at": time.Now().Add(signedMediaTTL).UTC(),
+	}, nil)
+}
+
+// redirectToSignedMedia answers with a 302 to a signed storage URL instead of
+// proxying the bytes, used by GET /v1/resources/{id}/media?mode=redirect.
+func (app *application) redirectToSignedMedia(w http.ResponseWriter, r *http.Request, key string) {
+	url, err := app.storage.PresignGet(r.Context(), key, signedMediaTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(signedMediaTTL.Seconds())-60))
+	http.Redirect(w, r, url, http.StatusFound)
+}
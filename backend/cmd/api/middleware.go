@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/draqist/iqraa/backend/internal/auth"
@@ -16,13 +15,6 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 		
-		// Allowed origins list
-		allowedOrigins := []string{
-			os.Getenv("FRONTEND_URL"),
-			"http://localhost:3000",
-			"http://localhost:8081", // Expo web
-		}
-		
 		// For mobile apps, Origin header might be empty or different
 		// In development, we can be more permissive
 		allowOrigin := ""
@@ -31,11 +23,8 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			allowOrigin = "*"
 		} else {
 			// Check if origin is in allowed list
-			for _, allowed := range allowedOrigins {
-				if origin == allowed {
-					allowOrigin = origin
-					break
-				}
+			if app.trustedOrigin(origin) {
+				allowOrigin = origin
 			}
 			// In development, allow any localhost origin
 			if allowOrigin == "" && (strings.HasPrefix(origin, "http://localhost") || strings.HasPrefix(origin, "http://10.") || strings.HasPrefix(origin, "http://192.168.")) {
@@ -45,7 +34,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		
 		if allowOrigin != "" {
 			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 		}
@@ -59,6 +48,17 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// trustedOrigin reports whether origin is one of the configured frontend
+// origins.
+func (app *application) trustedOrigin(origin string) bool {
+	for _, trusted := range app.config.cors.trustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+	return false
+}
+
 // authenticateIfExists checks for a Bearer token in the Authorization header.
 // If a valid token is present, it adds the UserID to the request context.
 // If the token is missing or invalid, it proceeds without adding the UserID (Guest mode).
@@ -50,4 +50,24 @@ func (app *application) requireSuperAdmin(next http.HandlerFunc) http.HandlerFun
 
 		next.ServeHTTP(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// requireModerator allows 'moderator', 'admin' and 'super_admin'
+// Use this for: The moderation queue, Sanctions, Blocked terms
+func (app *application) requireModerator(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(UserContextKey).(string)
+		user, err := app.models.Users.GetByID(userID)
+		if err != nil {
+			app.errorResponse(w, http.StatusUnauthorized, "User not found")
+			return
+		}
+
+		if !isStaff(user) {
+			app.errorResponse(w, http.StatusForbidden, "Access denied: Moderators only")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
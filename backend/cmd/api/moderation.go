@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+)
+
+// autoHideReports is how many open reports take content out of view until a
+// moderator has looked at it.
+const autoHideReports = 3
+
+// maxSanctionHours bounds temporary mutes and bans (90 days).
+const maxSanctionHours = 90 * 24
+
+// sanctionMessage tells a sanctioned user why they cannot post.
+func sanctionMessage(s *data.Sanction) string {
+	what := "muted"
+	if s.Kind == "ban" {
+		what = "banned from the community"
+	}
+	if s.ExpiresAt == nil {
+		return "You have been " + what + "."
+	}
+	return fmt.Sprintf("You have been %s until %s.", what, s.ExpiresAt.UTC().Format(time.RFC1123))
+}
+
+// checkPost enforces mutes and bans and runs the blocked-term filter over the
+// fields of a post. It returns the problems to show the user (nil when the
+// post may go ahead): a "sanction" entry for mutes and bans, field errors for
+// rejected terms. For posts that match a "review" term it also returns the
+// term that sends the post to the moderator queue.
+func (app *application) checkPost(userID string, fields map[string]string) (map[string]string, *data.BlockedTerm, error) {
+	sanction, err := app.models.Moderation.ActiveSanction(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sanction != nil {
+		return map[string]string{"sanction": sanctionMessage(sanction)}, nil, nil
+	}
+
+	v := validator.New()
+	var held *data.BlockedTerm
+	for field, text := range fields {
+		term, err := app.models.Moderation.MatchBlockedTerm(text)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case term == nil:
+		case term.Action == "reject":
+			v.AddError(field, "contains language that is not allowed")
+		default:
+			held = term
+		}
+	}
+	if !v.Valid() {
+		return v.Errors, nil, nil
+	}
+	return nil, held, nil
+}
+
+// screenPost is checkPost for HTTP handlers: it writes the error response
+// itself and returns false when the post is refused.
+func (app *application) screenPost(w http.ResponseWriter, r *http.Request, userID string, fields map[string]string) (*data.BlockedTerm, bool) {
+	problems, held, err := app.checkPost(userID, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if msg, ok := problems["sanction"]; ok {
+		app.errorResponse(w, http.StatusForbidden, msg)
+		return nil, false
+	}
+	if problems != nil {
+		app.failedValidationResponse(w, r, problems)
+		return nil, false
+	}
+	return held, true
+}
+
+// holdForReview hides freshly posted content that matched a "review" term
+// and files a report so it shows up in the moderator queue.
+func (app *application) holdForReview(contentType, contentID, authorID string, term *data.BlockedTerm) {
+	if err := app.models.Moderation.SetHidden(contentType, contentID, "", true); err != nil {
+		app.logger.Printf("holding %s %s for review: %v", contentType, contentID, err)
+		return
+	}
+	_, err := app.models.Moderation.CreateReport(&data.Report{
+		ContentType: contentType,
+		ContentID:   contentID,
+		Reason:      "blocked_term",
+		Details:     term.Term,
+	})
+	if err != nil {
+		app.logger.Printf("reporting %s %s for review: %v", contentType, contentID, err)
+	}
+	err = app.models.Moderation.Record(&data.ModerationAction{
+		Action:       data.ActionHide,
+		ContentType:  contentType,
+		ContentID:    contentID,
+		TargetUserID: authorID,
+		Reason:       "Matched blocked term: " + term.Term,
+	}, "")
+	if err != nil {
+		app.logger.Printf("recording hold of %s %s: %v", contentType, contentID, err)
+	}
+}
+
+// createReportHandler reports a discussion, reply (including chat messages)
+// or published note. Content with enough open reports is hidden until a
+// moderator reviews it.
+// POST /v1/reports
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		ContentType string `json:"content_type"`
+		ContentID   string `json:"content_id"`
+		Reason      string `json:"reason"`
+		Details     string `json:"details"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.ContentType, data.ContentDiscussion, data.ContentReply, data.ContentNote),
+		"content_type", "must be discussion, reply or note")
+	v.Check(input.ContentID != "", "content_id", "must be provided")
+	v.Check(validator.PermittedValue(input.Reason, data.ReportReasons...), "reason", "must be one of "+strings.Join(data.ReportReasons, ", "))
+	v.Check(len(input.Details) <= 1000, "details", "must not be more than 1000 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authorID, err := app.models.Moderation.ContentAuthor(input.ContentType, input.ContentID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Content not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if authorID == userID {
+		app.errorResponse(w, http.StatusBadRequest, "You cannot report your own content")
+		return
+	}
+
+	// Posts in a circle room can only be reported by those who can read them.
+	discussionID, err := app.models.Moderation.ContentDiscussion(input.ContentType, input.ContentID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if discussionID != "" {
+		ok, err := app.canAccessRoom(r, discussionID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.errorResponse(w, http.StatusNotFound, "Content not found")
+			return
+		}
+	}
+
+	report := &data.Report{
+		ReporterID:  userID,
+		ContentType: input.ContentType,
+		ContentID:   input.ContentID,
+		Reason:      input.Reason,
+		Details:     strings.TrimSpace(input.Details),
+	}
+	open, err := app.models.Moderation.CreateReport(report)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateReport) {
+			app.errorResponse(w, http.StatusConflict, "You have already reported this")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if open == autoHideReports {
+		if err := app.models.Moderation.SetHidden(report.ContentType, report.ContentID, "", true); err != nil {
+			app.logger.Printf("auto-hiding %s %s: %v", report.ContentType, report.ContentID, err)
+		} else {
+			err := app.models.Moderation.Record(&data.ModerationAction{
+				Action:       data.ActionHide,
+				ContentType:  report.ContentType,
+				ContentID:    report.ContentID,
+				TargetUserID: authorID,
+				Reason:       fmt.Sprintf("Hidden automatically after %d reports", open),
+			}, "")
+			if err != nil {
+				app.logger.Printf("recording auto-hide of %s %s: %v", report.ContentType, report.ContentID, err)
+			}
+		}
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"report": report}, nil)
+}
+
+// moderationQueueHandler lists reported content awaiting a moderator, most
+// reported first. ?type= narrows it to one content type.
+// GET /v1/moderation/queue
+func (app *application) moderationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := app.models.Moderation.GetQueue(r.URL.Query().Get("type"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"queue": items}, nil)
+}
+
+// moderationActionHandler applies a moderator action. hide, unhide, delete
+// and dismiss act on a piece of content; warn, mute, ban, unmute and unban
+// act on a user, given directly or as the author of the content. Acting on
+// content resolves its open reports. Every action lands in the audit trail.
+// POST /v1/moderation/actions
+func (app *application) moderationActionHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := app.contextGetUser(r)
+	if moderator == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var input struct {
+		Action        string `json:"action"`
+		ContentType   string `json:"content_type"`
+		ContentID     string `json:"content_id"`
+		UserID        string `json:"user_id"`
+		Reason        string `json:"reason"`
+		DurationHours int    `json:"duration_hours"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	contentAction := validator.PermittedValue(input.Action,
+		data.ActionHide, data.ActionUnhide, data.ActionDelete, data.ActionDismiss)
+	userAction := validator.PermittedValue(input.Action,
+		data.ActionWarn, data.ActionMute, data.ActionBan, data.ActionUnmute, data.ActionUnban)
+
+	v := validator.New()
+	v.Check(contentAction || userAction, "action", "must be hide, unhide, delete, dismiss, warn, mute, ban, unmute or unban")
+	if input.ContentType != "" || contentAction {
+		v.Check(validator.PermittedValue(input.ContentType, data.ContentDiscussion, data.ContentReply, data.ContentNote),
+			"content_type", "must be discussion, reply or note")
+		v.Check(input.ContentID != "", "content_id", "must be provided")
+	}
+	if userAction && input.ContentID == "" {
+		v.Check(input.UserID != "", "user_id", "must be provided")
+	}
+	if input.Action == data.ActionWarn {
+		v.Check(strings.TrimSpace(input.Reason) != "", "reason", "must be provided")
+	}
+	if input.Action == data.ActionMute {
+		v.Check(input.DurationHours > 0, "duration_hours", "must be provided")
+	}
+	v.Check(input.DurationHours >= 0 && input.DurationHours <= maxSanctionHours, "duration_hours",
+		fmt.Sprintf("must be between 1 and %d", maxSanctionHours))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 1. Resolve the target user
+	targetID := input.UserID
+	if input.ContentID != "" {
+		authorID, err := app.models.Moderation.ContentAuthor(input.ContentType, input.ContentID)
+		switch {
+		case err == nil:
+			if targetID == "" {
+				targetID = authorID
+			}
+		case errors.Is(err, data.ErrRecordNotFound) && input.Action == data.ActionDismiss:
+			// Reports can outlive their content.
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Content not found")
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if userAction {
+		target, err := app.models.Users.GetByID(targetID)
+		if err != nil {
+			app.errorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if isStaff(target) {
+			app.errorResponse(w, http.StatusForbidden, "Staff members cannot be sanctioned")
+			return
+		}
+	}
+
+	action := &data.ModerationAction{
+		ModeratorID:  moderator.ID,
+		Action:       input.Action,
+		ContentType:  input.ContentType,
+		ContentID:    input.ContentID,
+		TargetUserID: targetID,
+		Reason:       strings.TrimSpace(input.Reason),
+	}
+	if input.DurationHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.DurationHours) * time.Hour)
+		action.ExpiresAt = &expiresAt
+	}
+
+	// 2. Apply it
+	var err error
+	switch input.Action {
+	case data.ActionHide, data.ActionUnhide:
+		err = app.models.Moderation.SetHidden(input.ContentType, input.ContentID, moderator.ID, input.Action == data.ActionHide)
+	case data.ActionDelete:
+		if input.ContentType == data.ContentReply {
+			err = app.models.Community.DeleteReply(input.ContentID, moderator.ID)
+		} else {
+			err = app.models.Moderation.RemoveContent(input.ContentType, input.ContentID)
+		}
+	case data.ActionMute, data.ActionBan:
+		err = app.models.Moderation.AddSanction(&data.Sanction{
+			UserID:    targetID,
+			Kind:      input.Action,
+			Reason:    action.Reason,
+			ExpiresAt: action.ExpiresAt,
+			CreatedBy: moderator.ID,
+		})
+	case data.ActionUnmute, data.ActionUnban:
+		var lifted int64
+		lifted, err = app.models.Moderation.RevokeSanctions(targetID, strings.TrimPrefix(input.Action, "un"))
+		if err == nil && lifted == 0 {
+			app.errorResponse(w, http.StatusConflict, "The user has no active "+strings.TrimPrefix(input.Action, "un"))
+			return
+		}
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Content not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 3. Audit it and close the reports it answers
+	reportStatus := "actioned"
+	switch input.Action {
+	case data.ActionDismiss:
+		reportStatus = "dismissed"
+	case data.ActionUnhide, data.ActionUnmute, data.ActionUnban:
+		reportStatus = ""
+	}
+	if err := app.models.Moderation.Record(action, reportStatus); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 4. Let the user know
+	if title, message := moderationNotice(action); title != "" {
+		payload, _ := json.Marshal(map[string]string{"action_id": action.ID, "action": action.Action})
+		app.models.Notifications.Insert(&data.Notification{
+			UserID:  targetID,
+			Type:    "moderation_" + action.Action,
+			Title:   title,
+			Message: message,
+			Data:    payload,
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"action": action}, nil)
+}
+
+// moderationNotice is the notification a user receives about an action taken
+// against them, or empty strings for actions they are not told about.
+func moderationNotice(a *data.ModerationAction) (string, string) {
+	message := a.Reason
+	if a.ExpiresAt != nil {
+		message = strings.TrimSpace(message + " Until " + a.ExpiresAt.UTC().Format(time.RFC1123) + ".")
+	}
+	switch a.Action {
+	case data.ActionWarn:
+		return "You received a warning from a moderator", message
+	case data.ActionMute:
+		return "You have been muted", message
+	case data.ActionBan:
+		return "You have been banned from the community", message
+	case data.ActionDelete:
+		return "A moderator removed your post", message
+	case data.ActionUnmute, data.ActionUnban:
+		return "Your restriction has been lifted", message
+	}
+	return "", ""
+}
+
+// listModerationActionsHandler is the moderation audit trail. ?user_id=
+// narrows it to actions against one user, ?content_id= to one piece of
+// content.
+// GET /v1/moderation/actions
+func (app *application) listModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	actions, err := app.models.Moderation.GetActions(query.Get("user_id"), query.Get("content_id"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"actions": actions}, nil)
+}
+
+// listUserSanctionsHandler lists a user's mutes and bans, and the one in
+// force.
+// GET /v1/moderation/users/{id}/sanctions
+func (app *application) listUserSanctionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	sanctions, err := app.models.Moderation.GetSanctions(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	active, err := app.models.Moderation.ActiveSanction(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sanctions": sanctions, "active": active}, nil)
+}
+
+// listBlockedTermsHandler lists the blocked-term filter.
+// GET /v1/moderation/blocked-terms
+func (app *application) listBlockedTermsHandler(w http.ResponseWriter, r *http.Request) {
+	terms, err := app.models.Moderation.GetBlockedTerms()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"terms": terms}, nil)
+}
+
+// createBlockedTermHandler adds a term to the filter. "reject" (default)
+// refuses matching posts; "review" publishes them hidden for a moderator.
+// POST /v1/moderation/blocked-terms
+func (app *application) createBlockedTermHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Term   string `json:"term"`
+		Action string `json:"action"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.Term = strings.TrimSpace(input.Term)
+	if input.Action == "" {
+		input.Action = "reject"
+	}
+
+	v := validator.New()
+	v.Check(len([]rune(input.Term)) >= 2, "term", "must be at least 2 characters long")
+	v.Check(len(input.Term) <= 200, "term", "must not be more than 200 bytes long")
+	v.Check(validator.PermittedValue(input.Action, "reject", "review"), "action", "must be reject or review")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	term := &data.BlockedTerm{Term: input.Term, Action: input.Action}
+	if err := app.models.Moderation.InsertBlockedTerm(term, userID); err != nil {
+		if errors.Is(err, data.ErrDuplicateTerm) {
+			app.errorResponse(w, http.StatusConflict, "This term is already blocked")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"term": term}, nil)
+}
+
+// deleteBlockedTermHandler removes a term from the filter.
+// DELETE /v1/moderation/blocked-terms/{id}
+func (app *application) deleteBlockedTermHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Moderation.DeleteBlockedTerm(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Term not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "term removed"}, nil)
+}
@@ -58,6 +58,21 @@ func (app *application) saveBookNoteHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Publishing puts the note in the community feed, so it is screened like
+	// any other post. Private drafts are not.
+	var held *data.BlockedTerm
+	if input.IsPublished {
+		var ok bool
+		held, ok = app.screenPost(w, r, userID, map[string]string{
+			"title":       input.Title,
+			"description": input.Description,
+			"content":     string(input.Content),
+		})
+		if !ok {
+			return
+		}
+	}
+
 	note := &data.Note{
 		ID:          input.ID,
 		BookID:      bookID,
@@ -74,6 +89,9 @@ func (app *application) saveBookNoteHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	if held != nil {
+		app.holdForReview(data.ContentNote, note.ID, userID, held)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(note)
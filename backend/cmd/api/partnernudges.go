@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+)
+
+const (
+	// How often the nudger looks for partners who missed yesterday's goal.
+	partnerNudgeTick = time.Hour
+
+	// Nudges sent per tick; the rest go out on the next ones.
+	partnerNudgeBatch = 200
+)
+
+// partnerNudger reminds accountability partners who did not check in as
+// done yesterday, on behalf of their partner. Each miss is claimed in the
+// database before it is sent, so running it on every instance is safe.
+type partnerNudger struct {
+	app *application
+}
+
+func newPartnerNudger(app *application) *partnerNudger {
+	return &partnerNudger{app: app}
+}
+
+func (pn *partnerNudger) run() {
+	ticker := time.NewTicker(partnerNudgeTick)
+	defer ticker.Stop()
+
+	// Send nudges missed during a restart straight away.
+	pn.nudgeMissed()
+
+	for range ticker.C {
+		pn.nudgeMissed()
+	}
+}
+
+// nudgeMissed claims one batch of missed goals and notifies each partner.
+func (pn *partnerNudger) nudgeMissed() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			pn.app.logger.Printf("partner nudges: panic: %v", rec)
+		}
+	}()
+
+	missed, err := pn.app.models.Social.ClaimMissedGoals(partnerNudgeBatch)
+	if err != nil {
+		pn.app.logger.Printf("partner nudges: %v", err)
+		return
+	}
+
+	for _, m := range missed {
+		payload, _ := json.Marshal(map[string]string{
+			"partner_id": m.PartnershipID,
+			"missed_on":  m.MissedOn.Format(time.DateOnly),
+		})
+		err := pn.app.models.Notifications.Insert(&data.Notification{
+			UserID:  m.UserID,
+			Type:    "partner_nudge",
+			Title:   "Your Partner Is Waiting",
+			Message: fmt.Sprintf("You missed yesterday's check-in with %s: %s", m.PartnerName, m.Goal),
+			Data:    payload,
+		})
+		if err != nil {
+			pn.app.logger.Printf("partner nudges: %s: %v", m.UserID, err)
+		}
+	}
+}
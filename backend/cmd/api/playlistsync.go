@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/draqist/iqraa/backend/internal/youtube"
+)
+
+const (
+	// How often the syncer wakes up to look for stale playlists.
+	playlistSyncTick = time.Hour
+
+	// Minimum time between two scheduled syncs of the same playlist.
+	playlistSyncInterval = 24 * time.Hour
+
+	// Playlists synced per tick. Each costs one quota unit per 50 videos.
+	playlistSyncBatch = 20
+)
+
+// playlistSyncer keeps playlist resources in line with their source YouTube playlists.
+type playlistSyncer struct {
+	app *application
+}
+
+func newPlaylistSyncer(app *application) *playlistSyncer {
+	return &playlistSyncer{app: app}
+}
+
+func (ps *playlistSyncer) run() {
+	ticker := time.NewTicker(playlistSyncTick)
+	defer ticker.Stop()
+
+	// Pick up playlists that fell due while the API was down.
+	ps.syncDue()
+
+	for range ticker.C {
+		ps.syncDue()
+	}
+}
+
+// syncDue syncs one batch of playlists whose last sync is older than the interval.
+func (ps *playlistSyncer) syncDue() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			ps.app.logger.Printf("playlist sync: panic: %v", rec)
+		}
+	}()
+
+	ids, err := ps.app.models.Playlists.GetDueForSync(playlistSyncInterval, playlistSyncBatch)
+	if err != nil {
+		ps.app.logger.Printf("playlist sync: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		res, err := ps.app.models.Resources.Get(id)
+		if err != nil {
+			continue
+		}
+
+		if _, err := ps.sync(res, "scheduled"); err != nil {
+			ps.app.logger.Printf("playlist sync: %s: %v", id, err)
+			// Out of quota for today; the rest of the batch would fail too.
+			if errors.Is(err, youtube.ErrQuotaExceeded) {
+				return
+			}
+		}
+	}
+}
+
+// sync fetches the source playlist, diffs it against the stored episodes and
+// applies the changes. Failures are recorded against the playlist.
+func (ps *playlistSyncer) sync(parent *data.Resource, trigger string) (*data.PlaylistSyncRun, error) {
+	if parent.SourcePlaylistID == nil || *parent.SourcePlaylistID == "" {
+		return nil, errors.New("resource has no source playlist")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// Only scheduled syncs may reuse recently fetched pages.
+	if trigger != "scheduled" {
+		ctx = youtube.NoCache(ctx)
+	}
+
+	items, err := ps.app.youtube.PlaylistItems(ctx, *parent.SourcePlaylistID)
+	if err == nil {
+		var episodes []*data.Resource
+		episodes, err = ps.app.models.Playlists.GetEpisodes(parent.ID)
+		if err == nil {
+			return ps.app.models.Playlists.ApplySync(parent, planPlaylistSync(episodes, items), trigger)
+		}
+	}
+
+	ps.app.models.Playlists.RecordFailure(parent.ID, trigger, err.Error())
+	return nil, err
+}
+
+// planPlaylistSync works out which episodes to add, update and flag as removed.
+// Episodes without a recognisable YouTube video (e.g. a PDF an admin attached
+// to the series) are left alone.
+func planPlaylistSync(episodes []*data.Resource, items []youtube.PlaylistItem) *data.PlaylistSyncPlan {
+	plan := &data.PlaylistSyncPlan{}
+
+	byVideo := make(map[string]*data.Resource, len(episodes))
+	for _, ep := range episodes {
+		videoID := ""
+		if ep.SourceVideoID != nil {
+			videoID = *ep.SourceVideoID
+		} else {
+			videoID = youtube.VideoIDFromURL(ep.URL)
+		}
+		if videoID != "" {
+			if _, dup := byVideo[videoID]; !dup {
+				byVideo[videoID] = ep
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(items))
+	position := 0
+	for _, item := range items {
+		videoID := item.Snippet.ResourceId.VideoId
+		title := item.Snippet.Title
+
+		// Deleted and private videos stay in the playlist as placeholders.
+		if videoID == "" || seen[videoID] || title == "Deleted video" || title == "Private video" {
+			continue
+		}
+		seen[videoID] = true
+		position++
+
+		ep, ok := byVideo[videoID]
+		if !ok {
+			plan.Add = append(plan.Add, data.PlaylistEpisode{
+				VideoID:       videoID,
+				Title:         title,
+				URL:           youtube.WatchURL(videoID),
+				SequenceIndex: position,
+			})
+			continue
+		}
+
+		if ep.Title != title || ep.SequenceIndex != position || ep.SourceRemoved || ep.SourceVideoID == nil {
+			plan.Update = append(plan.Update, data.PlaylistEpisodeUpdate{
+				ResourceID:    ep.ID,
+				VideoID:       videoID,
+				Title:         title,
+				SequenceIndex: position,
+			})
+		}
+	}
+
+	for videoID, ep := range byVideo {
+		if !seen[videoID] && !ep.SourceRemoved {
+			plan.Remove = append(plan.Remove, ep.ID)
+		}
+	}
+
+	return plan
+}
+
+// syncPlaylistHandler runs a sync immediately and returns the counts.
+// POST /v1/resources/{id}/sync
+func (app *application) syncPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	if res.SourcePlaylistID == nil {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Resource is not linked to a YouTube playlist")
+		return
+	}
+
+	run, err := app.playlistSyncer.sync(res, "manual")
+	if err != nil {
+		switch {
+		case errors.Is(err, youtube.ErrQuotaExceeded):
+			app.errorResponse(w, http.StatusTooManyRequests, "YouTube quota exhausted for today, try again tomorrow")
+		case errors.Is(err, youtube.ErrNotFound):
+			app.errorResponse(w, http.StatusNotFound, "YouTube playlist not found or private")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sync_run": run}, nil)
+}
+
+// updatePlaylistSourceHandler links a playlist resource to a YouTube playlist.
+// PUT /v1/resources/{id}/sync
+func (app *application) updatePlaylistSourceHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	var input struct {
+		SourcePlaylistID string `json:"source_playlist_id"`
+		SyncEnabled      bool   `json:"sync_enabled"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.SourcePlaylistID = strings.TrimSpace(input.SourcePlaylistID)
+
+	v := validator.New()
+	v.Check(res.Type == "playlist", "type", "only playlists can be synced")
+	v.Check(!input.SyncEnabled || input.SourcePlaylistID != "", "source_playlist_id", "must be provided to enable sync")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Playlists.SetSource(res, input.SourcePlaylistID, input.SyncEnabled); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "sync settings saved"}, nil)
+}
+
+// listPlaylistSyncRunsHandler returns the sync history of a playlist.
+// GET /v1/resources/{id}/sync-runs
+func (app *application) listPlaylistSyncRunsHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := app.models.Playlists.GetRuns(r.PathValue("id"), 50)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sync_runs": runs}, nil)
+}
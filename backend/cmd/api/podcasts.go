@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/podcast"
+)
+
+// bookPodcastHandler serves the public podcast feed of a published, public book.
+// GET /v1/books/{id}/podcast.xml
+func (app *application) bookPodcastHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveBookPodcast(w, r, "")
+}
+
+// roadmapPodcastHandler serves the public podcast feed of a roadmap.
+// GET /v1/roadmaps/{slug}/podcast.xml
+func (app *application) roadmapPodcastHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveRoadmapPodcast(w, r, "")
+}
+
+// privateBookPodcastHandler serves a book feed through a user's feed token.
+// Members-only books are included.
+// GET /v1/podcast/{token}/books/{id}/feed.xml
+func (app *application) privateBookPodcastHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.podcastTokenUser(w, r)
+	if !ok {
+		return
+	}
+	app.serveBookPodcast(w, r, userID)
+}
+
+// privateRoadmapPodcastHandler serves a roadmap feed through a user's feed token.
+// Unlisted roadmaps and the user's own personal roadmaps are included.
+// GET /v1/podcast/{token}/roadmaps/{slug}/feed.xml
+func (app *application) privateRoadmapPodcastHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.podcastTokenUser(w, r)
+	if !ok {
+		return
+	}
+	app.serveRoadmapPodcast(w, r, userID)
+}
+
+// serveBookPodcast renders a book feed. userID is the owner of the feed
+// token for private feeds and empty for public ones.
+func (app *application) serveBookPodcast(w http.ResponseWriter, r *http.Request, userID string) {
+	private := userID != ""
+
+	book, err := app.models.Books.Get(r.PathValue("id"))
+	if err != nil || book.Status != "published" || (!private && !book.IsPublic) {
+		app.errorResponse(w, http.StatusNotFound, "Book not found")
+		return
+	}
+
+	episodes, err := app.models.Podcasts.GetBookEpisodes(book.ID, private)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feed := &podcast.Feed{
+		Title:       book.Title,
+		Link:        frontendURL("/library/" + book.ID),
+		SelfURL:     apiURL(r.URL.RequestURI()),
+		Description: book.Description,
+		Author:      book.OriginalAuthor,
+		ImageURL:    book.CoverImageURL,
+		Language:    "ar",
+		Category:    "Religion & Spirituality",
+	}
+	if feed.Description == "" {
+		feed.Description = fmt.Sprintf("Audio lessons for %s on Iqraa.", book.Title)
+	}
+
+	app.writePodcast(w, r, feed, episodes, private)
+}
+
+// serveRoadmapPodcast renders a roadmap feed. As on the roadmap page,
+// personal roadmaps are only served to their owner; unlisted ones need a
+// private feed.
+func (app *application) serveRoadmapPodcast(w http.ResponseWriter, r *http.Request, userID string) {
+	private := userID != ""
+
+	roadmap, err := app.models.Roadmaps.GetBySlug(r.PathValue("slug"), "")
+	if err != nil || (!private && !roadmap.IsPublic) || (roadmap.OwnerID != "" && roadmap.OwnerID != userID) {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return
+	}
+
+	episodes, err := app.models.Podcasts.GetRoadmapEpisodes(roadmap.ID, private)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feed := &podcast.Feed{
+		Title:       roadmap.Title,
+		Link:        frontendURL("/roadmaps/" + roadmap.Slug),
+		SelfURL:     apiURL(r.URL.RequestURI()),
+		Description: roadmap.Description,
+		Author:      "Iqraa",
+		ImageURL:    roadmap.CoverImageURL,
+		Language:    "ar",
+		Category:    "Religion & Spirituality",
+	}
+	if feed.Description == "" {
+		feed.Description = fmt.Sprintf("Audio lessons for the %s roadmap on Iqraa.", roadmap.Title)
+	}
+
+	app.writePodcast(w, r, feed, episodes, private)
+}
+
+// writePodcast adds the episodes to the feed and renders it. Roadmap feeds
+// mix several books, so episode titles are prefixed with the book.
+func (app *application) writePodcast(w http.ResponseWriter, r *http.Request, feed *podcast.Feed, episodes []*data.PodcastEpisode, private bool) {
+	multiBook := false
+	for _, e := range episodes {
+		if e.BookID != episodes[0].BookID {
+			multiBook = true
+			break
+		}
+	}
+
+	token := r.PathValue("token")
+	for i, e := range episodes {
+		// Hosted audio goes through the API, which checks access; private
+		// feeds carry their token since podcast apps cannot sign in.
+		url := e.URL
+		if _, ok := app.storageKey(url); ok {
+			url = mediaURL(e.ResourceID)
+			if private {
+				url = apiURL("/v1/podcast/" + token + "/episodes/" + e.ResourceID)
+			}
+		}
+
+		title := e.Title
+		if multiBook {
+			title = e.BookTitle + " – " + e.Title
+		}
+		feed.Episodes = append(feed.Episodes, podcast.Episode{
+			GUID:            e.ResourceID,
+			Title:           title,
+			URL:             url,
+			MimeType:        e.MimeType,
+			SizeBytes:       e.FileSizeBytes,
+			DurationSeconds: e.DurationSeconds,
+			PublishedAt:     e.CreatedAt,
+			Number:          i + 1,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	if private {
+		w.Header().Set("Cache-Control", "private, max-age=900")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=900")
+	}
+
+	if err := feed.Write(w); err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// podcastTokenUser resolves the {token} path segment to its user and writes
+// a 404 for unknown tokens, so feed URLs can't be probed for valid ones.
+func (app *application) podcastTokenUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	hash := sha256.Sum256([]byte(r.PathValue("token")))
+
+	userID, err := app.models.Podcasts.GetUserForToken(hash[:])
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Feed not found")
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return "", false
+	}
+	return userID, true
+}
+
+// createPodcastTokenHandler issues a new private feed token, revoking the old one.
+// The token is only shown once; only its hash is stored.
+// POST /v1/podcast/token
+func (app *application) createPodcastTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+	hash := sha256.Sum256([]byte(token))
+
+	if err := app.models.Podcasts.SetToken(userID, hash[:]); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	base := apiURL("/v1/podcast/" + token)
+	app.writeJSON(w, http.StatusCreated, envelope{
+		"token":            token,
+		"book_feed_url":    base + "/books/{id}/feed.xml",
+		"roadmap_feed_url": base + "/roadmaps/{slug}/feed.xml",
+	}, nil)
+}
+
+// deletePodcastTokenHandler revokes the user's private feed URLs.
+// DELETE /v1/podcast/token
+func (app *application) deletePodcastTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	if err := app.models.Podcasts.DeleteToken(userID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "podcast feeds revoked"}, nil)
+}
+
+// apiURL links to an API path on the configured public API_URL. Links
+// handed out in feeds, certificates and share URLs must not be built from
+// request headers, which clients control.
+func apiURL(path string) string {
+	base := strings.TrimRight(os.Getenv("API_URL"), "/")
+	if base == "" {
+		base = "https://api.iqraa.space"
+	}
+	return base + path
+}
+
+// frontendURL links to a page of the web app.
+func frontendURL(path string) string {
+	base := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+	if base == "" {
+		base = "https://iqraa.space"
+	}
+	return base + path
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/media"
+)
+
+const (
+	// Maximum size of a file we will download for inspection.
+	maxProcessingBytes = 200 << 20
+
+	// How often the processor sweeps the database for pending resources
+	// (covers restarts and a full queue).
+	processingSweepInterval = 5 * time.Minute
+)
+
+// mediaProcessor inspects uploaded PDFs and audio in the background so that
+// resource creation never waits on a download.
+// Jobs run one at a time to stay inside the 512MB memory budget.
+type mediaProcessor struct {
+	app    *application
+	queue  chan string
+	client *http.Client
+}
+
+func newMediaProcessor(app *application) *mediaProcessor {
+	return &mediaProcessor{
+		app:    app,
+		queue:  make(chan string, 100),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// enqueue schedules a resource for processing without blocking the request.
+// If the queue is full the resource stays 'pending' and the next sweep picks it up.
+func (p *mediaProcessor) enqueue(resourceID string) {
+	select {
+	case p.queue <- resourceID:
+	default:
+	}
+}
+
+func (p *mediaProcessor) run() {
+	ticker := time.NewTicker(processingSweepInterval)
+	defer ticker.Stop()
+
+	p.sweep()
+
+	for {
+		select {
+		case id := <-p.queue:
+			p.process(id)
+		case <-ticker.C:
+			p.sweep()
+		}
+	}
+}
+
+// sweep queues resources left pending, e.g. uploads made before a redeploy.
+func (p *mediaProcessor) sweep() {
+	ids, err := p.app.models.Resources.GetPendingProcessing(50)
+	if err != nil {
+		p.app.logger.Printf("media processor: sweep failed: %v", err)
+		return
+	}
+	for _, id := range ids {
+		p.enqueue(id)
+	}
+}
+
+// process runs a single job. Panics are recovered so one bad file cannot stop the worker.
+func (p *mediaProcessor) process(resourceID string) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.app.logger.Printf("media processor: panic on resource %s: %v", resourceID, rec)
+		}
+	}()
+
+	res, err := p.app.models.Resources.Get(resourceID)
+	if err != nil {
+		p.app.logger.Printf("media processor: load resource %s: %v", resourceID, err)
+		return
+	}
+
+	if res.Type != "pdf" && res.Type != "audio" {
+		p.app.models.Resources.SetProcessingStatus(res, "skipped", "")
+		return
+	}
+
+	if err := p.app.models.Resources.SetProcessingStatus(res, "processing", ""); err != nil {
+		p.app.logger.Printf("media processor: %v", err)
+		return
+	}
+
+	result, err := p.inspect(res)
+	if err != nil {
+		p.app.logger.Printf("media processor: resource %s failed: %v", res.ID, err)
+		if result == nil {
+			p.app.models.Resources.SetProcessingStatus(res, "failed", err.Error())
+			return
+		}
+		result.Error = err.Error()
+	}
+
+	if err := p.app.models.Resources.SaveProcessingResult(res, result); err != nil {
+		p.app.logger.Printf("media processor: save resource %s: %v", res.ID, err)
+	}
+}
+
+// inspect downloads the resource to a temp file and extracts its media details.
+// A file that is only partly understood, e.g. a PDF whose page count cannot be
+// found, yields what was read along with the error.
+func (p *mediaProcessor) inspect(res *data.Resource) (*data.ProcessingResult, error) {
+	// 1. Download
+	body, err := p.open(res.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "resource-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(body, maxProcessingBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > maxProcessingBytes {
+		return nil, fmt.Errorf("file exceeds %d MB processing limit", maxProcessingBytes>>20)
+	}
+
+	// 2. Analyse
+	info, inspectErr := media.Inspect(tmp, size)
+	if info == nil {
+		return nil, inspectErr
+	}
+
+	result := &data.ProcessingResult{
+		MimeType:        info.MimeType,
+		FileSizeBytes:   info.SizeBytes,
+		PageCount:       info.PageCount,
+		DurationSeconds: info.DurationSeconds,
+	}
+
+	// 3. Upload thumbnail (best effort; a missing cover is not a failure)
+	if len(info.Thumbnail) > 0 && p.app.storage != nil {
+		key := fmt.Sprintf("thumbnails/%s.jpg", res.ID)
+		url, err := p.app.storage.UploadFile(key, bytes.NewReader(info.Thumbnail), "image/jpeg")
+		if err != nil {
+			p.app.logger.Printf("media processor: thumbnail upload for %s: %v", res.ID, err)
+		} else {
+			result.ThumbnailURL = url
+		}
+	}
+
+	return result, inspectErr
+}
+
+// open fetches a resource's file. Hosted files are read through the storage
+// API, since the bucket is private; linked ones are downloaded.
+func (p *mediaProcessor) open(url string) (io.ReadCloser, error) {
+	if key, ok := p.app.storageKey(url); ok {
+		obj, err := p.app.storage.GetObject(context.Background(), key, "")
+		if err != nil {
+			return nil, err
+		}
+		return obj.Body, nil
+	}
+
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download returned %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
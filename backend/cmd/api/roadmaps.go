@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/draqist/iqraa/backend/internal/data"
@@ -61,12 +63,19 @@ func (app *application) getRoadmapHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Personal roadmaps are only visible to their owner (or via a share link).
+	if roadmap.OwnerID != "" && roadmap.OwnerID != userID {
+		app.errorResponse(w, http.StatusNotFound, "Roadmap not found")
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(roadmap)
 }
 
 // updateRoadmapProgressHandler updates the user's progress on a specific roadmap node.
-// It enforces that a reflection must be published before marking a book as completed.
+// It enforces that a reflection must be published, and any assessment on the
+// node passed, before marking a book as completed.
 // POST /v1/roadmaps/nodes/{node_id}/progress
 func (app *application) updateRoadmapProgressHandler(w http.ResponseWriter, r *http.Request) {
 	nodeID := r.PathValue("node_id")
@@ -80,21 +89,29 @@ func (app *application) updateRoadmapProgressHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	if input.Status == "completed" {
-		bookID, err := app.models.Roadmaps.GetNodeBookID(nodeID)
+	switch input.Status {
+	case "in_progress":
+		locked, err := app.models.Roadmaps.IsNodeLocked(userID, nodeID)
 		if err != nil {
+			app.errorResponse(w, http.StatusInternalServerError, "Failed to check prerequisites")
+			return
+		}
+		if locked {
+			app.errorResponse(w, http.StatusForbidden, "Complete the prerequisites for this step first.")
+			return
+		}
+	case "completed":
+		blocker, err := app.completionBlocker(userID, nodeID)
+		if errors.Is(err, sql.ErrNoRows) {
 			app.errorResponse(w, http.StatusNotFound, "Node not found")
 			return
 		}
-
-		hasNote, err := app.models.Notes.HasPublishedNote(userID, bookID)
 		if err != nil {
-			app.errorResponse(w, http.StatusInternalServerError, "Failed to verify reflection")
+			app.errorResponse(w, http.StatusInternalServerError, "Failed to check completion requirements")
 			return
 		}
-
-		if !hasNote {
-			app.errorResponse(w, http.StatusForbidden, "You must publish a reflection for this book before marking it as complete.")
+		if blocker != "" {
+			app.errorResponse(w, http.StatusForbidden, blocker)
 			return
 		}
 	}
@@ -105,8 +122,15 @@ func (app *application) updateRoadmapProgressHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "progress updated"}`))
+	resp := envelope{"message": "progress updated"}
+
+	if roadmapID, err := app.models.Roadmaps.GetNodeRoadmapID(nodeID); err == nil {
+		if cert := app.afterProgressChange(userID, roadmapID, input.Status); cert != nil {
+			resp["certificate"] = cert
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, resp, nil)
 }
 
 // createRoadmapHandler creates a new roadmap.
@@ -297,6 +321,44 @@ func (app *application) deleteRoadmapNodeHandler(w http.ResponseWriter, r *http.
 	w.Write([]byte(`{"message": "node deleted"}`))
 }
 
+// setRoadmapNodePrerequisitesHandler replaces the prerequisites of a roadmap node.
+// The change is rejected if it would create a cycle.
+// PUT /v1/roadmaps/nodes/{node_id}/prerequisites
+func (app *application) setRoadmapNodePrerequisitesHandler(w http.ResponseWriter, r *http.Request) {
+	nodeID := r.PathValue("node_id")
+
+	var input struct {
+		PrerequisiteIDs []string `json:"prerequisite_ids"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	roadmapID, err := app.models.Roadmaps.SetPrerequisites(nodeID, input.PrerequisiteIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, http.StatusNotFound, "Node not found")
+		case errors.Is(err, data.ErrPrerequisiteCycle):
+			app.failedValidationResponse(w, r, map[string]string{"prerequisite_ids": "must not create a cycle"})
+		case errors.Is(err, data.ErrInvalidPrerequisite):
+			app.failedValidationResponse(w, r, map[string]string{"prerequisite_ids": "must be other nodes of the same roadmap"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	roadmap, err := app.models.Roadmaps.GetByID(roadmapID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"roadmap": roadmap}, nil)
+}
+
 // batchUpdateRoadmapNodesHandler updates the order/level of multiple roadmap nodes.
 // PUT /v1/roadmaps/{id}/nodes/reorder
 func (app *application) batchUpdateRoadmapNodesHandler(w http.ResponseWriter, r *http.Request) {
@@ -60,9 +60,66 @@ func (app *application) routes() http.Handler {
 	// Resources
 	mux.HandleFunc("GET /v1/resources/{id}", app.requireAuth(app.getResourceHandler))
 	mux.HandleFunc("GET /v1/books/{id}/resources", app.listBookResourcesHandler)
+	mux.HandleFunc("GET /v1/books/{id}/resources/tree", app.authenticateIfExists(app.listBookResourceTreeHandler))
+	mux.HandleFunc("PUT /v1/resources/{id}/progress", app.requireAuth(app.saveResourceProgressHandler))
+	mux.HandleFunc("GET /v1/resources/{id}/media", app.authenticateIfExists(app.streamMediaHandler))
+	mux.HandleFunc("GET /v1/resources/{id}/thumbnail", app.authenticateIfExists(app.thumbnailHandler))
+	mux.HandleFunc("POST /v1/resources/{id}/media/sign", app.requireAuth(app.signMediaHandler))
+	mux.HandleFunc("GET /v1/resources/{id}/transcripts", app.authenticateIfExists(app.listTranscriptsHandler))
+	mux.HandleFunc("GET /v1/resources/{id}/transcripts/{lang}", app.authenticateIfExists(app.showTranscriptHandler))
+	mux.HandleFunc("GET /v1/transcripts/search", app.searchTranscriptsHandler)
+	mux.HandleFunc("GET /v1/books/{id}/podcast.xml", app.bookPodcastHandler)
+	mux.HandleFunc("GET /v1/roadmaps/{slug}/podcast.xml", app.roadmapPodcastHandler)
+	mux.HandleFunc("GET /v1/podcast/{token}/books/{id}/feed.xml", app.privateBookPodcastHandler)
+	mux.HandleFunc("GET /v1/podcast/{token}/roadmaps/{slug}/feed.xml", app.privateRoadmapPodcastHandler)
+	mux.HandleFunc("GET /v1/podcast/{token}/episodes/{id}", app.podcastEpisodeHandler)
+	mux.HandleFunc("POST /v1/podcast/token", app.requireAuth(app.createPodcastTokenHandler))
+	mux.HandleFunc("DELETE /v1/podcast/token", app.requireAuth(app.deletePodcastTokenHandler))
 
 	// Roadmaps (Progress)
 	mux.HandleFunc("POST /v1/roadmaps/nodes/{node_id}/progress", app.requireAuth(app.updateRoadmapProgressHandler))
+	mux.HandleFunc("GET /v1/users/me/roadmap-progress", app.requireAuth(app.listProgressEventsHandler))
+	mux.HandleFunc("DELETE /v1/users/me/roadmap-progress/suggestions/{id}", app.requireAuth(app.dismissProgressSuggestionHandler))
+
+	// Assessments
+	mux.HandleFunc("GET /v1/roadmaps/nodes/{node_id}/assessment", app.requireAuth(app.getNodeAssessmentHandler))
+	mux.HandleFunc("POST /v1/roadmaps/nodes/{node_id}/assessment/attempts", app.requireAuth(app.startAssessmentAttemptHandler))
+	mux.HandleFunc("POST /v1/assessments/attempts/{id}/submit", app.requireAuth(app.submitAssessmentAttemptHandler))
+	mux.HandleFunc("GET /v1/assessments/attempts/pending", app.requireAuth(app.listPendingAssessmentAttemptsHandler))
+	mux.HandleFunc("POST /v1/assessments/attempts/{id}/review", app.requireAuth(app.reviewAssessmentAttemptHandler))
+
+	// Personal Roadmaps (Forks)
+	mux.HandleFunc("POST /v1/roadmaps/{id}/fork", app.requireAuth(app.forkRoadmapHandler))
+	mux.HandleFunc("GET /v1/shared/roadmaps/{token}", app.authenticateIfExists(app.showSharedRoadmapHandler))
+	mux.HandleFunc("GET /v1/users/me/roadmaps", app.requireAuth(app.listMyRoadmapsHandler))
+	mux.HandleFunc("GET /v1/users/me/roadmaps/{id}", app.requireAuth(app.showMyRoadmapHandler))
+	mux.HandleFunc("PUT /v1/users/me/roadmaps/{id}", app.requireAuth(app.updateMyRoadmapHandler))
+	mux.HandleFunc("DELETE /v1/users/me/roadmaps/{id}", app.requireAuth(app.deleteMyRoadmapHandler))
+	mux.HandleFunc("POST /v1/users/me/roadmaps/{id}/nodes", app.requireAuth(app.addMyRoadmapNodeHandler))
+	mux.HandleFunc("PUT /v1/users/me/roadmaps/{id}/nodes/{node_id}", app.requireAuth(app.updateMyRoadmapNodeHandler))
+	mux.HandleFunc("DELETE /v1/users/me/roadmaps/{id}/nodes/{node_id}", app.requireAuth(app.deleteMyRoadmapNodeHandler))
+	mux.HandleFunc("PUT /v1/users/me/roadmaps/{id}/nodes/{node_id}/prerequisites", app.requireAuth(app.setMyRoadmapNodePrerequisitesHandler))
+	mux.HandleFunc("PUT /v1/users/me/roadmaps/{id}/progress/rules", app.requireAuth(app.updateMyRoadmapProgressRulesHandler))
+	mux.HandleFunc("POST /v1/users/me/roadmaps/{id}/share", app.requireAuth(app.shareMyRoadmapHandler))
+	mux.HandleFunc("DELETE /v1/users/me/roadmaps/{id}/share", app.requireAuth(app.unshareMyRoadmapHandler))
+	mux.HandleFunc("GET /v1/users/me/roadmaps/{id}/upstream", app.requireAuth(app.upstreamDiffHandler))
+	mux.HandleFunc("POST /v1/users/me/roadmaps/{id}/upstream/merge", app.requireAuth(app.mergeUpstreamHandler))
+
+	// Certificates
+	mux.HandleFunc("POST /v1/roadmaps/{id}/certificate", app.requireAuth(app.requireCertificates(app.claimCertificateHandler)))
+	mux.HandleFunc("GET /v1/users/me/certificates", app.requireAuth(app.listMyCertificatesHandler))
+	mux.HandleFunc("GET /v1/certificates/{code}", app.requireCertificates(app.verifyCertificateHandler))
+	mux.HandleFunc("GET /v1/certificates/{code}/download", app.requireCertificates(app.downloadCertificateHandler))
+
+	// Ijazat & Sanad
+	mux.HandleFunc("POST /v1/ijazat", app.requireAuth(app.requireCertificates(app.grantIjazahHandler)))
+	mux.HandleFunc("GET /v1/ijazat/{code}", app.requireCertificates(app.verifyIjazahHandler))
+	mux.HandleFunc("GET /v1/ijazat/{code}/download", app.requireCertificates(app.downloadIjazahHandler))
+	mux.HandleFunc("DELETE /v1/ijazat/{code}", app.requireAuth(app.revokeIjazahHandler))
+	mux.HandleFunc("GET /v1/users/me/ijazat", app.requireAuth(app.listMyIjazatHandler))
+	mux.HandleFunc("GET /v1/users/me/ijazat/{id}/chain", app.requireAuth(app.ijazahChainHandler))
+	mux.HandleFunc("POST /v1/users/me/sanad", app.requireAuth(app.recordSanadHandler))
+	mux.HandleFunc("DELETE /v1/users/me/sanad/{id}", app.requireAuth(app.deleteSanadHandler))
 
 	// Analytics
 	mux.HandleFunc("POST /v1/analytics/heartbeat", app.requireAuth(app.trackActivityHandler))
@@ -70,9 +127,15 @@ func (app *application) routes() http.Handler {
 
 	// Social (Cohorts & Partners)
 	mux.HandleFunc("POST /v1/roadmaps/{id}/join", app.requireAuth(app.joinCohortHandler))
-	mux.HandleFunc("GET /v1/partners", app.requireAuth(app.getPartnerHandler))
+	mux.HandleFunc("GET /v1/roadmaps/{id}/cohort", app.requireAuth(app.getCohortHandler))
+	mux.HandleFunc("GET /v1/partners", app.requireAuth(app.listPartnersHandler))
 	mux.HandleFunc("POST /v1/partners/invite", app.requireAuth(app.invitePartnerHandler))
 	mux.HandleFunc("POST /v1/partners/accept", app.requireAuth(app.acceptPartnerHandler))
+	mux.HandleFunc("POST /v1/partners/decline", app.requireAuth(app.declinePartnerHandler))
+	mux.HandleFunc("PATCH /v1/partners/{id}", app.requireAuth(app.updatePartnerGoalHandler))
+	mux.HandleFunc("DELETE /v1/partners/{id}", app.requireAuth(app.removePartnerHandler))
+	mux.HandleFunc("POST /v1/partners/{id}/checkins", app.requireAuth(app.partnerCheckInHandler))
+	mux.HandleFunc("GET /v1/partners/{id}/checkins", app.requireAuth(app.listPartnerCheckInsHandler)) // ?days=
 
 	// Notifications
 	mux.HandleFunc("GET /v1/notifications", app.requireAuth(app.listNotificationsHandler))
@@ -93,6 +156,22 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("POST /v1/resources", app.requireAuth(app.requireAdmin(app.createResourceHandler)))
 	mux.HandleFunc("PUT /v1/resources/{id}", app.requireAuth(app.requireAdmin(app.updateResourceHandler)))
 	mux.HandleFunc("DELETE /v1/resources/{id}", app.requireAuth(app.requireAdmin(app.deleteResourceHandler)))
+	mux.HandleFunc("PUT /v1/books/{id}/resources/reorder", app.requireAuth(app.requireAdmin(app.reorderBookResourcesHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/process", app.requireAuth(app.requireAdmin(app.reprocessResourceHandler)))
+	mux.HandleFunc("GET /v1/resources/{id}/link-checks", app.requireAuth(app.requireAdmin(app.listLinkChecksHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/link-checks", app.requireAuth(app.requireAdmin(app.checkResourceLinkHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/sync", app.requireAuth(app.requireAdmin(app.syncPlaylistHandler)))
+	mux.HandleFunc("PUT /v1/resources/{id}/sync", app.requireAuth(app.requireAdmin(app.updatePlaylistSourceHandler)))
+	mux.HandleFunc("GET /v1/resources/{id}/sync-runs", app.requireAuth(app.requireAdmin(app.listPlaylistSyncRunsHandler)))
+	mux.HandleFunc("GET /v1/resources/{id}/segments", app.requireAuth(app.requireAdmin(app.listSegmentsHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/segments/detect", app.requireAuth(app.requireAdmin(app.detectSegmentsHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/segments/review", app.requireAuth(app.requireSuperAdmin(app.reviewSegmentsHandler)))
+	mux.HandleFunc("POST /v1/books/{id}/proposals/internet-archive", app.requireAuth(app.requireAdmin(app.aggregateInternetArchiveHandler)))
+	mux.HandleFunc("GET /v1/books/{id}/proposals", app.requireAuth(app.requireAdmin(app.listProposalsHandler)))
+	mux.HandleFunc("POST /v1/resources/{id}/proposal", app.requireAuth(app.requireAdmin(app.decideProposalHandler)))
+	mux.HandleFunc("PUT /v1/resources/{id}/transcripts/{lang}", app.requireAuth(app.requireAdmin(app.saveTranscriptHandler)))
+	mux.HandleFunc("DELETE /v1/resources/{id}/transcripts/{lang}", app.requireAuth(app.requireAdmin(app.deleteTranscriptHandler)))
+	mux.HandleFunc("POST /v1/transcripts/{id}/review", app.requireAuth(app.requireSuperAdmin(app.reviewTranscriptHandler)))
 
 	// Roadmaps Management
 	mux.HandleFunc("POST /v1/roadmaps", app.requireAuth(app.requireAdmin(app.createRoadmapHandler)))
@@ -102,12 +181,20 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("PUT /v1/roadmaps/nodes/{node_id}", app.requireAuth(app.requireAdmin(app.updateRoadmapNodeHandler)))
 	mux.HandleFunc("DELETE /v1/roadmaps/nodes/{node_id}", app.requireAuth(app.requireAdmin(app.deleteRoadmapNodeHandler)))
 	mux.HandleFunc("PUT /v1/roadmaps/{id}/nodes/reorder", app.requireAuth(app.requireAdmin(app.batchUpdateRoadmapNodesHandler)))
+	mux.HandleFunc("PUT /v1/roadmaps/nodes/{node_id}/prerequisites", app.requireAuth(app.requireAdmin(app.setRoadmapNodePrerequisitesHandler)))
+	mux.HandleFunc("PUT /v1/roadmaps/nodes/{node_id}/assessment", app.requireAuth(app.requireAdmin(app.saveNodeAssessmentHandler)))
+	mux.HandleFunc("DELETE /v1/roadmaps/nodes/{node_id}/assessment", app.requireAuth(app.requireAdmin(app.deleteNodeAssessmentHandler)))
+	mux.HandleFunc("GET /v1/roadmaps/{id}/progress/rules", app.requireAuth(app.requireAdmin(app.getRoadmapProgressRulesHandler)))
+	mux.HandleFunc("PUT /v1/roadmaps/{id}/progress/rules", app.requireAuth(app.requireAdmin(app.updateRoadmapProgressRulesHandler)))
+	mux.HandleFunc("GET /v1/roadmaps/{id}/export", app.requireAuth(app.requireAdmin(app.exportRoadmapHandler)))
+	mux.HandleFunc("POST /v1/roadmaps/import", app.requireAuth(app.requireAdmin(app.importRoadmapHandler)))
 
 	// Admin Tools & Stats
 	mux.HandleFunc("POST /v1/uploads/sign", app.requireAuth(app.requireAdmin(app.generateUploadURLHandler)))
 	mux.HandleFunc("POST /v1/tools/youtube-playlist", app.requireAuth(app.requireAdmin(app.fetchYouTubePlaylistHandler)))
 	mux.HandleFunc("GET /v1/tools/youtube-search", app.requireAuth(app.requireAdmin(app.searchYouTubePlaylistsHandler)))
 	mux.HandleFunc("GET /v1/admin/stats", app.requireAuth(app.requireAdmin(app.getSystemStatsHandler)))
+	mux.HandleFunc("GET /v1/admin/broken-links", app.requireAuth(app.requireAdmin(app.listBrokenLinksHandler)))
 	mux.HandleFunc("POST /v1/admin/tools/extract-pdf", app.requireAuth(app.requireAdmin(app.extractPdfContentHandler)))
 	mux.HandleFunc("PATCH /v1/features/{id}/status", app.requireAuth(app.requireAdmin(app.updateFeatureStatusHandler)))
 
@@ -116,13 +203,48 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("POST /v1/features", app.requireAuth(app.createFeatureRequestHandler))
 	mux.HandleFunc("POST /v1/features/{id}/vote", app.requireAuth(app.voteFeatureRequestHandler))
 	// COMMUNITY / FORUM ROUTES
-mux.HandleFunc("GET /v1/discussions", app.listDiscussionsHandler) // ?type=book&id=123
+mux.HandleFunc("GET /v1/discussions", app.authenticateIfExists(app.listDiscussionsHandler)) // ?type=book&id=123
 mux.HandleFunc("POST /v1/discussions", app.requireAuth(app.createDiscussionHandler))
 
-mux.HandleFunc("GET /v1/discussions/{id}/replies", app.listRepliesHandler)
-mux.HandleFunc("POST /v1/discussions/{id}/replies", app.requireAuth(app.createReplyHandler))
+mux.HandleFunc("GET /v1/discussions/{id}", app.authenticateIfExists(app.requireCircleRoomAccess(app.showDiscussionHandler)))
+mux.HandleFunc("PUT /v1/discussions/{id}/accepted-reply", app.requireAuth(app.requireCircleRoomAccess(app.setAcceptedReplyHandler)))
+mux.HandleFunc("DELETE /v1/discussions/{id}/accepted-reply", app.requireAuth(app.requireCircleRoomAccess(app.setAcceptedReplyHandler)))
+mux.HandleFunc("GET /v1/discussions/{id}/presence", app.authenticateIfExists(app.requireCircleRoomAccess(app.chatPresenceHandler)))
+
+mux.HandleFunc("GET /v1/discussions/{id}/replies", app.authenticateIfExists(app.requireCircleRoomAccess(app.listRepliesHandler))) // ?parent_id=&cursor=&limit=
+mux.HandleFunc("POST /v1/discussions/{id}/replies", app.requireAuth(app.requireCircleRoomAccess(app.createReplyHandler)))
+mux.HandleFunc("PATCH /v1/discussions/{id}/replies/{reply_id}", app.requireAuth(app.requireCircleRoomAccess(app.editReplyHandler)))
+mux.HandleFunc("DELETE /v1/discussions/{id}/replies/{reply_id}", app.requireAuth(app.requireCircleRoomAccess(app.deleteReplyHandler)))
+mux.HandleFunc("GET /v1/discussions/{id}/replies/{reply_id}/history", app.authenticateIfExists(app.requireCircleRoomAccess(app.replyHistoryHandler)))
+mux.HandleFunc("POST /v1/discussions/{id}/replies/{reply_id}/reactions", app.requireAuth(app.requireCircleRoomAccess(app.toggleReactionHandler)))
+
+// Study Circles
+mux.HandleFunc("GET /v1/circles", app.requireAuth(app.listCirclesHandler))
+mux.HandleFunc("POST /v1/circles", app.requireAuth(app.createCircleHandler))
+mux.HandleFunc("POST /v1/circles/join", app.requireAuth(app.joinCircleHandler))
+mux.HandleFunc("GET /v1/circles/{id}", app.requireAuth(app.showCircleHandler))
+mux.HandleFunc("PATCH /v1/circles/{id}", app.requireAuth(app.updateCircleHandler))
+mux.HandleFunc("DELETE /v1/circles/{id}", app.requireAuth(app.deleteCircleHandler))
+mux.HandleFunc("POST /v1/circles/{id}/invite-code", app.requireAuth(app.resetInviteCodeHandler))
+mux.HandleFunc("GET /v1/circles/{id}/roster", app.requireAuth(app.circleRosterHandler))
+mux.HandleFunc("PUT /v1/circles/{id}/members/{user_id}", app.requireAuth(app.setCircleRoleHandler))
+mux.HandleFunc("DELETE /v1/circles/{id}/members/{user_id}", app.requireAuth(app.removeCircleMemberHandler))
+mux.HandleFunc("GET /v1/admin/teachers", app.requireAuth(app.requireAdmin(app.listTeachersHandler)))
+mux.HandleFunc("PUT /v1/admin/teachers/{id}", app.requireAuth(app.requireAdmin(app.approveTeacherHandler)))
+mux.HandleFunc("DELETE /v1/admin/teachers/{id}", app.requireAuth(app.requireAdmin(app.revokeTeacherHandler)))
+
+// Moderation
+mux.HandleFunc("POST /v1/reports", app.requireAuth(app.createReportHandler))
+mux.HandleFunc("GET /v1/moderation/queue", app.requireAuth(app.requireModerator(app.moderationQueueHandler))) // ?type=
+mux.HandleFunc("POST /v1/moderation/actions", app.requireAuth(app.requireModerator(app.moderationActionHandler)))
+mux.HandleFunc("GET /v1/moderation/actions", app.requireAuth(app.requireModerator(app.listModerationActionsHandler))) // ?user_id=&content_id=
+mux.HandleFunc("GET /v1/moderation/users/{id}/sanctions", app.requireAuth(app.requireModerator(app.listUserSanctionsHandler)))
+mux.HandleFunc("GET /v1/moderation/blocked-terms", app.requireAuth(app.requireModerator(app.listBlockedTermsHandler)))
+mux.HandleFunc("POST /v1/moderation/blocked-terms", app.requireAuth(app.requireModerator(app.createBlockedTermHandler)))
+mux.HandleFunc("DELETE /v1/moderation/blocked-terms/{id}", app.requireAuth(app.requireModerator(app.deleteBlockedTermHandler)))
 
 // Real-time Chat
+mux.HandleFunc("POST /v1/ws/tickets", app.requireAuth(app.createChatTicketHandler))
 mux.HandleFunc("GET /v1/ws/chat/{id}", func(w http.ResponseWriter, r *http.Request) {
     app.serveWs(app.hub, w, r)
 })
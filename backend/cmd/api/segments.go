@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/draqist/iqraa/backend/internal/youtube"
+)
+
+// detectSegmentsHandler reads the video's YouTube description, parses its
+// timestamp list and stores the entries as segments pending review.
+// POST /v1/resources/{id}/segments/detect
+func (app *application) detectSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	video, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	videoID := youtube.VideoIDFromURL(video.URL)
+	if video.SourceVideoID != nil {
+		videoID = *video.SourceVideoID
+	}
+	if video.Type != "youtube_video" || video.IsSegment || videoID == "" {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "Segments can only be detected for YouTube videos")
+		return
+	}
+
+	description, err := app.youtube.VideoDescription(r.Context(), videoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, youtube.ErrQuotaExceeded):
+			app.errorResponse(w, http.StatusTooManyRequests, "YouTube quota exhausted for today, try again tomorrow")
+		case errors.Is(err, youtube.ErrNotFound):
+			app.errorResponse(w, http.StatusNotFound, "YouTube video not found or private")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	chapters := youtube.ParseChapters(description)
+	if len(chapters) == 0 {
+		app.errorResponse(w, http.StatusUnprocessableEntity, "No timestamp list found in the video description")
+		return
+	}
+
+	drafts := make([]data.SegmentDraft, len(chapters))
+	for i, c := range chapters {
+		end := 0
+		if i+1 < len(chapters) {
+			end = chapters[i+1].StartSeconds
+		} else if video.DurationSeconds != nil {
+			end = *video.DurationSeconds
+		}
+		drafts[i] = data.SegmentDraft{
+			Title:        c.Title,
+			URL:          fmt.Sprintf("%s&t=%ds", youtube.WatchURL(videoID), c.StartSeconds),
+			StartSeconds: c.StartSeconds,
+			EndSeconds:   end,
+		}
+	}
+
+	if err := app.models.Segments.ReplaceDrafts(video, drafts, userID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	segments, err := app.models.Segments.GetForVideo(video.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.hideStorageURLs(segments...)
+	app.writeJSON(w, http.StatusOK, envelope{"segments": segments}, nil)
+}
+
+// listSegmentsHandler returns every segment of a video, including those awaiting review.
+// GET /v1/resources/{id}/segments
+func (app *application) listSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	segments, err := app.models.Segments.GetForVideo(r.PathValue("id"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.hideStorageURLs(segments...)
+	app.writeJSON(w, http.StatusOK, envelope{"segments": segments}, nil)
+}
+
+// reviewSegmentsHandler publishes or rejects pending segments. Titles and
+// boundaries can be corrected beforehand through PUT /v1/resources/{id}.
+// POST /v1/resources/{id}/segments/review
+func (app *application) reviewSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	video, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	var input struct {
+		Action     string   `json:"action"`
+		SegmentIDs []string `json:"segment_ids"` // empty = all pending
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Action, "publish", "reject"), "action", "must be publish or reject")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	status := "published"
+	if input.Action == "reject" {
+		status = "rejected"
+	}
+
+	n, err := app.models.Segments.Review(video, input.SegmentIDs, status, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"reviewed": n, "status": status}, nil)
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/validator"
 )
 
 // joinCohortHandler assigns a user to a cohort for a specific roadmap.
@@ -45,40 +50,118 @@ func (app *application) joinCohortHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Members joining mid-roadmap start from the progress they already have.
+	if err := app.models.Social.RefreshCohortProgress(userID, roadmapID); err != nil {
+		app.logger.Println(err)
+	}
+
+	schedule, err := app.cohortSchedule(cohort)
+	if err != nil {
+		app.logger.Println(err)
+		app.errorResponse(w, http.StatusInternalServerError, "Failed to build schedule")
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"message":   "Joined cohort successfully",
 		"cohort_id": cohort.ID,
 		"pace":      cohort.Pace,
+		"schedule":  schedule,
 	})
 }
 
-// getPartnerHandler retrieves the current accountability partner for the user.
-// GET /v1/partners
-func (app *application) getPartnerHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	if !ok || userID == "" {
-		app.errorResponse(w, http.StatusUnauthorized, "Unauthorized")
+// cohortSchedule builds the schedule of a cohort from its roadmap's nodes.
+func (app *application) cohortSchedule(cohort *data.Cohort) (*data.CohortSchedule, error) {
+	roadmap, err := app.models.Roadmaps.GetByID(cohort.RoadmapID)
+	if err != nil {
+		return nil, err
+	}
+	return data.BuildSchedule(cohort.StartDate, cohort.Pace, roadmap.Nodes)
+}
+
+// getCohortHandler returns the user's cohort for a roadmap: its weekly
+// schedule, where the user stands against it, and every member's status.
+// GET /v1/roadmaps/{id}/cohort
+func (app *application) getCohortHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	cohort, err := app.models.Social.GetUserCohort(userID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "You have not joined a cohort for this roadmap")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	partner, err := app.models.Social.GetPartner(userID)
+	schedule, err := app.cohortSchedule(cohort)
 	if err != nil {
-		app.errorResponse(w, http.StatusInternalServerError, "Failed to get partner")
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"partner": partner,
-	})
+	members, err := app.models.Social.GetCohortMembers(cohort.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	expected := schedule.ExpectedCompleted(now)
+	total := len(schedule.Nodes)
+
+	var me *data.CohortMember
+	for _, m := range members {
+		m.ExpectedNodes = expected
+		m.Status = data.PaceStatus(m.CompletedNodes, expected, total)
+		if m.UserID == userID {
+			me = m
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"cohort":       cohort,
+		"current_week": schedule.CurrentWeek(now),
+		"schedule":     schedule,
+		"me":           me,
+		"members":      members,
+	}, nil)
+}
+
+// maxPartners caps a user's partners and the pending invites they sent.
+const maxPartners = 10
+
+// listPartnersHandler lists the user's accountability partners and invites,
+// with shared streaks and today's check-ins. "partner" is the first
+// accepted partner, for clients built when there could only be one.
+// GET /v1/partners
+func (app *application) listPartnersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	partners, err := app.models.Social.GetPartners(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var first *data.Partner
+	for _, p := range partners {
+		if p.Status == "accepted" {
+			first = p
+			break
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"partners": partners, "partner": first}, nil)
 }
 
 // invitePartnerHandler sends a partnership invitation to another user.
 // POST /v1/partners/invite
 func (app *application) invitePartnerHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(UserContextKey).(string)
-	if !ok || userID == "" {
+	user := app.contextGetUser(r)
+	if user == nil {
 		app.errorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
@@ -91,27 +174,63 @@ func (app *application) invitePartnerHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err := app.models.Social.InvitePartner(userID, input.TargetUserID)
+	if _, err := app.models.Users.GetByID(input.TargetUserID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "User not found")
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	count, err := app.models.Social.CountPartners(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if count >= maxPartners {
+		app.errorResponse(w, http.StatusConflict, fmt.Sprintf("You can have at most %d partners and invites", maxPartners))
+		return
+	}
+
+	partnerID, err := app.models.Social.InvitePartner(user.ID, input.TargetUserID)
 	if err != nil {
-		app.errorResponse(w, http.StatusInternalServerError, "Failed to invite partner")
+		switch {
+		case errors.Is(err, data.ErrSelfPartner):
+			app.errorResponse(w, http.StatusBadRequest, "You cannot invite yourself")
+		case errors.Is(err, data.ErrDuplicatePartner):
+			app.errorResponse(w, http.StatusConflict, "You are already partners, or an invite is pending")
+		default:
+			app.errorResponse(w, http.StatusInternalServerError, "Failed to invite partner")
+		}
 		return
 	}
 
+	payload, _ := json.Marshal(map[string]string{"partner_id": partnerID, "user_id": user.ID})
 	app.models.Notifications.Insert(&data.Notification{
 		UserID:  input.TargetUserID,
 		Type:    "partner_invite",
 		Title:   "New Partner Request",
-		Message: "Someone wants to be your accountability partner!",
-		Data:    json.RawMessage(`{}`),
+		Message: fmt.Sprintf("%s wants to be your accountability partner!", displayName(user)),
+		Data:    payload,
 	})
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Invite sent"}`))
+	app.writeJSON(w, http.StatusOK, envelope{"message": "Invite sent", "partner_id": partnerID}, nil)
 }
 
 // acceptPartnerHandler accepts a pending partnership invitation.
 // POST /v1/partners/accept
 func (app *application) acceptPartnerHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerPartnerInvite(w, r, true)
+}
+
+// declinePartnerHandler declines a pending partnership invitation.
+// POST /v1/partners/decline
+func (app *application) declinePartnerHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerPartnerInvite(w, r, false)
+}
+
+func (app *application) answerPartnerInvite(w http.ResponseWriter, r *http.Request, accept bool) {
 	userID, ok := r.Context().Value(UserContextKey).(string)
 	if !ok || userID == "" {
 		app.errorResponse(w, http.StatusUnauthorized, "Unauthorized")
@@ -126,12 +245,193 @@ func (app *application) acceptPartnerHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err := app.models.Social.AcceptPartner(userID, input.PartnerID)
+	var err error
+	if accept {
+		err = app.models.Social.AcceptPartner(userID, input.PartnerID)
+	} else {
+		err = app.models.Social.DeclinePartner(userID, input.PartnerID)
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Invite not found or already answered")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !accept {
+		app.writeJSON(w, http.StatusOK, envelope{"message": "Partner declined"}, nil)
+		return
+	}
+
+	partner, err := app.models.Social.GetPartnership(userID, input.PartnerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]string{"partner_id": partner.ID, "user_id": userID})
+	app.models.Notifications.Insert(&data.Notification{
+		UserID:  partner.UserID,
+		Type:    "partner_accepted",
+		Title:   "Partner Request Accepted",
+		Message: "Your accountability partner request was accepted!",
+		Data:    payload,
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "Partner accepted", "partner": partner}, nil)
+}
+
+// removePartnerHandler ends a partnership, or withdraws an invite.
+// DELETE /v1/partners/{id}
+func (app *application) removePartnerHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	err := app.models.Social.RemovePartner(userID, r.PathValue("id"))
 	if err != nil {
-		app.errorResponse(w, http.StatusInternalServerError, "Failed to accept invite")
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Partner not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Partner accepted"}`))
-}
\ No newline at end of file
+	app.writeJSON(w, http.StatusOK, envelope{"message": "Partner removed"}, nil)
+}
+
+// acceptedPartnership loads the user's {id} partnership and checks that it
+// has been accepted. It writes the error response itself and returns nil
+// on failure.
+func (app *application) acceptedPartnership(w http.ResponseWriter, r *http.Request) *data.Partner {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	partner, err := app.models.Social.GetPartnership(userID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Partner not found")
+			return nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	if partner.Status != "accepted" {
+		app.errorResponse(w, http.StatusConflict, "This partnership has not been accepted")
+		return nil
+	}
+	return partner
+}
+
+// updatePartnerGoalHandler changes the daily goal both partners check in on.
+// PATCH /v1/partners/{id}
+func (app *application) updatePartnerGoalHandler(w http.ResponseWriter, r *http.Request) {
+	partner := app.acceptedPartnership(w, r)
+	if partner == nil {
+		return
+	}
+
+	var input struct {
+		Goal string `json:"goal"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	input.Goal = strings.TrimSpace(input.Goal)
+
+	v := validator.New()
+	v.Check(input.Goal != "", "goal", "must be provided")
+	v.Check(len(input.Goal) <= 200, "goal", "must not be more than 200 characters")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Social.SetPartnerGoal(partner.ID, input.Goal); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	partner.Goal = input.Goal
+
+	app.writeJSON(w, http.StatusOK, envelope{"partner": partner}, nil)
+}
+
+// partnerCheckInHandler records whether the user met the partnership's goal
+// today, and lets the partner know when they did.
+// POST /v1/partners/{id}/checkins
+func (app *application) partnerCheckInHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == nil {
+		app.errorResponse(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	partner := app.acceptedPartnership(w, r)
+	if partner == nil {
+		return
+	}
+
+	var input struct {
+		Done *bool  `json:"done"`
+		Note string `json:"note"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Done != nil, "done", "must be provided")
+	v.Check(len(input.Note) <= 500, "note", "must not be more than 500 characters")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	checkIn, err := app.models.Social.CheckIn(partner.ID, user.ID, *input.Done, input.Note)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only the first "done" of the day is worth a notification.
+	if checkIn.Done && !partner.CheckedInToday {
+		payload, _ := json.Marshal(map[string]string{"partner_id": partner.ID, "user_id": user.ID})
+		app.models.Notifications.Insert(&data.Notification{
+			UserID:  partner.UserID,
+			Type:    "partner_checkin",
+			Title:   "Partner Checked In",
+			Message: fmt.Sprintf("%s met today's goal: %s", displayName(user), partner.Goal),
+			Data:    payload,
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"checkin": checkIn}, nil)
+}
+
+// listPartnerCheckInsHandler lists both partners' check-ins of the last
+// days (14 by default, at most 90).
+// GET /v1/partners/{id}/checkins?days=
+func (app *application) listPartnerCheckInsHandler(w http.ResponseWriter, r *http.Request) {
+	partner := app.acceptedPartnership(w, r)
+	if partner == nil {
+		return
+	}
+
+	v := validator.New()
+	days := app.readInt(r.URL.Query(), "days", 14, v)
+	v.Check(days >= 1 && days <= 90, "days", "must be between 1 and 90")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	checkIns, err := app.models.Social.GetCheckIns(partner.ID, days)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"partner": partner, "checkins": checkIns}, nil)
+}
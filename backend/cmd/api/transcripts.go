@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/draqist/iqraa/backend/internal/subtitles"
+	"github.com/draqist/iqraa/backend/internal/validator"
+	"github.com/draqist/iqraa/backend/internal/youtube"
+)
+
+// isStaff reports whether the user can see content that is still in review.
+func isStaff(user *data.User) bool {
+	if user == nil {
+		return false
+	}
+	switch user.Role {
+	case "admin", "super_admin", "moderator":
+		return true
+	}
+	return false
+}
+
+// listTranscriptsHandler lists the transcripts available for a resource.
+// GET /v1/resources/{id}/transcripts
+func (app *application) listTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if _, ok := app.authorizeMedia(w, r, user); !ok {
+		return
+	}
+
+	transcripts, err := app.models.Transcripts.GetForResource(r.PathValue("id"), !isStaff(user))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"transcripts": transcripts}, nil)
+}
+
+// showTranscriptHandler returns a transcript with its cues, or the file itself
+// with ?format=vtt|srt for use as a <track> source.
+// GET /v1/resources/{id}/transcripts/{lang}
+func (app *application) showTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if _, ok := app.authorizeMedia(w, r, user); !ok {
+		return
+	}
+
+	t, err := app.models.Transcripts.Get(r.PathValue("id"), r.PathValue("lang"))
+	if err != nil || (t.Status != "published" && !isStaff(user)) {
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.errorResponse(w, http.StatusNotFound, "Transcript not found")
+		return
+	}
+
+	format := subtitles.Format(r.URL.Query().Get("format"))
+	if format != subtitles.VTT && format != subtitles.SRT {
+		app.writeJSON(w, http.StatusOK, envelope{"transcript": t}, nil)
+		return
+	}
+
+	cues := make([]subtitles.Cue, len(t.Cues))
+	for i, c := range t.Cues {
+		cues[i] = subtitles.Cue{
+			Start: time.Duration(c.StartMs) * time.Millisecond,
+			End:   time.Duration(c.EndMs) * time.Millisecond,
+			Text:  c.Text,
+		}
+	}
+
+	if format == subtitles.VTT {
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.%s.%s"`, t.ResourceID, t.Language, format))
+	subtitles.Write(w, cues, format)
+}
+
+// saveTranscriptHandler uploads or edits a transcript. The body is either a
+// WebVTT/SRT file (raw or multipart field "file") or JSON {"cues": [...]}
+// from the transcript editor. Like resources, only super admins publish
+// directly; other edits go back to pending_review.
+// PUT /v1/resources/{id}/transcripts/{lang}
+func (app *application) saveTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	res, err := app.models.Resources.Get(r.PathValue("id"))
+	if err != nil {
+		app.errorResponse(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	language := r.PathValue("lang")
+
+	v := validator.New()
+	v.Check(res.Type == "youtube_video" || res.Type == "audio", "resource", "transcripts can only be attached to videos and audio")
+	v.Check(len(language) >= 2 && len(language) <= 10, "language", "must be a language code such as ar or en")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cues, format, err := app.readTranscript(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	t := &data.Transcript{
+		ResourceID:   res.ID,
+		Language:     language,
+		SourceFormat: string(format),
+		Status:       "pending_review",
+		CreatedBy:    &userID,
+	}
+	if user.Role == "super_admin" {
+		t.Status = "published"
+		t.ReviewerID = &userID
+	}
+
+	if err := app.models.Transcripts.Save(t, cues); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"transcript": t}, nil)
+}
+
+// readTranscript decodes the request body into cues.
+func (app *application) readTranscript(w http.ResponseWriter, r *http.Request) ([]data.TranscriptCue, subtitles.Format, error) {
+	contentType := r.Header.Get("Content-Type")
+
+	if strings.HasPrefix(contentType, "application/json") {
+		var input struct {
+			Format string               `json:"format"`
+			Cues   []data.TranscriptCue `json:"cues"`
+		}
+		if err := app.readJSON(w, r, &input); err != nil {
+			return nil, "", err
+		}
+		if len(input.Cues) == 0 {
+			return nil, "", subtitles.ErrNoCues
+		}
+		for i, c := range input.Cues {
+			if c.StartMs < 0 || c.EndMs < c.StartMs || strings.TrimSpace(c.Text) == "" {
+				return nil, "", fmt.Errorf("cue %d: invalid timing or empty text", i+1)
+			}
+		}
+		format := subtitles.VTT
+		if input.Format == string(subtitles.SRT) {
+			format = subtitles.SRT
+		}
+		return input.Cues, format, nil
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, 5<<20)
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		if err := r.ParseMultipartForm(5 << 20); err != nil {
+			return nil, "", errors.New("file too large or invalid form")
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("missing file")
+		}
+		defer file.Close()
+		body = file
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	parsed, format, err := subtitles.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", err
+	}
+
+	cues := make([]data.TranscriptCue, len(parsed))
+	for i, c := range parsed {
+		cues[i] = data.TranscriptCue{
+			StartMs: int(c.Start.Milliseconds()),
+			EndMs:   int(c.End.Milliseconds()),
+			Text:    c.Text,
+		}
+	}
+	return cues, format, nil
+}
+
+// deleteTranscriptHandler removes a transcript.
+// DELETE /v1/resources/{id}/transcripts/{lang}
+func (app *application) deleteTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Transcripts.Delete(r.PathValue("id"), r.PathValue("lang"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Transcript not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"message": "transcript deleted"}, nil)
+}
+
+// reviewTranscriptHandler publishes or rejects a transcript.
+// POST /v1/transcripts/{id}/review
+func (app *application) reviewTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserContextKey).(string)
+
+	var input struct {
+		Action string `json:"action"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Action, "publish", "reject"), "action", "must be publish or reject")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	status := "published"
+	if input.Action == "reject" {
+		status = "rejected"
+	}
+
+	if err := app.models.Transcripts.SetStatus(r.PathValue("id"), status, userID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, http.StatusNotFound, "Transcript not found")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"status": status}, nil)
+}
+
+// searchTranscriptsHandler finds the moments in lectures where a phrase is said.
+// Each hit carries a link that opens the resource at the cue's timestamp.
+// GET /v1/transcripts/search?q=...&book_id=...
+func (app *application) searchTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	bookID := app.readString(qs, "book_id", "")
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+
+	v.Check(len([]rune(q)) >= 2, "q", "must be at least 2 characters")
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	hits, metadata, err := app.models.Transcripts.Search(q, bookID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type result struct {
+		*data.TranscriptHit
+		StartSeconds int    `json:"start_seconds"`
+		Link         string `json:"link"`
+	}
+
+	results := make([]result, len(hits))
+	for i, h := range hits {
+		start := h.StartMs / 1000
+		url := h.ResourceURL
+		if _, ok := app.storageKey(url); ok {
+			url = mediaURL(h.ResourceID)
+		}
+		results[i] = result{TranscriptHit: h, StartSeconds: start, Link: timestampLink(h.ResourceType, url, start)}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+}
+
+// timestampLink points at a moment inside a resource: YouTube's t parameter
+// for videos, a media fragment (#t=) for audio.
+func timestampLink(resourceType, url string, seconds int) string {
+	if resourceType == "youtube_video" {
+		if id := youtube.VideoIDFromURL(url); id != "" {
+			return fmt.Sprintf("%s&t=%ds", youtube.WatchURL(id), seconds)
+		}
+	}
+	if i := strings.IndexByte(url, '#'); i >= 0 {
+		url = url[:i]
+	}
+	return fmt.Sprintf("%s#t=%d", url, seconds)
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/draqist/iqraa/backend/internal/auth"
+	"github.com/draqist/iqraa/backend/internal/cache"
 	"github.com/draqist/iqraa/backend/internal/data"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -23,22 +30,72 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	maxMessageSize = 4096
+
+	// Messages sent per backfill frame.
+	backfillPageSize = 100
+
+	// Minimum time between two typing events from the same client.
+	typingInterval = 2 * time.Second
+)
+
+// Chat event types. Clients send message, typing and backfill frames; the
+// server sends all of them except typing to the client that caused them.
+const (
+	eventMessage  = "message"
+	eventTyping   = "typing"
+	eventPresence = "presence"
+	eventJoin     = "join"
+	eventLeave    = "leave"
+	eventBackfill = "backfill"
+	eventAck      = "ack"
+	eventError    = "error"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	// Create a custom CheckOrigin function to allow cross-origin requests
-	CheckOrigin: func(r *http.Request) bool {
-		return true // In production, replace this with a proper check!
-	},
+// chatEvent is the envelope of every frame the server sends. ClientID echoes
+// the ID a client gave its own message, so it can match acks and errors.
+type chatEvent struct {
+	Type     string    `json:"type"`
+	ClientID string    `json:"client_id,omitempty"`
+	Data     any       `json:"data,omitempty"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// chatCommand is a frame sent by a client.
+type chatCommand struct {
+	Type       string `json:"type"`
+	ClientID   string `json:"client_id"`
+	Body       string `json:"body"`
+	ParentID   string `json:"parent_id"`
+	LastSeenID string `json:"last_seen_id"`
+	BeforeID   string `json:"before_id"`
+}
+
+// chatUser identifies a room member in typing, presence, join and leave events.
+type chatUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// chatError is the payload of an error event.
+type chatError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func encodeEvent(eventType, clientID string, payload any) []byte {
+	msg, _ := json.Marshal(chatEvent{Type: eventType, ClientID: clientID, Data: payload, SentAt: time.Now().UTC()})
+	return msg
 }
 
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	hub *Hub
 
+	// Identifies the connection across instances, so an event can skip it.
+	id string
+
 	// The websocket connection.
 	conn *websocket.Conn
 
@@ -47,48 +104,88 @@ type Client struct {
 
 	// The specific chat room (discussion ID) this client belongs to
 	roomID string
-	
+
 	// User info
-	userID   string
-	userName string
-	userRole string
+	user chatUser
+
+	// When this client last announced it was typing.
+	lastTyping time.Time
+}
+
+// roomEvent is an encoded event for every client in a room, except the one
+// with skipID.
+type roomEvent struct {
+	RoomID  string          `json:"room_id"`
+	Payload json.RawMessage `json:"payload"`
+	SkipID  string          `json:"skip_id,omitempty"`
 }
 
 // Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+// clients. With Redis available, room events and presence are shared with
+// the hubs of the other API instances (see chatrelay.go).
 type Hub struct {
 	// Registered clients.
 	clients map[*Client]bool
 
-	// Inbound messages from the clients.
-	broadcast chan *data.Reply
+	// Events for the local clients of a room.
+	broadcast chan roomEvent
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
-	
+
+	// Joins and leaves for presenceLoop.
+	presence chan presenceOp
+
 	app *application
-	
+
+	// Shared with the other instances; nil runs the hub on its own.
+	cache *cache.Service
+
+	// Identifies this instance's presence entries.
+	instanceID string
+
+	// Whether this instance is listening to the other instances' events.
+	subscribed atomic.Bool
+
+	// Upgrades chat requests from trusted origins to websockets.
+	upgrader websocket.Upgrader
+
 	// Rooms maps roomID -> Set of Clients
 	rooms map[string]map[*Client]bool
-	
+
 	mu sync.RWMutex
 }
 
 func newHub(app *application) *Hub {
 	return &Hub{
-		broadcast:  make(chan *data.Reply),
+		broadcast:  make(chan roomEvent),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		presence:   make(chan presenceOp, presenceQueueSize),
 		clients:    make(map[*Client]bool),
 		rooms:      make(map[string]map[*Client]bool),
 		app:        app,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     app.checkChatOrigin,
+		},
+		cache:      app.models.Community.Cache,
+		instanceID: uuid.NewString(),
 	}
 }
 
+// run owns the local client and room sets. It does no network I/O:
+// presence goes through presenceLoop and events through send.
 func (h *Hub) run() {
+	if h.cache != nil {
+		go h.listen()
+	}
+	go h.presenceLoop()
+
 	for {
 		select {
 		case client := <-h.register:
@@ -98,6 +195,7 @@ func (h *Hub) run() {
 				h.rooms[client.roomID] = make(map[*Client]bool)
 			}
 			h.rooms[client.roomID][client] = true
+			h.queuePresence(presenceOp{client: client, joined: true})
 			h.mu.Unlock()
 
 		case client := <-h.unregister:
@@ -105,97 +203,199 @@ func (h *Hub) run() {
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
-				
+
 				if room, ok := h.rooms[client.roomID]; ok {
 					delete(room, client)
 					if len(room) == 0 {
 						delete(h.rooms, client.roomID)
 					}
 				}
+				if !h.inRoomLocked(client.roomID, client.user.ID) {
+					h.queuePresence(presenceOp{client: client})
+				}
 			}
 			h.mu.Unlock()
 
-		case reply := <-h.broadcast:
+		case event := <-h.broadcast:
 			h.mu.Lock()
-			// Broadcast only to clients in the same room
-			if room, ok := h.rooms[reply.DiscussionID]; ok {
-				for client := range room {
-					select {
-					case client.send <- []byte(reply.Body): // Ideally send JSON Structure
-						// TODO: Send full payload
-						// For now we just signal strict update
-					default:
-						close(client.send)
-						delete(h.clients, client)
-						delete(room, client)
-					}
-				}
-			}
+			h.broadcastLocked(event)
 			h.mu.Unlock()
 		}
 	}
 }
 
-// serveWs handles websocket requests from the peer.
-func (app *application) serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	// 1. Authentication (WebSockets cannot set headers easily, so we use Query Params)
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		// Fallback to Header if present (e.g. from non-browser clients)
-		authHeader := r.Header.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			token = strings.TrimPrefix(authHeader, "Bearer ")
+// publish sends an event to every client in a room, on every instance.
+func (h *Hub) publish(roomID, eventType string, payload any) {
+	h.send(roomEvent{RoomID: roomID, Payload: encodeEvent(eventType, "", payload)})
+}
+
+// send relays an event to the room on every instance, or straight to the
+// local clients when Redis is not available. It must not be called from run.
+func (h *Hub) send(event roomEvent) {
+	if !h.relay(event) {
+		h.broadcast <- event
+	}
+}
+
+// broadcastLocked delivers an event to the local clients of a room. h.mu
+// must be held.
+func (h *Hub) broadcastLocked(event roomEvent) {
+	for client := range h.rooms[event.RoomID] {
+		if client.id != event.SkipID {
+			h.deliverLocked(client, event.Payload)
 		}
 	}
+}
 
-	if token == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// deliverLocked queues a frame for a client. A client that is not keeping up
+// is disconnected; its readPump then unregisters it. h.mu must be held.
+func (h *Hub) deliverLocked(client *Client, payload []byte) {
+	select {
+	case client.send <- payload:
+	default:
+		client.conn.Close()
 	}
+}
 
-	claims, err := auth.ValidateToken(token)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// inRoomLocked reports whether a user has a local connection in a room.
+// h.mu must be held.
+func (h *Hub) inRoomLocked(roomID, userID string) bool {
+	for client := range h.rooms[roomID] {
+		if client.user.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// localPresenceLocked returns the users connected to a room on this
+// instance, keyed by ID. h.mu must be held (a read lock is enough).
+func (h *Hub) localPresenceLocked(roomID string) map[string]chatUser {
+	users := make(map[string]chatUser)
+	for client := range h.rooms[roomID] {
+		users[client.user.ID] = client.user
+	}
+	return users
+}
+
+// localPresence is localPresenceLocked for callers not holding h.mu.
+func (h *Hub) localPresence(roomID string) map[string]chatUser {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.localPresenceLocked(roomID)
+}
+
+// Presence returns the users connected to a room across all instances.
+func (h *Hub) Presence(roomID string) []chatUser {
+	users := h.remotePresence(roomID)
+	for id, u := range h.localPresence(roomID) {
+		users[id] = u
+	}
+	return sortedUsers(users)
+}
+
+func sortedUsers(users map[string]chatUser) []chatUser {
+	list := make([]chatUser, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// serveWs handles websocket requests from the peer. Browsers authenticate
+// with a one-time ?ticket= from POST /v1/ws/tickets; other clients may send
+// their token in the Authorization header instead. ?last_seen_id= resumes
+// the room's history after the last message the client has.
+func (app *application) serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("id")
+
+	// 1. Authentication
+	var userID string
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		hash := sha256.Sum256([]byte(ticket))
+		ticketUserID, ticketRoomID, err := app.models.Community.RedeemChatTicket(hash[:])
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if err != nil || ticketRoomID != roomID {
+			app.errorResponse(w, http.StatusUnauthorized, "Invalid or expired ticket")
+			return
+		}
+		userID = ticketUserID
+	} else if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		claims, err := auth.ValidateToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			app.errorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		userID = claims.UserID
+	} else {
+		app.errorResponse(w, http.StatusUnauthorized, "A ticket is required")
 		return
 	}
 
 	// 2. Fetch User Details
-	user, err := app.models.Users.GetByID(claims.UserID)
+	user, err := app.models.Users.GetByID(userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		app.errorResponse(w, http.StatusUnauthorized, "User not found")
 		return
 	}
 
-	// 3. Upgrade Connection
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println(err)
+	// 3. Room authorization
+	if !app.authorizeChatRoom(w, r, user, roomID) {
 		return
 	}
-	
-	roomID := r.PathValue("id")
-	if roomID == "" {
-		log.Println("No room ID provided")
-		conn.Close()
+
+	// 4. Upgrade Connection (the upgrader rejects untrusted origins)
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
 		return
 	}
 
 	client := &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		roomID:   roomID,
-		userID:   user.ID,
-		userName: user.Name,
-		userRole: user.Role,
+		hub:    hub,
+		id:     uuid.NewString(),
+		conn:   conn,
+		send:   make(chan []byte, 256),
+		roomID: roomID,
+		user:   chatUser{ID: user.ID, Name: user.Name, Role: user.Role},
 	}
-	
+
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
 	go client.writePump()
-	go client.readPump()
+	go client.readPump(r.URL.Query().Get("last_seen_id"))
+}
+
+// emit queues an event for this client alone, without blocking the reader
+// if the client is not keeping up.
+func (c *Client) emit(eventType, clientID string, payload any) {
+	select {
+	case c.send <- encodeEvent(eventType, clientID, payload):
+	default:
+	}
+}
+
+func (c *Client) emitError(clientID, code, message string) {
+	c.emit(eventError, clientID, chatError{Code: code, Message: message})
+}
+
+// backfill sends one page of the room's history after lastSeenID or before
+// beforeID (the latest messages when both are empty). Clients ask for newer
+// pages while has_more is set and for older ones while has_older is.
+func (c *Client) backfill(clientID, lastSeenID, beforeID string) {
+	replies, more, older, err := c.hub.app.models.Community.GetReplyHistory(c.roomID, lastSeenID, beforeID, backfillPageSize)
+	if err != nil {
+		log.Printf("Failed to load history: %v", err)
+		c.emitError(clientID, "internal_error", "Could not load the history.")
+		return
+	}
+	c.emit(eventBackfill, clientID, map[string]any{"messages": replies, "has_more": more, "has_older": older})
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -203,7 +403,7 @@ func (app *application) serveWs(hub *Hub, w http.ResponseWriter, r *http.Request
 // The application runs readPump in a per-connection goroutine. The application
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
-func (c *Client) readPump() {
+func (c *Client) readPump(lastSeenID string) {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
@@ -211,41 +411,103 @@ func (c *Client) readPump() {
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	c.backfill("", lastSeenID, "")
+
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, frame, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
-		
-		// Handle Incoming Message
-		// 1. Save to DB
-		reply := &data.Reply{
-			DiscussionID: c.roomID,
-			UserID:       c.userID,
-			Body:         string(message),
+
+		var cmd chatCommand
+		if err := json.Unmarshal(frame, &cmd); err != nil {
+			c.emitError("", "bad_request", "Frames must be JSON objects.")
+			continue
 		}
-		
-		err = c.hub.app.models.Community.CreateReply(reply)
-		if err != nil {
+
+		switch cmd.Type {
+		case eventMessage:
+			c.handleMessage(cmd)
+		case eventTyping:
+			if time.Since(c.lastTyping) < typingInterval {
+				continue
+			}
+			c.lastTyping = time.Now()
+			c.hub.send(roomEvent{RoomID: c.roomID, Payload: encodeEvent(eventTyping, "", c.user), SkipID: c.id})
+		case eventBackfill:
+			c.backfill(cmd.ClientID, cmd.LastSeenID, cmd.BeforeID)
+		default:
+			c.emitError(cmd.ClientID, "bad_request", "Unknown event type.")
+		}
+	}
+}
+
+// handleMessage saves a chat message as a reply of the room's discussion,
+// acknowledges it to the sender and broadcasts it to the room.
+func (c *Client) handleMessage(cmd chatCommand) {
+	if strings.TrimSpace(cmd.Body) == "" {
+		c.emitError(cmd.ClientID, "validation_failed", "The message is empty.")
+		return
+	}
+
+	// 1. Mutes, bans and the blocked-term filter apply to chat too
+	problems, held, err := c.hub.app.checkPost(c.user.ID, map[string]string{"body": cmd.Body})
+	if err != nil {
+		log.Printf("Failed to check message: %v", err)
+		c.emitError(cmd.ClientID, "internal_error", "The message could not be sent.")
+		return
+	}
+	if msg, ok := problems["sanction"]; ok {
+		c.emitError(cmd.ClientID, "sanctioned", msg)
+		return
+	}
+	if problems != nil {
+		c.emitError(cmd.ClientID, "blocked_term", "Your message contains language that is not allowed.")
+		return
+	}
+
+	// 2. Save to DB
+	reply := &data.Reply{
+		DiscussionID: c.roomID,
+		ParentID:     cmd.ParentID,
+		UserID:       c.user.ID,
+		UserName:     c.user.Name,
+		UserRole:     c.user.Role,
+		Body:         cmd.Body,
+	}
+
+	err = c.hub.app.models.Community.CreateReply(reply)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			c.emitError(cmd.ClientID, "not_found", "The discussion or parent message no longer exists.")
+		case errors.Is(err, data.ErrReplyDeleted), errors.Is(err, data.ErrReplyTooDeep):
+			c.emitError(cmd.ClientID, "validation_failed", "You cannot reply to that message.")
+		default:
 			log.Printf("Failed to save message: %v", err)
-			continue
+			c.emitError(cmd.ClientID, "internal_error", "The message could not be sent.")
 		}
-		
-		// 2. Broadcast to Hub (Room)
-		// Ideally we broadcast the FULL `reply` object with created_at, user details etc. 
-		// But channels pass references.
-		// For MVP, let's just trigger a "fetch" signal or send the raw body. 
-		// Actually, let's just broadcast this newly created Reply object.
-		
-		// This part needs the Hub to handle *data.Reply broadcast, which I updated in `Hub` struct.
-		c.hub.broadcast <- reply
+		return
+	}
+	if held != nil {
+		c.hub.app.holdForReview(data.ContentReply, reply.ID, c.user.ID, held)
+		reply.Hidden = true
+	}
+
+	// 3. Acknowledge, then broadcast to the room. Held messages are only
+	// acknowledged; a moderator decides whether the room sees them.
+	c.emit(eventAck, cmd.ClientID, map[string]any{"id": reply.ID, "created_at": reply.CreatedAt, "held": reply.Hidden})
+	if !reply.Hidden {
+		c.hub.publish(c.roomID, eventMessage, reply)
 	}
 }
 
-// writePump pumps messages from the hub to the websocket connection.
+// writePump pumps messages from the hub to the websocket connection. Each
+// event goes out as its own frame.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -262,19 +524,7 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
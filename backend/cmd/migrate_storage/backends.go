@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Backend is a place objects can be read from and written to.
+// Every backend exposes its objects under a public base URL, which is how
+// resources in the database point at them.
+type Backend interface {
+	// Name identifies the backend in logs and the plan.
+	Name() string
+	// Key returns the object key for a public URL owned by this backend.
+	Key(rawURL string) (string, bool)
+	// URL returns the public URL of an object.
+	URL(key string) string
+	// Open streams an object.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores an object. body is seekable so uploads can be retried.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+}
+
+// newBackend builds a backend from a spec:
+//
+//	http        read-only; any http(s) URL (e.g. Supabase public links)
+//	r2          Cloudflare R2 from R2_ACCOUNT_ID/R2_ACCESS_KEY_ID/R2_SECRET_ACCESS_KEY
+//	s3          any S3-compatible store from <PREFIX>_S3_ENDPOINT, _S3_BUCKET,
+//	            _S3_ACCESS_KEY, _S3_SECRET_KEY, _S3_REGION and <PREFIX>_PUBLIC_URL
+//	fs:<dir>    local directory served at <PREFIX>_PUBLIC_URL
+//
+// prefix is SRC or DST depending on the side.
+func newBackend(spec, prefix string) (Backend, error) {
+	env := func(name string) string { return os.Getenv(prefix + "_" + name) }
+
+	switch {
+	case spec == "http":
+		return &httpBackend{client: &http.Client{Timeout: 10 * time.Minute}}, nil
+
+	case spec == "r2":
+		accountID := os.Getenv("R2_ACCOUNT_ID")
+		if accountID == "" {
+			return nil, errors.New("r2: R2_ACCOUNT_ID not set")
+		}
+		publicURL := env("PUBLIC_URL")
+		if publicURL == "" {
+			publicURL = "https://media.iqraa.space"
+		}
+		bucket := env("S3_BUCKET")
+		if bucket == "" {
+			bucket = "iqraa-assets"
+		}
+		return newS3Backend("r2",
+			fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID), "auto", bucket,
+			os.Getenv("R2_ACCESS_KEY_ID"), os.Getenv("R2_SECRET_ACCESS_KEY"), publicURL)
+
+	case spec == "s3":
+		region := env("S3_REGION")
+		if region == "" {
+			region = "auto"
+		}
+		if env("S3_BUCKET") == "" || env("PUBLIC_URL") == "" {
+			return nil, fmt.Errorf("s3: %s_S3_BUCKET and %s_PUBLIC_URL must be set", prefix, prefix)
+		}
+		return newS3Backend("s3", env("S3_ENDPOINT"), region, env("S3_BUCKET"),
+			env("S3_ACCESS_KEY"), env("S3_SECRET_KEY"), env("PUBLIC_URL"))
+
+	case strings.HasPrefix(spec, "fs:"):
+		dir := strings.TrimPrefix(spec, "fs:")
+		publicURL := env("PUBLIC_URL")
+		if publicURL == "" {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, err
+			}
+			publicURL = "file://" + abs
+		}
+		return &fsBackend{dir: dir, publicURL: strings.TrimRight(publicURL, "/")}, nil
+	}
+
+	return nil, fmt.Errorf("unknown backend %q", spec)
+}
+
+// httpBackend reads objects by plain GET. The key is the URL itself.
+type httpBackend struct {
+	client *http.Client
+}
+
+func (b *httpBackend) Name() string { return "http" }
+
+func (b *httpBackend) Key(rawURL string) (string, bool) {
+	return rawURL, strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")
+}
+
+func (b *httpBackend) URL(key string) string { return key }
+
+func (b *httpBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: status %d", key, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (b *httpBackend) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	return errors.New("http backend is read-only")
+}
+
+// s3Backend talks to any S3-compatible object store (R2, AWS, Supabase S3, MinIO).
+type s3Backend struct {
+	name      string
+	client    *s3.Client
+	bucket    string
+	publicURL string
+}
+
+func newS3Backend(name, endpoint, region, bucket, accessKey, secretKey, publicURL string) (*s3Backend, error) {
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("%s: access key and secret must be set", name)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &s3Backend{name: name, client: client, bucket: bucket, publicURL: strings.TrimRight(publicURL, "/")}, nil
+}
+
+func (b *s3Backend) Name() string { return b.name }
+
+func (b *s3Backend) Key(rawURL string) (string, bool) {
+	return keyUnder(b.publicURL, rawURL)
+}
+
+func (b *s3Backend) URL(key string) string { return b.publicURL + "/" + key }
+
+func (b *s3Backend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (b *s3Backend) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	return err
+}
+
+// fsBackend stores objects as files under a directory.
+type fsBackend struct {
+	dir       string
+	publicURL string
+}
+
+func (b *fsBackend) Name() string { return "fs" }
+
+func (b *fsBackend) Key(rawURL string) (string, bool) {
+	return keyUnder(b.publicURL, rawURL)
+}
+
+func (b *fsBackend) URL(key string) string { return b.publicURL + "/" + key }
+
+func (b *fsBackend) path(key string) (string, error) {
+	p := filepath.Join(b.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(b.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("fs: key %q escapes %s", key, b.dir)
+	}
+	return p, nil
+}
+
+func (b *fsBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (b *fsBackend) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp := p + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// keyUnder returns the object key of rawURL relative to base.
+func keyUnder(base, rawURL string) (string, bool) {
+	if base == "" || !strings.HasPrefix(rawURL, base+"/") {
+		return "", false
+	}
+	key := strings.TrimPrefix(rawURL, base+"/")
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	if unescaped, err := url.PathUnescape(key); err == nil {
+		key = unescaped
+	}
+	return key, key != ""
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stages an item moves through. An item that crashed or failed between
+// upload and the database update resumes at the update instead of
+// uploading again.
+const (
+	stageUploaded      = "uploaded"
+	stageDone          = "done"
+	stageFailed        = "failed"         // the copy failed
+	stageRepointFailed = "repoint_failed" // the copy is in place, the update failed
+)
+
+// checkpointEntry is the persisted state of one resource.
+type checkpointEntry struct {
+	Stage       string    `json:"stage"`
+	DestKey     string    `json:"dest_key,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	SizeBytes   int64     `json:"size_bytes,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// checkpoint is a JSON file keyed by resource ID, rewritten atomically after
+// every change so a crash never leaves it half written.
+type checkpoint struct {
+	path    string
+	mu      sync.Mutex
+	Entries map[string]*checkpointEntry `json:"entries"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Entries: map[string]*checkpointEntry{}}
+	if path == "" {
+		return cp, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, cp); err != nil {
+		return nil, err
+	}
+	if cp.Entries == nil {
+		cp.Entries = map[string]*checkpointEntry{}
+	}
+	return cp, nil
+}
+
+// get returns a copy of the entry for id, if any.
+func (cp *checkpoint) get(id string) (checkpointEntry, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	e, ok := cp.Entries[id]
+	if !ok {
+		return checkpointEntry{}, false
+	}
+	return *e, true
+}
+
+// set records the entry for id and persists the file.
+func (cp *checkpoint) set(id string, e checkpointEntry) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if e.Stage == stageFailed || e.Stage == stageRepointFailed {
+		e.Attempts = 1
+		if prev, ok := cp.Entries[id]; ok {
+			e.Attempts = prev.Attempts + 1
+		}
+	}
+	e.UpdatedAt = time.Now().UTC()
+	cp.Entries[id] = &e
+
+	if cp.path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
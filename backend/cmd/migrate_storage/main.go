@@ -0,0 +1,421 @@
+// Command migrate_storage copies resource files from one storage backend to
+// another and repoints the resources at their new URLs. With -repoint=false
+// it only copies, e.g. to take a backup, and leaves the resources alone.
+//
+//	go run ./cmd/migrate_storage -from http -to r2 -dry-run
+//	go run ./cmd/migrate_storage -from r2 -to fs:/backups/media -repoint=false -concurrency 8
+//
+// Repointing at a local directory needs DST_PUBLIC_URL, the address the
+// directory is served at; file:// URLs would break every hosted file.
+//
+// Files are streamed through a temp file, never held in memory, and their
+// SHA-256 is verified after upload. Progress is written to a checkpoint file
+// so an interrupted run resumes where it left off. The API's Redis caches of
+// each repointed resource and of its book's resource list are cleared, so
+// clients stop being served the old URL.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+	"github.com/draqist/iqraa/backend/internal/media"
+	"github.com/lib/pq"
+)
+
+// item is one resource file to migrate.
+type item struct {
+	ID      string
+	BookID  string
+	Title   string
+	URL     string
+	Type    string
+	SrcKey  string
+	DestKey string
+}
+
+type migrator struct {
+	db         *sql.DB
+	src, dst   Backend
+	checkpoint *checkpoint
+	cache      *cache.Service
+	copyOnly   bool
+	verify     bool
+	delay      time.Duration
+	logger     *log.Logger
+}
+
+func main() {
+	from := flag.String("from", "http", "source backend: http, r2, s3 or fs:<dir>")
+	to := flag.String("to", "r2", "destination backend: r2, s3 or fs:<dir>")
+	types := flag.String("types", "pdf,audio", "comma-separated resource types to migrate")
+	concurrency := flag.Int("concurrency", 4, "number of files transferred in parallel")
+	delay := flag.Duration("delay", 0, "pause between files per worker, to stay under source rate limits")
+	checkpointPath := flag.String("checkpoint", "migrate_storage.checkpoint.json", "checkpoint file (empty disables resume)")
+	maxAttempts := flag.Int("max-attempts", 3, "skip items that already failed this many times")
+	verify := flag.Bool("verify", true, "re-read each uploaded file and compare its SHA-256")
+	dryRun := flag.Bool("dry-run", false, "print the migration plan without copying anything")
+	limit := flag.Int("limit", 0, "migrate at most this many items (0 = all)")
+	repoint := flag.Bool("repoint", true, "point resources at the copies; false only copies the files")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	dbDSN := os.Getenv("DB_DSN")
+	if dbDSN == "" {
+		logger.Fatal("DB_DSN must be set")
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	src, err := newBackend(*from, "SRC")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	dst, err := newBackend(*to, "DST")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *repoint && strings.HasPrefix(*to, "fs:") && os.Getenv("DST_PUBLIC_URL") == "" {
+		logger.Fatal("refusing to repoint resources at file:// URLs: set DST_PUBLIC_URL, or pass -repoint=false to only copy")
+	}
+
+	db, err := sql.Open("postgres", dbDSN)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	cp, err := loadCheckpoint(*checkpointPath)
+	if err != nil {
+		logger.Fatalf("load checkpoint: %v", err)
+	}
+
+	// Same Redis as the API, whose cached resources are invalidated on repoint
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "redis://localhost:6379"
+	}
+	cacheSvc, err := cache.New(redisURL)
+	if err != nil && !*dryRun {
+		logger.Printf("WARNING: Redis unavailable, the API may serve old URLs for up to an hour: %v", err)
+	}
+
+	m := &migrator{db: db, src: src, dst: dst, checkpoint: cp, cache: cacheSvc, copyOnly: !*repoint, verify: *verify, delay: *delay, logger: logger}
+
+	items, err := m.plan(strings.Split(*types, ","))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// Drop items the checkpoint has finished or given up on
+	pending := items[:0]
+	for _, it := range items {
+		if e, ok := cp.get(it.ID); ok {
+			failed := e.Stage == stageFailed || e.Stage == stageRepointFailed
+			if e.Stage == stageDone || (failed && e.Attempts >= *maxAttempts) {
+				continue
+			}
+			// Copied already; only a repointing run has work left
+			if m.copyOnly && (e.Stage == stageUploaded || e.Stage == stageRepointFailed) {
+				continue
+			}
+		}
+		pending = append(pending, it)
+	}
+	if *limit > 0 && len(pending) > *limit {
+		pending = pending[:*limit]
+	}
+
+	if *dryRun {
+		m.printPlan(pending)
+		return
+	}
+
+	logger.Printf("migrating %d files from %s to %s with %d workers", len(pending), src.Name(), dst.Name(), *concurrency)
+	stats := m.run(pending, *concurrency)
+	logger.Printf("done: %d migrated, %d failed", stats.ok, stats.failed)
+
+	if stats.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// plan lists the resources whose file lives on the source backend and has
+// not yet been moved to the destination.
+func (m *migrator) plan(types []string) ([]*item, error) {
+	query := `
+		SELECT id::text, book_id::text, title, url, type::text
+		FROM resources
+		WHERE type::text = ANY($1)
+		ORDER BY created_at ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, pq.Array(types))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.ID, &it.BookID, &it.Title, &it.URL, &it.Type); err != nil {
+			return nil, err
+		}
+
+		if _, onDest := m.dst.Key(it.URL); onDest {
+			continue
+		}
+		srcKey, onSource := m.src.Key(it.URL)
+		if !onSource {
+			continue
+		}
+
+		it.SrcKey = srcKey
+		it.DestKey = m.destKey(&it)
+		items = append(items, &it)
+	}
+
+	return items, rows.Err()
+}
+
+// destKey keeps the object key when moving between buckets. Files coming
+// from arbitrary URLs are stored as <resource id>.<ext>, like the uploads handler.
+func (m *migrator) destKey(it *item) string {
+	if m.src.Name() != "http" {
+		return it.SrcKey
+	}
+
+	ext := strings.ToLower(path.Ext(strings.SplitN(it.URL, "?", 2)[0]))
+	if ext == "" || len(ext) > 5 {
+		ext = ".pdf"
+		if it.Type == "audio" {
+			ext = ".mp3"
+		}
+	}
+	return it.ID + ext
+}
+
+func (m *migrator) printPlan(items []*item) {
+	fmt.Printf("%d files to migrate from %s to %s\n\n", len(items), m.src.Name(), m.dst.Name())
+	for _, it := range items {
+		state := "new"
+		if e, ok := m.checkpoint.get(it.ID); ok {
+			state = e.Stage
+			switch e.Stage {
+			case stageFailed:
+				state = fmt.Sprintf("retry %d (%s)", e.Attempts+1, e.Error)
+			case stageRepointFailed:
+				state = fmt.Sprintf("repoint retry %d (%s)", e.Attempts+1, e.Error)
+			}
+		}
+		fmt.Printf("%s  %-6s  %s\n    %s\n    -> %s  [%s]\n", it.ID, it.Type, it.Title, it.URL, m.dst.URL(it.DestKey), state)
+	}
+}
+
+type runStats struct {
+	mu         sync.Mutex
+	ok, failed int
+}
+
+// run migrates items with a fixed number of workers.
+func (m *migrator) run(items []*item, workers int) *runStats {
+	stats := &runStats{}
+	queue := make(chan *item)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range queue {
+				entry, err := m.migrate(it)
+
+				stats.mu.Lock()
+				if err != nil {
+					stats.failed++
+					m.logger.Printf("FAIL %s (%s): %v", it.ID, it.Title, err)
+					// Keep what an uploaded copy needs for the repoint retry
+					if entry.Stage == stageUploaded || entry.Stage == stageRepointFailed {
+						entry.Stage = stageRepointFailed
+					} else {
+						entry = checkpointEntry{Stage: stageFailed, DestKey: it.DestKey}
+					}
+					entry.Error = err.Error()
+					m.checkpoint.set(it.ID, entry)
+				} else {
+					stats.ok++
+					m.logger.Printf("ok   %s (%s)", it.ID, it.Title)
+				}
+				stats.mu.Unlock()
+
+				if m.delay > 0 {
+					time.Sleep(m.delay)
+				}
+			}
+		}()
+	}
+
+	for _, it := range items {
+		queue <- it
+	}
+	close(queue)
+	wg.Wait()
+
+	return stats
+}
+
+// migrate copies one file and repoints its resource, returning the last
+// stage reached. A file that was uploaded before a crash or a failed update
+// is not copied again; only the database update is redone.
+func (m *migrator) migrate(it *item) (checkpointEntry, error) {
+	entry, ok := m.checkpoint.get(it.ID)
+	resume := ok && (entry.Stage == stageUploaded || entry.Stage == stageRepointFailed) && entry.DestKey == it.DestKey
+	if !resume {
+		var err error
+		entry, err = m.copy(it)
+		if err != nil {
+			return checkpointEntry{}, err
+		}
+		if err := m.checkpoint.set(it.ID, entry); err != nil {
+			return entry, fmt.Errorf("write checkpoint: %w", err)
+		}
+	}
+	if m.copyOnly {
+		return entry, nil
+	}
+
+	if err := m.repoint(it, entry); err != nil {
+		return entry, err
+	}
+
+	entry.Stage = stageDone
+	entry.Error = ""
+	return entry, m.checkpoint.set(it.ID, entry)
+}
+
+// copy streams the source object to a temp file, detecting its content type
+// and hashing it on the way, then uploads and optionally verifies it.
+func (m *migrator) copy(it *item) (checkpointEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	body, err := m.src.Open(ctx, it.SrcKey)
+	if err != nil {
+		return checkpointEntry{}, fmt.Errorf("read source: %w", err)
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "migrate-*")
+	if err != nil {
+		return checkpointEntry{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), body)
+	if err != nil {
+		return checkpointEntry{}, fmt.Errorf("download: %w", err)
+	}
+	if size == 0 {
+		return checkpointEntry{}, errors.New("source file is empty")
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType := media.DetectContentType(head[:n])
+	if contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(path.Ext(it.DestKey)); byExt != "" {
+			contentType = byExt
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return checkpointEntry{}, err
+	}
+	if err := m.dst.Put(ctx, it.DestKey, tmp, size, contentType); err != nil {
+		return checkpointEntry{}, fmt.Errorf("upload: %w", err)
+	}
+
+	if m.verify {
+		if err := m.verifyUpload(ctx, it.DestKey, sum); err != nil {
+			return checkpointEntry{}, err
+		}
+	}
+
+	return checkpointEntry{
+		Stage:       stageUploaded,
+		DestKey:     it.DestKey,
+		SHA256:      sum,
+		ContentType: contentType,
+		SizeBytes:   size,
+	}, nil
+}
+
+// verifyUpload reads the uploaded object back and compares its checksum.
+func (m *migrator) verifyUpload(ctx context.Context, key, want string) error {
+	body, err := m.dst.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != want {
+		return fmt.Errorf("verify: checksum mismatch (source %s, destination %s)", want, got)
+	}
+	return nil
+}
+
+// repoint updates the resource to its new URL and drops the API's cached
+// copies of it. The old URL is part of the condition so an admin edit made
+// during the run is never overwritten.
+func (m *migrator) repoint(it *item, entry checkpointEntry) error {
+	query := `
+		UPDATE resources
+		SET url = $1, mime_type = $2, file_size_bytes = $3
+		WHERE id = $4 AND url = $5`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, m.dst.URL(entry.DestKey), entry.ContentType, entry.SizeBytes, it.ID, it.URL)
+	if err != nil {
+		return fmt.Errorf("update resource: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("resource URL changed during migration; not updated")
+	}
+
+	// Keys as in data.ResourceModel
+	if err := m.cache.Delete(ctx, "resource:"+it.ID); err != nil {
+		m.logger.Printf("%s: invalidate cache: %v", it.ID, err)
+	}
+	if err := m.cache.Delete(ctx, "resources:book:"+it.BookID); err != nil {
+		m.logger.Printf("%s: invalidate cache: %v", it.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+// Package archive queries the Internet Archive (archive.org) advanced-search
+// and metadata APIs to find PDFs and recordings of classical texts.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the public Internet Archive endpoint.
+const DefaultBaseURL = "https://archive.org"
+
+// ErrNotFound is returned when an item does not exist or has been darkened.
+var ErrNotFound = errors.New("archive: item not found")
+
+// HTTPClient is the subset of *http.Client used by the Client.
+// It is an interface so the aggregator can run against a local fake server.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client talks to the Internet Archive APIs.
+type Client struct {
+	HTTP    HTTPClient
+	BaseURL string
+}
+
+// New returns a Client using client, or a default client when nil.
+func New(client HTTPClient) *Client {
+	if client == nil {
+		client = &http.Client{Timeout: 20 * time.Second}
+	}
+	return &Client{HTTP: client, BaseURL: DefaultBaseURL}
+}
+
+// SearchResult is one item returned by advanced search.
+type SearchResult struct {
+	Identifier string `json:"identifier"`
+	Title      string `json:"title"`
+	Creator    string `json:"creator"`
+	MediaType  string `json:"mediatype"`
+	Year       string `json:"year"`
+	Downloads  int    `json:"downloads"`
+}
+
+// Item is an archive.org item with its files.
+type Item struct {
+	Identifier string
+	Title      string
+	Creator    string
+	Language   string
+	License    string
+	Files      []File
+}
+
+// File is a single file of an item.
+type File struct {
+	Name            string
+	Title           string
+	Format          string
+	SizeBytes       int64
+	DurationSeconds int
+	Track           int
+}
+
+// Kind classifies a file as "pdf", "audio" or "" (not useful to us).
+func (f File) Kind() string {
+	ext := strings.ToLower(path.Ext(f.Name))
+	switch {
+	case ext == ".pdf" || f.Format == "Text PDF":
+		return "pdf"
+	case ext == ".mp3" || ext == ".m4a" || ext == ".ogg" || strings.Contains(f.Format, "MP3"):
+		return "audio"
+	}
+	return ""
+}
+
+// DownloadURL returns the public download URL of a file.
+func (c *Client) DownloadURL(identifier, name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return fmt.Sprintf("%s/download/%s/%s", c.BaseURL, url.PathEscape(identifier), strings.Join(segments, "/"))
+}
+
+// DetailsURL returns the item's page on archive.org.
+func (c *Client) DetailsURL(identifier string) string {
+	return fmt.Sprintf("%s/details/%s", c.BaseURL, url.PathEscape(identifier))
+}
+
+// Search finds text and audio items whose title or creator matches the terms.
+func (c *Client) Search(ctx context.Context, title, creator string, rows int) ([]SearchResult, error) {
+	var clauses []string
+	if title = quoteTerm(title); title != "" {
+		clauses = append(clauses, "title:("+title+")")
+	}
+	if creator = quoteTerm(creator); creator != "" {
+		clauses = append(clauses, "creator:("+creator+")")
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("archive: title or creator required")
+	}
+
+	q := "(" + strings.Join(clauses, " OR ") + ") AND mediatype:(texts OR audio)"
+	params := url.Values{
+		"q":      {q},
+		"fl[]":   {"identifier", "title", "creator", "mediatype", "year", "downloads"},
+		"sort[]": {"downloads desc"},
+		"rows":   {strconv.Itoa(rows)},
+		"page":   {"1"},
+		"output": {"json"},
+	}
+
+	var body struct {
+		Response struct {
+			Docs []json.RawMessage `json:"docs"`
+		} `json:"response"`
+	}
+	if err := c.get(ctx, "/advancedsearch.php?"+params.Encode(), &body); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(body.Response.Docs))
+	for _, raw := range body.Response.Docs {
+		var doc map[string]any
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{
+			Identifier: str(doc["identifier"]),
+			Title:      str(doc["title"]),
+			Creator:    str(doc["creator"]),
+			MediaType:  str(doc["mediatype"]),
+			Year:       str(doc["year"]),
+			Downloads:  int(num(doc["downloads"])),
+		})
+	}
+	return results, nil
+}
+
+// Metadata fetches an item and its file list.
+func (c *Client) Metadata(ctx context.Context, identifier string) (*Item, error) {
+	var body struct {
+		Metadata map[string]any `json:"metadata"`
+		Files    []struct {
+			Name   string `json:"name"`
+			Title  string `json:"title"`
+			Format string `json:"format"`
+			Size   string `json:"size"`
+			Length string `json:"length"`
+			Track  string `json:"track"`
+			Source string `json:"source"`
+		} `json:"files"`
+	}
+	if err := c.get(ctx, "/metadata/"+url.PathEscape(identifier), &body); err != nil {
+		return nil, err
+	}
+	// The metadata API answers {} for unknown identifiers.
+	if body.Metadata == nil {
+		return nil, ErrNotFound
+	}
+
+	item := &Item{
+		Identifier: identifier,
+		Title:      str(body.Metadata["title"]),
+		Creator:    str(body.Metadata["creator"]),
+		Language:   str(body.Metadata["language"]),
+		License:    str(body.Metadata["licenseurl"]),
+	}
+	for _, f := range body.Files {
+		// Derivatives (e.g. the 64kbps MP3 of a FLAC) duplicate an original.
+		if f.Source == "derivative" && !strings.Contains(f.Format, "MP3") && f.Format != "Text PDF" {
+			continue
+		}
+		size, _ := strconv.ParseInt(f.Size, 10, 64)
+		track, _ := strconv.Atoi(strings.SplitN(f.Track, "/", 2)[0])
+		item.Files = append(item.Files, File{
+			Name:            f.Name,
+			Title:           f.Title,
+			Format:          f.Format,
+			SizeBytes:       size,
+			DurationSeconds: parseLength(f.Length),
+			Track:           track,
+		})
+	}
+	return item, nil
+}
+
+func (c *Client) get(ctx context.Context, pathAndQuery string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+pathAndQuery, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("archive: %s returned %d", pathAndQuery, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// quoteTerm strips Lucene syntax from user text and quotes it as a phrase.
+func quoteTerm(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`"\():[]{}^~*?!+-&|/`, r) {
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return ""
+	}
+	return `"` + s + `"`
+}
+
+// parseLength reads seconds ("1834.21") or h:mm:ss ("30:34") durations.
+func parseLength(s string) int {
+	if s == "" {
+		return 0
+	}
+	if !strings.Contains(s, ":") {
+		f, _ := strconv.ParseFloat(s, 64)
+		return int(f)
+	}
+	total := 0
+	for _, p := range strings.Split(s, ":") {
+		n, _ := strconv.ParseFloat(p, 64)
+		total = total*60 + int(n)
+	}
+	return total
+}
+
+// Metadata fields may be a string or a list of strings; take the first.
+func str(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []any:
+		if len(t) > 0 {
+			return str(t[0])
+		}
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return ""
+}
+
+func num(v any) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case string:
+		f, _ := strconv.ParseFloat(t, 64)
+		return f
+	}
+	return 0
+}
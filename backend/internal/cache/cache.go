@@ -97,6 +97,34 @@ func (s *Service) IncrBy(ctx context.Context, key string, value int64) error {
 	return s.client.IncrBy(ctx, key, value).Err()
 }
 
+// incrWithinScript adds to a counter only if the total stays within a
+// limit, starting the counter's TTL when it is created.
+var incrWithinScript = redis.NewScript(`
+local used = redis.call('INCRBY', KEYS[1], ARGV[1])
+if used == tonumber(ARGV[1]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+if used > tonumber(ARGV[2]) then
+	redis.call('DECRBY', KEYS[1], ARGV[1])
+	return 0
+end
+return 1
+`)
+
+// IncrWithin atomically increments a counter by value unless that would take
+// it over limit, and reports whether it did. A new counter expires after ttl.
+// A nil receiver is safe and always succeeds.
+func (s *Service) IncrWithin(ctx context.Context, key string, value, limit int64, ttl time.Duration) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+	ok, err := incrWithinScript.Run(ctx, s.client, []string{key}, value, limit, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
 // DecrBy decrements a key by value.
 // A nil receiver is safe and is a no-op.
 func (s *Service) DecrBy(ctx context.Context, key string, value int) error {
@@ -127,4 +155,88 @@ func (s *Service) GetInt(ctx context.Context, key string) (int, error) {
 		return 0, err
 	}
 	return val, nil
-}
\ No newline at end of file
+}
+
+// Publish sends a message to every subscriber of a pub/sub channel.
+// A nil receiver is safe and is a no-op.
+func (s *Service) Publish(ctx context.Context, channel string, payload []byte) error {
+	if s == nil {
+		return nil
+	}
+	return s.client.Publish(ctx, channel, payload).Err()
+}
+
+// Subscribe calls handle with every message published on a channel until ctx
+// is cancelled. ready, if not nil, is called once Redis has confirmed the
+// subscription, before any message is handled. The subscription reconnects
+// by itself if Redis drops it.
+// A nil receiver returns immediately.
+func (s *Service) Subscribe(ctx context.Context, channel string, ready func(), handle func(payload []byte)) error {
+	if s == nil {
+		return nil
+	}
+	sub := s.client.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed before reading.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	if ready != nil {
+		ready()
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handle([]byte(msg.Payload))
+		}
+	}
+}
+
+// HashSet sets fields of a hash to the JSON encoding of their values and
+// resets the hash's TTL.
+// A nil receiver is safe and is a no-op.
+func (s *Service) HashSet(ctx context.Context, key string, fields map[string]interface{}, ttl time.Duration) error {
+	if s == nil || len(fields) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, 2*len(fields))
+	for field, value := range fields {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		values = append(values, field, data)
+	}
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, values...)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// HashGetAll returns every field of a hash. Values are returned as stored
+// (JSON).
+// A nil receiver returns an empty map.
+func (s *Service) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	if s == nil {
+		return map[string]string{}, nil
+	}
+	return s.client.HGetAll(ctx, key).Result()
+}
+
+// HashDelete removes fields from a hash.
+// A nil receiver is safe and is a no-op.
+func (s *Service) HashDelete(ctx context.Context, key string, fields ...string) error {
+	if s == nil || len(fields) == 0 {
+		return nil
+	}
+	return s.client.HDel(ctx, key, fields...).Err()
+}
@@ -0,0 +1,120 @@
+package certificate
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// Teacher is one link of a sanad above the student. Verified links were
+// granted on the platform; the others were recorded by their student.
+type Teacher struct {
+	Name      string `json:"name"`
+	GrantedOn string `json:"granted_on,omitempty"`
+	Verified  bool   `json:"verified"`
+}
+
+// Ijazah is the signed content of an ijazah: a teacher's attestation that
+// the student completed a text, with the sanad as it stood when granted.
+// Sanad lists the teacher's own teachers, nearest first.
+type Ijazah struct {
+	Code        string    `json:"code"`
+	StudentID   string    `json:"student_id"`
+	StudentName string    `json:"student_name"`
+	TeacherID   string    `json:"teacher_id"`
+	TeacherName string    `json:"teacher_name"`
+	BookID      string    `json:"book_id,omitempty"`
+	TextTitle   string    `json:"text_title"`
+	Type        string    `json:"type"`
+	Completion  string    `json:"completion"`
+	GrantedOn   string    `json:"granted_on"`
+	IssuedAt    time.Time `json:"issued_at"`
+	Sanad       []Teacher `json:"sanad"`
+}
+
+// SignIjazah encodes p and signs it. As with Sign, the exact returned bytes
+// must be stored.
+func (s *Signer) SignIjazah(p *Ijazah) (payload []byte, signature string, err error) {
+	return s.sign(p)
+}
+
+// VerifyIjazah checks the signature of an ijazah payload with the key keyID
+// and decodes it.
+func (s *Signer) VerifyIjazah(payload []byte, signature, keyID string) (*Ijazah, error) {
+	var p Ijazah
+	if err := s.verify(payload, signature, keyID, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ijazahDocument is what the ijazah page needs besides the payload.
+type ijazahDocument struct {
+	*Ijazah
+	VerifyURL string
+	Revoked   bool
+}
+
+// The chain reads top down, from the earliest recorded teacher to the
+// student, the way a sanad is traditionally written out.
+var ijazahTemplate = template.Must(template.New("ijazah").Funcs(template.FuncMap{
+	"reverse": func(links []Teacher) []Teacher {
+		out := make([]Teacher, len(links))
+		for i, l := range links {
+			out[len(links)-1-i] = l
+		}
+		return out
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Ijazah {{.Code}} – {{.TextTitle}}</title>
+<style>
+  body { margin: 0; padding: 48px 16px; background: #fdfbf5; color: #222; font-family: Georgia, 'Amiri', serif; }
+  main { max-width: 720px; margin: 0 auto; border: 4px double #1f5f4a; padding: 40px; background: #fff; text-align: center; }
+  h1 { color: #1f5f4a; font-weight: normal; margin: 0 0 4px; }
+  .ar { font-size: 1.4em; color: #1f5f4a; margin: 0 0 32px; }
+  .name { font-size: 1.8em; margin: 8px 0; }
+  .text { font-size: 1.4em; color: #1f5f4a; margin: 8px 0; }
+  ol { list-style: none; padding: 0; margin: 32px 0; }
+  li { padding: 6px 0; }
+  li + li::before { content: "↓"; display: block; color: #c9a44c; }
+  .unverified { color: #777; font-style: italic; }
+  .revoked { color: #a12; font-weight: bold; }
+  footer { margin-top: 32px; font-size: 0.85em; color: #666; }
+</style>
+</head>
+<body>
+<main>
+  <h1>Ijazah</h1>
+  <p class="ar" dir="rtl">إجازة</p>
+  {{- if .Revoked}}
+  <p class="revoked">This ijazah has been revoked by the teacher.</p>
+  {{- end}}
+  <p>This attests that</p>
+  <p class="name" dir="auto">{{.StudentName}}</p>
+  <p>completed the {{.Completion}} of</p>
+  <p class="text" dir="auto">{{.TextTitle}}</p>
+  <p>with <span dir="auto">{{.TeacherName}}</span> on {{.GrantedOn}}, who granted an ijazah of {{.Type}}.</p>
+  <h2>Sanad</h2>
+  <ol>
+    {{- range reverse .Sanad}}
+    <li{{if not .Verified}} class="unverified"{{end}} dir="auto">{{.Name}}{{if not .Verified}} (recorded, not verified){{end}}</li>
+    {{- end}}
+    <li dir="auto">{{.TeacherName}}</li>
+    <li dir="auto">{{.StudentName}}</li>
+  </ol>
+  <footer>
+    Ijazah {{.Code}}, issued {{.IssuedAt.Format "2 January 2006"}}<br>
+    Verify at {{.VerifyURL}}
+  </footer>
+</main>
+</body>
+</html>
+`))
+
+// RenderIjazah writes an ijazah and its sanad as a printable HTML page.
+func RenderIjazah(w io.Writer, p *Ijazah, verifyURL string, revoked bool) error {
+	return ijazahTemplate.Execute(w, ijazahDocument{Ijazah: p, VerifyURL: verifyURL, Revoked: revoked})
+}
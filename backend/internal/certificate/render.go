@@ -0,0 +1,97 @@
+package certificate
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// maxListedBooks keeps the book list inside the page; the rest are summarised.
+const maxListedBooks = 10
+
+// document is what the templates need besides the payload.
+type document struct {
+	*Payload
+	VerifyURL string
+	Listed    []Book
+	More      int
+	Date      string
+}
+
+var funcs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"mul": func(a, b int) int { return a * b },
+}
+
+// The SVG is an A4 landscape page at 96 dpi. dir="auto" lets Arabic names
+// and titles render right to left.
+var svgTemplate = template.Must(template.New("svg").Funcs(funcs).Parse(`
+{{- define "certificate" -}}
+<svg xmlns="http://www.w3.org/2000/svg" width="1123" height="794" viewBox="0 0 1123 794" font-family="Georgia, 'Amiri', serif">
+  <rect x="0" y="0" width="1123" height="794" fill="#fdfbf5"/>
+  <rect x="24" y="24" width="1075" height="746" fill="none" stroke="#1f5f4a" stroke-width="4"/>
+  <rect x="36" y="36" width="1051" height="722" fill="none" stroke="#c9a44c" stroke-width="1.5"/>
+  <text x="561.5" y="110" text-anchor="middle" font-size="40" fill="#1f5f4a">Certificate of Completion</text>
+  <text x="561.5" y="150" text-anchor="middle" font-size="26" fill="#1f5f4a" direction="rtl">شهادة إتمام</text>
+  <text x="561.5" y="210" text-anchor="middle" font-size="18" fill="#444">This certifies that</text>
+  <text x="561.5" y="262" text-anchor="middle" font-size="38" fill="#111" dir="auto">{{.Name}}</text>
+  <text x="561.5" y="306" text-anchor="middle" font-size="18" fill="#444">has completed the roadmap</text>
+  <text x="561.5" y="352" text-anchor="middle" font-size="30" fill="#1f5f4a" dir="auto">{{.RoadmapTitle}}</text>
+  {{- range $i, $b := .Listed}}
+  <text x="561.5" y="{{add 400 (mul $i 24)}}" text-anchor="middle" font-size="15" fill="#333" dir="auto">{{$b.Title}} — {{$b.CompletedAt.Format "2 Jan 2006"}}</text>
+  {{- end}}
+  {{- if .More}}
+  <text x="561.5" y="{{add 400 (mul (len .Listed) 24)}}" text-anchor="middle" font-size="15" fill="#333">and {{.More}} more</text>
+  {{- end}}
+  <text x="80" y="710" font-size="15" fill="#444">Issued {{.Date}}</text>
+  <text x="1043" y="710" text-anchor="end" font-size="13" fill="#444">Certificate {{.Code}}</text>
+  <text x="1043" y="732" text-anchor="end" font-size="11" fill="#777">Verify at {{.VerifyURL}}</text>
+</svg>
+{{- end -}}
+{{template "certificate" .}}
+`))
+
+var htmlTemplate = template.Must(template.Must(svgTemplate.Clone()).New("html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Certificate {{.Code}} – {{.RoadmapTitle}}</title>
+<style>
+  @page { size: A4 landscape; margin: 0; }
+  body { margin: 0; display: flex; justify-content: center; background: #eee; }
+  svg { width: 100%; max-width: 1123px; height: auto; background: #fff; }
+  @media print { body { background: none; } }
+</style>
+</head>
+<body>
+{{template "certificate" .}}
+</body>
+</html>
+`))
+
+// Render writes the certificate as a standalone SVG ("svg") or a printable
+// HTML page ("html") embedding it.
+func Render(w io.Writer, p *Payload, format, verifyURL string) error {
+	doc := document{
+		Payload:   p,
+		VerifyURL: verifyURL,
+		Listed:    p.Books,
+		Date:      p.IssuedAt.Format("2 January 2006"),
+	}
+	if len(doc.Listed) > maxListedBooks {
+		doc.More = len(doc.Listed) - maxListedBooks + 1
+		doc.Listed = doc.Listed[:maxListedBooks-1]
+	}
+
+	switch format {
+	case "svg":
+		if _, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"); err != nil {
+			return err
+		}
+		return svgTemplate.Execute(w, doc)
+	case "html":
+		return htmlTemplate.Execute(w, doc)
+	default:
+		return fmt.Errorf("unsupported certificate format %q", format)
+	}
+}
@@ -0,0 +1,232 @@
+// Package curriculum reads and writes roadmaps as plain documents, so that
+// curricula can be reviewed in git and promoted between environments.
+//
+// A document looks like:
+//
+//	version: 1
+//	slug: hifz-foundations
+//	title: Hifz Foundations
+//	levels: [beginner, intermediate, advanced]
+//	nodes:
+//	  - key: tuhfah
+//	    book: tuhfat-al-atfal   # book slug or ID
+//	    level: beginner
+//	    description: Start with the basics of tajweed.
+//	  - key: jazariyyah
+//	    book: al-jazariyyah
+//	    level: intermediate
+//	    requires: [tuhfah]
+//
+// Nodes are listed in study order. JSON documents use the same field names.
+package curriculum
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the document format version written by Encode.
+const Version = 1
+
+// DefaultLevels are used when a document does not declare its own.
+var DefaultLevels = []string{"beginner", "intermediate", "advanced"}
+
+var (
+	slugRX = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	keyRX  = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+)
+
+// Document is a roadmap with its ordered nodes.
+type Document struct {
+	Version       int      `yaml:"version" json:"version"`
+	Slug          string   `yaml:"slug" json:"slug"`
+	Title         string   `yaml:"title" json:"title"`
+	Description   string   `yaml:"description,omitempty" json:"description,omitempty"`
+	CoverImageURL string   `yaml:"cover_image_url,omitempty" json:"cover_image_url,omitempty"`
+	IsPublic      bool     `yaml:"is_public" json:"is_public"`
+	Levels        []string `yaml:"levels,omitempty" json:"levels,omitempty"`
+	Nodes         []Node   `yaml:"nodes" json:"nodes"`
+}
+
+// Node is one step of the roadmap. Key identifies the node across imports;
+// Book is a book slug or ID.
+type Node struct {
+	Key         string   `yaml:"key" json:"key"`
+	Book        string   `yaml:"book" json:"book"`
+	Level       string   `yaml:"level" json:"level"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Requires    []string `yaml:"requires,omitempty" json:"requires,omitempty"`
+}
+
+// ValidationError collects every problem found in a document, keyed by the
+// path of the offending field (e.g. "nodes[2].level").
+type ValidationError map[string]string
+
+func (v ValidationError) Error() string {
+	parts := make([]string, 0, len(v))
+	for field, msg := range v {
+		parts = append(parts, field+": "+msg)
+	}
+	return "invalid curriculum: " + strings.Join(parts, "; ")
+}
+
+// Parse decodes a YAML or JSON document; JSON is recognised by its leading
+// brace. Unknown fields are rejected so typos do not silently drop data.
+func Parse(src []byte) (*Document, error) {
+	trimmed := bytes.TrimSpace(src)
+	if len(trimmed) == 0 {
+		return nil, errors.New("document is empty")
+	}
+
+	var doc Document
+	if trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(trimmed))
+		dec.KnownFields(true)
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Version == 0 {
+		doc.Version = Version
+	}
+	if len(doc.Levels) == 0 {
+		doc.Levels = DefaultLevels
+	}
+	return &doc, nil
+}
+
+// Validate checks the document's shape: required fields, unique node keys,
+// known levels and an acyclic requires graph. It does not check that the
+// referenced books exist.
+func (d *Document) Validate() error {
+	errs := ValidationError{}
+
+	if d.Version != Version {
+		errs["version"] = fmt.Sprintf("unsupported version %d", d.Version)
+	}
+	if !slugRX.MatchString(d.Slug) {
+		errs["slug"] = "must be lowercase letters, digits and hyphens"
+	}
+	if strings.TrimSpace(d.Title) == "" {
+		errs["title"] = "must be provided"
+	}
+	if len(d.Nodes) == 0 {
+		errs["nodes"] = "must contain at least one node"
+	}
+
+	levels := make(map[string]bool, len(d.Levels))
+	for _, l := range d.Levels {
+		levels[l] = true
+	}
+
+	keys := make(map[string]bool, len(d.Nodes))
+	for i, n := range d.Nodes {
+		path := fmt.Sprintf("nodes[%d]", i)
+		switch {
+		case !keyRX.MatchString(n.Key):
+			errs[path+".key"] = "must be lowercase letters, digits, hyphens or underscores"
+		case keys[n.Key]:
+			errs[path+".key"] = fmt.Sprintf("duplicate key %q", n.Key)
+		}
+		keys[n.Key] = true
+		if strings.TrimSpace(n.Book) == "" {
+			errs[path+".book"] = "must be provided"
+		}
+		if !levels[n.Level] {
+			errs[path+".level"] = fmt.Sprintf("must be one of %s", strings.Join(d.Levels, ", "))
+		}
+	}
+
+	for i, n := range d.Nodes {
+		for _, req := range n.Requires {
+			path := fmt.Sprintf("nodes[%d].requires", i)
+			switch {
+			case req == n.Key:
+				errs[path] = "a node cannot require itself"
+			case !keys[req]:
+				errs[path] = fmt.Sprintf("unknown key %q", req)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		if key := d.cycle(); key != "" {
+			errs["nodes"] = fmt.Sprintf("requires forms a cycle through %q", key)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// cycle returns a key on a requires cycle, or "" if there is none.
+func (d *Document) cycle() string {
+	requires := make(map[string][]string, len(d.Nodes))
+	for _, n := range d.Nodes {
+		requires[n.Key] = n.Requires
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(d.Nodes))
+	var visit func(key string) string
+	visit = func(key string) string {
+		switch state[key] {
+		case visiting:
+			return key
+		case done:
+			return ""
+		}
+		state[key] = visiting
+		for _, req := range requires[key] {
+			if k := visit(req); k != "" {
+				return k
+			}
+		}
+		state[key] = done
+		return ""
+	}
+
+	for _, n := range d.Nodes {
+		if k := visit(n.Key); k != "" {
+			return k
+		}
+	}
+	return ""
+}
+
+// Encode writes the document as "yaml" or "json".
+func Encode(w io.Writer, d *Document, format string) error {
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	default:
+		return fmt.Errorf("unsupported curriculum format %q", format)
+	}
+}
@@ -46,6 +46,7 @@ type AdminStats struct {
 	BooksThisWeek     int `json:"books_this_week"`
 	ResourcesThisWeek int `json:"resources_this_week"`
 	StudentsGrowthPct int `json:"students_growth_pct"`
+	BrokenResources   int `json:"broken_resources"`
 }
 
 // AdminDashboardData contains all data required for the admin dashboard view.
@@ -336,7 +337,8 @@ func (m AnalyticsModel) GetDashboardData() (*AdminDashboardData, error) {
 						(SELECT COUNT(*) FROM users WHERE role = 'student') - (SELECT COUNT(*) FROM users WHERE role = 'student' AND created_at < NOW() - INTERVAL '30 days')
 					) * 100 / (SELECT COUNT(*) FROM users WHERE role = 'student' AND created_at < NOW() - INTERVAL '30 days')
 				END
-			)`
+			),
+			(SELECT COUNT(*) FROM resources WHERE link_status = 'broken')`
 
 	err := m.DB.QueryRowContext(ctx, queryTotals).Scan(
 		&data.Stats.TotalBooks,
@@ -345,6 +347,7 @@ func (m AnalyticsModel) GetDashboardData() (*AdminDashboardData, error) {
 		&data.Stats.BooksThisWeek,
 		&data.Stats.ResourcesThisWeek,
 		&data.Stats.StudentsGrowthPct,
+		&data.Stats.BrokenResources,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,575 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+var (
+	// ErrAttemptOpen is returned when starting an attempt while another one
+	// is still in progress or awaiting review.
+	ErrAttemptOpen = errors.New("an attempt is already open")
+	// ErrAttemptClosed is returned when submitting or reviewing an attempt
+	// that is not in the expected state.
+	ErrAttemptClosed = errors.New("attempt is not open")
+)
+
+// Assessment kinds.
+const (
+	AssessmentQuiz       = "quiz"
+	AssessmentRecitation = "recitation"
+	AssessmentSignoff    = "signoff"
+)
+
+// Assessment gates completion of a roadmap node.
+type Assessment struct {
+	ID            string                `json:"id"`
+	NodeID        string                `json:"node_id"`
+	Kind          string                `json:"kind"`
+	Title         string                `json:"title"`
+	Instructions  string                `json:"instructions"`
+	PassScore     int                   `json:"pass_score"`
+	QuestionCount int                   `json:"question_count"`
+	CooldownHours int                   `json:"cooldown_hours"`
+	Questions     []*AssessmentQuestion `json:"questions,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
+
+// AssessmentQuestion is a multiple-choice question of a quiz. CorrectIndex
+// is only sent to staff.
+type AssessmentQuestion struct {
+	ID           string   `json:"id"`
+	Prompt       string   `json:"prompt"`
+	Choices      []string `json:"choices"`
+	CorrectIndex *int     `json:"correct_index,omitempty"`
+}
+
+// AssessmentAttempt is one try of a user at an assessment.
+type AssessmentAttempt struct {
+	ID           string         `json:"id"`
+	AssessmentID string         `json:"assessment_id"`
+	UserID       string         `json:"user_id"`
+	Status       string         `json:"status"` // in_progress, pending_review, passed, failed
+	QuestionIDs  []string       `json:"question_ids"`
+	Answers      map[string]int `json:"answers"`
+	Submission   string         `json:"submission"`
+	Score        *int           `json:"score"`
+	Feedback     string         `json:"feedback"`
+	ReviewerID   string         `json:"reviewer_id,omitempty"`
+	StartedAt    time.Time      `json:"started_at"`
+	SubmittedAt  *time.Time     `json:"submitted_at"`
+	ReviewedAt   *time.Time     `json:"reviewed_at"`
+}
+
+// PendingAttempt is an attempt waiting for a reviewer, with enough context
+// to grade it.
+type PendingAttempt struct {
+	AssessmentAttempt
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	PassScore int    `json:"pass_score"`
+	NodeID    string `json:"node_id"`
+	BookTitle string `json:"book_title"`
+	RoadmapID string `json:"roadmap_id"`
+	UserName  string `json:"user_name"`
+}
+
+// AssessmentStatus summarises a user's standing on an assessment.
+type AssessmentStatus struct {
+	Passed   bool               `json:"passed"`
+	Attempts int                `json:"attempts"`
+	Open     *AssessmentAttempt `json:"open_attempt"`
+	Last     *AssessmentAttempt `json:"last_attempt"`
+	RetryAt  *time.Time         `json:"retry_at"`
+}
+
+// Status derives the user's standing from their attempts, newest first.
+// RetryAt is set while the cool-down after a failed attempt is running.
+func (a *Assessment) Status(attempts []*AssessmentAttempt, now time.Time) AssessmentStatus {
+	s := AssessmentStatus{Attempts: len(attempts)}
+	if len(attempts) > 0 {
+		s.Last = attempts[0]
+	}
+	for _, at := range attempts {
+		switch at.Status {
+		case "passed":
+			s.Passed = true
+		case "in_progress", "pending_review":
+			s.Open = at
+		}
+	}
+	if s.Last != nil && s.Last.Status == "failed" && a.CooldownHours > 0 {
+		failedAt := s.Last.StartedAt
+		if s.Last.ReviewedAt != nil {
+			failedAt = *s.Last.ReviewedAt
+		} else if s.Last.SubmittedAt != nil {
+			failedAt = *s.Last.SubmittedAt
+		}
+		retry := failedAt.Add(time.Duration(a.CooldownHours) * time.Hour)
+		if retry.After(now) {
+			s.RetryAt = &retry
+		}
+	}
+	return s
+}
+
+// AssessmentModel wraps the database connection pool for node assessments.
+type AssessmentModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// GetForNode fetches a node's assessment with its question bank.
+func (m AssessmentModel) GetForNode(nodeID string) (*Assessment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	a := &Assessment{}
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT id, node_id, kind, title, instructions, pass_score, question_count, cooldown_hours, created_at, updated_at
+		FROM node_assessments
+		WHERE node_id = $1`, nodeID).
+		Scan(&a.ID, &a.NodeID, &a.Kind, &a.Title, &a.Instructions, &a.PassScore, &a.QuestionCount,
+			&a.CooldownHours, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	a.Questions, err = m.questions(ctx, `WHERE assessment_id = $1 ORDER BY sequence_index ASC`, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// questions loads questions matching the given WHERE/ORDER clause.
+func (m AssessmentModel) questions(ctx context.Context, clause string, args ...any) ([]*AssessmentQuestion, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, prompt, choices, correct_index FROM assessment_questions `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []*AssessmentQuestion{}
+	for rows.Next() {
+		var q AssessmentQuestion
+		var choices []byte
+		var correct int
+		if err := rows.Scan(&q.ID, &q.Prompt, &choices, &correct); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(choices, &q.Choices); err != nil {
+			return nil, err
+		}
+		q.CorrectIndex = &correct
+		questions = append(questions, &q)
+	}
+	return questions, rows.Err()
+}
+
+// GetQuestions returns the questions served in an attempt, in the order
+// they were served and without their answers.
+func (m AssessmentModel) GetQuestions(attempt *AssessmentAttempt) ([]*AssessmentQuestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ids, _ := json.Marshal(attempt.QuestionIDs)
+	all, err := m.questions(ctx, `WHERE id::text IN (SELECT jsonb_array_elements_text($1::jsonb))`, string(ids))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*AssessmentQuestion, len(all))
+	for _, q := range all {
+		q.CorrectIndex = nil
+		byID[q.ID] = q
+	}
+	questions := make([]*AssessmentQuestion, 0, len(attempt.QuestionIDs))
+	for _, id := range attempt.QuestionIDs {
+		if q, ok := byID[id]; ok {
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+// Save creates or replaces the assessment of a node, including its question
+// bank. Submitted attempts are kept.
+func (m AssessmentModel) Save(a *Assessment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO node_assessments (node_id, kind, title, instructions, pass_score, question_count, cooldown_hours)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (node_id) DO UPDATE
+		SET kind = EXCLUDED.kind, title = EXCLUDED.title, instructions = EXCLUDED.instructions,
+			pass_score = EXCLUDED.pass_score, question_count = EXCLUDED.question_count,
+			cooldown_hours = EXCLUDED.cooldown_hours, updated_at = NOW()
+		RETURNING id, created_at, updated_at`,
+		a.NodeID, a.Kind, a.Title, a.Instructions, a.PassScore, a.QuestionCount, a.CooldownHours).
+		Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Questions get new IDs, so quizzes served from the old bank are dropped
+	// and must be restarted.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM assessment_attempts WHERE assessment_id = $1 AND status = 'in_progress'`, a.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM assessment_questions WHERE assessment_id = $1`, a.ID); err != nil {
+		return err
+	}
+	for i, q := range a.Questions {
+		choices, err := json.Marshal(q.Choices)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO assessment_questions (assessment_id, prompt, choices, correct_index, sequence_index)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`, a.ID, q.Prompt, choices, *q.CorrectIndex, i).Scan(&q.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a node's assessment, ungating it.
+func (m AssessmentModel) Delete(nodeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM node_assessments WHERE node_id = $1`, nodeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+const attemptColumns = `a.id, a.assessment_id, a.user_id, a.status, a.question_ids, a.answers, a.submission,
+	a.score, a.feedback, COALESCE(a.reviewer_id::text, ''), a.started_at, a.submitted_at, a.reviewed_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttempt(row rowScanner, extra ...any) (*AssessmentAttempt, error) {
+	var at AssessmentAttempt
+	var questionIDs, answers []byte
+	var score sql.NullInt64
+	var submittedAt, reviewedAt sql.NullTime
+	dest := append([]any{&at.ID, &at.AssessmentID, &at.UserID, &at.Status, &questionIDs, &answers, &at.Submission,
+		&score, &at.Feedback, &at.ReviewerID, &at.StartedAt, &submittedAt, &reviewedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(questionIDs, &at.QuestionIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(answers, &at.Answers); err != nil {
+		return nil, err
+	}
+	if score.Valid {
+		s := int(score.Int64)
+		at.Score = &s
+	}
+	if submittedAt.Valid {
+		at.SubmittedAt = &submittedAt.Time
+	}
+	if reviewedAt.Valid {
+		at.ReviewedAt = &reviewedAt.Time
+	}
+	return &at, nil
+}
+
+// GetAttempt fetches one attempt.
+func (m AssessmentModel) GetAttempt(id string) (*AssessmentAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	at, err := scanAttempt(m.DB.QueryRowContext(ctx,
+		`SELECT `+attemptColumns+` FROM assessment_attempts a WHERE a.id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return at, nil
+}
+
+// GetAttempts lists a user's attempts at an assessment, newest first.
+func (m AssessmentModel) GetAttempts(assessmentID, userID string) ([]*AssessmentAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+attemptColumns+`
+		FROM assessment_attempts a
+		WHERE a.assessment_id = $1 AND a.user_id = $2
+		ORDER BY a.started_at DESC`, assessmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*AssessmentAttempt{}
+	for rows.Next() {
+		at, err := scanAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, at)
+	}
+	return attempts, rows.Err()
+}
+
+// StartAttempt opens a new attempt. Quizzes draw their questions from the
+// bank and wait for answers; recitations and sign-offs go straight to review
+// with the student's submission (a recording link or a note).
+func (m AssessmentModel) StartAttempt(a *Assessment, userID, submission string) (*AssessmentAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	questionIDs := []string{}
+	status := "pending_review"
+	if a.Kind == AssessmentQuiz {
+		status = "in_progress"
+		submission = ""
+
+		limit := a.QuestionCount
+		if limit <= 0 {
+			limit = len(a.Questions)
+		}
+		rows, err := m.DB.QueryContext(ctx, `
+			SELECT id FROM assessment_questions
+			WHERE assessment_id = $1
+			ORDER BY random()
+			LIMIT $2`, a.ID, limit)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			questionIDs = append(questionIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	ids, err := json.Marshal(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	at, err := scanAttempt(m.DB.QueryRowContext(ctx, `
+		INSERT INTO assessment_attempts AS a (assessment_id, user_id, status, question_ids, submission, submitted_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $3 = 'pending_review' THEN NOW() END)
+		RETURNING `+attemptColumns,
+		a.ID, userID, status, ids, submission))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAttemptOpen
+		}
+		return nil, err
+	}
+	return at, nil
+}
+
+// SubmitQuiz grades the answers to an open quiz attempt. answers maps
+// question IDs to the chosen choice index; unanswered questions score zero.
+func (m AssessmentModel) SubmitQuiz(attemptID, userID string, answers map[string]int) (*AssessmentAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var passScore int
+	at, err := scanAttempt(tx.QueryRowContext(ctx, `
+		SELECT `+attemptColumns+`, na.pass_score
+		FROM assessment_attempts a
+		JOIN node_assessments na ON na.id = a.assessment_id
+		WHERE a.id = $1 AND a.user_id = $2
+		FOR UPDATE OF a`, attemptID, userID), &passScore)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	if at.Status != "in_progress" {
+		return nil, ErrAttemptClosed
+	}
+
+	served := make(map[string]bool, len(at.QuestionIDs))
+	for _, id := range at.QuestionIDs {
+		served[id] = true
+	}
+	kept := make(map[string]int, len(answers))
+	for id, choice := range answers {
+		if served[id] {
+			kept[id] = choice
+		}
+	}
+
+	ids, _ := json.Marshal(at.QuestionIDs)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, correct_index FROM assessment_questions
+		WHERE id::text IN (SELECT jsonb_array_elements_text($1::jsonb))`, string(ids))
+	if err != nil {
+		return nil, err
+	}
+	correct := 0
+	for rows.Next() {
+		var id string
+		var index int
+		if err := rows.Scan(&id, &index); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if choice, ok := kept[id]; ok && choice == index {
+			correct++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	score := 100
+	if len(at.QuestionIDs) > 0 {
+		score = correct * 100 / len(at.QuestionIDs)
+	}
+	status := "failed"
+	if score >= passScore {
+		status = "passed"
+	}
+	answersJSON, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE assessment_attempts SET status = $1, answers = $2, score = $3, submitted_at = $4, reviewed_at = $4
+		WHERE id = $5`, status, answersJSON, score, now, at.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	at.Status, at.Answers, at.Score = status, kept, &score
+	at.SubmittedAt, at.ReviewedAt = &now, &now
+	return at, nil
+}
+
+// Review grades an attempt awaiting review. The attempt passes when score
+// reaches the assessment's pass score.
+func (m AssessmentModel) Review(attemptID, reviewerID string, score int, feedback string) (*AssessmentAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	at, err := scanAttempt(m.DB.QueryRowContext(ctx, `
+		UPDATE assessment_attempts a
+		SET status = CASE WHEN $1 >= na.pass_score THEN 'passed' ELSE 'failed' END,
+			score = $1, feedback = $2, reviewer_id = $3, reviewed_at = NOW()
+		FROM node_assessments na
+		WHERE na.id = a.assessment_id AND a.id = $4 AND a.status = 'pending_review'
+		RETURNING `+attemptColumns, score, feedback, reviewerID, attemptID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := m.GetAttempt(attemptID); err != nil {
+				return nil, err
+			}
+			return nil, ErrAttemptClosed
+		}
+		return nil, err
+	}
+	return at, nil
+}
+
+// GetPending lists attempts awaiting review, oldest first.
+func (m AssessmentModel) GetPending() ([]*PendingAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+attemptColumns+`, na.kind, na.title, na.pass_score, rn.id, b.title, rn.roadmap_id,
+			COALESCE(NULLIF(u.name, ''), u.username, '')
+		FROM assessment_attempts a
+		JOIN node_assessments na ON na.id = a.assessment_id
+		JOIN roadmap_nodes rn ON rn.id = na.node_id
+		JOIN books b ON b.id = rn.book_id
+		JOIN users u ON u.id = a.user_id
+		WHERE a.status = 'pending_review'
+		ORDER BY a.submitted_at ASC
+		LIMIT 100`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []*PendingAttempt{}
+	for rows.Next() {
+		var p PendingAttempt
+		at, err := scanAttempt(rows, &p.Kind, &p.Title, &p.PassScore, &p.NodeID, &p.BookTitle, &p.RoadmapID,
+			&p.UserName)
+		if err != nil {
+			return nil, err
+		}
+		p.AssessmentAttempt = *at
+		pending = append(pending, &p)
+	}
+	return pending, rows.Err()
+}
+
+// IsGateOpen reports whether a user may complete a node: true when the node
+// has no assessment or the user has passed it.
+func (m AssessmentModel) IsGateOpen(userID, nodeID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var open bool
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM node_assessments na
+			WHERE na.node_id = $1
+			AND NOT EXISTS (
+				SELECT 1 FROM assessment_attempts a
+				WHERE a.assessment_id = na.id AND a.user_id = $2 AND a.status = 'passed'
+			)
+		)`, nodeID, userID).Scan(&open)
+	return open, err
+}
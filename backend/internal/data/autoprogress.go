@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sources of roadmap progress changes.
+const (
+	ProgressSourceManual   = "manual"
+	ProgressSourceActivity = "activity"
+	ProgressSourceReading  = "reading"
+)
+
+// ProgressRules configure how a roadmap's nodes move on their own: to
+// in_progress on the first study activity for the node's book, and to
+// completed (or a suggestion to complete) once the book is fully read.
+type ProgressRules struct {
+	RoadmapID        string    `json:"roadmap_id"`
+	StartOnActivity  bool      `json:"start_on_activity"`
+	CompleteOnFinish string    `json:"complete_on_finish"` // off, suggest, auto
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// DefaultProgressRules apply to roadmaps without their own rules.
+func DefaultProgressRules(roadmapID string) *ProgressRules {
+	return &ProgressRules{RoadmapID: roadmapID, StartOnActivity: true, CompleteOnFinish: "suggest"}
+}
+
+// ProgressEvent is one recorded progress change, or an unapplied suggestion.
+type ProgressEvent struct {
+	ID         string          `json:"id"`
+	NodeID     string          `json:"node_id"`
+	RoadmapID  string          `json:"roadmap_id"`
+	BookTitle  string          `json:"book_title"`
+	FromStatus string          `json:"from_status"`
+	ToStatus   string          `json:"to_status"`
+	Source     string          `json:"source"`
+	Applied    bool            `json:"applied"`
+	Detail     json.RawMessage `json:"detail"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// AutoProgressNode is a node the rules may move for a user, with the rules of
+// its roadmap and the user's current status on it.
+type AutoProgressNode struct {
+	NodeID           string
+	RoadmapID        string
+	Status           string
+	StartOnActivity  bool
+	CompleteOnFinish string
+}
+
+// GetProgressRules returns a roadmap's rules, or the defaults.
+func (m RoadmapModel) GetProgressRules(roadmapID string) (*ProgressRules, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rules := &ProgressRules{RoadmapID: roadmapID}
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT start_on_activity, complete_on_finish, updated_at
+		FROM roadmap_progress_rules WHERE roadmap_id = $1`, roadmapID).
+		Scan(&rules.StartOnActivity, &rules.CompleteOnFinish, &rules.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultProgressRules(roadmapID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SetProgressRules creates or replaces a roadmap's rules.
+func (m RoadmapModel) SetProgressRules(rules *ProgressRules) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, `
+		INSERT INTO roadmap_progress_rules (roadmap_id, start_on_activity, complete_on_finish)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (roadmap_id) DO UPDATE
+		SET start_on_activity = EXCLUDED.start_on_activity,
+			complete_on_finish = EXCLUDED.complete_on_finish,
+			updated_at = NOW()
+		RETURNING updated_at`, rules.RoadmapID, rules.StartOnActivity, rules.CompleteOnFinish).
+		Scan(&rules.UpdatedAt)
+}
+
+// GetAutoProgressNodes finds the nodes for a book on the roadmaps a user
+// follows: roadmaps they own or already have progress on.
+func (m RoadmapModel) GetAutoProgressNodes(userID, bookID string) ([]*AutoProgressNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT rn.id, rn.roadmap_id, COALESCE(up.status::text, 'not_started'),
+			COALESCE(pr.start_on_activity, true), COALESCE(pr.complete_on_finish, 'suggest')
+		FROM roadmap_nodes rn
+		JOIN roadmaps r ON r.id = rn.roadmap_id
+		LEFT JOIN roadmap_progress_rules pr ON pr.roadmap_id = rn.roadmap_id
+		LEFT JOIN user_roadmap_progress up ON up.node_id = rn.id AND up.user_id = $1
+		WHERE rn.book_id = $2
+		AND (r.owner_id = $1 OR EXISTS (
+			SELECT 1 FROM user_roadmap_progress fp
+			JOIN roadmap_nodes fn ON fn.id = fp.node_id
+			WHERE fp.user_id = $1 AND fn.roadmap_id = rn.roadmap_id
+		))`, userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*AutoProgressNode
+	for rows.Next() {
+		var n AutoProgressNode
+		if err := rows.Scan(&n.NodeID, &n.RoadmapID, &n.Status, &n.StartOnActivity, &n.CompleteOnFinish); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, &n)
+	}
+	return nodes, rows.Err()
+}
+
+// SetProgress changes a user's status on a node and records where the change
+// came from. Completing a node resolves any open suggestion to complete it.
+func (m RoadmapModel) SetProgress(userID, nodeID, status, source string, detail map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	if detail == nil {
+		detailJSON = []byte(`{}`)
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var from string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status::text FROM user_roadmap_progress
+		WHERE user_id = $1 AND node_id = $2
+		FOR UPDATE`, userID, nodeID).Scan(&from)
+	if errors.Is(err, sql.ErrNoRows) {
+		from = "not_started"
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_roadmap_progress (user_id, node_id, status, last_updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, node_id)
+		DO UPDATE SET status = $3, last_updated_at = NOW()`, userID, nodeID, status)
+	if err != nil {
+		return err
+	}
+
+	if from != status {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO roadmap_progress_events (user_id, node_id, from_status, to_status, source, detail)
+			VALUES ($1, $2, $3, $4, $5, $6)`, userID, nodeID, from, status, source, detailJSON)
+		if err != nil {
+			return err
+		}
+	}
+	if status == "completed" {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE roadmap_progress_events SET resolved_at = NOW()
+			WHERE user_id = $1 AND node_id = $2 AND NOT applied AND resolved_at IS NULL`, userID, nodeID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Cached roadmaps carry this user's statuses and lock state.
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("roadmap:slug:*:user:%s", userID))
+}
+
+// SuggestProgress records a suggested change the rules could not (or were
+// not allowed to) apply. It returns false when the same node already has an
+// open suggestion.
+func (m RoadmapModel) SuggestProgress(userID, nodeID, from, to, source string, detail map[string]any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.DB.ExecContext(ctx, `
+		INSERT INTO roadmap_progress_events (user_id, node_id, from_status, to_status, source, applied, detail)
+		VALUES ($1, $2, $3, $4, $5, false, $6)
+		ON CONFLICT (user_id, node_id) WHERE NOT applied AND resolved_at IS NULL DO NOTHING`,
+		userID, nodeID, from, to, source, detailJSON)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetProgressEvents lists a user's progress history, newest first. With
+// suggestionsOnly it returns just the open suggestions. An empty roadmapID
+// covers every roadmap.
+func (m RoadmapModel) GetProgressEvents(userID, roadmapID string, suggestionsOnly bool) ([]*ProgressEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT e.id, e.node_id, rn.roadmap_id, b.title, e.from_status, e.to_status, e.source, e.applied,
+			e.detail, e.created_at, e.resolved_at
+		FROM roadmap_progress_events e
+		JOIN roadmap_nodes rn ON rn.id = e.node_id
+		JOIN books b ON b.id = rn.book_id
+		WHERE e.user_id = $1
+		AND ($2 = '' OR rn.roadmap_id::text = $2)
+		AND (NOT $3 OR (NOT e.applied AND e.resolved_at IS NULL))
+		ORDER BY e.created_at DESC
+		LIMIT 200`, userID, roadmapID, suggestionsOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*ProgressEvent{}
+	for rows.Next() {
+		var e ProgressEvent
+		var detail []byte
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&e.ID, &e.NodeID, &e.RoadmapID, &e.BookTitle, &e.FromStatus, &e.ToStatus, &e.Source,
+			&e.Applied, &detail, &e.CreatedAt, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Detail = detail
+		if resolvedAt.Valid {
+			e.ResolvedAt = &resolvedAt.Time
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// DismissSuggestion resolves one of the user's open suggestions without
+// applying it.
+func (m RoadmapModel) DismissSuggestion(id, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE roadmap_progress_events SET resolved_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND NOT applied AND resolved_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
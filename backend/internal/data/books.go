@@ -27,6 +27,7 @@ type Book struct {
 	ResourceCount  int             `json:"resource_count"`
 	Status         string          `json:"status"`
 	ReviewerID     *string         `json:"reviewer_id"`
+	Slug           *string         `json:"slug"` // stable reference for curriculum documents
 }
 
 // BookModel wraps the database connection pool for Book-related operations.
@@ -39,8 +40,8 @@ type BookModel struct {
 // It returns the ID, creation time, and initial version of the newly created book.
 func (m BookModel) Insert(book *Book) error {
 	query := `
-		INSERT INTO books (title, original_author, description, cover_image_url, metadata, is_public, title_ar, author_ar, status, reviewer_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO books (title, original_author, description, cover_image_url, metadata, is_public, title_ar, author_ar, status, reviewer_id, slug)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -48,11 +49,14 @@ func (m BookModel) Insert(book *Book) error {
 
 	args := []any{
 		book.Title, book.OriginalAuthor, book.Description, book.CoverImageURL, book.Metadata, book.IsPublic, book.TitleAr, book.OriginalAuthorAr,
-		book.Status, book.ReviewerID,
+		book.Status, book.ReviewerID, book.Slug,
 	}
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateSlug
+		}
 		return err
 	}
 
@@ -75,7 +79,7 @@ func (m BookModel) Get(id string) (*Book, error) {
 	}
 
 	query := `
-		SELECT id, title, original_author, COALESCE(description, ''), COALESCE(cover_image_url, ''), COALESCE(metadata, '{}'), is_public, created_at, version, title_ar, author_ar, status, reviewer_id
+		SELECT id, title, original_author, COALESCE(description, ''), COALESCE(cover_image_url, ''), COALESCE(metadata, '{}'), is_public, created_at, version, title_ar, author_ar, status, reviewer_id, slug
 		FROM books
 		WHERE id = $1`
 
@@ -96,6 +100,7 @@ func (m BookModel) Get(id string) (*Book, error) {
 		&book.OriginalAuthorAr,
 		&book.Status,
 		&book.ReviewerID,
+		&book.Slug,
 	)
 
 	if err != nil {
@@ -116,9 +121,9 @@ func (m BookModel) Get(id string) (*Book, error) {
 func (m BookModel) GetAll(title string, filters Filters, status string) ([]*Book, Metadata, error) {
 	query := `
 		SELECT count(*) OVER(), id, title, original_author, COALESCE(description, ''), COALESCE(cover_image_url, ''), COALESCE(metadata, '{}'), is_public, created_at, version, title_ar, author_ar,
-		(SELECT COUNT(*) FROM resources WHERE book_id = books.id) as resource_count, status, reviewer_id
+		(SELECT COUNT(*) FROM resources WHERE book_id = books.id) as resource_count, status, reviewer_id, slug
 		FROM books
-		WHERE (title ILIKE '%' || $1 || '%' OR original_author ILIKE '%' || $1 || '%' OR title_ar ILIKE '%' || $1 || '%' OR author_ar ILIKE '%' || $1 || '%' OR $1 = '')
+		WHERE (title ILIKE '%' || $1 || '%' OR original_author ILIKE '%' || $1 || '%' OR normalize_arabic(COALESCE(title_ar, '') || ' ' || COALESCE(author_ar, '')) LIKE '%' || replace(replace(replace(normalize_arabic($1), '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\' OR $1 = '')
         AND ($4::boolean IS NULL OR is_public = $4)
         AND ($5 = '' OR status::text = $5)
 		ORDER BY id DESC
@@ -153,6 +158,7 @@ func (m BookModel) GetAll(title string, filters Filters, status string) ([]*Book
 			&book.ResourceCount,
 			&book.Status,
 			&book.ReviewerID,
+			&book.Slug,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -174,8 +180,8 @@ func (m BookModel) GetAll(title string, filters Filters, status string) ([]*Book
 func (m BookModel) Update(book *Book) error {
 	query := `
 		UPDATE books
-		SET title = $1, original_author = $2, description = $3, cover_image_url = $4, metadata = $5, is_public = $6, title_ar = $7, author_ar = $8, status = $9, reviewer_id = $10, version = version + 1
-		WHERE id = $11
+		SET title = $1, original_author = $2, description = $3, cover_image_url = $4, metadata = $5, is_public = $6, title_ar = $7, author_ar = $8, status = $9, reviewer_id = $10, slug = $11, version = version + 1
+		WHERE id = $12
 		RETURNING version`
 
 	args := []any{
@@ -189,6 +195,7 @@ func (m BookModel) Update(book *Book) error {
 		book.OriginalAuthorAr,
 		book.Status,
 		book.ReviewerID,
+		book.Slug,
 		book.ID,
 	}
 
@@ -197,6 +204,9 @@ func (m BookModel) Update(book *Book) error {
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateSlug
+		}
 		return err
 	}
 
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// Certificate is an issued roadmap completion certificate. Payload is the
+// signed JSON document; its contents are what verification shows.
+type Certificate struct {
+	ID        string    `json:"id"`
+	Code      string    `json:"code"`
+	UserID    string    `json:"user_id"`
+	RoadmapID string    `json:"roadmap_id"`
+	Payload   string    `json:"-"`
+	Signature string    `json:"signature"`
+	KeyID     string    `json:"key_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+}
+
+// CompletedNode is one step of a roadmap and when the user completed it.
+type CompletedNode struct {
+	BookID      string
+	BookTitle   string
+	Completed   bool
+	CompletedAt time.Time
+}
+
+// CertificateModel wraps the database connection pool for certificates.
+type CertificateModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// GetCompletion returns the title of a curated roadmap and the user's
+// completion of each of its nodes, in roadmap order. Personal roadmaps are
+// not eligible for certificates and return ErrRecordNotFound.
+func (m CertificateModel) GetCompletion(userID, roadmapID string) (string, []CompletedNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var title string
+	err := m.DB.QueryRowContext(ctx,
+		`SELECT title FROM roadmaps WHERE id = $1 AND owner_id IS NULL`, roadmapID).Scan(&title)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrRecordNotFound
+		}
+		return "", nil, err
+	}
+
+	query := `
+		SELECT rn.book_id, b.title, COALESCE(up.status = 'completed', false), COALESCE(up.last_updated_at, NOW())
+		FROM roadmap_nodes rn
+		JOIN books b ON b.id = rn.book_id
+		LEFT JOIN user_roadmap_progress up ON up.node_id = rn.id AND up.user_id = $1
+		WHERE rn.roadmap_id = $2
+		ORDER BY rn.sequence_index ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, roadmapID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var nodes []CompletedNode
+	for rows.Next() {
+		var n CompletedNode
+		if err := rows.Scan(&n.BookID, &n.BookTitle, &n.Completed, &n.CompletedAt); err != nil {
+			return "", nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return title, nodes, rows.Err()
+}
+
+// Insert stores a new certificate. If the user already holds one for the
+// roadmap, nothing is written and the existing certificate is returned.
+func (m CertificateModel) Insert(c *Certificate) (*Certificate, error) {
+	query := `
+		INSERT INTO certificates (code, user_id, roadmap_id, payload, signature, key_id, issued_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, roadmap_id) DO NOTHING
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, c.Code, c.UserID, c.RoadmapID, c.Payload, c.Signature, c.KeyID, c.IssuedAt).Scan(&c.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.GetForRoadmap(c.UserID, c.RoadmapID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+const certificateColumns = `id, code, user_id, roadmap_id, payload, signature, key_id, issued_at`
+
+func scanCertificate(row interface{ Scan(...any) error }) (*Certificate, error) {
+	var c Certificate
+	err := row.Scan(&c.ID, &c.Code, &c.UserID, &c.RoadmapID, &c.Payload, &c.Signature, &c.KeyID, &c.IssuedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetByCode fetches a certificate by its public verification code.
+func (m CertificateModel) GetByCode(code string) (*Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `SELECT `+certificateColumns+` FROM certificates WHERE code = $1`, code)
+	return scanCertificate(row)
+}
+
+// GetForRoadmap fetches the user's certificate for a roadmap.
+func (m CertificateModel) GetForRoadmap(userID, roadmapID string) (*Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx,
+		`SELECT `+certificateColumns+` FROM certificates WHERE user_id = $1 AND roadmap_id = $2`, userID, roadmapID)
+	return scanCertificate(row)
+}
+
+// GetForUser lists a user's certificates, newest first.
+func (m CertificateModel) GetForUser(userID string) ([]*Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx,
+		`SELECT `+certificateColumns+` FROM certificates WHERE user_id = $1 ORDER BY issued_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certificates := []*Certificate{}
+	for rows.Next() {
+		c, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+	return certificates, rows.Err()
+}
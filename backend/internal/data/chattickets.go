@@ -0,0 +1,43 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CreateChatTicket stores a websocket ticket for a user and chat room and
+// returns when it expires. Expired tickets are cleared out on the way.
+func (m CommunityModel) CreateChatTicket(tokenHash []byte, userID, roomID string, ttl time.Duration) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := m.DB.ExecContext(ctx, `DELETE FROM chat_tickets WHERE expires_at < NOW()`); err != nil {
+		return time.Time{}, err
+	}
+
+	var expiresAt time.Time
+	err := m.DB.QueryRowContext(ctx, `
+		INSERT INTO chat_tickets (token_hash, user_id, room_id, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+		RETURNING expires_at`, tokenHash, userID, roomID, ttl.Seconds()).Scan(&expiresAt)
+	return expiresAt, err
+}
+
+// RedeemChatTicket consumes a ticket and returns the user and room it was
+// issued for. A ticket works once, and only until it expires.
+func (m CommunityModel) RedeemChatTicket(tokenHash []byte) (userID, roomID string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var valid bool
+	err = m.DB.QueryRowContext(ctx, `
+		DELETE FROM chat_tickets
+		WHERE token_hash = $1
+		RETURNING user_id, room_id, expires_at > NOW()`, tokenHash).Scan(&userID, &roomID, &valid)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !valid) {
+		return "", "", ErrRecordNotFound
+	}
+	return userID, roomID, err
+}
@@ -0,0 +1,522 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// Roles a member can hold in a study circle. Every circle has exactly one
+// teacher, the user who created it.
+const (
+	CircleTeacher   = "teacher"
+	CircleAssistant = "assistant"
+	CircleStudent   = "student"
+)
+
+// ErrDuplicateInviteCode is returned when a generated invite code is already taken.
+var ErrDuplicateInviteCode = errors.New("duplicate invite code")
+
+// Circle is a teacher-run study circle (halaqah). Role is the requesting
+// user's role in it, empty when they are not a member.
+type Circle struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	TeacherID    string    `json:"teacher_id"`
+	TeacherName  string    `json:"teacher_name"`
+	BookID       string    `json:"book_id,omitempty"`
+	BookTitle    string    `json:"book_title,omitempty"`
+	RoadmapID    string    `json:"roadmap_id,omitempty"`
+	RoadmapTitle string    `json:"roadmap_title,omitempty"`
+	InviteCode   string    `json:"invite_code,omitempty"`
+	DiscussionID string    `json:"discussion_id"`
+	MemberCount  int       `json:"member_count"`
+	Role         string    `json:"role,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RosterEntry is one member of a circle as the teacher sees them. Progress
+// is the percentage of the circle's assigned book or roadmap completed.
+type RosterEntry struct {
+	UserID        string     `json:"user_id"`
+	UserName      string     `json:"user_name"`
+	Role          string     `json:"role"`
+	Progress      int        `json:"progress"`
+	CurrentStreak int        `json:"current_streak"`
+	LastActiveAt  *time.Time `json:"last_active_at"`
+	JoinedAt      time.Time  `json:"joined_at"`
+}
+
+// CircleModel wraps the database connection pool for study circles.
+type CircleModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// circleSelect loads circles along with the role of the user passed as $1.
+const circleSelect = `
+	SELECT c.id, c.name, c.description, c.teacher_id, COALESCE(u.name, ''),
+		COALESCE(c.book_id::text, ''), COALESCE(b.title, ''),
+		COALESCE(c.roadmap_id::text, ''), COALESCE(r.title, ''),
+		c.invite_code, COALESCE(c.discussion_id::text, ''),
+		(SELECT COUNT(*) FROM circle_members WHERE circle_id = c.id),
+		COALESCE(me.role, ''), c.created_at
+	FROM study_circles c
+	JOIN users u ON u.id = c.teacher_id
+	LEFT JOIN books b ON b.id = c.book_id
+	LEFT JOIN roadmaps r ON r.id = c.roadmap_id
+	LEFT JOIN circle_members me ON me.circle_id = c.id AND me.user_id::text = $1`
+
+func scanCircle(row interface{ Scan(...any) error }) (*Circle, error) {
+	var c Circle
+	err := row.Scan(
+		&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.TeacherName,
+		&c.BookID, &c.BookTitle, &c.RoadmapID, &c.RoadmapTitle,
+		&c.InviteCode, &c.DiscussionID, &c.MemberCount, &c.Role, &c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Insert creates a circle with its private discussion room and makes the
+// teacher its first member.
+func (m CircleModel) Insert(c *Circle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO study_circles (name, description, teacher_id, book_id, roadmap_id, invite_code)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, $6)
+		RETURNING id, created_at`,
+		c.Name, c.Description, c.TeacherID, c.BookID, c.RoadmapID, c.InviteCode,
+	).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateInviteCode
+		}
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO discussions (user_id, context_type, context_id, kind, title, body, last_reply_at)
+		VALUES ($1, 'circle', $2, 'discussion', $3, $4, NOW())
+		RETURNING id`,
+		c.TeacherID, c.ID, c.Name, c.Description,
+	).Scan(&c.DiscussionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE study_circles SET discussion_id = $1 WHERE id = $2`, c.DiscussionID, c.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO circle_members (circle_id, user_id, role)
+		VALUES ($1, $2, 'teacher')`, c.ID, c.TeacherID)
+	if err != nil {
+		return err
+	}
+
+	c.Role = CircleTeacher
+	c.MemberCount = 1
+	return tx.Commit()
+}
+
+// Get fetches a circle with the user's role in it.
+func (m CircleModel) Get(id, userID string) (*Circle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, err := scanCircle(m.DB.QueryRowContext(ctx, circleSelect+` WHERE c.id::text = $2`, userID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetByInviteCode fetches the circle an invite code belongs to.
+func (m CircleModel) GetByInviteCode(code, userID string) (*Circle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, err := scanCircle(m.DB.QueryRowContext(ctx, circleSelect+` WHERE c.invite_code = $2`, userID, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetForUser lists the circles the user belongs to, newest first.
+func (m CircleModel) GetForUser(userID string) ([]*Circle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, circleSelect+` WHERE me.user_id IS NOT NULL ORDER BY c.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	circles := []*Circle{}
+	for rows.Next() {
+		c, err := scanCircle(rows)
+		if err != nil {
+			return nil, err
+		}
+		circles = append(circles, c)
+	}
+	return circles, rows.Err()
+}
+
+// Update saves a circle's name, description and assignment, and keeps the
+// title of its discussion room in step with the name.
+func (m CircleModel) Update(c *Circle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE study_circles
+		SET name = $1, description = $2,
+			book_id = NULLIF($3, '')::uuid, roadmap_id = NULLIF($4, '')::uuid,
+			updated_at = NOW()
+		WHERE id = $5`,
+		c.Name, c.Description, c.BookID, c.RoadmapID, c.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE discussions SET title = $1 WHERE id::text = $2`, c.Name, c.DiscussionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetInviteCode replaces a circle's invite code, so the old one stops working.
+func (m CircleModel) SetInviteCode(circleID, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE study_circles SET invite_code = $1, updated_at = NOW() WHERE id = $2`, code, circleID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateInviteCode
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a circle, its memberships and its discussion room.
+func (m CircleModel) Delete(circleID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var discussionID sql.NullString
+	err = tx.QueryRowContext(ctx, `DELETE FROM study_circles WHERE id = $1 RETURNING discussion_id`, circleID).Scan(&discussionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if discussionID.Valid {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM discussions WHERE id = $1`, discussionID.String); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddMember adds a user to a circle. It reports false when they were
+// already a member, in which case their role is left alone.
+func (m CircleModel) AddMember(circleID, userID, role string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		INSERT INTO circle_members (circle_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (circle_id, user_id) DO NOTHING`, circleID, userID, role)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// SetMemberRole changes a member's role. The teacher's role never changes.
+func (m CircleModel) SetMemberRole(circleID, userID, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE circle_members SET role = $1
+		WHERE circle_id = $2 AND user_id::text = $3 AND role <> 'teacher'`, role, circleID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RemoveMember takes a member out of a circle. The teacher cannot be removed.
+func (m CircleModel) RemoveMember(circleID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		DELETE FROM circle_members
+		WHERE circle_id = $1 AND user_id::text = $2 AND role <> 'teacher'`, circleID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// MemberRole returns the user's role in a circle, or "" if they are not a member.
+func (m CircleModel) MemberRole(circleID, userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT role FROM circle_members
+		WHERE circle_id::text = $1 AND user_id::text = $2`, circleID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+// RoomRole returns the user's role in the circle whose room is the given
+// discussion, or "" if they are not a member. It returns ErrRecordNotFound
+// when the discussion is not a circle room.
+func (m CircleModel) RoomRole(discussionID, userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(cm.role, '')
+		FROM study_circles c
+		LEFT JOIN circle_members cm ON cm.circle_id = c.id AND cm.user_id::text = $2
+		WHERE c.discussion_id::text = $1`, discussionID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+// GetRoster lists a circle's members with their progress through its
+// assigned book or roadmap, their study streak and when they were last
+// active. A streak counts only while the member studied today or yesterday.
+func (m CircleModel) GetRoster(circleID string) ([]*RosterEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT u.id, COALESCE(u.name, ''), cm.role, cm.joined_at,
+			COALESCE(CASE
+				WHEN c.roadmap_id IS NOT NULL THEN (
+					SELECT ROUND(100.0 * COUNT(*) FILTER (WHERE up.status = 'completed') / NULLIF(COUNT(*), 0))::int
+					FROM roadmap_nodes rn
+					LEFT JOIN user_roadmap_progress up ON up.node_id = rn.id AND up.user_id = cm.user_id
+					WHERE rn.roadmap_id = c.roadmap_id)
+				WHEN c.book_id IS NOT NULL THEN (
+					SELECT LEAST(100, ROUND(100.0 * bp.current_page / NULLIF(bp.total_pages, 0)))::int
+					FROM user_book_progress bp
+					WHERE bp.user_id = cm.user_id AND bp.book_id = c.book_id)
+			END, 0),
+			CASE WHEN s.last_study_date >= CURRENT_DATE - 1 THEN s.current_streak ELSE 0 END,
+			GREATEST(
+				s.updated_at,
+				(SELECT MAX(last_updated_at) FROM user_roadmap_progress WHERE user_id = cm.user_id),
+				(SELECT MAX(updated_at) FROM user_book_progress WHERE user_id = cm.user_id)
+			)
+		FROM circle_members cm
+		JOIN study_circles c ON c.id = cm.circle_id
+		JOIN users u ON u.id = cm.user_id
+		LEFT JOIN user_stats s ON s.user_id = cm.user_id
+		WHERE cm.circle_id = $1
+		ORDER BY CASE cm.role WHEN 'teacher' THEN 0 WHEN 'assistant' THEN 1 ELSE 2 END, u.name ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, circleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roster := []*RosterEntry{}
+	for rows.Next() {
+		var e RosterEntry
+		var streak sql.NullInt64
+		var lastActive sql.NullTime
+		if err := rows.Scan(&e.UserID, &e.UserName, &e.Role, &e.JoinedAt, &e.Progress, &streak, &lastActive); err != nil {
+			return nil, err
+		}
+		e.CurrentStreak = int(streak.Int64)
+		if lastActive.Valid {
+			e.LastActiveAt = &lastActive.Time
+		}
+		roster = append(roster, &e)
+	}
+	return roster, rows.Err()
+}
+
+// TeachesStudent reports whether the teacher leads or assists a circle the
+// student studies in.
+func (m CircleModel) TeachesStudent(teacherID, studentID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var teaches bool
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM circle_members t
+			JOIN circle_members s ON s.circle_id = t.circle_id
+			WHERE t.user_id = $1 AND t.role IN ('teacher', 'assistant')
+			AND s.user_id::text = $2 AND s.role = 'student'
+		)`, teacherID, studentID).Scan(&teaches)
+	return teaches, err
+}
+
+// ApprovedTeacher is a user staff have approved to lead circles and grant
+// ijazat.
+type ApprovedTeacher struct {
+	UserID     string    `json:"user_id"`
+	UserName   string    `json:"user_name"`
+	Note       string    `json:"note"`
+	ApprovedBy string    `json:"approved_by,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// IsTeacher reports whether staff have approved the user as a teacher.
+func (m CircleModel) IsTeacher(userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var approved bool
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM teachers WHERE user_id::text = $1)`, userID).Scan(&approved)
+	return approved, err
+}
+
+// ApproveTeacher approves a user as a teacher, or updates the note of one
+// already approved.
+func (m CircleModel) ApproveTeacher(userID, approvedBy, note string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		INSERT INTO teachers (user_id, approved_by, note)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET note = EXCLUDED.note`, userID, approvedBy, note)
+	return err
+}
+
+// RevokeTeacher withdraws a teacher's approval. Their circles and the
+// ijazat they already granted are kept.
+func (m CircleModel) RevokeTeacher(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM teachers WHERE user_id::text = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetTeachers lists the approved teachers, most recently approved first.
+func (m CircleModel) GetTeachers() ([]*ApprovedTeacher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT t.user_id, COALESCE(u.name, ''), t.note, COALESCE(t.approved_by::text, ''), t.approved_at
+		FROM teachers t
+		JOIN users u ON u.id = t.user_id
+		ORDER BY t.approved_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teachers := []*ApprovedTeacher{}
+	for rows.Next() {
+		var t ApprovedTeacher
+		if err := rows.Scan(&t.UserID, &t.UserName, &t.Note, &t.ApprovedBy, &t.ApprovedAt); err != nil {
+			return nil, err
+		}
+		teachers = append(teachers, &t)
+	}
+	return teachers, rows.Err()
+}
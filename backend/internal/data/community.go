@@ -3,6 +3,9 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/draqist/iqraa/backend/internal/cache"
@@ -10,30 +13,72 @@ import (
 
 // Discussion represents a top-level thread
 type Discussion struct {
-	ID          string    `json:"id"`
-	UserID      string    `json:"user_id"`
-	UserName    string    `json:"user_name"`       // Joined from Users table
-	UserRole    string    `json:"user_role"`       // Useful for highlighting Admin/Sheikh posts
-	ContextType string    `json:"context_type"`
-	ContextID   string    `json:"context_id"`
-	Title       string    `json:"title"`           // Can be empty
-	Body        string    `json:"body"`
-	ReplyCount  int       `json:"reply_count"`
-	LastReplyAt time.Time `json:"last_reply_at"`
-	CreatedAt   time.Time `json:"created_at"`
-}
-
-// Reply represents a comment within a thread
+	ID              string    `json:"id"`
+	UserID          string    `json:"user_id"`
+	UserName        string    `json:"user_name"` // Joined from Users table
+	UserRole        string    `json:"user_role"` // Useful for highlighting Admin/Sheikh posts
+	ContextType     string    `json:"context_type"`
+	ContextID       string    `json:"context_id"`
+	Kind            string    `json:"kind"`  // 'discussion' or 'question'
+	Title           string    `json:"title"` // Can be empty
+	Body            string    `json:"body"`
+	ReplyCount      int       `json:"reply_count"`
+	AcceptedReplyID string    `json:"accepted_reply_id,omitempty"`
+	Hidden          bool      `json:"hidden"` // Hidden by a moderator
+	LastReplyAt     time.Time `json:"last_reply_at"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Reply represents a comment within a thread. Replies nest through ParentID;
+// a deleted reply stays as a tombstone (empty body, Deleted set) so its
+// children keep their place. Replies hidden by a moderator are blanked the
+// same way, with Hidden set.
 type Reply struct {
-	ID           string    `json:"id"`
-	DiscussionID string    `json:"discussion_id"`
-	UserID       string    `json:"user_id"`
-	UserName     string    `json:"user_name"`
-	UserRole     string    `json:"user_role"`
-	Body         string    `json:"body"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           string          `json:"id"`
+	DiscussionID string          `json:"discussion_id"`
+	ParentID     string          `json:"parent_id,omitempty"`
+	Depth        int             `json:"depth"`
+	UserID       string          `json:"user_id"`
+	UserName     string          `json:"user_name"`
+	UserRole     string          `json:"user_role"`
+	Body         string          `json:"body"`
+	ChildCount   int             `json:"child_count"`
+	Reactions    []ReactionCount `json:"reactions"`
+	IsAccepted   bool            `json:"is_accepted"`
+	Deleted      bool            `json:"deleted"`
+	Hidden       bool            `json:"hidden"`
+	EditedAt     *time.Time      `json:"edited_at"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// ReactionCount is how many users reacted to a reply with an emoji, and
+// whether the current user is one of them.
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
 }
 
+// ReplyRevision is an earlier version of an edited reply. Deleting a reply
+// records its last body as a revision too, edited by whoever deleted it.
+type ReplyRevision struct {
+	Body      string    `json:"body"`
+	EditedBy  string    `json:"edited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MaxReplyDepth limits how deeply replies nest.
+const MaxReplyDepth = 8
+
+var (
+	// ErrReplyTooDeep is returned when replying below MaxReplyDepth.
+	ErrReplyTooDeep = errors.New("reply nesting too deep")
+	// ErrReplyDeleted is returned when acting on a deleted reply.
+	ErrReplyDeleted = errors.New("reply has been deleted")
+	// ErrInvalidCursor is returned for a malformed pagination cursor.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
 type CommunityModel struct {
 	DB    *sql.DB
 	Cache *cache.Service
@@ -42,29 +87,62 @@ type CommunityModel struct {
 // CreateDiscussion inserts a new thread and returns its ID
 func (m CommunityModel) CreateDiscussion(d *Discussion) error {
 	query := `
-		INSERT INTO discussions (user_id, context_type, context_id, title, body, last_reply_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+		INSERT INTO discussions (user_id, context_type, context_id, kind, title, body, last_reply_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
 		RETURNING id, created_at, last_reply_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, d.UserID, d.ContextType, d.ContextID, d.Title, d.Body).
+	return m.DB.QueryRowContext(ctx, query, d.UserID, d.ContextType, d.ContextID, d.Kind, d.Title, d.Body).
 		Scan(&d.ID, &d.CreatedAt, &d.LastReplyAt)
 }
 
-// GetContextDiscussions fetches threads for a specific context (e.g., Book ID)
+// GetDiscussion fetches a single thread.
+func (m CommunityModel) GetDiscussion(id string) (*Discussion, error) {
+	query := `
+		SELECT
+			d.id, d.user_id, u.name, u.role,
+			d.context_type, d.context_id, d.kind,
+			COALESCE(d.title, ''), d.body,
+			d.reply_count, COALESCE(d.accepted_reply_id::text, ''), d.hidden_at IS NOT NULL,
+			d.last_reply_at, d.created_at
+		FROM discussions d
+		JOIN users u ON d.user_id = u.id
+		WHERE d.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var d Discussion
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&d.ID, &d.UserID, &d.UserName, &d.UserRole,
+		&d.ContextType, &d.ContextID, &d.Kind,
+		&d.Title, &d.Body,
+		&d.ReplyCount, &d.AcceptedReplyID, &d.Hidden, &d.LastReplyAt, &d.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetContextDiscussions fetches threads for a specific context (e.g., Book ID).
+// Threads hidden by a moderator are left out.
 func (m CommunityModel) GetContextDiscussions(contextType, contextID string) ([]*Discussion, error) {
 	// We JOIN users to get the name/role instantly without N+1 queries
 	query := `
 		SELECT 
 			d.id, d.user_id, u.name, u.role, 
-			d.context_type, d.context_id, 
+			d.context_type, d.context_id, d.kind,
 			COALESCE(d.title, ''), d.body, 
-			d.reply_count, d.last_reply_at, d.created_at
+			d.reply_count, COALESCE(d.accepted_reply_id::text, ''), d.last_reply_at, d.created_at
 		FROM discussions d
 		JOIN users u ON d.user_id = u.id
-		WHERE d.context_type = $1 AND d.context_id = $2
+		WHERE d.context_type = $1 AND d.context_id = $2 AND d.hidden_at IS NULL
 		ORDER BY d.last_reply_at DESC -- Most active threads first
 		LIMIT 50`
 
@@ -82,9 +160,9 @@ func (m CommunityModel) GetContextDiscussions(contextType, contextID string) ([]
 		var d Discussion
 		err := rows.Scan(
 			&d.ID, &d.UserID, &d.UserName, &d.UserRole,
-			&d.ContextType, &d.ContextID,
+			&d.ContextType, &d.ContextID, &d.Kind,
 			&d.Title, &d.Body,
-			&d.ReplyCount, &d.LastReplyAt, &d.CreatedAt,
+			&d.ReplyCount, &d.AcceptedReplyID, &d.LastReplyAt, &d.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -95,7 +173,8 @@ func (m CommunityModel) GetContextDiscussions(contextType, contextID string) ([]
 	return discussions, nil
 }
 
-// CreateReply adds a comment and updates the parent thread's timestamp/count
+// CreateReply adds a comment and updates the parent thread's timestamp/count.
+// Replying to another reply (ParentID) nests it one level below its parent.
 func (m CommunityModel) CreateReply(r *Reply) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -107,60 +186,482 @@ func (m CommunityModel) CreateReply(r *Reply) error {
 	}
 	defer tx.Rollback() // Rollback if function exits early
 
-	// 1. Insert Reply
+	// 1. Place it under its parent
+	r.Depth = 0
+	if r.ParentID != "" {
+		var parentDepth int
+		var deleted bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT depth, deleted_at IS NOT NULL FROM discussion_replies
+			WHERE id = $1 AND discussion_id = $2
+			FOR UPDATE`, r.ParentID, r.DiscussionID).Scan(&parentDepth, &deleted)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if deleted {
+			return ErrReplyDeleted
+		}
+		if parentDepth+1 > MaxReplyDepth {
+			return ErrReplyTooDeep
+		}
+		r.Depth = parentDepth + 1
+
+		_, err = tx.ExecContext(ctx, `UPDATE discussion_replies SET child_count = child_count + 1 WHERE id = $1`, r.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 2. Insert Reply
 	queryInsert := `
-		INSERT INTO discussion_replies (discussion_id, user_id, body)
-		VALUES ($1, $2, $3)
+		INSERT INTO discussion_replies (discussion_id, user_id, body, parent_id, depth)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5)
 		RETURNING id, created_at`
-	
-	err = tx.QueryRowContext(ctx, queryInsert, r.DiscussionID, r.UserID, r.Body).Scan(&r.ID, &r.CreatedAt)
+
+	err = tx.QueryRowContext(ctx, queryInsert, r.DiscussionID, r.UserID, r.Body, r.ParentID, r.Depth).Scan(&r.ID, &r.CreatedAt)
 	if err != nil {
 		return err
 	}
+	r.Reactions = []ReactionCount{}
 
-	// 2. Update Parent Discussion (Bump last_reply_at and increment count)
+	// 3. Update Parent Discussion (Bump last_reply_at and increment count)
 	queryUpdate := `
 		UPDATE discussions 
 		SET last_reply_at = NOW(), reply_count = reply_count + 1
 		WHERE id = $1`
-	
-	_, err = tx.ExecContext(ctx, queryUpdate, r.DiscussionID)
+
+	result, err := tx.ExecContext(ctx, queryUpdate, r.DiscussionID)
 	if err != nil {
 		return err
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
 
 	return tx.Commit()
 }
 
-// GetReplies fetches comments for a specific thread
-func (m CommunityModel) GetReplies(discussionID string) ([]*Reply, error) {
+// replyCursor encodes the position after a reply for keyset pagination.
+func replyCursor(r *Reply) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(r.CreatedAt.UTC().Format(time.RFC3339) + "," + r.ID))
+}
+
+func parseReplyCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, id, nil
+}
+
+const replyColumns = `
+	r.id, r.discussion_id, COALESCE(r.parent_id::text, ''), r.depth, r.user_id, u.name, u.role,
+	CASE WHEN r.deleted_at IS NULL AND r.hidden_at IS NULL THEN r.body ELSE '' END, r.child_count,
+	COALESCE(d.accepted_reply_id = r.id, false), r.deleted_at IS NOT NULL, r.hidden_at IS NOT NULL,
+	r.edited_at, r.created_at`
+
+func scanReply(row interface{ Scan(...any) error }) (*Reply, error) {
+	var r Reply
+	var editedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.DiscussionID, &r.ParentID, &r.Depth, &r.UserID, &r.UserName, &r.UserRole,
+		&r.Body, &r.ChildCount, &r.IsAccepted, &r.Deleted, &r.Hidden, &editedAt, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		r.EditedAt = &editedAt.Time
+	}
+	r.Reactions = []ReactionCount{}
+	return &r, nil
+}
+
+// GetReply fetches a single reply of a thread.
+func (m CommunityModel) GetReply(discussionID, replyID string) (*Reply, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r, err := scanReply(m.DB.QueryRowContext(ctx, `
+		SELECT `+replyColumns+`
+		FROM discussion_replies r
+		JOIN users u ON r.user_id = u.id
+		JOIN discussions d ON d.id = r.discussion_id
+		WHERE r.id = $1 AND r.discussion_id = $2`, replyID, discussionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetReplies fetches one page of the direct replies to parentID (the thread
+// itself when empty), oldest first. Deeper replies are fetched by paging
+// their parent. It returns the cursor of the next page, or "" on the last.
+// userID, when set, marks the user's own reactions.
+func (m CommunityModel) GetReplies(discussionID, parentID, userID, cursor string, limit int) ([]*Reply, string, error) {
+	after, afterID := time.Time{}, ""
+	if cursor != "" {
+		var err error
+		if after, afterID, err = parseReplyCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
 	query := `
-		SELECT r.id, r.discussion_id, r.user_id, u.name, u.role, r.body, r.created_at
+		SELECT ` + replyColumns + `
 		FROM discussion_replies r
 		JOIN users u ON r.user_id = u.id
+		JOIN discussions d ON d.id = r.discussion_id
 		WHERE r.discussion_id = $1
-		ORDER BY r.created_at ASC` // Oldest first (Chronological chat style)
+		AND COALESCE(r.parent_id::text, '') = $2
+		AND ($3 = '' OR (r.created_at, r.id::text) > ($4, $3))
+		ORDER BY r.created_at ASC, r.id::text ASC -- Oldest first (Chronological chat style)
+		LIMIT $5`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, discussionID)
+	rows, err := m.DB.QueryContext(ctx, query, discussionID, parentID, afterID, after, limit+1)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var replies []*Reply
+	replies := []*Reply{}
 	for rows.Next() {
-		var r Reply
-		err := rows.Scan(
-			&r.ID, &r.DiscussionID, &r.UserID, &r.UserName, &r.UserRole, &r.Body, &r.CreatedAt,
-		)
+		r, err := scanReply(rows)
 		if err != nil {
+			return nil, "", err
+		}
+		replies = append(replies, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(replies) > limit {
+		replies = replies[:limit]
+		next = replyCursor(replies[limit-1])
+	}
+
+	if err := m.loadReactions(ctx, replies, userID); err != nil {
+		return nil, "", err
+	}
+	return replies, next, nil
+}
+
+// GetReplyHistory fetches up to limit replies of a thread at any depth,
+// oldest first, as a chat history. With afterID it pages forward from that
+// reply, with beforeID backward; with neither (or when the reply is not in
+// the thread) it returns the latest replies. It reports whether newer and
+// older replies remain beyond the page.
+func (m CommunityModel) GetReplyHistory(discussionID, afterID, beforeID string, limit int) ([]*Reply, bool, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	cursorID, forward := beforeID, false
+	if afterID != "" {
+		cursorID, forward = afterID, true
+	}
+
+	var cursor time.Time
+	if cursorID != "" {
+		err := m.DB.QueryRowContext(ctx, `
+			SELECT created_at FROM discussion_replies
+			WHERE id::text = $1 AND discussion_id = $2`, cursorID, discussionID).Scan(&cursor)
+		if errors.Is(err, sql.ErrNoRows) {
+			cursorID = ""
+		} else if err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	var rows *sql.Rows
+	var err error
+	switch {
+	case cursorID == "":
+		rows, err = m.DB.QueryContext(ctx, `
+			SELECT `+replyColumns+`
+			FROM discussion_replies r
+			JOIN users u ON r.user_id = u.id
+			JOIN discussions d ON d.id = r.discussion_id
+			WHERE r.discussion_id = $1
+			ORDER BY r.created_at DESC, r.id::text DESC
+			LIMIT $2`, discussionID, limit+1)
+	case forward:
+		rows, err = m.DB.QueryContext(ctx, `
+			SELECT `+replyColumns+`
+			FROM discussion_replies r
+			JOIN users u ON r.user_id = u.id
+			JOIN discussions d ON d.id = r.discussion_id
+			WHERE r.discussion_id = $1
+			AND (r.created_at, r.id::text) > ($2, $3)
+			ORDER BY r.created_at ASC, r.id::text ASC
+			LIMIT $4`, discussionID, cursor, cursorID, limit+1)
+	default:
+		rows, err = m.DB.QueryContext(ctx, `
+			SELECT `+replyColumns+`
+			FROM discussion_replies r
+			JOIN users u ON r.user_id = u.id
+			JOIN discussions d ON d.id = r.discussion_id
+			WHERE r.discussion_id = $1
+			AND (r.created_at, r.id::text) < ($2, $3)
+			ORDER BY r.created_at DESC, r.id::text DESC
+			LIMIT $4`, discussionID, cursor, cursorID, limit+1)
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer rows.Close()
+
+	replies := []*Reply{}
+	for rows.Next() {
+		r, err := scanReply(rows)
+		if err != nil {
+			return nil, false, false, err
+		}
+		replies = append(replies, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, false, err
+	}
+
+	// The extra row only tells whether the page is the last one that way.
+	full := len(replies) > limit
+	if full {
+		replies = replies[:limit]
+	}
+
+	var newer, older bool
+	if forward {
+		newer, older = full, true
+	} else {
+		// Newest first from the query; history reads oldest first.
+		for i, j := 0, len(replies)-1; i < j; i, j = i+1, j-1 {
+			replies[i], replies[j] = replies[j], replies[i]
+		}
+		newer, older = cursorID != "", full
+	}
+
+	if err := m.loadReactions(ctx, replies, ""); err != nil {
+		return nil, false, false, err
+	}
+	return replies, newer, older, nil
+}
+
+// loadReactions fills in the reaction counts of the given replies.
+func (m CommunityModel) loadReactions(ctx context.Context, replies []*Reply, userID string) error {
+	if len(replies) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Reply, len(replies))
+	ids := make([]string, 0, len(replies))
+	for _, r := range replies {
+		byID[r.ID] = r
+		ids = append(ids, r.ID)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT reply_id::text, emoji, COUNT(*), COALESCE(bool_or(user_id::text = $2), false)
+		FROM discussion_reactions
+		WHERE reply_id = ANY($1::uuid[])
+		GROUP BY reply_id, emoji
+		ORDER BY MIN(created_at)`, ids, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var replyID string
+		var rc ReactionCount
+		if err := rows.Scan(&replyID, &rc.Emoji, &rc.Count, &rc.Reacted); err != nil {
+			return err
+		}
+		if r, ok := byID[replyID]; ok {
+			r.Reactions = append(r.Reactions, rc)
+		}
+	}
+	return rows.Err()
+}
+
+// EditReply replaces a reply's body, keeping the previous body as a revision.
+func (m CommunityModel) EditReply(replyID, editorID, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	var deleted bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT body, deleted_at IS NOT NULL FROM discussion_replies WHERE id = $1 FOR UPDATE`, replyID).
+		Scan(&previous, &deleted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	if deleted {
+		return ErrReplyDeleted
+	}
+	if previous == body {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO discussion_reply_revisions (reply_id, body, edited_by) VALUES ($1, $2, $3)`,
+		replyID, previous, editorID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE discussion_replies SET body = $1, edited_at = NOW() WHERE id = $2`, body, replyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetReplyRevisions lists the earlier versions of a reply, oldest first.
+func (m CommunityModel) GetReplyRevisions(replyID string) ([]*ReplyRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT body, COALESCE(edited_by::text, ''), created_at
+		FROM discussion_reply_revisions
+		WHERE reply_id = $1
+		ORDER BY created_at ASC`, replyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ReplyRevision{}
+	for rows.Next() {
+		var rev ReplyRevision
+		if err := rows.Scan(&rev.Body, &rev.EditedBy, &rev.CreatedAt); err != nil {
 			return nil, err
 		}
-		replies = append(replies, &r)
+		revisions = append(revisions, &rev)
 	}
+	return revisions, rows.Err()
+}
 
-	return replies, nil
-}
\ No newline at end of file
+// DeleteReply turns a reply into a tombstone: its body is cleared but the
+// row stays so nested replies keep their parent. The last body is kept as a
+// revision, with the rest of its history, for moderators. A deleted accepted
+// answer is unmarked.
+func (m CommunityModel) DeleteReply(replyID, deletedBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var discussionID, body string
+	err = tx.QueryRowContext(ctx, `
+		WITH old AS (
+			SELECT id, body FROM discussion_replies
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE
+		)
+		UPDATE discussion_replies r SET body = '', deleted_at = NOW(), deleted_by = $2
+		FROM old
+		WHERE r.id = old.id
+		RETURNING r.discussion_id, old.body`, replyID, deletedBy).Scan(&discussionID, &body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO discussion_reply_revisions (reply_id, body, edited_by) VALUES ($1, $2, $3)`,
+		replyID, body, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`DELETE FROM discussion_reactions WHERE reply_id = $1`,
+		`UPDATE discussions SET accepted_reply_id = NULL WHERE accepted_reply_id = $1`,
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, replyID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE discussions SET reply_count = GREATEST(reply_count - 1, 0) WHERE id = $1`, discussionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ToggleReaction adds the user's reaction to a reply, or removes it if it
+// was already there. It reports whether the reaction is now present.
+func (m CommunityModel) ToggleReaction(replyID, userID, emoji string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		DELETE FROM discussion_reactions WHERE reply_id = $1 AND user_id = $2 AND emoji = $3`,
+		replyID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		INSERT INTO discussion_reactions (reply_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, replyID, userID, emoji)
+	return err == nil, err
+}
+
+// GetReactions returns the reaction counts of one reply.
+func (m CommunityModel) GetReactions(reply *Reply, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	reply.Reactions = []ReactionCount{}
+	return m.loadReactions(ctx, []*Reply{reply}, userID)
+}
+
+// SetAcceptedReply marks a reply as the accepted answer of a question
+// thread; an empty replyID clears it.
+func (m CommunityModel) SetAcceptedReply(discussionID, replyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE discussions SET accepted_reply_id = NULLIF($1, '')::uuid WHERE id = $2`, replyID, discussionID)
+	return err
+}
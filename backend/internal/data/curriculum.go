@@ -0,0 +1,378 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/curriculum"
+)
+
+// ImportResult summarises what an import changed, or would change on a dry run.
+// Unmanaged lists nodes that exist in the roadmap but not in the document;
+// they are kept unless the import prunes them.
+type ImportResult struct {
+	RoadmapID      string   `json:"roadmap_id"`
+	Slug           string   `json:"slug"`
+	DryRun         bool     `json:"dry_run"`
+	RoadmapCreated bool     `json:"roadmap_created"`
+	RoadmapUpdated bool     `json:"roadmap_updated"`
+	NodesCreated   int      `json:"nodes_created"`
+	NodesUpdated   int      `json:"nodes_updated"`
+	NodesUnchanged int      `json:"nodes_unchanged"`
+	NodesRemoved   int      `json:"nodes_removed"`
+	Unmanaged      []string `json:"unmanaged_node_ids"`
+}
+
+// curriculumNode is a node as stored, for matching against a document.
+type curriculumNode struct {
+	id            string
+	key           string
+	bookID        string
+	sequenceIndex int
+	level         string
+	description   string
+	prerequisites []string
+}
+
+// Export renders a curated roadmap as a curriculum document. Books are
+// referenced by slug, and nodes without a key are given one derived from
+// their book so the document can be imported back. Book IDs differ between
+// environments, so a node whose book has no slug fails the export with a
+// curriculum.ValidationError naming it.
+func (m RoadmapModel) Export(idOrSlug string) (*curriculum.Document, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	doc := &curriculum.Document{Version: curriculum.Version, Nodes: []curriculum.Node{}}
+	var roadmapID string
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT id, slug, title, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public
+		FROM roadmaps
+		WHERE (id::text = $1 OR slug = $1) AND owner_id IS NULL`, idOrSlug).
+		Scan(&roadmapID, &doc.Slug, &doc.Title, &doc.Description, &doc.CoverImageURL, &doc.IsPublic)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT rn.id, COALESCE(rn.key, ''), COALESCE(b.slug, ''), b.title, rn.level, COALESCE(rn.description, '')
+		FROM roadmap_nodes rn
+		JOIN books b ON b.id = rn.book_id
+		WHERE rn.roadmap_id = $1
+		ORDER BY rn.sequence_index ASC, rn.id ASC`, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	slugless := curriculum.ValidationError{}
+	for rows.Next() {
+		var id, bookTitle string
+		var n curriculum.Node
+		if err := rows.Scan(&id, &n.Key, &n.Book, &bookTitle, &n.Level, &n.Description); err != nil {
+			return nil, err
+		}
+		if n.Book == "" {
+			slugless[fmt.Sprintf("nodes[%d].book", len(ids))] = fmt.Sprintf("book %q has no slug; give it one before exporting", bookTitle)
+		}
+		ids = append(ids, id)
+		doc.Nodes = append(doc.Nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(slugless) > 0 {
+		return nil, slugless
+	}
+
+	// Fill in missing keys without clashing with existing ones.
+	used := make(map[string]bool, len(doc.Nodes))
+	for _, n := range doc.Nodes {
+		if n.Key != "" {
+			used[n.Key] = true
+		}
+	}
+	keyOf := make(map[string]string, len(ids))
+	for i := range doc.Nodes {
+		n := &doc.Nodes[i]
+		if n.Key == "" {
+			n.Key = n.Book
+			for suffix := 2; used[n.Key]; suffix++ {
+				n.Key = fmt.Sprintf("%s-%d", n.Book, suffix)
+			}
+			used[n.Key] = true
+		}
+		keyOf[ids[i]] = n.Key
+	}
+
+	edges, err := m.getEdges(ctx, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	requires := make(map[string][]string)
+	for _, e := range edges[roadmapID] {
+		requires[e.To] = append(requires[e.To], keyOf[e.From])
+	}
+	for i := range doc.Nodes {
+		if reqs := requires[ids[i]]; len(reqs) > 0 {
+			sort.Strings(reqs)
+			doc.Nodes[i].Requires = reqs
+		}
+	}
+
+	doc.Levels = append([]string{}, curriculum.DefaultLevels...)
+	for _, n := range doc.Nodes {
+		known := false
+		for _, l := range doc.Levels {
+			known = known || l == n.Level
+		}
+		if !known {
+			doc.Levels = append(doc.Levels, n.Level)
+		}
+	}
+
+	return doc, nil
+}
+
+// Import upserts a validated curriculum document. The roadmap is matched by
+// slug and its nodes by key, falling back to an unkeyed node for the same
+// book, so importing the same document twice changes nothing. Node order
+// follows the document. Nodes missing from the document are deleted only
+// when prune is set. With dryRun the changes are computed and rolled back.
+func (m RoadmapModel) Import(doc *curriculum.Document, dryRun, prune bool) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &ImportResult{Slug: doc.Slug, DryRun: dryRun, Unmanaged: []string{}}
+
+	// Resolve book references up front so a bad reference fails the whole import.
+	bookIDs := make([]string, len(doc.Nodes))
+	missing := curriculum.ValidationError{}
+	for i, n := range doc.Nodes {
+		err := tx.QueryRowContext(ctx, `SELECT id FROM books WHERE id::text = $1 OR slug = $1`, n.Book).Scan(&bookIDs[i])
+		if errors.Is(err, sql.ErrNoRows) {
+			missing[fmt.Sprintf("nodes[%d].book", i)] = fmt.Sprintf("no book with slug or id %q", n.Book)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missing
+	}
+
+	var current Roadmap
+	var ownerID sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, title, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, owner_id
+		FROM roadmaps WHERE slug = $1 FOR UPDATE`, doc.Slug).
+		Scan(&current.ID, &current.Title, &current.Description, &current.CoverImageURL, &current.IsPublic, &ownerID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO roadmaps (title, slug, description, cover_image_url, is_public)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`, doc.Title, doc.Slug, doc.Description, doc.CoverImageURL, doc.IsPublic).Scan(&res.RoadmapID)
+		if err != nil {
+			return nil, err
+		}
+		res.RoadmapCreated = true
+	case err != nil:
+		return nil, err
+	case ownerID.Valid:
+		return nil, curriculum.ValidationError{"slug": "belongs to a personal roadmap"}
+	default:
+		res.RoadmapID = current.ID
+		if current.Title != doc.Title || current.Description != doc.Description ||
+			current.CoverImageURL != doc.CoverImageURL || current.IsPublic != doc.IsPublic {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE roadmaps SET title = $1, description = $2, cover_image_url = $3, is_public = $4, updated_at = NOW()
+				WHERE id = $5`, doc.Title, doc.Description, doc.CoverImageURL, doc.IsPublic, current.ID)
+			if err != nil {
+				return nil, err
+			}
+			res.RoadmapUpdated = true
+		}
+	}
+
+	existing, err := m.curriculumNodes(ctx, tx, res.RoadmapID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Match document nodes to stored ones: by key first, then by book.
+	matched := make([]*curriculumNode, len(doc.Nodes))
+	taken := make(map[string]bool)
+	for i, n := range doc.Nodes {
+		for _, e := range existing {
+			if e.key == n.Key {
+				matched[i] = e
+				taken[e.id] = true
+				break
+			}
+		}
+	}
+	for i := range doc.Nodes {
+		if matched[i] != nil {
+			continue
+		}
+		for _, e := range existing {
+			if !taken[e.id] && e.key == "" && e.bookID == bookIDs[i] {
+				matched[i] = e
+				taken[e.id] = true
+				break
+			}
+		}
+	}
+
+	for _, e := range existing {
+		if taken[e.id] {
+			continue
+		}
+		if !prune {
+			res.Unmanaged = append(res.Unmanaged, e.id)
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM roadmap_nodes WHERE id = $1`, e.id); err != nil {
+			return nil, err
+		}
+		res.NodesRemoved++
+	}
+
+	nodeIDs := make(map[string]string, len(doc.Nodes))
+	changed := make([]bool, len(doc.Nodes))
+	for i, n := range doc.Nodes {
+		seq := i + 1
+		e := matched[i]
+		if e == nil {
+			var id string
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO roadmap_nodes (roadmap_id, book_id, sequence_index, level, description, key)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING id`, res.RoadmapID, bookIDs[i], seq, n.Level, n.Description, n.Key).Scan(&id)
+			if err != nil {
+				return nil, err
+			}
+			nodeIDs[n.Key] = id
+			res.NodesCreated++
+			continue
+		}
+
+		nodeIDs[n.Key] = e.id
+		if e.key != n.Key || e.bookID != bookIDs[i] || e.sequenceIndex != seq ||
+			e.level != n.Level || e.description != n.Description {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE roadmap_nodes SET key = $1, book_id = $2, sequence_index = $3, level = $4, description = $5
+				WHERE id = $6`, n.Key, bookIDs[i], seq, n.Level, n.Description, e.id)
+			if err != nil {
+				return nil, err
+			}
+			changed[i] = true
+		}
+	}
+
+	for i, n := range doc.Nodes {
+		want := make([]string, 0, len(n.Requires))
+		for _, req := range n.Requires {
+			want = append(want, nodeIDs[req])
+		}
+		sort.Strings(want)
+
+		e := matched[i]
+		if e != nil && reflect.DeepEqual(e.prerequisites, want) {
+			continue
+		}
+		if e != nil {
+			changed[i] = true
+		}
+		id := nodeIDs[n.Key]
+		if _, err := tx.ExecContext(ctx, `DELETE FROM roadmap_node_prerequisites WHERE node_id = $1`, id); err != nil {
+			return nil, err
+		}
+		for _, prereqID := range want {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO roadmap_node_prerequisites (node_id, prerequisite_id) VALUES ($1, $2)`, id, prereqID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := range doc.Nodes {
+		switch {
+		case matched[i] == nil:
+		case changed[i]:
+			res.NodesUpdated++
+		default:
+			res.NodesUnchanged++
+		}
+	}
+
+	if dryRun {
+		return res, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	m.Cache.Delete(context.Background(), "roadmap:slug:*")
+	m.Cache.Delete(context.Background(), "roadmaps:list:*")
+	return res, nil
+}
+
+// curriculumNodes loads a roadmap's nodes with their prerequisite IDs, sorted.
+func (m RoadmapModel) curriculumNodes(ctx context.Context, q queryer, roadmapID string) ([]*curriculumNode, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, COALESCE(key, ''), book_id, sequence_index, level, COALESCE(description, '')
+		FROM roadmap_nodes
+		WHERE roadmap_id = $1
+		ORDER BY sequence_index ASC, id ASC`, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*curriculumNode
+	byID := make(map[string]*curriculumNode)
+	for rows.Next() {
+		n := &curriculumNode{prerequisites: []string{}}
+		if err := rows.Scan(&n.id, &n.key, &n.bookID, &n.sequenceIndex, &n.level, &n.description); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		byID[n.id] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, edges, err := loadGraph(ctx, q, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range edges {
+		if n, ok := byID[e.To]; ok {
+			n.prerequisites = append(n.prerequisites, e.From)
+		}
+	}
+	for _, n := range nodes {
+		sort.Strings(n.prerequisites)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,517 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ErrNoUpstream is returned when diffing a roadmap that is not a fork, or
+// whose original has been deleted.
+var ErrNoUpstream = errors.New("roadmap has no upstream")
+
+// RoadmapNodeSnapshot is the comparable state of one roadmap node. For fork
+// nodes, Prerequisites are expressed as upstream node IDs where possible so
+// they can be compared with the original.
+type RoadmapNodeSnapshot struct {
+	NodeID         string   `json:"node_id"`
+	UpstreamNodeID string   `json:"upstream_node_id,omitempty"`
+	BookID         string   `json:"book_id"`
+	BookTitle      string   `json:"book_title"`
+	SequenceIndex  int      `json:"sequence_index"`
+	Level          string   `json:"level"`
+	Description    string   `json:"description"`
+	Prerequisites  []string `json:"prerequisites"`
+}
+
+// RoadmapChange is one upstream change not yet merged into a fork.
+// Conflict is set when the fork also changed (or deleted) the node since it
+// last synced, so merging would overwrite the user's edit.
+type RoadmapChange struct {
+	Kind           string               `json:"kind"` // added, removed, modified
+	UpstreamNodeID string               `json:"upstream_node_id"`
+	Fields         []string             `json:"fields,omitempty"`
+	Upstream       *RoadmapNodeSnapshot `json:"upstream,omitempty"`
+	Local          *RoadmapNodeSnapshot `json:"local,omitempty"`
+	Conflict       bool                 `json:"conflict"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// loadSnapshot reads the nodes and prerequisite edges of a roadmap.
+func loadSnapshot(ctx context.Context, q queryer, roadmapID string) ([]RoadmapNodeSnapshot, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT rn.id, COALESCE(rn.upstream_node_id::text, ''), rn.book_id, b.title,
+			rn.sequence_index, rn.level, COALESCE(rn.description, '')
+		FROM roadmap_nodes rn
+		JOIN books b ON b.id = rn.book_id
+		WHERE rn.roadmap_id = $1
+		ORDER BY rn.sequence_index ASC`, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []RoadmapNodeSnapshot
+	index := make(map[string]int)
+	for rows.Next() {
+		var n RoadmapNodeSnapshot
+		err := rows.Scan(&n.NodeID, &n.UpstreamNodeID, &n.BookID, &n.BookTitle,
+			&n.SequenceIndex, &n.Level, &n.Description)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		n.Prerequisites = []string{}
+		index[n.NodeID] = len(nodes)
+		nodes = append(nodes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.QueryContext(ctx, `
+		SELECT p.node_id, p.prerequisite_id
+		FROM roadmap_node_prerequisites p
+		JOIN roadmap_nodes rn ON rn.id = p.node_id
+		WHERE rn.roadmap_id = $1`, roadmapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nodeID, prereqID string
+		if err := rows.Scan(&nodeID, &prereqID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[nodeID]; ok {
+			nodes[i].Prerequisites = append(nodes[i].Prerequisites, prereqID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Express fork prerequisites in upstream terms so they compare cleanly.
+	upstreamOf := make(map[string]string)
+	for _, n := range nodes {
+		if n.UpstreamNodeID != "" {
+			upstreamOf[n.NodeID] = n.UpstreamNodeID
+		}
+	}
+	for i := range nodes {
+		for j, p := range nodes[i].Prerequisites {
+			if up, ok := upstreamOf[p]; ok {
+				nodes[i].Prerequisites[j] = up
+			}
+		}
+		sort.Strings(nodes[i].Prerequisites)
+	}
+
+	return nodes, nil
+}
+
+// changedFields lists the fields that differ between two node snapshots.
+func changedFields(a, b RoadmapNodeSnapshot) []string {
+	var fields []string
+	if a.BookID != b.BookID {
+		fields = append(fields, "book_id")
+	}
+	if a.SequenceIndex != b.SequenceIndex {
+		fields = append(fields, "sequence_index")
+	}
+	if a.Level != b.Level {
+		fields = append(fields, "level")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+	if !reflect.DeepEqual(a.Prerequisites, b.Prerequisites) {
+		fields = append(fields, "prerequisites")
+	}
+	return fields
+}
+
+// diffRoadmap compares the upstream roadmap with the base the fork last
+// synced with. Local fork nodes are matched by their upstream node ID.
+func diffRoadmap(base, upstream, local []RoadmapNodeSnapshot) []RoadmapChange {
+	baseBy := make(map[string]RoadmapNodeSnapshot, len(base))
+	for _, b := range base {
+		baseBy[b.NodeID] = b
+	}
+	upBy := make(map[string]bool, len(upstream))
+	localBy := make(map[string]*RoadmapNodeSnapshot)
+	for i := range local {
+		if local[i].UpstreamNodeID != "" {
+			localBy[local[i].UpstreamNodeID] = &local[i]
+		}
+	}
+
+	changes := []RoadmapChange{}
+	for i := range upstream {
+		u := &upstream[i]
+		upBy[u.NodeID] = true
+		l := localBy[u.NodeID]
+
+		b, ok := baseBy[u.NodeID]
+		if !ok {
+			changes = append(changes, RoadmapChange{Kind: "added", UpstreamNodeID: u.NodeID, Upstream: u, Local: l})
+			continue
+		}
+		if fields := changedFields(b, *u); len(fields) > 0 {
+			changes = append(changes, RoadmapChange{
+				Kind: "modified", UpstreamNodeID: u.NodeID, Fields: fields, Upstream: u, Local: l,
+				Conflict: l == nil || len(changedFields(b, *l)) > 0,
+			})
+		}
+	}
+	for _, b := range base {
+		if upBy[b.NodeID] {
+			continue
+		}
+		l := localBy[b.NodeID]
+		changes = append(changes, RoadmapChange{
+			Kind: "removed", UpstreamNodeID: b.NodeID, Local: l,
+			Conflict: l != nil && len(changedFields(b, *l)) > 0,
+		})
+	}
+	return changes
+}
+
+// Fork copies a public curated roadmap into a private roadmap owned by the
+// user, including prerequisites and the user's progress on the original.
+// fork must carry the new Slug; the remaining fields are filled in.
+func (m RoadmapModel) Fork(sourceID, userID string, fork *Roadmap) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT title, COALESCE(description, ''), COALESCE(cover_image_url, '')
+		FROM roadmaps
+		WHERE id = $1 AND owner_id IS NULL AND is_public = true`, sourceID).
+		Scan(&fork.Title, &fork.Description, &fork.CoverImageURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	base, err := loadSnapshot(ctx, tx, sourceID)
+	if err != nil {
+		return err
+	}
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO roadmaps (title, slug, description, cover_image_url, is_public, owner_id, forked_from_id, upstream_base)
+		VALUES ($1, $2, $3, $4, false, $5, $6, $7)
+		RETURNING id, created_at`,
+		fork.Title, fork.Slug, fork.Description, fork.CoverImageURL, userID, sourceID, baseJSON).
+		Scan(&fork.ID, &fork.CreatedAt)
+	if err != nil {
+		return err
+	}
+	fork.OwnerID = userID
+	fork.ForkedFromID = sourceID
+
+	queries := []string{
+		`INSERT INTO roadmap_nodes (roadmap_id, book_id, sequence_index, level, description, upstream_node_id)
+		SELECT $1, book_id, sequence_index, level, description, id
+		FROM roadmap_nodes WHERE roadmap_id = $2`,
+
+		`INSERT INTO roadmap_node_prerequisites (node_id, prerequisite_id)
+		SELECT fn.id, fp.id
+		FROM roadmap_node_prerequisites p
+		JOIN roadmap_nodes fn ON fn.upstream_node_id = p.node_id AND fn.roadmap_id = $1
+		JOIN roadmap_nodes fp ON fp.upstream_node_id = p.prerequisite_id AND fp.roadmap_id = $1`,
+
+		`INSERT INTO user_roadmap_progress (user_id, node_id, status, last_updated_at)
+		SELECT $2, fn.id, up.status, up.last_updated_at
+		FROM roadmap_nodes fn
+		JOIN user_roadmap_progress up ON up.node_id = fn.upstream_node_id AND up.user_id = $2
+		WHERE fn.roadmap_id = $1`,
+	}
+	args := [][]any{{fork.ID, sourceID}, {fork.ID}, {fork.ID, userID}}
+	for i, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, args[i]...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetOwned lists the personal roadmaps of a user, without nodes.
+func (m RoadmapModel) GetOwned(userID string) ([]*Roadmap, error) {
+	query := `
+		SELECT r.id, r.title, r.slug, COALESCE(r.description, ''), COALESCE(r.cover_image_url, ''), r.is_public,
+			r.created_at, COALESCE(r.forked_from_id::text, ''), COALESCE(r.share_token, ''),
+			(SELECT COUNT(*) FROM roadmap_nodes rn WHERE rn.roadmap_id = r.id)
+		FROM roadmaps r
+		WHERE r.owner_id = $1
+		ORDER BY r.created_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roadmaps := []*Roadmap{}
+	for rows.Next() {
+		r := &Roadmap{OwnerID: userID}
+		err := rows.Scan(&r.ID, &r.Title, &r.Slug, &r.Description, &r.CoverImageURL, &r.IsPublic,
+			&r.CreatedAt, &r.ForkedFromID, &r.ShareToken, &r.NodesCount)
+		if err != nil {
+			return nil, err
+		}
+		roadmaps = append(roadmaps, r)
+	}
+	return roadmaps, rows.Err()
+}
+
+// GetSlugByShareToken resolves a share link to the roadmap's slug.
+func (m RoadmapModel) GetSlugByShareToken(token string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var slug string
+	err := m.DB.QueryRowContext(ctx, `SELECT slug FROM roadmaps WHERE share_token = $1`, token).Scan(&slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+	return slug, nil
+}
+
+// SetShareToken sets or, with an empty token, revokes a roadmap's share link.
+func (m RoadmapModel) SetShareToken(id, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`UPDATE roadmaps SET share_token = NULLIF($1, ''), updated_at = NOW() WHERE id = $2`, token, id)
+	if err != nil {
+		return err
+	}
+	return m.Cache.Delete(context.Background(), "roadmap:slug:*")
+}
+
+// GetNodeRoadmapID returns the roadmap a node belongs to.
+func (m RoadmapModel) GetNodeRoadmapID(nodeID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var roadmapID string
+	err := m.DB.QueryRowContext(ctx, `SELECT roadmap_id FROM roadmap_nodes WHERE id = $1`, nodeID).Scan(&roadmapID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+	return roadmapID, nil
+}
+
+// forkState loads everything needed to diff a fork against its upstream.
+func (m RoadmapModel) forkState(ctx context.Context, q queryer, forkID string, lock bool) (base, upstream, local []RoadmapNodeSnapshot, err error) {
+	query := `SELECT forked_from_id, upstream_base FROM roadmaps WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var upstreamID sql.NullString
+	var baseJSON []byte
+	err = q.QueryRowContext(ctx, query, forkID).Scan(&upstreamID, &baseJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrRecordNotFound
+		}
+		return
+	}
+	if !upstreamID.Valid {
+		err = ErrNoUpstream
+		return
+	}
+	if len(baseJSON) > 0 {
+		if err = json.Unmarshal(baseJSON, &base); err != nil {
+			return
+		}
+	}
+
+	if upstream, err = loadSnapshot(ctx, q, upstreamID.String); err != nil {
+		return
+	}
+	local, err = loadSnapshot(ctx, q, forkID)
+	return
+}
+
+// UpstreamDiff lists the changes made to the original roadmap since the fork
+// was created or last merged.
+func (m RoadmapModel) UpstreamDiff(forkID string) ([]RoadmapChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	base, upstream, local, err := m.forkState(ctx, m.DB, forkID, false)
+	if err != nil {
+		return nil, err
+	}
+	return diffRoadmap(base, upstream, local), nil
+}
+
+// MergeUpstream applies upstream changes to a fork. An empty upstreamNodeIDs
+// merges every change; otherwise only the listed nodes are merged and the
+// rest stay pending. Merged nodes take the upstream version, overwriting
+// local edits. It returns the number of changes applied.
+func (m RoadmapModel) MergeUpstream(forkID string, upstreamNodeIDs []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	base, upstream, local, err := m.forkState(ctx, tx, forkID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range upstreamNodeIDs {
+		selected[id] = true
+	}
+
+	localByUp := make(map[string]string)
+	for _, l := range local {
+		if l.UpstreamNodeID != "" {
+			localByUp[l.UpstreamNodeID] = l.NodeID
+		}
+	}
+
+	var merged []RoadmapChange
+	for _, c := range diffRoadmap(base, upstream, local) {
+		if len(selected) == 0 || selected[c.UpstreamNodeID] {
+			merged = append(merged, c)
+		}
+	}
+
+	for _, c := range merged {
+		localID, exists := localByUp[c.UpstreamNodeID]
+		switch {
+		case c.Kind == "removed":
+			if exists {
+				if _, err := tx.ExecContext(ctx, `DELETE FROM roadmap_nodes WHERE id = $1`, localID); err != nil {
+					return 0, err
+				}
+				delete(localByUp, c.UpstreamNodeID)
+			}
+		case exists:
+			u := c.Upstream
+			_, err := tx.ExecContext(ctx, `
+				UPDATE roadmap_nodes SET book_id = $1, sequence_index = $2, level = $3, description = $4
+				WHERE id = $5`, u.BookID, u.SequenceIndex, u.Level, u.Description, localID)
+			if err != nil {
+				return 0, err
+			}
+		default:
+			u := c.Upstream
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO roadmap_nodes (roadmap_id, book_id, sequence_index, level, description, upstream_node_id)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING id`, forkID, u.BookID, u.SequenceIndex, u.Level, u.Description, u.NodeID).Scan(&localID)
+			if err != nil {
+				return 0, err
+			}
+			localByUp[c.UpstreamNodeID] = localID
+		}
+	}
+
+	// Prerequisites are applied once every merged node exists locally.
+	for _, c := range merged {
+		if c.Kind == "removed" {
+			continue
+		}
+		localID := localByUp[c.UpstreamNodeID]
+		if _, err := tx.ExecContext(ctx, `DELETE FROM roadmap_node_prerequisites WHERE node_id = $1`, localID); err != nil {
+			return 0, err
+		}
+		for _, p := range c.Upstream.Prerequisites {
+			prereqID, ok := localByUp[p]
+			if !ok {
+				continue
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO roadmap_node_prerequisites (node_id, prerequisite_id) VALUES ($1, $2)`, localID, prereqID)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Local prerequisites may combine with upstream ones into a cycle.
+	ids, edges, err := loadGraph(ctx, tx, forkID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := layerNodes(ids, edges); err != nil {
+		return 0, err
+	}
+
+	// Advance the base only for what was merged, so skipped changes remain
+	// in the next diff.
+	baseBy := make(map[string]RoadmapNodeSnapshot, len(base))
+	for _, b := range base {
+		baseBy[b.NodeID] = b
+	}
+	for _, c := range merged {
+		if c.Kind == "removed" {
+			delete(baseBy, c.UpstreamNodeID)
+		} else {
+			baseBy[c.UpstreamNodeID] = *c.Upstream
+		}
+	}
+	newBase := make([]RoadmapNodeSnapshot, 0, len(baseBy))
+	for _, b := range baseBy {
+		newBase = append(newBase, b)
+	}
+	sort.Slice(newBase, func(i, j int) bool { return newBase[i].SequenceIndex < newBase[j].SequenceIndex })
+	baseJSON, err := json.Marshal(newBase)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE roadmaps SET upstream_base = $1, updated_at = NOW() WHERE id = $2`, baseJSON, forkID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	m.Cache.Delete(context.Background(), "roadmap:slug:*")
+	return len(merged), nil
+}
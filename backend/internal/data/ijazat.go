@@ -0,0 +1,330 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// IjazahTypes are the kinds of ijazah a teacher can grant: to transmit the
+// text (riwayah), to teach it (tadris), or for blessing (tabarruk).
+var IjazahTypes = []string{"riwayah", "tadris", "tabarruk"}
+
+// IjazahCompletions are the ways a student can complete a text with their
+// teacher: reciting it in full from memory, or reading it in full.
+var IjazahCompletions = []string{"recitation", "reading"}
+
+// ErrSanadInUse is returned when deleting a recorded sanad link that other
+// ijazat already build on.
+var ErrSanadInUse = errors.New("sanad is referenced by other ijazat")
+
+// Ijazah is a teacher's attestation that a student completed a text.
+// ParentID is the teacher's own ijazah for the text. Verified ijazat were
+// granted on the platform and carry a public code and a signed payload;
+// unverified ones are sanad links recorded by their student.
+type Ijazah struct {
+	ID          string     `json:"id"`
+	Code        string     `json:"code,omitempty"`
+	StudentID   string     `json:"student_id,omitempty"`
+	StudentName string     `json:"student_name"`
+	TeacherID   string     `json:"teacher_id,omitempty"`
+	TeacherName string     `json:"teacher_name"`
+	ParentID    string     `json:"parent_id,omitempty"`
+	BookID      string     `json:"book_id,omitempty"`
+	TextTitle   string     `json:"text_title"`
+	Type        string     `json:"type"`
+	Completion  string     `json:"completion"`
+	GrantedOn   time.Time  `json:"granted_on"`
+	Notes       string     `json:"notes"`
+	Verified    bool       `json:"verified"`
+	Payload     string     `json:"-"`
+	Signature   string     `json:"-"`
+	KeyID       string     `json:"-"`
+	RecordedBy  string     `json:"-"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SanadLink is one ijazah in a chain of transmission.
+type SanadLink struct {
+	IjazahID    string    `json:"ijazah_id"`
+	Code        string    `json:"code,omitempty"`
+	StudentName string    `json:"student_name"`
+	TeacherID   string    `json:"teacher_id,omitempty"`
+	TeacherName string    `json:"teacher_name"`
+	TextTitle   string    `json:"text_title"`
+	GrantedOn   time.Time `json:"granted_on"`
+	Verified    bool      `json:"verified"`
+	Revoked     bool      `json:"revoked"`
+}
+
+// IjazahModel wraps the database connection pool for ijazat.
+type IjazahModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// maxSanadDepth stops chain walks on data that loops back on itself.
+const maxSanadDepth = 100
+
+const ijazahColumns = `
+	id, COALESCE(code, ''), COALESCE(student_id::text, ''), student_name,
+	COALESCE(teacher_id::text, ''), teacher_name, COALESCE(parent_id::text, ''),
+	COALESCE(book_id::text, ''), text_title, type, completion, granted_on, notes,
+	verified, COALESCE(payload, ''), COALESCE(signature, ''), key_id, COALESCE(recorded_by::text, ''),
+	revoked_at, created_at`
+
+func scanIjazah(row interface{ Scan(...any) error }) (*Ijazah, error) {
+	var i Ijazah
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&i.ID, &i.Code, &i.StudentID, &i.StudentName,
+		&i.TeacherID, &i.TeacherName, &i.ParentID,
+		&i.BookID, &i.TextTitle, &i.Type, &i.Completion, &i.GrantedOn, &i.Notes,
+		&i.Verified, &i.Payload, &i.Signature, &i.KeyID, &i.RecordedBy,
+		&revokedAt, &i.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	if revokedAt.Valid {
+		i.RevokedAt = &revokedAt.Time
+	}
+	return &i, nil
+}
+
+// Insert stores an ijazah granted on the platform.
+func (m IjazahModel) Insert(i *Ijazah) error {
+	query := `
+		INSERT INTO ijazat (code, student_id, student_name, teacher_id, teacher_name, parent_id,
+			book_id, text_title, type, completion, granted_on, notes, verified, payload, signature, key_id, recorded_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, NULLIF($7, '')::uuid,
+			$8, $9, $10, $11, $12, TRUE, $13, $14, $15, $4)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	i.Verified = true
+	return m.DB.QueryRowContext(ctx, query,
+		i.Code, i.StudentID, i.StudentName, i.TeacherID, i.TeacherName, i.ParentID,
+		i.BookID, i.TextTitle, i.Type, i.Completion, i.GrantedOn, i.Notes, i.Payload, i.Signature, i.KeyID,
+	).Scan(&i.ID, &i.CreatedAt)
+}
+
+// InsertSanad records an ijazah the user received from a teacher who is not
+// on the platform. upstream names that teacher's own teachers, nearest
+// first; each gets an unverified link so the whole chain can be walked.
+func (m IjazahModel) InsertSanad(i *Ijazah, upstream []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert := `
+		INSERT INTO ijazat (student_id, student_name, teacher_name, parent_id, book_id,
+			text_title, type, completion, granted_on, notes, recorded_by)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid,
+			$6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at`
+
+	// Build the chain from the top down so each link can point at the one
+	// above it. The upper links share the text but not the date or type,
+	// which the student does not know.
+	parentID := ""
+	for k := len(upstream) - 1; k >= 0; k-- {
+		student := i.TeacherName
+		if k > 0 {
+			student = upstream[k-1]
+		}
+		var created time.Time
+		err := tx.QueryRowContext(ctx, insert,
+			"", student, upstream[k], parentID, i.BookID,
+			i.TextTitle, i.Type, i.Completion, i.GrantedOn, "", i.RecordedBy,
+		).Scan(&parentID, &created)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.ParentID = parentID
+	err = tx.QueryRowContext(ctx, insert,
+		i.StudentID, i.StudentName, i.TeacherName, i.ParentID, i.BookID,
+		i.TextTitle, i.Type, i.Completion, i.GrantedOn, i.Notes, i.RecordedBy,
+	).Scan(&i.ID, &i.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get fetches an ijazah by ID.
+func (m IjazahModel) Get(id string) (*Ijazah, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `SELECT `+ijazahColumns+` FROM ijazat WHERE id::text = $1`, id)
+	return scanIjazah(row)
+}
+
+// GetByCode fetches a verified ijazah by its public code.
+func (m IjazahModel) GetByCode(code string) (*Ijazah, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `SELECT `+ijazahColumns+` FROM ijazat WHERE code = $1 AND verified`, code)
+	return scanIjazah(row)
+}
+
+// GetForStudent lists the ijazat a user holds, verified and recorded,
+// most recently granted first.
+func (m IjazahModel) GetForStudent(userID string) ([]*Ijazah, error) {
+	return m.list(`SELECT `+ijazahColumns+` FROM ijazat WHERE student_id = $1 ORDER BY granted_on DESC, created_at DESC`, userID)
+}
+
+// GetGrantedBy lists the ijazat a teacher has granted on the platform.
+func (m IjazahModel) GetGrantedBy(teacherID string) ([]*Ijazah, error) {
+	return m.list(`SELECT `+ijazahColumns+` FROM ijazat WHERE teacher_id = $1 AND verified ORDER BY granted_on DESC, created_at DESC`, teacherID)
+}
+
+func (m IjazahModel) list(query string, args ...any) ([]*Ijazah, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ijazat := []*Ijazah{}
+	for rows.Next() {
+		i, err := scanIjazah(rows)
+		if err != nil {
+			return nil, err
+		}
+		ijazat = append(ijazat, i)
+	}
+	return ijazat, rows.Err()
+}
+
+// GetChain walks the sanad up from an ijazah: the ijazah itself first, then
+// its teacher's ijazah, and so on to the earliest recorded teacher.
+func (m IjazahModel) GetChain(id string) ([]*SanadLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM ijazat WHERE id::text = $1
+			UNION ALL
+			SELECT i.id, i.parent_id, c.depth + 1
+			FROM ijazat i
+			JOIN chain c ON i.id = c.parent_id
+			WHERE c.depth < $2
+		)
+		SELECT i.id, COALESCE(i.code, ''), i.student_name, COALESCE(i.teacher_id::text, ''), i.teacher_name,
+			i.text_title, i.granted_on, i.verified, i.revoked_at IS NOT NULL
+		FROM chain c
+		JOIN ijazat i ON i.id = c.id
+		ORDER BY c.depth ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, id, maxSanadDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chain := []*SanadLink{}
+	for rows.Next() {
+		var l SanadLink
+		err := rows.Scan(&l.IjazahID, &l.Code, &l.StudentName, &l.TeacherID, &l.TeacherName,
+			&l.TextTitle, &l.GrantedOn, &l.Verified, &l.Revoked)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, &l)
+	}
+	return chain, rows.Err()
+}
+
+// Revoke marks a verified ijazah as revoked. Its page stays up so anyone
+// checking it learns that it no longer stands.
+func (m IjazahModel) Revoke(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE ijazat SET revoked_at = NOW()
+		WHERE id = $1 AND verified AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteSanad removes a sanad link the user recorded for themselves, along
+// with the teacher links above it that were recorded with it. Links that
+// other ijazat build on cannot be deleted.
+func (m IjazahModel) DeleteSanad(id, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM ijazat WHERE parent_id = s.id)
+		FROM ijazat s
+		WHERE s.id::text = $1 AND s.student_id::text = $2 AND NOT s.verified`, id, userID).Scan(&inUse)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	if inUse {
+		return ErrSanadInUse
+	}
+
+	// The upper links have no student account and were recorded by this user.
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM ijazat WHERE id::text = $1
+			UNION ALL
+			SELECT i.id, i.parent_id, c.depth + 1
+			FROM ijazat i
+			JOIN chain c ON i.id = c.parent_id
+			WHERE c.depth < $3 AND i.student_id IS NULL AND i.recorded_by::text = $2 AND NOT i.verified
+		)
+		DELETE FROM ijazat WHERE id IN (SELECT id FROM chain)`
+
+	if _, err := tx.ExecContext(ctx, query, id, userID, maxSanadDepth); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
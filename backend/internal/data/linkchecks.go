@@ -0,0 +1,208 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// LinkCheck is one recorded probe of a resource URL.
+type LinkCheck struct {
+	ID         string    `json:"id"`
+	ResourceID string    `json:"resource_id"`
+	OK         bool      `json:"ok"`
+	StatusCode *int      `json:"status_code"`
+	Error      *string   `json:"error,omitempty"`
+	LatencyMs  int       `json:"latency_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// BrokenLink is a row of the admin broken-links report.
+type BrokenLink struct {
+	ResourceID     string     `json:"resource_id"`
+	Title          string     `json:"title"`
+	Type           string     `json:"type"`
+	URL            string     `json:"url"`
+	BookID         string     `json:"book_id"`
+	BookTitle      string     `json:"book_title"`
+	CreatedBy      *string    `json:"created_by"`
+	Failures       int        `json:"failures"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	LastCheckedAt  *time.Time `json:"last_checked_at"`
+}
+
+// LinkCheckModel wraps the database connection pool for link health operations.
+type LinkCheckModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// GetDue returns resources whose link has not been checked within the interval.
+// URLs starting with skipPrefix (our own storage), playlist containers and
+// video segments, which share their parent video's URL, are skipped.
+func (m LinkCheckModel) GetDue(interval time.Duration, skipPrefix string, limit int) ([]*Resource, error) {
+	query := `
+		SELECT id::text, book_id::text, type, title, url, created_by::text, link_status
+		FROM resources
+		WHERE url <> ''
+		AND type::text <> 'playlist'
+		AND NOT is_segment
+		AND ($1 = '' OR url NOT LIKE $1 || '%')
+		AND (link_checked_at IS NULL OR link_checked_at < NOW() - make_interval(secs => $2))
+		ORDER BY link_checked_at ASC NULLS FIRST
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, skipPrefix, interval.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []*Resource
+	for rows.Next() {
+		var r Resource
+		if err := rows.Scan(&r.ID, &r.BookID, &r.Type, &r.Title, &r.URL, &r.CreatedBy, &r.LinkStatus); err != nil {
+			return nil, err
+		}
+		resources = append(resources, &r)
+	}
+
+	return resources, rows.Err()
+}
+
+// Record stores a probe result and updates the resource's link status.
+// A resource becomes 'broken' after failureThreshold consecutive failures;
+// any success resets it to 'ok'. It reports whether this check is the one
+// that flipped the resource to broken, so callers notify only once.
+func (m LinkCheckModel) Record(r *Resource, check *LinkCheck, failureThreshold int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 1. History row
+	queryInsert := `
+		INSERT INTO resource_link_checks (resource_id, ok, status_code, error, latency_ms)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, checked_at`
+
+	err = tx.QueryRowContext(ctx, queryInsert, r.ID, check.OK, check.StatusCode, check.Error, check.LatencyMs).
+		Scan(&check.ID, &check.CheckedAt)
+	if err != nil {
+		return false, err
+	}
+
+	// 2. Roll up onto the resource (old status is read before the update applies)
+	queryUpdate := `
+		UPDATE resources r
+		SET link_failures = CASE WHEN $2 THEN 0 ELSE r.link_failures + 1 END,
+			link_status = CASE
+				WHEN $2 THEN 'ok'
+				WHEN r.link_failures + 1 >= $3 THEN 'broken'
+				ELSE r.link_status
+			END,
+			link_checked_at = NOW()
+		FROM (SELECT link_status FROM resources WHERE id = $1) old
+		WHERE r.id = $1
+		RETURNING old.link_status, r.link_status`
+
+	var oldStatus, newStatus string
+	err = tx.QueryRowContext(ctx, queryUpdate, r.ID, check.OK, failureThreshold).Scan(&oldStatus, &newStatus)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	if oldStatus != newStatus {
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", r.ID))
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", r.BookID))
+	}
+
+	return newStatus == "broken" && oldStatus != "broken", nil
+}
+
+// GetHistory returns the most recent probes for a resource, newest first.
+func (m LinkCheckModel) GetHistory(resourceID string, limit int) ([]*LinkCheck, error) {
+	query := `
+		SELECT id::text, resource_id::text, ok, status_code, error, latency_ms, checked_at
+		FROM resource_link_checks
+		WHERE resource_id = $1
+		ORDER BY checked_at DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, resourceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []*LinkCheck{}
+	for rows.Next() {
+		var c LinkCheck
+		if err := rows.Scan(&c.ID, &c.ResourceID, &c.OK, &c.StatusCode, &c.Error, &c.LatencyMs, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, &c)
+	}
+
+	return checks, rows.Err()
+}
+
+// GetBrokenReport lists all broken resources with their latest failure details.
+func (m LinkCheckModel) GetBrokenReport() ([]*BrokenLink, error) {
+	query := `
+		SELECT r.id::text, r.title, r.type, r.url, r.book_id::text, b.title, r.created_by::text,
+			r.link_failures, lc.status_code, lc.error, r.link_checked_at
+		FROM resources r
+		JOIN books b ON r.book_id = b.id
+		LEFT JOIN LATERAL (
+			SELECT status_code, error
+			FROM resource_link_checks
+			WHERE resource_id = r.id
+			ORDER BY checked_at DESC
+			LIMIT 1
+		) lc ON true
+		WHERE r.link_status = 'broken'
+		ORDER BY r.link_checked_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []*BrokenLink{}
+	for rows.Next() {
+		var b BrokenLink
+		err := rows.Scan(
+			&b.ResourceID, &b.Title, &b.Type, &b.URL, &b.BookID, &b.BookTitle, &b.CreatedBy,
+			&b.Failures, &b.LastStatusCode, &b.LastError, &b.LastCheckedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, &b)
+	}
+
+	return report, rows.Err()
+}
@@ -3,15 +3,31 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"strings"
 
 	"github.com/draqist/iqraa/backend/internal/cache"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // Define a custom error for when records aren't found
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrDuplicateSlug  = errors.New("duplicate slug")
 )
 
+// isUniqueViolation reports whether err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isConstraintViolation reports whether err is any integrity constraint
+// violation (foreign key, check, not null, unique).
+func isConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23")
+}
+
 // Models holds all the database models for the application.
 // It acts as a single container to inject data access layers into handlers.
 type Models struct {
@@ -28,6 +44,17 @@ type Models struct {
 	Notifications NotificationModel
 	Features      FeatureRequestModel
 	Community     CommunityModel
+	LinkChecks    LinkCheckModel
+	Playlists     PlaylistModel
+	Segments      SegmentModel
+	Podcasts      PodcastModel
+	Transcripts   TranscriptModel
+	Proposals     ProposalModel
+	Certificates  CertificateModel
+	Assessments   AssessmentModel
+	Moderation    ModerationModel
+	Circles       CircleModel
+	Ijazat        IjazahModel
 }
 
 // NewModels initializes and returns a Models struct with all model instances
@@ -47,5 +74,16 @@ func NewModels(db *sql.DB, cacheSvc *cache.Service) Models {
 		Notifications: NotificationModel{DB: db, Cache: cacheSvc},
 		Features:      FeatureRequestModel{DB: db, Cache: cacheSvc},
 		Community:     CommunityModel{DB: db, Cache: cacheSvc},
+		LinkChecks:    LinkCheckModel{DB: db, Cache: cacheSvc},
+		Playlists:     PlaylistModel{DB: db, Cache: cacheSvc},
+		Segments:      SegmentModel{DB: db, Cache: cacheSvc},
+		Podcasts:      PodcastModel{DB: db, Cache: cacheSvc},
+		Transcripts:   TranscriptModel{DB: db, Cache: cacheSvc},
+		Proposals:     ProposalModel{DB: db, Cache: cacheSvc},
+		Certificates:  CertificateModel{DB: db, Cache: cacheSvc},
+		Assessments:   AssessmentModel{DB: db, Cache: cacheSvc},
+		Moderation:    ModerationModel{DB: db, Cache: cacheSvc},
+		Circles:       CircleModel{DB: db, Cache: cacheSvc},
+		Ijazat:        IjazahModel{DB: db, Cache: cacheSvc},
 	}
 }
\ No newline at end of file
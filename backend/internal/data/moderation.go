@@ -0,0 +1,621 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// Content types that can be reported and moderated.
+const (
+	ContentDiscussion = "discussion"
+	ContentReply      = "reply"
+	ContentNote       = "note"
+)
+
+// Moderator actions recorded in the audit trail.
+const (
+	ActionHide    = "hide"
+	ActionUnhide  = "unhide"
+	ActionDelete  = "delete"
+	ActionDismiss = "dismiss"
+	ActionWarn    = "warn"
+	ActionMute    = "mute"
+	ActionUnmute  = "unmute"
+	ActionBan     = "ban"
+	ActionUnban   = "unban"
+)
+
+// ReportReasons are the reasons users can give for a report. The filter
+// files its own reports with the reason "blocked_term".
+var ReportReasons = []string{"spam", "abuse", "inappropriate", "misinformation", "other"}
+
+var (
+	// ErrDuplicateReport is returned when a user reports the same content twice.
+	ErrDuplicateReport = errors.New("content already reported")
+	// ErrDuplicateTerm is returned when a blocked term normalizes to an existing one.
+	ErrDuplicateTerm = errors.New("blocked term already exists")
+)
+
+// Report is one user's report of a piece of content. Reports filed by the
+// blocked-term filter have no reporter.
+type Report struct {
+	ID          string     `json:"id"`
+	ReporterID  string     `json:"reporter_id,omitempty"`
+	ContentType string     `json:"content_type"`
+	ContentID   string     `json:"content_id"`
+	Reason      string     `json:"reason"`
+	Details     string     `json:"details"`
+	Status      string     `json:"status"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// QueueItem is a reported piece of content with its open reports, as shown
+// in the moderator queue.
+type QueueItem struct {
+	ContentType     string          `json:"content_type"`
+	ContentID       string          `json:"content_id"`
+	DiscussionID    string          `json:"discussion_id,omitempty"`
+	BookID          string          `json:"book_id,omitempty"`
+	AuthorID        string          `json:"author_id"`
+	AuthorName      string          `json:"author_name"`
+	Excerpt         string          `json:"excerpt"`
+	Hidden          bool            `json:"hidden"`
+	Removed         bool            `json:"removed"`
+	ReportCount     int             `json:"report_count"`
+	Reports         json.RawMessage `json:"reports"`
+	FirstReportedAt time.Time       `json:"first_reported_at"`
+	LastReportedAt  time.Time       `json:"last_reported_at"`
+}
+
+// Sanction restricts a user: a mute stops them posting, a ban also keeps
+// them out of chat rooms. A nil ExpiresAt never expires.
+type Sanction struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ModerationAction is an entry in the moderation audit trail. Actions taken
+// by the system have no moderator.
+type ModerationAction struct {
+	ID             string     `json:"id"`
+	ModeratorID    string     `json:"moderator_id,omitempty"`
+	ModeratorName  string     `json:"moderator_name,omitempty"`
+	Action         string     `json:"action"`
+	ContentType    string     `json:"content_type,omitempty"`
+	ContentID      string     `json:"content_id,omitempty"`
+	TargetUserID   string     `json:"target_user_id,omitempty"`
+	TargetUserName string     `json:"target_user_name,omitempty"`
+	Reason         string     `json:"reason"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// BlockedTerm is a word or phrase the pre-filter looks for. "reject" refuses
+// the post; "review" publishes it hidden and queues it for a moderator.
+type BlockedTerm struct {
+	ID         string    `json:"id"`
+	Term       string    `json:"term"`
+	Normalized string    `json:"normalized"`
+	Action     string    `json:"action"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ModerationModel wraps the database connection pool for reports, sanctions
+// and the moderation audit trail.
+type ModerationModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// contentTable maps a content type to its table.
+func contentTable(contentType string) (string, error) {
+	switch contentType {
+	case ContentDiscussion:
+		return "discussions", nil
+	case ContentReply:
+		return "discussion_replies", nil
+	case ContentNote:
+		return "notes", nil
+	}
+	return "", fmt.Errorf("unknown content type %q", contentType)
+}
+
+// ContentAuthor returns the author of a piece of content. Notes only count
+// while they are published.
+func (m ModerationModel) ContentAuthor(contentType, contentID string) (string, error) {
+	table, err := contentTable(contentType)
+	if err != nil {
+		return "", err
+	}
+	query := `SELECT user_id FROM ` + table + ` WHERE id::text = $1`
+	if contentType == ContentNote {
+		query += ` AND is_published = TRUE`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var authorID string
+	err = m.DB.QueryRowContext(ctx, query, contentID).Scan(&authorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrRecordNotFound
+	}
+	return authorID, err
+}
+
+// ContentDiscussion returns the discussion a discussion or reply belongs to,
+// or "" for content outside the forum.
+func (m ModerationModel) ContentDiscussion(contentType, contentID string) (string, error) {
+	var query string
+	switch contentType {
+	case ContentDiscussion:
+		query = `SELECT id::text FROM discussions WHERE id::text = $1`
+	case ContentReply:
+		query = `SELECT discussion_id::text FROM discussion_replies WHERE id::text = $1`
+	default:
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var discussionID string
+	err := m.DB.QueryRowContext(ctx, query, contentID).Scan(&discussionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrRecordNotFound
+	}
+	return discussionID, err
+}
+
+// CreateReport files a report and returns how many open reports the content
+// now has.
+func (m ModerationModel) CreateReport(r *Report) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `
+		INSERT INTO content_reports (reporter_id, content_type, content_id, reason, details)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5)
+		RETURNING id, status, created_at`, r.ReporterID, r.ContentType, r.ContentID, r.Reason, r.Details).
+		Scan(&r.ID, &r.Status, &r.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateReport
+		}
+		return 0, err
+	}
+
+	var open int
+	err = m.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM content_reports
+		WHERE content_type = $1 AND content_id = $2 AND status = 'open'`, r.ContentType, r.ContentID).Scan(&open)
+	return open, err
+}
+
+// GetQueue lists reported content with open reports, most reported first.
+// An empty contentType covers every type.
+func (m ModerationModel) GetQueue(contentType string) ([]*QueueItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		WITH q AS (
+			SELECT content_type, content_id, COUNT(*) AS report_count,
+				MIN(created_at) AS first_reported_at, MAX(created_at) AS last_reported_at,
+				json_agg(json_build_object(
+					'id', id, 'reporter_id', reporter_id, 'reason', reason,
+					'details', details, 'created_at', created_at
+				) ORDER BY created_at) AS reports
+			FROM content_reports
+			WHERE status = 'open' AND ($1 = '' OR content_type = $1)
+			GROUP BY content_type, content_id
+		)
+		SELECT q.content_type, q.content_id,
+			COALESCE(COALESCE(d.id, r.discussion_id)::text, ''), COALESCE(n.book_id::text, ''),
+			COALESCE(COALESCE(d.user_id, r.user_id, n.user_id)::text, ''), COALESCE(u.name, ''),
+			LEFT(CASE q.content_type
+				WHEN 'discussion' THEN CONCAT_WS(E'\n', NULLIF(d.title, ''), d.body)
+				WHEN 'reply' THEN r.body
+				ELSE CONCAT_WS(E'\n', n.title, n.description)
+			END, 500),
+			COALESCE(d.hidden_at, r.hidden_at, n.hidden_at) IS NOT NULL,
+			CASE q.content_type
+				WHEN 'discussion' THEN d.id IS NULL
+				WHEN 'reply' THEN r.id IS NULL OR r.deleted_at IS NOT NULL
+				ELSE n.id IS NULL OR NOT n.is_published
+			END,
+			q.report_count, q.reports, q.first_reported_at, q.last_reported_at
+		FROM q
+		LEFT JOIN discussions d ON q.content_type = 'discussion' AND d.id = q.content_id
+		LEFT JOIN discussion_replies r ON q.content_type = 'reply' AND r.id = q.content_id
+		LEFT JOIN notes n ON q.content_type = 'note' AND n.id = q.content_id
+		LEFT JOIN users u ON u.id = COALESCE(d.user_id, r.user_id, n.user_id)
+		ORDER BY q.report_count DESC, q.first_reported_at ASC
+		LIMIT 100`, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*QueueItem{}
+	for rows.Next() {
+		var item QueueItem
+		var excerpt sql.NullString
+		var reports []byte
+		err := rows.Scan(&item.ContentType, &item.ContentID, &item.DiscussionID, &item.BookID,
+			&item.AuthorID, &item.AuthorName, &excerpt, &item.Hidden, &item.Removed,
+			&item.ReportCount, &reports, &item.FirstReportedAt, &item.LastReportedAt)
+		if err != nil {
+			return nil, err
+		}
+		item.Excerpt = excerpt.String
+		item.Reports = reports
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// SetHidden takes content out of public view, or puts it back. The author
+// still sees their own note.
+func (m ModerationModel) SetHidden(contentType, contentID, moderatorID string, hidden bool) error {
+	table, err := contentTable(contentType)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE `+table+`
+		SET hidden_at = CASE WHEN $2 THEN NOW() END,
+			hidden_by = CASE WHEN $2 THEN NULLIF($3, '')::uuid END
+		WHERE id::text = $1`, contentID, hidden, moderatorID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+
+	if contentType == ContentNote {
+		return m.invalidateNote(contentID)
+	}
+	return nil
+}
+
+// RemoveContent deletes a discussion with its replies, or unpublishes a note
+// so it goes back to being its author's private draft. Replies are removed
+// with CommunityModel.DeleteReply, which keeps their place in the thread.
+func (m ModerationModel) RemoveContent(contentType, contentID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var query string
+	switch contentType {
+	case ContentDiscussion:
+		query = `DELETE FROM discussions WHERE id::text = $1`
+	case ContentNote:
+		query = `UPDATE notes SET is_published = FALSE, updated_at = NOW() WHERE id::text = $1`
+	default:
+		return fmt.Errorf("cannot remove content of type %q", contentType)
+	}
+
+	result, err := m.DB.ExecContext(ctx, query, contentID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+
+	if contentType == ContentNote {
+		return m.invalidateNote(contentID)
+	}
+	return nil
+}
+
+// invalidateNote drops the cached public views of a note.
+func (m ModerationModel) invalidateNote(noteID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var bookID string
+	if err := m.DB.QueryRowContext(ctx, `SELECT book_id FROM notes WHERE id::text = $1`, noteID).Scan(&bookID); err != nil {
+		return err
+	}
+	m.Cache.Delete(context.Background(), fmt.Sprintf("note:public:%s", noteID))
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("notes:published:book:%s", bookID))
+}
+
+// Record adds an action to the audit trail. When the action concerns a
+// piece of content and reportStatus is set ("actioned" or "dismissed"), the
+// content's open reports are resolved with it.
+func (m ModerationModel) Record(a *ModerationAction, reportStatus string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO moderation_actions (moderator_id, action, content_type, content_id, target_user_id, reason, expires_at)
+		VALUES (NULLIF($1, '')::uuid, $2, NULLIF($3, ''), NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, $6, $7)
+		RETURNING id, created_at`,
+		a.ModeratorID, a.Action, a.ContentType, a.ContentID, a.TargetUserID, a.Reason, a.ExpiresAt).
+		Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if a.ContentID != "" && reportStatus != "" {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE content_reports
+			SET status = $3, resolved_by = NULLIF($4, '')::uuid, resolved_at = NOW()
+			WHERE content_type = $1 AND content_id::text = $2 AND status = 'open'`,
+			a.ContentType, a.ContentID, reportStatus, a.ModeratorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetActions lists the audit trail, newest first. userID narrows it to the
+// actions taken against one user, contentID to one piece of content.
+func (m ModerationModel) GetActions(userID, contentID string) ([]*ModerationAction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT a.id, COALESCE(a.moderator_id::text, ''), COALESCE(mu.name, ''), a.action,
+			COALESCE(a.content_type, ''), COALESCE(a.content_id::text, ''),
+			COALESCE(a.target_user_id::text, ''), COALESCE(tu.name, ''),
+			a.reason, a.expires_at, a.created_at
+		FROM moderation_actions a
+		LEFT JOIN users mu ON mu.id = a.moderator_id
+		LEFT JOIN users tu ON tu.id = a.target_user_id
+		WHERE ($1 = '' OR a.target_user_id::text = $1)
+		AND ($2 = '' OR a.content_id::text = $2)
+		ORDER BY a.created_at DESC
+		LIMIT 200`, userID, contentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+	for rows.Next() {
+		var a ModerationAction
+		var expiresAt sql.NullTime
+		err := rows.Scan(&a.ID, &a.ModeratorID, &a.ModeratorName, &a.Action, &a.ContentType, &a.ContentID,
+			&a.TargetUserID, &a.TargetUserName, &a.Reason, &expiresAt, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			a.ExpiresAt = &expiresAt.Time
+		}
+		actions = append(actions, &a)
+	}
+	return actions, rows.Err()
+}
+
+func sanctionCacheKey(userID string) string {
+	return fmt.Sprintf("moderation:sanction:%s", userID)
+}
+
+// AddSanction mutes or bans a user.
+func (m ModerationModel) AddSanction(s *Sanction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `
+		INSERT INTO user_sanctions (user_id, kind, reason, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid)
+		RETURNING id, created_at`, s.UserID, s.Kind, s.Reason, s.ExpiresAt, s.CreatedBy).
+		Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return m.Cache.Delete(context.Background(), sanctionCacheKey(s.UserID))
+}
+
+// RevokeSanctions lifts a user's active sanctions of one kind and returns
+// how many were lifted.
+func (m ModerationModel) RevokeSanctions(userID, kind string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE user_sanctions SET revoked_at = NOW()
+		WHERE user_id = $1 AND kind = $2 AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())`, userID, kind)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return n, m.Cache.Delete(context.Background(), sanctionCacheKey(userID))
+}
+
+// ActiveSanction returns the sanction currently in force for a user, a ban
+// before a mute, or nil. It is checked on every post and chat message, so
+// the answer is cached for a minute.
+func (m ModerationModel) ActiveSanction(userID string) (*Sanction, error) {
+	var s Sanction
+	key := sanctionCacheKey(userID)
+	if m.Cache.Get(context.Background(), key, &s) {
+		if s.Kind == "" || (s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now())) {
+			return nil, nil
+		}
+		return &s, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiresAt sql.NullTime
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, kind, reason, expires_at, COALESCE(created_by::text, ''), created_at
+		FROM user_sanctions
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY kind = 'ban' DESC, expires_at DESC NULLS FIRST
+		LIMIT 1`, userID).
+		Scan(&s.ID, &s.UserID, &s.Kind, &s.Reason, &expiresAt, &s.CreatedBy, &s.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Cache the miss too; most users are never sanctioned.
+		m.Cache.Set(context.Background(), key, &Sanction{}, time.Minute)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		s.ExpiresAt = &expiresAt.Time
+	}
+
+	m.Cache.Set(context.Background(), key, &s, time.Minute)
+	return &s, nil
+}
+
+// GetSanctions lists every sanction a user has received, newest first.
+func (m ModerationModel) GetSanctions(userID string) ([]*Sanction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, user_id, kind, reason, expires_at, COALESCE(created_by::text, ''), created_at, revoked_at
+		FROM user_sanctions
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sanctions := []*Sanction{}
+	for rows.Next() {
+		var s Sanction
+		var expiresAt, revokedAt sql.NullTime
+		err := rows.Scan(&s.ID, &s.UserID, &s.Kind, &s.Reason, &expiresAt, &s.CreatedBy, &s.CreatedAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			s.ExpiresAt = &expiresAt.Time
+		}
+		if revokedAt.Valid {
+			s.RevokedAt = &revokedAt.Time
+		}
+		sanctions = append(sanctions, &s)
+	}
+	return sanctions, rows.Err()
+}
+
+// GetBlockedTerms lists the blocked-term filter.
+func (m ModerationModel) GetBlockedTerms() ([]*BlockedTerm, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, term, normalized, action, created_at
+		FROM blocked_terms
+		ORDER BY term`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []*BlockedTerm{}
+	for rows.Next() {
+		var t BlockedTerm
+		if err := rows.Scan(&t.ID, &t.Term, &t.Normalized, &t.Action, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		terms = append(terms, &t)
+	}
+	return terms, rows.Err()
+}
+
+// InsertBlockedTerm adds a term to the filter. Terms are stored normalized,
+// so variants of a term that is already listed are duplicates.
+func (m ModerationModel) InsertBlockedTerm(t *BlockedTerm, createdBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `
+		INSERT INTO blocked_terms (term, normalized, action, created_by)
+		VALUES ($1, normalize_arabic($1), $2, NULLIF($3, '')::uuid)
+		RETURNING id, normalized, created_at`, t.Term, t.Action, createdBy).
+		Scan(&t.ID, &t.Normalized, &t.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateTerm
+	}
+	return err
+}
+
+// DeleteBlockedTerm removes a term from the filter.
+func (m ModerationModel) DeleteBlockedTerm(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM blocked_terms WHERE id::text = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// termSeparators matches the runs of spaces and punctuation, Latin or
+// Arabic, between words.
+const termSeparators = `[[:space:][:punct:]،؛؟«»]+`
+
+// MatchBlockedTerm looks for a blocked term among the words of text,
+// comparing normalized forms so diacritics, tatweel and alef/yaa/taa marbuta
+// variants still match. A "reject" term wins over a "review" one. It returns
+// nil when the text is clean.
+func (m ModerationModel) MatchBlockedTerm(text string) (*BlockedTerm, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Both sides are cut into space-separated words, so a term only matches
+	// whole words: "ass" does not match "class".
+	var t BlockedTerm
+	err := m.DB.QueryRowContext(ctx, `
+		WITH input AS (
+			SELECT ' ' || regexp_replace(normalize_arabic($1), $2, ' ', 'g') || ' ' AS words
+		)
+		SELECT id, term, normalized, action, created_at
+		FROM blocked_terms, input
+		WHERE strpos(input.words, ' ' || btrim(regexp_replace(normalized, $2, ' ', 'g')) || ' ') > 0
+		ORDER BY action = 'reject' DESC
+		LIMIT 1`, text, termSeparators).
+		Scan(&t.ID, &t.Term, &t.Normalized, &t.Action, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
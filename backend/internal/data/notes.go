@@ -167,7 +167,7 @@ func (m NoteModel) GetPublished(bookID string) ([]*PublicNote, error) {
 		SELECT n.id, n.title, n.description, u.name, n.created_at
 		FROM notes n
 		JOIN users u ON n.user_id = u.id
-		WHERE n.book_id = $1 AND n.is_published = TRUE
+		WHERE n.book_id = $1 AND n.is_published = TRUE AND n.hidden_at IS NULL
 		ORDER BY n.created_at DESC`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -234,7 +234,7 @@ func (m NoteModel) GetAllPublished(filters NoteFilters) ([]*GlobalNote, Metadata
 		FROM notes n
 		JOIN users u ON n.user_id = u.id
 		JOIN books b ON n.book_id = b.id
-		WHERE n.is_published = TRUE
+		WHERE n.is_published = TRUE AND n.hidden_at IS NULL
 		AND ($1 = '' OR b.metadata->>'category' = $1)
 		AND ($2 = '' OR (b.title ILIKE '%' || $2 || '%' OR u.name ILIKE '%' || $2 || '%'))
 		ORDER BY n.created_at DESC
@@ -288,7 +288,7 @@ func (m NoteModel) GetPublicByID(noteID string) (*GlobalNote, error) {
 		FROM notes n
 		JOIN users u ON n.user_id = u.id
 		JOIN books b ON n.book_id = b.id
-		WHERE n.id = $1 AND n.is_published = TRUE`
+		WHERE n.id = $1 AND n.is_published = TRUE AND n.hidden_at IS NULL`
 
 
 	var content []byte
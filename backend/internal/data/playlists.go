@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// PlaylistEpisode is a video to add to a synced playlist.
+type PlaylistEpisode struct {
+	VideoID       string
+	Title         string
+	URL           string
+	SequenceIndex int
+}
+
+// PlaylistEpisodeUpdate changes an existing episode to match its source video.
+type PlaylistEpisodeUpdate struct {
+	ResourceID    string
+	VideoID       string
+	Title         string
+	SequenceIndex int
+}
+
+// PlaylistSyncPlan is the set of changes that brings a playlist resource in
+// line with its source playlist.
+type PlaylistSyncPlan struct {
+	Add    []PlaylistEpisode
+	Update []PlaylistEpisodeUpdate
+	Remove []string // resource IDs whose video left the source playlist
+}
+
+// PlaylistSyncRun is the recorded outcome of one sync.
+type PlaylistSyncRun struct {
+	ID         string    `json:"id"`
+	ResourceID string    `json:"resource_id"`
+	Trigger    string    `json:"trigger"`
+	Added      int       `json:"added"`
+	Updated    int       `json:"updated"`
+	Removed    int       `json:"removed"`
+	Error      *string   `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PlaylistModel wraps the database connection pool for playlist sync operations.
+type PlaylistModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// GetEpisodes returns the children of a playlist resource in sequence order.
+func (m PlaylistModel) GetEpisodes(parentID string) ([]*Resource, error) {
+	query := `
+		SELECT id::text, book_id::text, title, url, sequence_index, source_video_id, source_removed
+		FROM resources
+		WHERE parent_id = $1
+		ORDER BY sequence_index ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var episodes []*Resource
+	for rows.Next() {
+		var r Resource
+		if err := rows.Scan(&r.ID, &r.BookID, &r.Title, &r.URL, &r.SequenceIndex, &r.SourceVideoID, &r.SourceRemoved); err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, &r)
+	}
+
+	return episodes, rows.Err()
+}
+
+// ApplySync writes a sync plan in one transaction and records the run.
+// New episodes inherit the parent's book, review status, official flag and creator.
+// Removed videos are flagged rather than deleted so student progress is kept.
+func (m PlaylistModel) ApplySync(parent *Resource, plan *PlaylistSyncPlan, trigger string) (*PlaylistSyncRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 1. Add new videos
+	queryInsert := `
+		INSERT INTO resources (book_id, type, title, url, is_official, parent_id, sequence_index, status, created_by, source_video_id)
+		VALUES ($1, 'youtube_video', $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	for _, ep := range plan.Add {
+		_, err := tx.ExecContext(ctx, queryInsert,
+			parent.BookID, ep.Title, ep.URL, parent.IsOfficial, parent.ID, ep.SequenceIndex, parent.Status, parent.CreatedBy, ep.VideoID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Update titles/positions (also restores videos that came back)
+	queryUpdate := `
+		UPDATE resources
+		SET title = $1, sequence_index = $2, source_video_id = $3, source_removed = FALSE
+		WHERE id = $4 AND parent_id = $5`
+
+	for _, u := range plan.Update {
+		if _, err := tx.ExecContext(ctx, queryUpdate, u.Title, u.SequenceIndex, u.VideoID, u.ResourceID, parent.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Flag removed videos
+	queryRemove := `UPDATE resources SET source_removed = TRUE WHERE id = $1 AND parent_id = $2`
+
+	for _, id := range plan.Remove {
+		if _, err := tx.ExecContext(ctx, queryRemove, id, parent.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4. Stamp the parent and record the run
+	if _, err := tx.ExecContext(ctx, `UPDATE resources SET last_synced_at = NOW(), last_sync_attempt_at = NOW() WHERE id = $1`, parent.ID); err != nil {
+		return nil, err
+	}
+
+	run := &PlaylistSyncRun{
+		ResourceID: parent.ID,
+		Trigger:    trigger,
+		Added:      len(plan.Add),
+		Updated:    len(plan.Update),
+		Removed:    len(plan.Remove),
+	}
+
+	queryRun := `
+		INSERT INTO playlist_sync_runs (resource_id, trigger, added, updated, removed)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, queryRun, run.ResourceID, run.Trigger, run.Added, run.Updated, run.Removed).
+		Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", parent.ID))
+	for _, u := range plan.Update {
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", u.ResourceID))
+	}
+	for _, id := range plan.Remove {
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", id))
+	}
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", parent.BookID))
+	return run, nil
+}
+
+// RecordFailure stores a failed sync run so admins can see why a playlist is
+// stale. The attempt is stamped on the playlist so it waits its turn again
+// instead of holding the head of the queue.
+func (m PlaylistModel) RecordFailure(resourceID, trigger, errMsg string) error {
+	query := `
+		WITH attempt AS (
+			UPDATE resources SET last_sync_attempt_at = NOW() WHERE id = $1
+		)
+		INSERT INTO playlist_sync_runs (resource_id, trigger, error)
+		VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, resourceID, trigger, errMsg)
+	return err
+}
+
+// SetSource links a playlist resource to a YouTube playlist and toggles scheduled syncs.
+func (m PlaylistModel) SetSource(r *Resource, playlistID string, syncEnabled bool) error {
+	query := `
+		UPDATE resources
+		SET source_playlist_id = NULLIF($1, ''), sync_enabled = $2
+		WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := m.DB.ExecContext(ctx, query, playlistID, syncEnabled, r.ID); err != nil {
+		return err
+	}
+
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", r.ID))
+}
+
+// GetDueForSync returns playlist resources with scheduled sync enabled that
+// have not been tried within the interval, least recently tried first.
+func (m PlaylistModel) GetDueForSync(interval time.Duration, limit int) ([]string, error) {
+	query := `
+		SELECT id::text
+		FROM resources
+		WHERE sync_enabled = TRUE AND source_playlist_id IS NOT NULL
+		AND (last_sync_attempt_at IS NULL OR last_sync_attempt_at < NOW() - make_interval(secs => $1))
+		ORDER BY last_sync_attempt_at ASC NULLS FIRST
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, interval.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetRuns returns the latest sync runs for a playlist resource.
+func (m PlaylistModel) GetRuns(resourceID string, limit int) ([]*PlaylistSyncRun, error) {
+	query := `
+		SELECT id::text, resource_id::text, trigger, added, updated, removed, error, created_at
+		FROM playlist_sync_runs
+		WHERE resource_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, resourceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*PlaylistSyncRun{}
+	for rows.Next() {
+		var r PlaylistSyncRun
+		if err := rows.Scan(&r.ID, &r.ResourceID, &r.Trigger, &r.Added, &r.Updated, &r.Removed, &r.Error, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, &r)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// PodcastEpisode is a published audio resource as it appears in a feed.
+type PodcastEpisode struct {
+	ResourceID      string
+	BookID          string
+	BookTitle       string
+	Title           string
+	URL             string
+	MimeType        string
+	FileSizeBytes   int64
+	DurationSeconds int
+	CreatedAt       time.Time
+}
+
+// PodcastModel wraps the database connection pool for podcast feeds.
+type PodcastModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// episodeColumns and episodeOrder keep book and roadmap feeds consistent:
+// top-level audio and playlists in sequence_index order, episodes after their
+// playlist. Playlists sharing a sequence_index are kept apart by ID.
+const (
+	episodeColumns = `
+		r.id::text, r.book_id::text, b.title, r.title, r.url,
+		COALESCE(r.mime_type, ''), COALESCE(r.file_size_bytes, 0), COALESCE(r.duration_seconds, 0), r.created_at`
+
+	episodeJoin = `
+		FROM resources r
+		JOIN books b ON b.id = r.book_id
+		LEFT JOIN resources p ON p.id = r.parent_id`
+
+	episodeFilter = `
+		r.type::text = 'audio' AND r.status = 'published' AND NOT r.is_segment
+		AND b.status = 'published' AND ($2 OR b.is_public)`
+
+	episodeOrder = `
+		COALESCE(p.sequence_index, r.sequence_index), COALESCE(r.parent_id, r.id), r.parent_id IS NOT NULL, r.sequence_index, r.created_at`
+)
+
+// GetBookEpisodes returns the published audio of a book in listening order.
+// Members-only books (is_public = false) are included only for private feeds.
+func (m PodcastModel) GetBookEpisodes(bookID string, includePrivate bool) ([]*PodcastEpisode, error) {
+	query := `SELECT ` + episodeColumns + episodeJoin + `
+		WHERE r.book_id = $1 AND ` + episodeFilter + `
+		ORDER BY ` + episodeOrder
+
+	return m.queryEpisodes(query, bookID, includePrivate)
+}
+
+// GetRoadmapEpisodes returns the published audio of every book on a roadmap,
+// following the roadmap's node order.
+func (m PodcastModel) GetRoadmapEpisodes(roadmapID string, includePrivate bool) ([]*PodcastEpisode, error) {
+	query := `SELECT ` + episodeColumns + episodeJoin + `
+		JOIN roadmap_nodes rn ON rn.book_id = r.book_id AND rn.roadmap_id = $1
+		WHERE ` + episodeFilter + `
+		ORDER BY rn.sequence_index, ` + episodeOrder
+
+	return m.queryEpisodes(query, roadmapID, includePrivate)
+}
+
+func (m PodcastModel) queryEpisodes(query string, args ...any) ([]*PodcastEpisode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var episodes []*PodcastEpisode
+	for rows.Next() {
+		var e PodcastEpisode
+		err := rows.Scan(&e.ResourceID, &e.BookID, &e.BookTitle, &e.Title, &e.URL,
+			&e.MimeType, &e.FileSizeBytes, &e.DurationSeconds, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, &e)
+	}
+
+	return episodes, rows.Err()
+}
+
+// SetToken stores a new feed token hash for the user, replacing any previous
+// one so old feed URLs stop working.
+func (m PodcastModel) SetToken(userID string, tokenHash []byte) error {
+	query := `
+		INSERT INTO podcast_tokens (user_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = NOW(), last_used_at = NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, tokenHash)
+	return err
+}
+
+// GetUserForToken resolves a feed token hash to its user and marks it used.
+func (m PodcastModel) GetUserForToken(tokenHash []byte) (string, error) {
+	query := `
+		UPDATE podcast_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING user_id::text`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID string
+	err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// DeleteToken revokes the user's private feed URLs.
+func (m PodcastModel) DeleteToken(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM podcast_tokens WHERE user_id = $1`, userID)
+	return err
+}
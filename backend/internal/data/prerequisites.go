@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPrerequisiteCycle is returned when a prerequisite change would make a
+	// node (indirectly) depend on itself.
+	ErrPrerequisiteCycle = errors.New("prerequisites would create a cycle")
+	// ErrInvalidPrerequisite is returned when a prerequisite is the node itself
+	// or belongs to a different roadmap.
+	ErrInvalidPrerequisite = errors.New("invalid prerequisite")
+)
+
+// RoadmapEdge is a prerequisite link: From must be completed before To unlocks.
+type RoadmapEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// layerNodes orders the graph topologically and returns each node's depth,
+// the length of the longest prerequisite chain leading to it. Nodes at the
+// same depth can be studied in parallel. Edges that reference unknown nodes
+// are ignored.
+func layerNodes(nodeIDs []string, edges []RoadmapEdge) (map[string]int, error) {
+	depth := make(map[string]int, len(nodeIDs))
+	indegree := make(map[string]int, len(nodeIDs))
+	next := make(map[string][]string)
+	for _, id := range nodeIDs {
+		indegree[id] = 0
+	}
+	for _, e := range edges {
+		_, okFrom := indegree[e.From]
+		_, okTo := indegree[e.To]
+		if !okFrom || !okTo {
+			continue
+		}
+		indegree[e.To]++
+		next[e.From] = append(next[e.From], e.To)
+	}
+
+	queue := make([]string, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, to := range next[id] {
+			if depth[id]+1 > depth[to] {
+				depth[to] = depth[id] + 1
+			}
+			indegree[to]--
+			if indegree[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	if visited != len(indegree) {
+		return nil, ErrPrerequisiteCycle
+	}
+	return depth, nil
+}
+
+// applyGraph attaches prerequisites, depth and lock state to the roadmap's
+// nodes. A node is locked while any of its prerequisites is not completed;
+// nodes without prerequisites are always unlocked.
+func applyGraph(r *Roadmap, edges []RoadmapEdge) {
+	if edges == nil {
+		edges = []RoadmapEdge{}
+	}
+	r.Edges = edges
+
+	ids := make([]string, 0, len(r.Nodes))
+	status := make(map[string]string, len(r.Nodes))
+	for _, n := range r.Nodes {
+		ids = append(ids, n.ID)
+		status[n.ID] = n.UserStatus
+	}
+
+	prereqs := make(map[string][]string)
+	for _, e := range edges {
+		prereqs[e.To] = append(prereqs[e.To], e.From)
+	}
+
+	// Stored graphs are validated on write, so a cycle here only means
+	// corrupt data; fall back to depth 0 rather than failing the read.
+	depth, _ := layerNodes(ids, edges)
+
+	for _, n := range r.Nodes {
+		n.Prerequisites = prereqs[n.ID]
+		if n.Prerequisites == nil {
+			n.Prerequisites = []string{}
+		}
+		n.Depth = depth[n.ID]
+		n.Locked = false
+		for _, p := range n.Prerequisites {
+			if status[p] != "completed" {
+				n.Locked = true
+				break
+			}
+		}
+	}
+}
+
+// getEdges loads the prerequisite edges of the given roadmaps, grouped by
+// roadmap ID.
+func (m RoadmapModel) getEdges(ctx context.Context, roadmapIDs ...string) (map[string][]RoadmapEdge, error) {
+	edges := make(map[string][]RoadmapEdge)
+	if len(roadmapIDs) == 0 {
+		return edges, nil
+	}
+
+	query := `
+		SELECT p.prerequisite_id, p.node_id, rn.roadmap_id
+		FROM roadmap_node_prerequisites p
+		JOIN roadmap_nodes rn ON rn.id = p.node_id
+		WHERE rn.roadmap_id = ANY($1::uuid[])
+		ORDER BY rn.roadmap_id, p.node_id, p.prerequisite_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, roadmapIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e RoadmapEdge
+		var rid string
+		if err := rows.Scan(&e.From, &e.To, &rid); err != nil {
+			return nil, err
+		}
+		edges[rid] = append(edges[rid], e)
+	}
+	return edges, rows.Err()
+}
+
+// loadGraph reads the node IDs and prerequisite edges of one roadmap.
+func loadGraph(ctx context.Context, q queryer, roadmapID string) ([]string, []RoadmapEdge, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id FROM roadmap_nodes WHERE roadmap_id = $1`, roadmapID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = q.QueryContext(ctx, `
+		SELECT p.prerequisite_id, p.node_id
+		FROM roadmap_node_prerequisites p
+		JOIN roadmap_nodes rn ON rn.id = p.node_id
+		WHERE rn.roadmap_id = $1`, roadmapID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var edges []RoadmapEdge
+	for rows.Next() {
+		var e RoadmapEdge
+		if err := rows.Scan(&e.From, &e.To); err != nil {
+			return nil, nil, err
+		}
+		edges = append(edges, e)
+	}
+	return ids, edges, rows.Err()
+}
+
+// SetPrerequisites replaces the prerequisites of a node. Every prerequisite
+// must be another node of the same roadmap, and the resulting graph must be
+// acyclic. It returns the roadmap ID of the node.
+func (m RoadmapModel) SetPrerequisites(nodeID string, prerequisiteIDs []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var roadmapID string
+	err = tx.QueryRowContext(ctx, `SELECT roadmap_id FROM roadmap_nodes WHERE id = $1`, nodeID).Scan(&roadmapID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	// Serialise graph edits per roadmap so two concurrent changes cannot
+	// each pass the cycle check and together form a cycle.
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM roadmaps WHERE id = $1 FOR UPDATE`, roadmapID); err != nil {
+		return "", err
+	}
+
+	ids, all, err := loadGraph(ctx, tx, roadmapID)
+	if err != nil {
+		return "", err
+	}
+	inRoadmap := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		inRoadmap[id] = true
+	}
+	var edges []RoadmapEdge
+	for _, e := range all {
+		if e.To != nodeID {
+			edges = append(edges, e)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, p := range prerequisiteIDs {
+		if seen[p] {
+			continue
+		}
+		if p == nodeID || !inRoadmap[p] {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPrerequisite, p)
+		}
+		seen[p] = true
+		unique = append(unique, p)
+		edges = append(edges, RoadmapEdge{From: p, To: nodeID})
+	}
+
+	if _, err := layerNodes(ids, edges); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM roadmap_node_prerequisites WHERE node_id = $1`, nodeID); err != nil {
+		return "", err
+	}
+	for _, p := range unique {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO roadmap_node_prerequisites (node_id, prerequisite_id) VALUES ($1, $2)`, nodeID, p)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	m.Cache.Delete(context.Background(), "roadmap:slug:*")
+	m.Cache.Delete(context.Background(), "roadmaps:list:*")
+	return roadmapID, nil
+}
+
+// IsNodeLocked reports whether the user still has uncompleted prerequisites
+// for the node.
+func (m RoadmapModel) IsNodeLocked(userID, nodeID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM roadmap_node_prerequisites p
+			LEFT JOIN user_roadmap_progress up ON up.node_id = p.prerequisite_id AND up.user_id = $2
+			WHERE p.node_id = $1 AND COALESCE(up.status, 'not_started') <> 'completed'
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var locked bool
+	err := m.DB.QueryRowContext(ctx, query, nodeID, userID).Scan(&locked)
+	return locked, err
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// Provenance records where an aggregated resource was found.
+type Provenance struct {
+	Source     string    `json:"source"` // e.g. "internet_archive"
+	Identifier string    `json:"identifier"`
+	File       string    `json:"file"`
+	DetailsURL string    `json:"details_url"`
+	ItemTitle  string    `json:"item_title,omitempty"`
+	Creator    string    `json:"creator,omitempty"`
+	License    string    `json:"license,omitempty"`
+	Query      string    `json:"query,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+}
+
+// Proposal is a draft resource suggested by an aggregator.
+type Proposal struct {
+	Resource
+	Provenance Provenance `json:"provenance"`
+}
+
+// ProposalModel wraps the database connection pool for aggregator proposals.
+type ProposalModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// Insert stores a proposal as a draft resource. It reports false without
+// inserting when the book already has a resource with the same URL, so
+// re-running a search never duplicates accepted or rejected files.
+func (m ProposalModel) Insert(p *Proposal) (bool, error) {
+	provenance, err := json.Marshal(p.Provenance)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		INSERT INTO resources (book_id, type, title, url, is_official, sequence_index, status, created_by,
+			mime_type, file_size_bytes, duration_seconds, processing_status, provenance)
+		SELECT $1, $2, $3, $4, FALSE, $5, 'draft', $6, NULLIF($7, ''), NULLIF($8, 0), NULLIF($9, 0), 'skipped', $10
+		WHERE NOT EXISTS (SELECT 1 FROM resources WHERE book_id = $1 AND url = $4)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var fileSize int64
+	if p.FileSizeBytes != nil {
+		fileSize = *p.FileSizeBytes
+	}
+	var duration int
+	if p.DurationSeconds != nil {
+		duration = *p.DurationSeconds
+	}
+	var mimeType string
+	if p.MimeType != nil {
+		mimeType = *p.MimeType
+	}
+
+	err = m.DB.QueryRowContext(ctx, query,
+		p.BookID, p.Type, p.Title, p.URL, p.SequenceIndex, p.CreatedBy,
+		mimeType, fileSize, duration, provenance,
+	).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	p.Status = "draft"
+	p.ProcessingStatus = "skipped"
+	return true, nil
+}
+
+// GetPending returns the undecided proposals of a book, newest first.
+func (m ProposalModel) GetPending(bookID string) ([]*Proposal, error) {
+	query := `
+		SELECT id::text, book_id::text, type::text, title, url, sequence_index, status, created_by::text,
+			mime_type, file_size_bytes, duration_seconds, created_at, provenance
+		FROM resources
+		WHERE book_id = $1 AND provenance IS NOT NULL AND status = 'draft'
+		ORDER BY created_at DESC, provenance->>'identifier', sequence_index`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proposals := []*Proposal{}
+	for rows.Next() {
+		var p Proposal
+		var provenance []byte
+		err := rows.Scan(&p.ID, &p.BookID, &p.Type, &p.Title, &p.URL, &p.SequenceIndex, &p.Status, &p.CreatedBy,
+			&p.MimeType, &p.FileSizeBytes, &p.DurationSeconds, &p.CreatedAt, &provenance)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(provenance, &p.Provenance); err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, &p)
+	}
+
+	return proposals, rows.Err()
+}
+
+// Decide accepts (status published or pending_review) or rejects a proposal.
+// Accepted files are queued for media processing.
+func (m ProposalModel) Decide(id, status, reviewerID string) (*Resource, error) {
+	query := `
+		UPDATE resources
+		SET status = $1, reviewer_id = $2,
+			processing_status = CASE WHEN $1 <> 'rejected' THEN 'pending' ELSE processing_status END
+		WHERE id = $3 AND provenance IS NOT NULL AND status = 'draft'
+		RETURNING id::text, book_id::text, type::text, title, url, status, processing_status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var r Resource
+	err := m.DB.QueryRowContext(ctx, query, status, reviewerID, id).
+		Scan(&r.ID, &r.BookID, &r.Type, &r.Title, &r.URL, &r.Status, &r.ProcessingStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", r.ID))
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", r.BookID))
+	return &r, nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/draqist/iqraa/backend/internal/cache"
@@ -27,6 +28,74 @@ type Resource struct {
 	Status            string    `json:"status"`
 	ReviewerID        *string   `json:"reviewer_id"`
 	CreatedBy         *string   `json:"created_by,omitempty"`
+
+	// Populated asynchronously by the media processor (PDF/audio only).
+	ProcessingStatus string     `json:"processing_status"`
+	ProcessingError  *string    `json:"processing_error,omitempty"`
+	MimeType         *string    `json:"mime_type,omitempty"`
+	FileSizeBytes    *int64     `json:"file_size_bytes,omitempty"`
+	PageCount        *int       `json:"page_count,omitempty"`
+	DurationSeconds  *int       `json:"duration_seconds,omitempty"`
+	ThumbnailURL     *string    `json:"thumbnail_url,omitempty"`
+	ProcessedAt      *time.Time `json:"processed_at,omitempty"`
+
+	// Maintained by the periodic link checker ('unknown', 'ok', 'broken').
+	LinkStatus string `json:"link_status,omitempty"`
+
+	// YouTube playlist sync. Parents carry the source playlist, episodes their video.
+	SourcePlaylistID *string    `json:"source_playlist_id,omitempty"`
+	SourceVideoID    *string    `json:"source_video_id,omitempty"`
+	SourceRemoved    bool       `json:"source_removed"`
+	SyncEnabled      bool       `json:"sync_enabled"`
+	LastSyncedAt     *time.Time `json:"last_synced_at,omitempty"`
+
+	// Timestamped chapter of its parent video (MediaStartSeconds/MediaEndSeconds).
+	IsSegment bool `json:"is_segment,omitempty"`
+}
+
+// ProcessingResult carries the output of the media processor for a resource.
+type ProcessingResult struct {
+	MimeType        string
+	FileSizeBytes   int64
+	PageCount       int
+	DurationSeconds int
+	ThumbnailURL    string
+
+	// Error is set when the file was only partly understood; what was read
+	// is still stored, but the resource is marked failed.
+	Error string
+}
+
+// ErrInvalidHierarchy is returned when a reorder/move would nest playlists,
+// parent a resource to itself, or cross books.
+var ErrInvalidHierarchy = errors.New("invalid resource hierarchy")
+
+// ResourceProgress is a user's position within a single resource.
+type ResourceProgress struct {
+	PositionSeconds int       `json:"position_seconds"`
+	Completed       bool      `json:"completed"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ResourceNode is a resource in the book's resource tree. Playlists carry
+// their ordered episodes plus aggregates over them.
+type ResourceNode struct {
+	*Resource
+	Children             []*ResourceNode   `json:"children"`
+	EpisodeCount         int               `json:"episode_count"`
+	TotalDurationSeconds int               `json:"total_duration_seconds"`
+	CompletedCount       int               `json:"completed_count"`
+	ProgressPercent      int               `json:"progress_percent"`
+	UserProgress         *ResourceProgress `json:"user_progress,omitempty"`
+	Segments             []*Resource       `json:"segments,omitempty"`
+}
+
+// ResourceMove describes the new position of a resource in a batch reorder.
+// A nil ParentID moves the resource to the top level.
+type ResourceMove struct {
+	ResourceID    string  `json:"resource_id"`
+	ParentID      *string `json:"parent_id"`
+	SequenceIndex int     `json:"sequence_index"`
 }
 
 // ResourceModel wraps the database connection pool for Resource-related operations.
@@ -46,9 +115,13 @@ func (m ResourceModel) GetByBookID(bookID string) ([]*Resource, error) {
 	}
 
 	query := `
-        SELECT id, book_id, type, title, url, media_start_seconds, media_end_seconds, is_official, created_at, parent_id, sequence_index, status, reviewer_id
+        SELECT id, book_id, type, title, url, media_start_seconds, media_end_seconds, is_official, created_at, parent_id, sequence_index, status, reviewer_id,
+            processing_status, page_count, duration_seconds, thumbnail_url,
+            source_playlist_id, source_video_id, source_removed, is_segment
         FROM resources
         WHERE book_id = $1
+        AND (NOT is_segment OR status = 'published')
+        AND (provenance IS NULL OR status NOT IN ('draft', 'rejected'))
         ORDER BY is_official DESC, sequence_index ASC, created_at DESC`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -80,6 +153,14 @@ func (m ResourceModel) GetByBookID(bookID string) ([]*Resource, error) {
 			&r.SequenceIndex,
 			&r.Status,
 			&r.ReviewerID,
+			&r.ProcessingStatus,
+			&r.PageCount,
+			&r.DurationSeconds,
+			&r.ThumbnailURL,
+			&r.SourcePlaylistID,
+			&r.SourceVideoID,
+			&r.SourceRemoved,
+			&r.IsSegment,
 		)
 		if err != nil {
 			return nil, err
@@ -118,7 +199,9 @@ func (m ResourceModel) Get(id string) (*Resource, error) {
 	}
 
 	query := `
-		SELECT id::text, book_id::text, type, title, url, media_start_seconds, media_end_seconds, is_official, parent_id::text, sequence_index, created_at, status, reviewer_id::text
+		SELECT id::text, book_id::text, type, title, url, media_start_seconds, media_end_seconds, is_official, parent_id::text, sequence_index, created_at, status, reviewer_id::text,
+			processing_status, processing_error, mime_type, file_size_bytes, page_count, duration_seconds, thumbnail_url, processed_at,
+			created_by::text, source_playlist_id, source_video_id, source_removed, sync_enabled, last_synced_at, is_segment
 		FROM resources
 		WHERE id = $1`
 
@@ -132,6 +215,8 @@ func (m ResourceModel) Get(id string) (*Resource, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&r.ID, &r.BookID, &r.Type, &r.Title, &r.URL,
 		&mediaStart, &mediaEnd, &r.IsOfficial, &parentID, &r.SequenceIndex, &r.CreatedAt, &r.Status, &reviewerID,
+		&r.ProcessingStatus, &r.ProcessingError, &r.MimeType, &r.FileSizeBytes, &r.PageCount, &r.DurationSeconds, &r.ThumbnailURL, &r.ProcessedAt,
+		&r.CreatedBy, &r.SourcePlaylistID, &r.SourceVideoID, &r.SourceRemoved, &r.SyncEnabled, &r.LastSyncedAt, &r.IsSegment,
 	)
 
 	if reviewerID.Valid {
@@ -163,7 +248,7 @@ func (m ResourceModel) Get(id string) (*Resource, error) {
 
 // GetAll fetches all resources, joined with book titles.
 // This is primarily used for the Admin dashboard.
-func (m ResourceModel) GetAll(title string, filters Filters, status string) ([]*Resource, Metadata, error) {
+func (m ResourceModel) GetAll(title string, filters Filters, status, processingStatus string) ([]*Resource, Metadata, error) {
 	query := `
         SELECT count(*) OVER(),
             r.id::text, 
@@ -175,18 +260,24 @@ func (m ResourceModel) GetAll(title string, filters Filters, status string) ([]*
             r.is_official, 
             r.created_at,
             r.status,
-            r.reviewer_id::text
+            r.reviewer_id::text,
+            r.processing_status,
+            r.processing_error,
+            r.page_count,
+            r.duration_seconds,
+            r.link_status
         FROM resources r
         JOIN books b ON r.book_id = b.id
         WHERE (r.title ILIKE '%' || $3 || '%' OR $3 = '')
         AND ($4 = '' OR r.status::text = $4)
+        AND ($5 = '' OR r.processing_status = $5)
         ORDER BY r.created_at DESC
         LIMIT $1 OFFSET $2`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, filters.Limit(), filters.Offset(), title, status)
+	rows, err := m.DB.QueryContext(ctx, query, filters.Limit(), filters.Offset(), title, status, processingStatus)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -197,7 +288,8 @@ func (m ResourceModel) GetAll(title string, filters Filters, status string) ([]*
 	for rows.Next() {
 		var r Resource
 		var reviewerID sql.NullString
-		err := rows.Scan(&totalRecords, &r.ID, &r.BookID, &r.BookTitle, &r.Type, &r.Title, &r.URL, &r.IsOfficial, &r.CreatedAt, &r.Status, &reviewerID)
+		err := rows.Scan(&totalRecords, &r.ID, &r.BookID, &r.BookTitle, &r.Type, &r.Title, &r.URL, &r.IsOfficial, &r.CreatedAt, &r.Status, &reviewerID,
+			&r.ProcessingStatus, &r.ProcessingError, &r.PageCount, &r.DurationSeconds, &r.LinkStatus)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -221,7 +313,7 @@ func (m ResourceModel) Insert(r *Resource) error {
 	query := `
 		INSERT INTO resources (book_id, type, title, url, media_start_seconds, media_end_seconds, is_official, parent_id, sequence_index, status, reviewer_id)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, created_at`
+		RETURNING id, created_at, processing_status`
 
 	args := []any{
 		r.BookID, r.Type, r.Title, r.URL,
@@ -232,7 +324,7 @@ func (m ResourceModel) Insert(r *Resource) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID, &r.CreatedAt)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID, &r.CreatedAt, &r.ProcessingStatus)
 	if err != nil {
 		return err
 	}
@@ -293,3 +385,323 @@ func (m ResourceModel) Delete(id string) error {
 	m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", id))
 	return m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", r.BookID))
 }
+
+
+// GetPendingProcessing returns the IDs of resources still waiting for the media processor.
+// The oldest are returned first so a backlog drains in upload order.
+func (m ResourceModel) GetPendingProcessing(limit int) ([]string, error) {
+	query := `
+		SELECT id::text
+		FROM resources
+		WHERE processing_status = 'pending'
+		ORDER BY created_at ASC
+		LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetProcessingStatus moves a resource through the processing lifecycle.
+// errMsg is stored only for the 'failed' status and cleared otherwise.
+func (m ResourceModel) SetProcessingStatus(r *Resource, status, errMsg string) error {
+	query := `
+		UPDATE resources
+		SET processing_status = $1, processing_error = NULLIF($2, ''),
+			processed_at = CASE WHEN $1 IN ('failed', 'skipped') THEN NOW() ELSE processed_at END
+		WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := m.DB.ExecContext(ctx, query, status, errMsg, r.ID); err != nil {
+		return err
+	}
+
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", r.ID))
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", r.BookID))
+}
+
+// SaveProcessingResult stores the media processor's output and marks the
+// resource completed, or failed when the result carries an error.
+func (m ResourceModel) SaveProcessingResult(r *Resource, res *ProcessingResult) error {
+	query := `
+		UPDATE resources
+		SET processing_status = CASE WHEN $7 = '' THEN 'completed' ELSE 'failed' END,
+			processing_error = NULLIF($7, ''),
+			mime_type = $1, file_size_bytes = $2,
+			page_count = NULLIF($3, 0), duration_seconds = NULLIF($4, 0),
+			thumbnail_url = NULLIF($5, ''), processed_at = NOW()
+		WHERE id = $6`
+
+	args := []any{res.MimeType, res.FileSizeBytes, res.PageCount, res.DurationSeconds, res.ThumbnailURL, r.ID, res.Error}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := m.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", r.ID))
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", r.BookID))
+}
+
+
+// EffectiveDuration returns the playable length of a resource in seconds:
+// the processed media duration, or the clip length for timestamped segments.
+func (r *Resource) EffectiveDuration() int {
+	if r.DurationSeconds != nil && *r.DurationSeconds > 0 {
+		return *r.DurationSeconds
+	}
+	if r.MediaEndSeconds > r.MediaStartSeconds {
+		return r.MediaEndSeconds - r.MediaStartSeconds
+	}
+	return 0
+}
+
+// GetTreeByBookID groups a book's resources into playlists with ordered episodes.
+// When userID is set, each node carries the user's progress and playlists
+// aggregate it (duration-weighted when durations are known).
+func (m ResourceModel) GetTreeByBookID(bookID, userID string) ([]*ResourceNode, error) {
+	resources, err := m.GetByBookID(bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := map[string]*ResourceProgress{}
+	if userID != "" {
+		progress, err = m.GetProgressForBook(userID, bookID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. Wrap every resource, keeping the top-level order from GetByBookID
+	nodes := make(map[string]*ResourceNode, len(resources))
+	for _, r := range resources {
+		nodes[r.ID] = &ResourceNode{
+			Resource:     r,
+			Children:     []*ResourceNode{},
+			UserProgress: progress[r.ID],
+		}
+	}
+
+	// 2. Attach children; orphans (parent deleted or in another book) stay top level.
+	// Segments hang off their video and don't count as episodes.
+	roots := []*ResourceNode{}
+	for _, r := range resources {
+		node := nodes[r.ID]
+		if r.ParentID != nil {
+			if parent, ok := nodes[*r.ParentID]; ok {
+				if r.IsSegment {
+					parent.Segments = append(parent.Segments, r)
+				} else {
+					parent.Children = append(parent.Children, node)
+				}
+				continue
+			}
+		}
+		if r.IsSegment {
+			continue
+		}
+		roots = append(roots, node)
+	}
+
+	// 3. Order episodes and compute aggregates
+	for _, node := range nodes {
+		sort.SliceStable(node.Children, func(i, j int) bool {
+			return node.Children[i].SequenceIndex < node.Children[j].SequenceIndex
+		})
+		sort.SliceStable(node.Segments, func(i, j int) bool {
+			return node.Segments[i].MediaStartSeconds < node.Segments[j].MediaStartSeconds
+		})
+		node.aggregate()
+	}
+
+	return roots, nil
+}
+
+// aggregate fills in the playlist totals from the node's children.
+// Leaf nodes report their own duration and progress.
+func (n *ResourceNode) aggregate() {
+	if len(n.Children) == 0 {
+		n.TotalDurationSeconds = n.EffectiveDuration()
+		if n.UserProgress != nil {
+			if n.UserProgress.Completed {
+				n.CompletedCount = 1
+				n.ProgressPercent = 100
+			} else if n.TotalDurationSeconds > 0 {
+				n.ProgressPercent = min(100, n.UserProgress.PositionSeconds*100/n.TotalDurationSeconds)
+			}
+		}
+		return
+	}
+
+	watched := 0
+	for _, c := range n.Children {
+		d := c.EffectiveDuration()
+		n.EpisodeCount++
+		n.TotalDurationSeconds += d
+
+		if c.UserProgress == nil {
+			continue
+		}
+		if c.UserProgress.Completed {
+			n.CompletedCount++
+			watched += d
+		} else {
+			watched += min(c.UserProgress.PositionSeconds, d)
+		}
+	}
+
+	switch {
+	case n.TotalDurationSeconds > 0:
+		n.ProgressPercent = watched * 100 / n.TotalDurationSeconds
+	case n.EpisodeCount > 0:
+		n.ProgressPercent = n.CompletedCount * 100 / n.EpisodeCount
+	}
+}
+
+// BatchMove reorders and re-parents resources of a book in a single transaction,
+// similar to RoadmapModel.BatchUpdateNodes. Playlists are one level deep, so
+// the move is rejected with ErrInvalidHierarchy if a new parent is not a
+// playlist of the same book, or if it would nest a playlist or parent a
+// resource to itself.
+func (m ResourceModel) BatchMove(bookID string, moves []ResourceMove) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// IDs are compared as text so malformed ones are simply not found
+	queryParent := `
+		SELECT EXISTS (
+			SELECT 1 FROM resources
+			WHERE book_id = $1 AND id::text = $2 AND type::text = 'playlist' AND NOT is_segment
+		)`
+	query := `UPDATE resources SET parent_id = $1::uuid, sequence_index = $2 WHERE book_id = $4 AND id::text = $3`
+
+	for _, mv := range moves {
+		if mv.ParentID != nil {
+			var ok bool
+			if err := tx.QueryRowContext(ctx, queryParent, bookID, *mv.ParentID).Scan(&ok); err != nil {
+				return err
+			}
+			if !ok {
+				return ErrInvalidHierarchy
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, query, mv.ParentID, mv.SequenceIndex, mv.ResourceID, bookID)
+		if err != nil {
+			if isConstraintViolation(err) {
+				return ErrInvalidHierarchy
+			}
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrRecordNotFound
+		}
+	}
+
+	// Validate the resulting shape before committing
+	queryCheck := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM resources c
+			JOIN resources p ON c.parent_id = p.id
+			WHERE c.book_id = $1 AND NOT c.is_segment
+			AND (p.parent_id IS NOT NULL OR p.book_id <> c.book_id)
+		)`
+
+	var invalid bool
+	if err := tx.QueryRowContext(ctx, queryCheck, bookID).Scan(&invalid); err != nil {
+		return err
+	}
+	if invalid {
+		return ErrInvalidHierarchy
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, mv := range moves {
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resource:%s", mv.ResourceID))
+	}
+	return m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", bookID))
+}
+
+// SaveProgress records a user's position in a resource.
+// Completion is sticky: once completed, later position updates don't undo it.
+// It returns ErrRecordNotFound when the resource does not exist.
+func (m ResourceModel) SaveProgress(userID, resourceID string, positionSeconds int, completed bool) error {
+	query := `
+		INSERT INTO user_resource_progress (user_id, resource_id, position_seconds, completed, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (user_id, resource_id)
+		DO UPDATE SET
+			position_seconds = EXCLUDED.position_seconds,
+			completed = user_resource_progress.completed OR EXCLUDED.completed,
+			updated_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, resourceID, positionSeconds, completed)
+	if isConstraintViolation(err) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// GetProgressForBook returns the user's progress on every resource of a book, keyed by resource ID.
+func (m ResourceModel) GetProgressForBook(userID, bookID string) (map[string]*ResourceProgress, error) {
+	query := `
+		SELECT p.resource_id::text, p.position_seconds, p.completed, p.updated_at
+		FROM user_resource_progress p
+		JOIN resources r ON p.resource_id = r.id
+		WHERE p.user_id = $1 AND r.book_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := make(map[string]*ResourceProgress)
+	for rows.Next() {
+		var id string
+		var p ResourceProgress
+		if err := rows.Scan(&id, &p.PositionSeconds, &p.Completed, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		progress[id] = &p
+	}
+
+	return progress, rows.Err()
+}
@@ -18,9 +18,15 @@ type Roadmap struct {
 	Description   string         `json:"description"`
 	CoverImageURL string         `json:"cover_image_url"`
 	Nodes         []*RoadmapNode `json:"nodes,omitempty"`
+	Edges         []RoadmapEdge  `json:"edges,omitempty"`
 	NodesCount    int            `json:"nodes_count"`
 	CreatedAt     time.Time      `json:"created_at"`
 	IsPublic      bool           `json:"is_public"`
+
+	// Personal roadmaps are forks of a curated roadmap owned by one user.
+	OwnerID      string `json:"owner_id,omitempty"`
+	ForkedFromID string `json:"forked_from_id,omitempty"`
+	ShareToken   string `json:"share_token,omitempty"`
 }
 
 // RoadmapNode represents a single step or book within a roadmap.
@@ -35,6 +41,12 @@ type RoadmapNode struct {
 	Level         string `json:"level"`
 	Description   string `json:"description"`
 	UserStatus    string `json:"user_status"`
+
+	// Graph shape: the nodes that must be completed first, the longest
+	// prerequisite chain leading here, and whether the user can start it.
+	Prerequisites []string `json:"prerequisites"`
+	Depth         int      `json:"depth"`
+	Locked        bool     `json:"locked"`
 }
 
 // RoadmapModel wraps the database connection pool for Roadmap-related operations.
@@ -59,11 +71,12 @@ func (m RoadmapModel) GetAll(includeDrafts bool) ([]*Roadmap, error) {
 	if includeDrafts {
 		query = `SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at 
                  FROM roadmaps 
+                 WHERE owner_id IS NULL
                  ORDER BY title ASC`
 	} else {
 		query = `SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at 
                  FROM roadmaps 
-                 WHERE is_public = true 
+                 WHERE is_public = true AND owner_id IS NULL
                  ORDER BY title ASC`
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -101,6 +114,7 @@ func (m RoadmapModel) GetAll(includeDrafts bool) ([]*Roadmap, error) {
 			FROM roadmap_nodes rn
 			JOIN books b ON rn.book_id = b.id
 			JOIN roadmaps r ON rn.roadmap_id = r.id
+			WHERE r.owner_id IS NULL
 			ORDER BY rn.roadmap_id, rn.sequence_index ASC`
 	} else {
 		queryNodes = `
@@ -110,7 +124,7 @@ func (m RoadmapModel) GetAll(includeDrafts bool) ([]*Roadmap, error) {
 			FROM roadmap_nodes rn
 			JOIN books b ON rn.book_id = b.id
 			JOIN roadmaps r ON rn.roadmap_id = r.id
-			WHERE r.is_public = true
+			WHERE r.is_public = true AND r.owner_id IS NULL
 			ORDER BY rn.roadmap_id, rn.sequence_index ASC`
 	}
 
@@ -142,6 +156,15 @@ func (m RoadmapModel) GetAll(includeDrafts bool) ([]*Roadmap, error) {
 		nodesMap[n.RoadmapID] = append(nodesMap[n.RoadmapID], &n)
 	}
 
+	ids := make([]string, len(roadmaps))
+	for i, r := range roadmaps {
+		ids[i] = r.ID
+	}
+	edges, err := m.getEdges(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, r := range roadmaps {
 		if nodes, ok := nodesMap[r.ID]; ok {
 			r.Nodes = nodes
@@ -150,6 +173,7 @@ func (m RoadmapModel) GetAll(includeDrafts bool) ([]*Roadmap, error) {
 			r.Nodes = []*RoadmapNode{}
 			r.NodesCount = 0
 		}
+		applyGraph(r, edges[r.ID])
 	}
 
 	// 2. Set Cache
@@ -178,12 +202,14 @@ func (m RoadmapModel) GetBySlug(slug string, userID string) (*Roadmap, error) {
 	defer cancel()
 
 	queryRoadmap := `
-		SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at 
+		SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at,
+			COALESCE(owner_id::text, ''), COALESCE(forked_from_id::text, ''), COALESCE(share_token, '')
 		FROM roadmaps 
 		WHERE slug = $1`
 
 	err := m.DB.QueryRowContext(ctx, queryRoadmap, slug).Scan(
 		&r.ID, &r.Title, &r.Slug, &r.Description, &r.CoverImageURL, &r.IsPublic, &r.CreatedAt,
+		&r.OwnerID, &r.ForkedFromID, &r.ShareToken,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -235,25 +261,22 @@ func (m RoadmapModel) GetBySlug(slug string, userID string) (*Roadmap, error) {
 
 	r.Nodes = nodes
 
+	edges, err := m.getEdges(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	applyGraph(&r, edges[r.ID])
+
 	// 2. Set Cache (1 Hour)
 	m.Cache.Set(context.Background(), cacheKey, &r, 1*time.Hour)
 
 	return &r, nil
 }
 
-// UpdateProgress updates the status of a specific node for a user.
+// UpdateProgress updates the status of a specific node for a user, as set
+// by the user themselves.
 func (m RoadmapModel) UpdateProgress(userID, nodeID, status string) error {
-	query := `
-		INSERT INTO user_roadmap_progress (user_id, node_id, status, last_updated_at)
-		VALUES ($1, $2, $3, NOW())
-		ON CONFLICT (user_id, node_id) 
-		DO UPDATE SET status = $3, last_updated_at = NOW()`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	_, err := m.DB.ExecContext(ctx, query, userID, nodeID, status)
-	return err
+	return m.SetProgress(userID, nodeID, status, ProgressSourceManual, nil)
 }
 
 // Insert creates a new roadmap.
@@ -343,7 +366,10 @@ func (m RoadmapModel) InsertNode(n *RoadmapNode) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&n.ID)
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&n.ID); err != nil {
+		return err
+	}
+	return m.Cache.Delete(context.Background(), "roadmap:slug:*")
 }
 
 // UpdateNode modifies an existing roadmap step.
@@ -359,7 +385,10 @@ func (m RoadmapModel) UpdateNode(n *RoadmapNode) error {
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	if err != nil {
+		return err
+	}
+	return m.Cache.Delete(context.Background(), "roadmap:slug:*")
 }
 
 // DeleteNode removes a step from a roadmap.
@@ -368,7 +397,13 @@ func (m RoadmapModel) DeleteNode(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Its prerequisite edges are gone too, which may unlock other nodes.
+	m.Cache.Delete(context.Background(), "roadmap:slug:*")
+	return m.Cache.Delete(context.Background(), "roadmaps:list:*")
 }
 
 // GetByID fetches a roadmap by its ID.
@@ -379,12 +414,14 @@ func (m RoadmapModel) GetByID(id string) (*Roadmap, error) {
 
 	var r Roadmap
 	queryRoadmap := `
-		SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at 
+		SELECT id, title, slug, COALESCE(description, ''), COALESCE(cover_image_url, ''), is_public, created_at,
+			COALESCE(owner_id::text, ''), COALESCE(forked_from_id::text, ''), COALESCE(share_token, '')
 		FROM roadmaps 
 		WHERE id = $1`
 
 	err := m.DB.QueryRowContext(ctx, queryRoadmap, id).Scan(
 		&r.ID, &r.Title, &r.Slug, &r.Description, &r.CoverImageURL, &r.IsPublic, &r.CreatedAt,
+		&r.OwnerID, &r.ForkedFromID, &r.ShareToken,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -429,6 +466,13 @@ func (m RoadmapModel) GetByID(id string) (*Roadmap, error) {
 	}
 
 	r.Nodes = nodes
+
+	edges, err := m.getEdges(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	applyGraph(&r, edges[r.ID])
+
 	return &r, nil
 }
 
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrUnknownPace is returned when building a schedule for an unsupported pace.
+var ErrUnknownPace = errors.New("unknown pace")
+
+// PaceDaysPerNode is how long a cohort spends on each roadmap step.
+var PaceDaysPerNode = map[string]int{
+	"casual":    28,
+	"dedicated": 14,
+	"intensive": 7,
+}
+
+// ScheduledNode is one roadmap step with the dates a cohort studies it.
+// DueDate is the last day of the step.
+type ScheduledNode struct {
+	NodeID    string    `json:"node_id"`
+	BookID    string    `json:"book_id"`
+	BookTitle string    `json:"book_title"`
+	Position  int       `json:"position"`
+	StartDate time.Time `json:"start_date"`
+	DueDate   time.Time `json:"due_date"`
+}
+
+// ScheduleWeek lists the steps a cohort works on in one week, as the range
+// of positions From..To, and the steps due by the end of it.
+type ScheduleWeek struct {
+	Week      int       `json:"week"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	From      int       `json:"from_position"`
+	To        int       `json:"to_position"`
+	NodeIDs   []string  `json:"node_ids"`
+	Due       []string  `json:"due_node_ids"`
+}
+
+// CohortSchedule is the plan of a cohort through its roadmap.
+type CohortSchedule struct {
+	Pace        string          `json:"pace"`
+	DaysPerNode int             `json:"days_per_node"`
+	StartDate   time.Time       `json:"start_date"`
+	EndDate     time.Time       `json:"end_date"`
+	Nodes       []ScheduledNode `json:"nodes"`
+	Weeks       []ScheduleWeek  `json:"weeks"`
+}
+
+// BuildSchedule lays the roadmap's nodes out one after another from the
+// cohort's start date. Nodes are taken in prerequisite order (by depth, then
+// sequence), so no step is scheduled before the steps it depends on.
+func BuildSchedule(start time.Time, pace string, nodes []*RoadmapNode) (*CohortSchedule, error) {
+	days, ok := PaceDaysPerNode[pace]
+	if !ok {
+		return nil, ErrUnknownPace
+	}
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	ordered := make([]*RoadmapNode, len(nodes))
+	copy(ordered, nodes)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Depth != ordered[j].Depth {
+			return ordered[i].Depth < ordered[j].Depth
+		}
+		return ordered[i].SequenceIndex < ordered[j].SequenceIndex
+	})
+
+	s := &CohortSchedule{
+		Pace:        pace,
+		DaysPerNode: days,
+		StartDate:   start,
+		EndDate:     start,
+		Nodes:       make([]ScheduledNode, 0, len(ordered)),
+		Weeks:       []ScheduleWeek{},
+	}
+	for i, n := range ordered {
+		from := start.AddDate(0, 0, i*days)
+		s.Nodes = append(s.Nodes, ScheduledNode{
+			NodeID:    n.ID,
+			BookID:    n.BookID,
+			BookTitle: n.BookTitle,
+			Position:  i + 1,
+			StartDate: from,
+			DueDate:   from.AddDate(0, 0, days-1),
+		})
+	}
+	if len(s.Nodes) == 0 {
+		return s, nil
+	}
+	s.EndDate = s.Nodes[len(s.Nodes)-1].DueDate
+
+	for week := 0; ; week++ {
+		ws := start.AddDate(0, 0, week*7)
+		if ws.After(s.EndDate) {
+			break
+		}
+		we := ws.AddDate(0, 0, 6)
+		w := ScheduleWeek{Week: week + 1, StartDate: ws, EndDate: we, NodeIDs: []string{}, Due: []string{}}
+		for _, n := range s.Nodes {
+			if n.StartDate.After(we) || n.DueDate.Before(ws) {
+				continue
+			}
+			if w.From == 0 {
+				w.From = n.Position
+			}
+			w.To = n.Position
+			w.NodeIDs = append(w.NodeIDs, n.NodeID)
+			if !n.DueDate.After(we) {
+				w.Due = append(w.Due, n.NodeID)
+			}
+		}
+		s.Weeks = append(s.Weeks, w)
+	}
+
+	return s, nil
+}
+
+// ExpectedCompleted is how many nodes should be finished by the given day:
+// every node whose due date has passed.
+func (s *CohortSchedule) ExpectedCompleted(on time.Time) int {
+	day := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	expected := 0
+	for _, n := range s.Nodes {
+		if n.DueDate.Before(day) {
+			expected++
+		}
+	}
+	return expected
+}
+
+// CurrentWeek returns the 1-based week number for the given day, 0 before
+// the cohort starts.
+func (s *CohortSchedule) CurrentWeek(on time.Time) int {
+	day := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	if day.Before(s.StartDate) {
+		return 0
+	}
+	return int(day.Sub(s.StartDate).Hours()/24)/7 + 1
+}
+
+// PaceStatus compares completed nodes with the schedule.
+func PaceStatus(completed, expected, total int) string {
+	switch {
+	case total > 0 && completed >= total:
+		return "completed"
+	case completed < expected:
+		return "behind"
+	default:
+		return "on_track"
+	}
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// SegmentDraft is a parsed chapter waiting to be stored as a segment.
+type SegmentDraft struct {
+	Title        string
+	URL          string
+	StartSeconds int
+	EndSeconds   int // 0 when the end of the video is unknown
+}
+
+// SegmentModel wraps the database connection pool for video segments.
+type SegmentModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// GetForVideo returns all segments of a video regardless of review status.
+func (m SegmentModel) GetForVideo(videoID string) ([]*Resource, error) {
+	query := `
+		SELECT id::text, book_id::text, title, url, COALESCE(media_start_seconds, 0), COALESCE(media_end_seconds, 0),
+			sequence_index, status, reviewer_id::text, created_at
+		FROM resources
+		WHERE parent_id = $1 AND is_segment
+		ORDER BY media_start_seconds ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := []*Resource{}
+	for rows.Next() {
+		r := Resource{Type: "youtube_video", ParentID: &videoID, IsSegment: true}
+		err := rows.Scan(&r.ID, &r.BookID, &r.Title, &r.URL, &r.MediaStartSeconds, &r.MediaEndSeconds,
+			&r.SequenceIndex, &r.Status, &r.ReviewerID, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, &r)
+	}
+
+	return segments, rows.Err()
+}
+
+// ReplaceDrafts swaps the unpublished segments of a video for a freshly
+// parsed set. Published segments are kept so re-detecting never takes
+// reviewed chapters offline; drafts that start where a published segment
+// already starts are skipped.
+func (m SegmentModel) ReplaceDrafts(video *Resource, drafts []SegmentDraft, createdBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queryDelete := `DELETE FROM resources WHERE parent_id = $1 AND is_segment AND status <> 'published'`
+	if _, err := tx.ExecContext(ctx, queryDelete, video.ID); err != nil {
+		return err
+	}
+
+	queryInsert := `
+		INSERT INTO resources (book_id, type, title, url, media_start_seconds, media_end_seconds, is_official,
+			parent_id, sequence_index, status, created_by, is_segment, processing_status)
+		SELECT $1, 'youtube_video', $2, $3, $4, $5, $6, $7, $8, 'pending_review', $9, TRUE, 'skipped'
+		WHERE NOT EXISTS (
+			SELECT 1 FROM resources
+			WHERE parent_id = $7 AND is_segment AND status = 'published' AND media_start_seconds = $4
+		)`
+
+	for i, d := range drafts {
+		_, err := tx.ExecContext(ctx, queryInsert,
+			video.BookID, d.Title, d.URL, d.StartSeconds, d.EndSeconds, video.IsOfficial, video.ID, i+1, createdBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Review publishes or rejects pending segments of a video. An empty ids
+// slice applies the decision to every pending segment.
+func (m SegmentModel) Review(video *Resource, ids []string, status, reviewerID string) (int, error) {
+	query := `
+		UPDATE resources
+		SET status = $1, reviewer_id = $2
+		WHERE parent_id = $3 AND is_segment AND status = 'pending_review'
+		AND (cardinality($4::text[]) = 0 OR id::text = ANY($4::text[]))`
+
+	if ids == nil {
+		ids = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, reviewerID, video.ID, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		m.Cache.Delete(context.Background(), fmt.Sprintf("resources:book:%s", video.BookID))
+	}
+	return int(n), nil
+}
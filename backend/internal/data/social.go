@@ -23,6 +23,11 @@ type CohortMember struct {
 	UserName        string    `json:"user_name"`
 	CurrentProgress int       `json:"current_progress"`
 	LastActiveAt    time.Time `json:"last_active_at"`
+
+	// Filled in against the cohort's schedule.
+	CompletedNodes int    `json:"completed_nodes"`
+	ExpectedNodes  int    `json:"expected_nodes"`
+	Status         string `json:"status,omitempty"` // 'on_track', 'behind', 'completed'
 }
 
 // SocialModel wraps the database connection pool for social features (Cohorts, Partners).
@@ -84,6 +89,88 @@ func (m SocialModel) JoinCohort(cohortID, userID string) error {
 	return err
 }
 
+// RefreshCohortProgress recomputes current_progress (the percentage of the
+// roadmap's nodes completed) for the user's cohorts on a roadmap, and marks
+// them active now.
+func (m SocialModel) RefreshCohortProgress(userID, roadmapID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE cohort_members cm
+		SET current_progress = (
+				SELECT COALESCE(ROUND(100.0 * COUNT(*) FILTER (WHERE up.status = 'completed') / NULLIF(COUNT(*), 0)), 0)
+				FROM roadmap_nodes rn
+				LEFT JOIN user_roadmap_progress up ON up.node_id = rn.id AND up.user_id = cm.user_id
+				WHERE rn.roadmap_id = c.roadmap_id
+			),
+			last_active_at = NOW()
+		FROM cohorts c
+		WHERE c.id = cm.cohort_id AND cm.user_id = $1 AND c.roadmap_id = $2`
+
+	_, err := m.DB.ExecContext(ctx, query, userID, roadmapID)
+	return err
+}
+
+// GetUserCohort fetches the most recent cohort the user joined for a roadmap.
+func (m SocialModel) GetUserCohort(userID, roadmapID string) (*Cohort, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT c.id, c.roadmap_id, c.pace, c.start_date
+		FROM cohorts c
+		JOIN cohort_members cm ON cm.cohort_id = c.id
+		WHERE cm.user_id = $1 AND c.roadmap_id = $2
+		ORDER BY c.start_date DESC
+		LIMIT 1`
+
+	var c Cohort
+	err := m.DB.QueryRowContext(ctx, query, userID, roadmapID).Scan(&c.ID, &c.RoadmapID, &c.Pace, &c.StartDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCohortMembers lists every member of a cohort with the number of the
+// roadmap's nodes they have completed, most progressed first.
+func (m SocialModel) GetCohortMembers(cohortID string) ([]*CohortMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT u.id, COALESCE(u.name, ''), cm.current_progress, cm.last_active_at,
+			(SELECT COUNT(*)
+			 FROM roadmap_nodes rn
+			 JOIN user_roadmap_progress up ON up.node_id = rn.id AND up.user_id = cm.user_id
+			 WHERE rn.roadmap_id = c.roadmap_id AND up.status = 'completed')
+		FROM cohort_members cm
+		JOIN cohorts c ON c.id = cm.cohort_id
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.cohort_id = $1
+		ORDER BY cm.current_progress DESC, u.name ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*CohortMember{}
+	for rows.Next() {
+		var cm CohortMember
+		if err := rows.Scan(&cm.UserID, &cm.UserName, &cm.CurrentProgress, &cm.LastActiveAt, &cm.CompletedNodes); err != nil {
+			return nil, err
+		}
+		members = append(members, &cm)
+	}
+	return members, rows.Err()
+}
+
 // GetCohortPeers fetches the list of classmates for a specific roadmap's active cohort.
 // It returns the top 10 most active members.
 func (m SocialModel) GetCohortPeers(userID, roadmapID string) ([]*CohortMember, error) {
@@ -123,89 +210,342 @@ func (m SocialModel) GetCohortPeers(userID, roadmapID string) ([]*CohortMember,
 	return members, nil
 }
 
-// Partner represents a learning partner relationship.
+// Partnership errors.
+var (
+	// ErrDuplicatePartner is returned when the two users are already partners
+	// or an invite between them is pending.
+	ErrDuplicatePartner = errors.New("partnership already exists")
+	// ErrSelfPartner is returned when a user invites themselves.
+	ErrSelfPartner = errors.New("cannot invite yourself")
+)
+
+// Partner represents a learning partner relationship, seen from one of
+// the two users. Streak is the shared streak: the days in a row both of
+// them have studied, which is the shorter of their two current streaks.
 type Partner struct {
-	ID            string    `json:"id"`
-	UserID        string    `json:"user_id"`
-	UserName      string    `json:"user_name"`
-	Status        string    `json:"status"` // 'pending', 'accepted'
-	Streak        int       `json:"streak"`
-	LastActive    time.Time `json:"last_active_at"`
-	InitiatedByMe bool      `json:"initiated_by_me"`
+	ID                    string    `json:"id"`
+	UserID                string    `json:"user_id"`
+	UserName              string    `json:"user_name"`
+	Status                string    `json:"status"` // 'pending', 'accepted', 'declined'
+	Goal                  string    `json:"goal"`
+	Streak                int       `json:"streak"`
+	MyStreak              int       `json:"my_streak"`
+	PartnerStreak         int       `json:"partner_streak"`
+	CheckedInToday        bool      `json:"checked_in_today"`
+	PartnerCheckedInToday bool      `json:"partner_checked_in_today"`
+	LastActive            time.Time `json:"last_active_at"`
+	InitiatedByMe         bool      `json:"initiated_by_me"`
 }
 
-// InvitePartner sends a partnership invitation to another user.
-func (m SocialModel) InvitePartner(requesterID, targetUserID string) error {
+// CheckIn is a partner's answer to the partnership's daily goal.
+type CheckIn struct {
+	UserID    string    `json:"user_id"`
+	Date      time.Time `json:"date"`
+	Done      bool      `json:"done"`
+	Note      string    `json:"note"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MissedGoal is a partner who did not meet the partnership's goal on a day.
+type MissedGoal struct {
+	PartnershipID string
+	UserID        string
+	PartnerName   string
+	Goal          string
+	MissedOn      time.Time
+}
+
+// InvitePartner sends a partnership invitation to another user and returns
+// the partnership's ID. A user who declined an invite can later invite the
+// requester back; any other existing pairing returns ErrDuplicatePartner.
+func (m SocialModel) InvitePartner(requesterID, targetUserID string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	if targetUserID == requesterID {
-		return errors.New("cannot invite yourself")
+		return "", ErrSelfPartner
 	}
 
 	// We store requester as user_id_1
 	query := `
 		INSERT INTO partners (user_id_1, user_id_2, status)
 		VALUES ($1, $2, 'pending')
-		ON CONFLICT (user_id_1, user_id_2) DO NOTHING`
-
-	_, err := m.DB.ExecContext(ctx, query, requesterID, targetUserID)
-	return err
+		ON CONFLICT ((LEAST(user_id_1, user_id_2)), (GREATEST(user_id_1, user_id_2))) DO UPDATE
+		SET user_id_1 = EXCLUDED.user_id_1, user_id_2 = EXCLUDED.user_id_2,
+			status = 'pending', created_at = NOW(), updated_at = NOW()
+		WHERE partners.status = 'declined' AND partners.user_id_2 = EXCLUDED.user_id_1
+		RETURNING id`
+
+	var id string
+	err := m.DB.QueryRowContext(ctx, query, requesterID, targetUserID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrDuplicatePartner
+		}
+		return "", err
+	}
+	return id, nil
 }
 
 // AcceptPartner accepts a pending partnership invitation.
 func (m SocialModel) AcceptPartner(userID, partnerID string) error {
+	return m.answerInvite(userID, partnerID, "accepted")
+}
+
+// DeclinePartner declines a pending partnership invitation. The requester
+// sees it as declined and cannot invite again.
+func (m SocialModel) DeclinePartner(userID, partnerID string) error {
+	return m.answerInvite(userID, partnerID, "declined")
+}
+
+func (m SocialModel) answerInvite(userID, partnerID, status string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Update status to accepted where user is the invitee (user_id_2)
+	// Update status where user is the invitee (user_id_2)
 	query := `
-		UPDATE partners 
-		SET status = 'accepted', updated_at = NOW()
-		WHERE id = $1 AND user_id_2 = $2`
+		UPDATE partners
+		SET status = $3, updated_at = NOW(),
+			accepted_at = CASE WHEN $3 = 'accepted' THEN NOW() END
+		WHERE id::text = $1 AND user_id_2 = $2 AND status = 'pending'`
 
-	result, err := m.DB.ExecContext(ctx, query, partnerID, userID)
+	result, err := m.DB.ExecContext(ctx, query, partnerID, userID, status)
 	if err != nil {
 		return err
 	}
 
-	rows, _ := result.RowsAffected()
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
 	if rows == 0 {
-		return errors.New("invite not found or already accepted")
+		return ErrRecordNotFound
 	}
 	return nil
 }
 
-// GetPartner fetches the current user's partner status.
-func (m SocialModel) GetPartner(userID string) (*Partner, error) {
+// RemovePartner ends a partnership, or withdraws an invite, for either of
+// the two users. Its check-ins go with it.
+func (m SocialModel) RemovePartner(userID, partnerID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Find any relationship where user is 1 or 2
-	query := `
-		SELECT p.id, p.status, p.user_id_1, u.id, u.name
-		FROM partners p
-		JOIN users u ON (CASE WHEN p.user_id_1 = $1 THEN p.user_id_2 ELSE p.user_id_1 END) = u.id
-		WHERE p.user_id_1 = $1 OR p.user_id_2 = $1
-		LIMIT 1`
+	result, err := m.DB.ExecContext(ctx, `
+		DELETE FROM partners
+		WHERE id::text = $1 AND (user_id_1 = $2 OR user_id_2 = $2)`, partnerID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
 
+// partnerSelect loads partnerships from the point of view of the user
+// passed as $1. A streak only counts while its owner studied today or
+// yesterday, since user_stats is updated when they study, not when they stop.
+const partnerSelect = `
+	SELECT p.id, p.status, p.user_id_1 = $1, u.id, COALESCE(u.name, ''), p.goal,
+		COALESCE(CASE WHEN ms.last_study_date >= CURRENT_DATE - 1 THEN ms.current_streak END, 0),
+		COALESCE(CASE WHEN ps.last_study_date >= CURRENT_DATE - 1 THEN ps.current_streak END, 0),
+		EXISTS (SELECT 1 FROM partner_checkins c
+			WHERE c.partnership_id = p.id AND c.user_id = $1 AND c.checkin_date = CURRENT_DATE AND c.done),
+		EXISTS (SELECT 1 FROM partner_checkins c
+			WHERE c.partnership_id = p.id AND c.user_id = u.id AND c.checkin_date = CURRENT_DATE AND c.done),
+		COALESCE(ps.updated_at, p.created_at)
+	FROM partners p
+	JOIN users u ON (CASE WHEN p.user_id_1 = $1 THEN p.user_id_2 ELSE p.user_id_1 END) = u.id
+	LEFT JOIN user_stats ms ON ms.user_id = $1
+	LEFT JOIN user_stats ps ON ps.user_id = u.id`
+
+func scanPartner(row interface{ Scan(...any) error }) (*Partner, error) {
 	var p Partner
-	var partnerUserID string
-	var initiatorID string
+	err := row.Scan(&p.ID, &p.Status, &p.InitiatedByMe, &p.UserID, &p.UserName, &p.Goal,
+		&p.MyStreak, &p.PartnerStreak, &p.CheckedInToday, &p.PartnerCheckedInToday, &p.LastActive)
+	if err != nil {
+		return nil, err
+	}
+	p.Streak = min(p.MyStreak, p.PartnerStreak)
+	return &p, nil
+}
+
+// GetPartners lists the user's partners and invites, accepted ones first.
+// Declined invites are only shown to the user who sent them.
+func (m SocialModel) GetPartners(userID string) ([]*Partner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := partnerSelect + `
+		WHERE (p.user_id_1 = $1 OR p.user_id_2 = $1)
+		AND (p.status <> 'declined' OR p.user_id_1 = $1)
+		ORDER BY p.status = 'accepted' DESC, p.created_at DESC`
 
-	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&p.ID, &p.Status, &initiatorID, &partnerUserID, &p.UserName)
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partners := []*Partner{}
+	for rows.Next() {
+		p, err := scanPartner(rows)
+		if err != nil {
+			return nil, err
+		}
+		partners = append(partners, p)
+	}
+	return partners, rows.Err()
+}
+
+// GetPartnership fetches one of the user's partnerships.
+func (m SocialModel) GetPartnership(userID, partnerID string) (*Partner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := partnerSelect + `
+		WHERE p.id::text = $2 AND (p.user_id_1 = $1 OR p.user_id_2 = $1)`
+
+	p, err := scanPartner(m.DB.QueryRowContext(ctx, query, userID, partnerID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // No partner
+			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
+	return p, nil
+}
 
-	p.UserID = partnerUserID
-	p.InitiatedByMe = (initiatorID == userID)
+// CountPartners counts the user's accepted partners and the invites they
+// sent that are still pending. Invites they received are not theirs to
+// limit, so they don't count.
+func (m SocialModel) CountPartners(userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	// Calculate Streak (Mock logic for now, or simple query)
-	p.Streak = 0
+	var n int
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM partners
+		WHERE (status = 'accepted' AND (user_id_1 = $1 OR user_id_2 = $1))
+		OR (status = 'pending' AND user_id_1 = $1)`, userID).Scan(&n)
+	return n, err
+}
 
-	return &p, nil
-}
\ No newline at end of file
+// SetPartnerGoal changes the daily goal of an accepted partnership.
+func (m SocialModel) SetPartnerGoal(partnerID, goal string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE partners SET goal = $1, updated_at = NOW() WHERE id = $2`, goal, partnerID)
+	return err
+}
+
+// CheckIn records whether the user met the partnership's goal today.
+// Checking in again the same day replaces the answer.
+func (m SocialModel) CheckIn(partnerID, userID string, done bool, note string) (*CheckIn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO partner_checkins (partnership_id, user_id, checkin_date, done, note)
+		VALUES ($1, $2, CURRENT_DATE, $3, $4)
+		ON CONFLICT (partnership_id, user_id, checkin_date) DO UPDATE
+		SET done = EXCLUDED.done, note = EXCLUDED.note, updated_at = NOW()
+		RETURNING user_id, checkin_date, done, note, updated_at`
+
+	var c CheckIn
+	err := m.DB.QueryRowContext(ctx, query, partnerID, userID, done, note).
+		Scan(&c.UserID, &c.Date, &c.Done, &c.Note, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCheckIns lists both partners' check-ins of the last days, newest first.
+func (m SocialModel) GetCheckIns(partnerID string, days int) ([]*CheckIn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT user_id, checkin_date, done, note, updated_at
+		FROM partner_checkins
+		WHERE partnership_id = $1 AND checkin_date > CURRENT_DATE - $2::int
+		ORDER BY checkin_date DESC, user_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, partnerID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkIns := []*CheckIn{}
+	for rows.Next() {
+		var c CheckIn
+		if err := rows.Scan(&c.UserID, &c.Date, &c.Done, &c.Note, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		checkIns = append(checkIns, &c)
+	}
+	return checkIns, rows.Err()
+}
+
+// ClaimMissedGoals finds partners who did not check in as done yesterday
+// and records a nudge for each, returning only the ones not nudged before,
+// so concurrent callers never nudge anyone twice. Partners who have not
+// met the goal in over a week are left alone.
+func (m SocialModel) ClaimMissedGoals(limit int) ([]*MissedGoal, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		WITH missed AS (
+			SELECT p.id, s.user_id, s.partner_id, p.goal
+			FROM partners p
+			CROSS JOIN LATERAL (VALUES (p.user_id_1, p.user_id_2), (p.user_id_2, p.user_id_1)) AS s(user_id, partner_id)
+			WHERE p.status = 'accepted' AND p.accepted_at < CURRENT_DATE - 1
+			AND NOT EXISTS (
+				SELECT 1 FROM partner_checkins c
+				WHERE c.partnership_id = p.id AND c.user_id = s.user_id
+				AND c.checkin_date = CURRENT_DATE - 1 AND c.done)
+			AND EXISTS (
+				SELECT 1 FROM partner_checkins c
+				WHERE c.partnership_id = p.id AND c.user_id = s.user_id
+				AND c.checkin_date >= CURRENT_DATE - 8 AND c.done)
+			AND NOT EXISTS (
+				SELECT 1 FROM partner_nudges n
+				WHERE n.partnership_id = p.id AND n.user_id = s.user_id AND n.missed_on = CURRENT_DATE - 1)
+			LIMIT $1
+		), nudged AS (
+			INSERT INTO partner_nudges (partnership_id, user_id, missed_on)
+			SELECT id, user_id, CURRENT_DATE - 1 FROM missed
+			ON CONFLICT DO NOTHING
+			RETURNING partnership_id, user_id, missed_on
+		)
+		SELECT n.partnership_id, n.user_id, COALESCE(u.name, ''), m.goal, n.missed_on
+		FROM nudged n
+		JOIN missed m ON m.id = n.partnership_id AND m.user_id = n.user_id
+		JOIN users u ON u.id = m.partner_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missed := []*MissedGoal{}
+	for rows.Next() {
+		var g MissedGoal
+		if err := rows.Scan(&g.PartnershipID, &g.UserID, &g.PartnerName, &g.Goal, &g.MissedOn); err != nil {
+			return nil, err
+		}
+		missed = append(missed, &g)
+	}
+	return missed, rows.Err()
+}
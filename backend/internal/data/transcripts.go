@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+// Transcript is a timed transcript (subtitles) of a video or audio resource.
+type Transcript struct {
+	ID           string          `json:"id"`
+	ResourceID   string          `json:"resource_id"`
+	Language     string          `json:"language"`
+	SourceFormat string          `json:"source_format"`
+	Status       string          `json:"status"`
+	CreatedBy    *string         `json:"created_by,omitempty"`
+	ReviewerID   *string         `json:"reviewer_id,omitempty"`
+	Version      int             `json:"version"`
+	CueCount     int             `json:"cue_count"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Cues         []TranscriptCue `json:"cues,omitempty"`
+}
+
+// TranscriptCue is one timed line of a transcript.
+type TranscriptCue struct {
+	Seq     int    `json:"seq"`
+	StartMs int    `json:"start_ms"`
+	EndMs   int    `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
+// TranscriptHit is a cue matching a transcript search.
+type TranscriptHit struct {
+	TranscriptID  string `json:"transcript_id"`
+	ResourceID    string `json:"resource_id"`
+	ResourceTitle string `json:"resource_title"`
+	ResourceType  string `json:"resource_type"`
+	ResourceURL   string `json:"-"`
+	BookID        string `json:"book_id"`
+	BookTitle     string `json:"book_title"`
+	Language      string `json:"language"`
+	StartMs       int    `json:"start_ms"`
+	EndMs         int    `json:"end_ms"`
+	Text          string `json:"text"`
+}
+
+// TranscriptModel wraps the database connection pool for transcripts.
+type TranscriptModel struct {
+	DB    *sql.DB
+	Cache *cache.Service
+}
+
+// Save creates or replaces the transcript of a resource in one language.
+// Replacing bumps the version and puts it back through review unless the
+// caller already decided the status.
+func (m TranscriptModel) Save(t *Transcript, cues []TranscriptCue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO transcripts (resource_id, language, source_format, status, created_by, reviewer_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (resource_id, language)
+		DO UPDATE SET
+			source_format = EXCLUDED.source_format,
+			status = EXCLUDED.status,
+			reviewer_id = EXCLUDED.reviewer_id,
+			version = transcripts.version + 1,
+			updated_at = NOW()
+		RETURNING id, version, created_at, updated_at`
+
+	err = tx.QueryRowContext(ctx, query, t.ResourceID, t.Language, t.SourceFormat, t.Status, t.CreatedBy, t.ReviewerID).
+		Scan(&t.ID, &t.Version, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM transcript_cues WHERE transcript_id = $1`, t.ID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO transcript_cues (transcript_id, seq, start_ms, end_ms, text)
+		VALUES ($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, c := range cues {
+		if _, err := stmt.ExecContext(ctx, t.ID, i+1, c.StartMs, c.EndMs, c.Text); err != nil {
+			return err
+		}
+	}
+	t.CueCount = len(cues)
+
+	return tx.Commit()
+}
+
+// Get returns a resource's transcript in one language, including its cues.
+func (m TranscriptModel) Get(resourceID, language string) (*Transcript, error) {
+	query := `
+		SELECT id::text, resource_id::text, language, source_format, status, created_by::text, reviewer_id::text,
+			version, created_at, updated_at
+		FROM transcripts
+		WHERE resource_id = $1 AND language = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t Transcript
+	err := m.DB.QueryRowContext(ctx, query, resourceID, language).Scan(
+		&t.ID, &t.ResourceID, &t.Language, &t.SourceFormat, &t.Status, &t.CreatedBy, &t.ReviewerID,
+		&t.Version, &t.CreatedAt, &t.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT seq, start_ms, end_ms, text
+		FROM transcript_cues
+		WHERE transcript_id = $1
+		ORDER BY seq ASC`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c TranscriptCue
+		if err := rows.Scan(&c.Seq, &c.StartMs, &c.EndMs, &c.Text); err != nil {
+			return nil, err
+		}
+		t.Cues = append(t.Cues, c)
+	}
+	t.CueCount = len(t.Cues)
+
+	return &t, rows.Err()
+}
+
+// GetForResource lists a resource's transcripts without their cues.
+func (m TranscriptModel) GetForResource(resourceID string, publishedOnly bool) ([]*Transcript, error) {
+	query := `
+		SELECT t.id::text, t.resource_id::text, t.language, t.source_format, t.status, t.created_by::text, t.reviewer_id::text,
+			t.version, t.created_at, t.updated_at,
+			(SELECT COUNT(*) FROM transcript_cues c WHERE c.transcript_id = t.id)
+		FROM transcripts t
+		WHERE t.resource_id = $1 AND (NOT $2 OR t.status = 'published')
+		ORDER BY t.language ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, resourceID, publishedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transcripts := []*Transcript{}
+	for rows.Next() {
+		var t Transcript
+		err := rows.Scan(&t.ID, &t.ResourceID, &t.Language, &t.SourceFormat, &t.Status, &t.CreatedBy, &t.ReviewerID,
+			&t.Version, &t.CreatedAt, &t.UpdatedAt, &t.CueCount)
+		if err != nil {
+			return nil, err
+		}
+		transcripts = append(transcripts, &t)
+	}
+
+	return transcripts, rows.Err()
+}
+
+// SetStatus records a review decision.
+func (m TranscriptModel) SetStatus(id, status, reviewerID string) error {
+	query := `
+		UPDATE transcripts
+		SET status = $1, reviewer_id = $2, updated_at = NOW()
+		WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, reviewerID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete removes a transcript and its cues.
+func (m TranscriptModel) Delete(resourceID, language string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM transcripts WHERE resource_id = $1 AND language = $2`, resourceID, language)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Search finds cues of published transcripts on published resources whose
+// text contains the query, compared through normalize_arabic so harakat,
+// hamza forms and transliteration apostrophes don't get in the way. The
+// query is matched literally: LIKE wildcards in it are escaped.
+func (m TranscriptModel) Search(q, bookID string, filters Filters) ([]*TranscriptHit, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(),
+			t.id::text, r.id::text, r.title, r.type::text, r.url, b.id::text, b.title, t.language,
+			c.start_ms, c.end_ms, c.text
+		FROM transcript_cues c
+		JOIN transcripts t ON t.id = c.transcript_id
+		JOIN resources r ON r.id = t.resource_id
+		JOIN books b ON b.id = r.book_id
+		WHERE normalize_arabic(c.text) LIKE '%' || replace(replace(replace(normalize_arabic($1), '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+		AND t.status = 'published' AND r.status = 'published' AND b.status = 'published'
+		AND ($2 = '' OR b.id::text = $2)
+		ORDER BY b.title, r.sequence_index, c.start_ms
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, q, bookID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	hits := []*TranscriptHit{}
+	for rows.Next() {
+		var h TranscriptHit
+		err := rows.Scan(&totalRecords, &h.TranscriptID, &h.ResourceID, &h.ResourceTitle, &h.ResourceType, &h.ResourceURL,
+			&h.BookID, &h.BookTitle, &h.Language, &h.StartMs, &h.EndMs, &h.Text)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		hits = append(hits, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return hits, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,98 @@
+// Package linkcheck probes external resource URLs to find dead links.
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPClient is the subset of *http.Client used by the Checker.
+// It is an interface so the checker can run against a fake in tests or scripts.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Result describes the outcome of a single probe.
+type Result struct {
+	OK         bool
+	StatusCode int // 0 if no response was received
+	Error      string
+	Latency    time.Duration
+}
+
+// Checker probes URLs through an injectable HTTP client.
+type Checker struct {
+	Client HTTPClient
+}
+
+// New returns a Checker using client, or a default client with a short timeout when nil.
+func New(client HTTPClient) *Checker {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &Checker{Client: client}
+}
+
+// Check probes rawURL. YouTube videos and playlists are checked through the
+// oEmbed endpoint, which returns 401/404 for private or deleted media while
+// the watch page itself always answers 200.
+func (c *Checker) Check(ctx context.Context, rawURL string) Result {
+	start := time.Now()
+
+	target := rawURL
+	if isYouTube(rawURL) {
+		target = "https://www.youtube.com/oembed?format=json&url=" + url.QueryEscape(rawURL)
+	}
+
+	// Some servers reject HEAD, so retry with GET before calling a link dead.
+	status, err := c.probe(ctx, http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusForbidden || status == http.StatusNotImplemented) {
+		status, err = c.probe(ctx, http.MethodGet, target)
+	}
+
+	res := Result{StatusCode: status, Latency: time.Since(start)}
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+	case status >= 200 && status < 400:
+		res.OK = true
+	default:
+		res.Error = fmt.Sprintf("unexpected status %d", status)
+	}
+	return res
+}
+
+func (c *Checker) probe(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "IqraaLinkChecker/1.0")
+	if method == http.MethodGet {
+		// Only the status matters; avoid downloading whole files.
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	return resp.StatusCode, nil
+}
+
+func isYouTube(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	return host == "youtube.com" || host == "m.youtube.com" || host == "youtu.be"
+}
@@ -0,0 +1,192 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errNoFrame = errors.New("no MPEG audio frame found")
+
+// Bitrate (kbps) tables for Layer III, indexed by the 4-bit bitrate field.
+var (
+	mpeg1L3Bitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mpeg2L3Bitrates = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+)
+
+// Sample rates indexed by [version][rate index]; version uses the raw 2-bit field.
+var sampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG 1
+	2: {22050, 24000, 16000}, // MPEG 2
+	0: {11025, 12000, 8000},  // MPEG 2.5
+}
+
+// mp3Duration returns the playback length of an MP3 file in seconds.
+// VBR files are measured through their Xing/Info or VBRI header; anything
+// without one is treated as constant bitrate and estimated from the file size.
+func mp3Duration(r io.ReaderAt, size int64) (int, error) {
+	offset, err := skipID3v2(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Scan a bounded window for the first frame sync.
+	buf := make([]byte, 64*1024)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+
+		h := buf[i : i+4]
+		version := (h[1] >> 3) & 0x03
+		layer := (h[1] >> 1) & 0x03
+		bitrateIdx := h[2] >> 4
+		rateIdx := (h[2] >> 2) & 0x03
+		channelMode := h[3] >> 6
+
+		// Reject false syncs: reserved version, non Layer III, bad indices.
+		if version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+			continue
+		}
+
+		sampleRate := sampleRates[version][rateIdx]
+		bitrate := mpeg2L3Bitrates[bitrateIdx]
+		samplesPerFrame := 576
+		sideInfo := 17
+		if channelMode == 3 {
+			sideInfo = 9
+		}
+		if version == 3 {
+			bitrate = mpeg1L3Bitrates[bitrateIdx]
+			samplesPerFrame = 1152
+			sideInfo = 32
+			if channelMode == 3 {
+				sideInfo = 17
+			}
+		}
+
+		frame := buf[i:]
+
+		// 1. Xing / Info header (LAME and most encoders)
+		if x := 4 + sideInfo; len(frame) >= x+12 {
+			tag := string(frame[x : x+4])
+			if tag == "Xing" || tag == "Info" {
+				flags := binary.BigEndian.Uint32(frame[x+4 : x+8])
+				if flags&0x1 != 0 {
+					frames := binary.BigEndian.Uint32(frame[x+8 : x+12])
+					return int(uint64(frames) * uint64(samplesPerFrame) / uint64(sampleRate)), nil
+				}
+			}
+		}
+
+		// 2. VBRI header (Fraunhofer) sits at a fixed offset
+		if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+			frames := binary.BigEndian.Uint32(frame[36+14 : 36+18])
+			return int(uint64(frames) * uint64(samplesPerFrame) / uint64(sampleRate)), nil
+		}
+
+		// 3. Constant bitrate estimate
+		audioBytes := size - offset - int64(i)
+		return int(audioBytes * 8 / int64(bitrate*1000)), nil
+	}
+
+	return 0, errNoFrame
+}
+
+// skipID3v2 returns the offset of the first byte after any leading ID3v2 tag.
+func skipID3v2(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return 0, errNoFrame
+		}
+		return 0, err
+	}
+
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	// Tag size is a 28-bit syncsafe integer that excludes the 10 byte header.
+	tagSize := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	offset := 10 + tagSize
+	if header[5]&0x10 != 0 {
+		offset += 10 // footer present
+	}
+	return offset, nil
+}
+
+// mp4Duration reads the movie header (moov/mvhd) of an MPEG-4 container.
+func mp4Duration(r io.ReaderAt, size int64) (int, error) {
+	moovStart, moovSize, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+
+	mvhdStart, _, err := findBox(r, moovStart, moovStart+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	// mvhd payload: version(1) flags(3) then version-dependent fields.
+	buf := make([]byte, 32)
+	if _, err := r.ReadAt(buf, mvhdStart); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if buf[0] == 1 {
+		timescale = binary.BigEndian.Uint32(buf[20:24])
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(buf[12:16])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, errors.New("mvhd has zero timescale")
+	}
+	return int(duration / uint64(timescale)), nil
+}
+
+// findBox walks sibling boxes in [start, end) and returns the payload offset
+// and payload size of the first box with the given type.
+func findBox(r io.ReaderAt, start, end int64, boxType string) (int64, int64, error) {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return 0, 0, err
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		headerLen := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = end - pos // box runs to the end of the container
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return 0, 0, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+
+		if boxSize < headerLen {
+			return 0, 0, errors.New("malformed mp4 box")
+		}
+
+		if string(header[4:8]) == boxType {
+			return pos + headerLen, boxSize - headerLen, nil
+		}
+		pos += boxSize
+	}
+
+	return 0, 0, errors.New("mp4 box not found: " + boxType)
+}
@@ -0,0 +1,79 @@
+// Package media inspects uploaded resource files (PDFs and audio) to extract
+// the details we cannot know from a URL alone: the real content type, page
+// count, playback duration and, where possible, a cover thumbnail.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrUnsupported is returned when a file's format cannot be analysed.
+var ErrUnsupported = errors.New("unsupported media format")
+
+// Info holds everything extracted from a single file.
+// Fields that do not apply to the file's format are left at their zero value.
+type Info struct {
+	MimeType        string
+	SizeBytes       int64
+	PageCount       int
+	DurationSeconds int
+	Thumbnail       []byte // JPEG encoded, nil if none could be produced
+}
+
+// Inspect sniffs the content type of r and runs the matching analyser.
+// A file whose type is recognised but cannot be fully parsed still returns
+// the sniffed MimeType alongside the error, so callers can store what we know.
+func Inspect(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{SizeBytes: size}
+
+	head := make([]byte, 512)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	info.MimeType = DetectContentType(head)
+
+	switch info.MimeType {
+	case "application/pdf":
+		pages, thumb, err := inspectPDF(r, size)
+		info.PageCount = pages
+		info.Thumbnail = thumb
+		return info, err
+	case "audio/mpeg":
+		d, err := mp3Duration(r, size)
+		info.DurationSeconds = d
+		return info, err
+	case "audio/mp4":
+		d, err := mp4Duration(r, size)
+		info.DurationSeconds = d
+		return info, err
+	default:
+		return info, ErrUnsupported
+	}
+}
+
+// DetectContentType extends http.DetectContentType with the audio containers
+// the standard library either misses (raw MPEG frames) or reports as video (M4A).
+func DetectContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "application/pdf"
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return "audio/mpeg"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return "audio/mpeg"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		switch string(head[8:12]) {
+		case "M4A ", "M4B ", "M4P ", "mp42", "isom", "dash":
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	}
+
+	return http.DetectContentType(head)
+}
@@ -0,0 +1,241 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// maxPDFScanBytes caps how much of a PDF the fallback scan reads.
+	maxPDFScanBytes = 100 << 20
+
+	// The fallback scan reads the file in chunks; consecutive chunks overlap
+	// so that patterns crossing a chunk boundary are still found.
+	pdfChunkBytes   = 1 << 20
+	pdfOverlapBytes = 4 << 10
+
+	// maxInflatedBytes caps the decompressed stream data of one file, across
+	// all its streams, so a crafted PDF cannot balloon in memory.
+	maxInflatedBytes = 16 << 20
+
+	// Embedded JPEGs larger than this are not decoded for thumbnails.
+	maxThumbnailSourcePixels = 16 << 20
+
+	// Embedded JPEGs tried before giving up on a thumbnail.
+	maxThumbnailCandidates = 20
+)
+
+// thumbnailWidth is the target width of generated cover thumbnails.
+const thumbnailWidth = 320
+
+var errInflateBudget = errors.New("pdf: decompressed data exceeds limit")
+
+var (
+	pagesCountRX = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pageRX       = regexp.MustCompile(`/Type\s*/Page\b`)
+	objStmRX     = regexp.MustCompile(`(?s)<<[^>]*?/Type\s*/ObjStm[^>]*?>>\s*stream\r?\n`)
+	jpegImageRX  = regexp.MustCompile(`(?s)<<[^>]*?/Subtype\s*/Image[^>]*?/Filter\s*/DCTDecode[^>]*?>>\s*stream\r?\n|<<[^>]*?/Filter\s*/DCTDecode[^>]*?/Subtype\s*/Image[^>]*?>>\s*stream\r?\n`)
+)
+
+// inspectPDF returns the page count and, when the document embeds a JPEG
+// image (typical for scanned books), a thumbnail of the first one found.
+// We cannot rasterise vector pages without a renderer, so text-only PDFs
+// simply have no thumbnail.
+//
+// The page count is read from the root page tree, found through the
+// trailer and cross-reference data. Damaged files fall back to scanning for
+// page objects. Neither holds more than a chunk of the file in memory.
+func inspectPDF(r io.ReaderAt, size int64) (int, []byte, error) {
+	budget := &inflateBudget{left: maxInflatedBytes}
+
+	pages := pdfRootPageCount(r, size, budget)
+	scan, err := scanPDF(r, size, budget, pages == 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if pages == 0 {
+		pages = scan.pageCount()
+	}
+
+	if pages == 0 {
+		return 0, scan.thumbnail, errors.New("could not determine pdf page count")
+	}
+	return pages, scan.thumbnail, nil
+}
+
+// inflateBudget hands out the decompressed bytes a single file may use.
+type inflateBudget struct {
+	left int64
+}
+
+// inflate decompresses a zlib stream from r, which may run past the end of
+// the stream. It fails once the file's budget is spent.
+func (b *inflateBudget) inflate(r io.Reader) ([]byte, error) {
+	if b.left <= 0 {
+		return nil, errInflateBudget
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, b.left+1))
+	if int64(len(out)) > b.left {
+		b.left = 0
+		return nil, errInflateBudget
+	}
+	b.left -= int64(len(out))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pdfScan is what the chunked scan found.
+type pdfScan struct {
+	maxCount  int // largest /Count of a page tree node
+	pageObjs  int // number of /Page objects
+	thumbnail []byte
+}
+
+// pageCount prefers the root page tree's /Count (the largest one) and falls
+// back to the number of individual /Page objects.
+func (s *pdfScan) pageCount() int {
+	if s.maxCount > 0 {
+		return s.maxCount
+	}
+	return s.pageObjs
+}
+
+// scanPDF reads the file chunk by chunk looking for a thumbnail and, when
+// countPages is set, page tree nodes and page objects, including those in
+// compressed object streams (PDF 1.5+).
+func scanPDF(r io.ReaderAt, size int64, budget *inflateBudget, countPages bool) (*pdfScan, error) {
+	scan := &pdfScan{}
+	limit := min(size, maxPDFScanBytes)
+	buf := make([]byte, min(limit, pdfChunkBytes))
+	candidates := 0
+
+	for off := int64(0); off < limit; {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-off)], off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		chunk := buf[:n]
+
+		// Matches are only taken from the part of the chunk the next one
+		// does not overlap, so none is counted twice.
+		own := n
+		if off+int64(n) < limit && n > pdfOverlapBytes {
+			own = n - pdfOverlapBytes
+		}
+
+		if scan.thumbnail == nil && candidates < maxThumbnailCandidates {
+			for _, loc := range jpegImageRX.FindAllIndex(chunk, -1) {
+				if loc[0] >= own {
+					break
+				}
+				start := off + int64(loc[1])
+				scan.thumbnail = pdfThumbnail(io.NewSectionReader(r, start, size-start))
+				candidates++
+				if scan.thumbnail != nil || candidates == maxThumbnailCandidates {
+					break
+				}
+			}
+		}
+
+		if countPages {
+			scan.countIn(chunk, own)
+			for _, loc := range objStmRX.FindAllIndex(chunk, -1) {
+				if loc[0] >= own {
+					break
+				}
+				start := off + int64(loc[1])
+				if inflated, err := budget.inflate(io.NewSectionReader(r, start, size-start)); err == nil {
+					scan.countIn(inflated, len(inflated))
+				}
+			}
+		} else if scan.thumbnail != nil || candidates == maxThumbnailCandidates {
+			break
+		}
+
+		off += int64(own)
+	}
+
+	return scan, nil
+}
+
+// countIn records the page tree nodes and page objects starting in b[:own].
+func (s *pdfScan) countIn(b []byte, own int) {
+	for _, m := range pagesCountRX.FindAllSubmatchIndex(b, -1) {
+		if m[0] >= own {
+			break
+		}
+		var digits []byte
+		if m[2] >= 0 {
+			digits = b[m[2]:m[3]]
+		} else {
+			digits = b[m[4]:m[5]]
+		}
+		if c, err := strconv.Atoi(string(digits)); err == nil && c > s.maxCount {
+			s.maxCount = c
+		}
+	}
+	for _, loc := range pageRX.FindAllIndex(b, -1) {
+		if loc[0] >= own {
+			break
+		}
+		s.pageObjs++
+	}
+}
+
+// pdfThumbnail decodes the embedded JPEG at the start of r and scales it
+// down. Decorations such as logos or ornaments, and images too large to
+// decode safely, yield nil.
+func pdfThumbnail(r *io.SectionReader) []byte {
+	cfg, err := jpeg.DecodeConfig(r)
+	if err != nil || cfg.Width < 100 || cfg.Height < 100 || cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil
+	}
+
+	img, err := jpeg.Decode(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scaleToWidth(img, thumbnailWidth), &jpeg.Options{Quality: 80}); err != nil {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// scaleToWidth performs a nearest-neighbour resize, preserving aspect ratio.
+// Images already narrower than width are returned unchanged.
+func scaleToWidth(src image.Image, width int) image.Image {
+	sb := src.Bounds()
+	if sb.Dx() <= width {
+		return src
+	}
+
+	height := sb.Dy() * width / sb.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := sb.Min.Y + y*sb.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := sb.Min.X + x*sb.Dx()/width
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
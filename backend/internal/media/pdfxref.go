@@ -0,0 +1,580 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The page count of a well-formed PDF is the /Count of its root page tree.
+// The trailer at the end of the file points at the cross-reference data,
+// which gives the location of the document catalog and from there of the
+// page tree. Only those few objects are read.
+
+const (
+	// Bytes read from the end of the file to find startxref.
+	pdfTailBytes = 4 << 10
+
+	// Bytes read for a single object; page tree roots with many kids are
+	// the largest we look at.
+	pdfObjectBytes = 64 << 10
+
+	// Incremental updates followed through /Prev before giving up.
+	maxXrefSections = 32
+)
+
+var errBadXref = errors.New("pdf: malformed cross-reference data")
+
+var (
+	startxrefRX = regexp.MustCompile(`startxref\s+(\d+)`)
+	objHeaderRX = regexp.MustCompile(`^\s*(\d+)\s+\d+\s+obj\b`)
+	rootRX      = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	prevRX      = regexp.MustCompile(`/Prev\s+(\d+)`)
+	xrefStmRX   = regexp.MustCompile(`/XRefStm\s+(\d+)`)
+	pagesRefRX  = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	countRX     = regexp.MustCompile(`/Count\s+(\d+)(\s+\d+\s+R)?`)
+	widthsRX    = regexp.MustCompile(`/W\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+	indexRX     = regexp.MustCompile(`/Index\s*\[([\d\s]*)\]`)
+	sizeRX      = regexp.MustCompile(`/Size\s+(\d+)`)
+	predictorRX = regexp.MustCompile(`/Predictor\s+(\d+)`)
+	columnsRX   = regexp.MustCompile(`/Columns\s+(\d+)`)
+	objCountRX  = regexp.MustCompile(`/N\s+(\d+)`)
+	firstRX     = regexp.MustCompile(`/First\s+(\d+)`)
+)
+
+// pdfRootPageCount returns the /Count of the document's root page tree, or
+// 0 when the cross-reference data cannot be followed.
+func pdfRootPageCount(r io.ReaderAt, size int64, budget *inflateBudget) int {
+	x, err := loadXref(r, size, budget)
+	if err != nil {
+		return 0
+	}
+
+	catalog, err := x.object(x.root)
+	if err != nil {
+		return 0
+	}
+	m := pagesRefRX.FindSubmatch(catalog)
+	if m == nil {
+		return 0
+	}
+	pagesNum, _ := strconv.Atoi(string(m[1]))
+
+	pages, err := x.object(pagesNum)
+	if err != nil {
+		return 0
+	}
+	m = countRX.FindSubmatch(pages)
+	if m == nil || len(m[2]) > 0 {
+		return 0
+	}
+	count, _ := strconv.Atoi(string(m[1]))
+	return count
+}
+
+// xrefEntry locates an object: at a file offset, or as the index-th object
+// of a compressed object stream.
+type xrefEntry struct {
+	offset   int64
+	inStream bool
+	stream   int
+	index    int
+	free     bool
+}
+
+// xrefSection is one cross-reference table or stream.
+type xrefSection interface {
+	lookup(num int) (xrefEntry, bool)
+}
+
+// pdfXref resolves object numbers through the chain of cross-reference
+// sections, newest first.
+type pdfXref struct {
+	r        io.ReaderAt
+	size     int64
+	budget   *inflateBudget
+	root     int
+	sections []xrefSection
+	objStms  map[int]*objectStream
+}
+
+func loadXref(r io.ReaderAt, size int64, budget *inflateBudget) (*pdfXref, error) {
+	tailStart := max(size-pdfTailBytes, 0)
+	tail := make([]byte, size-tailStart)
+	if _, err := r.ReadAt(tail, tailStart); err != nil && err != io.EOF {
+		return nil, err
+	}
+	matches := startxrefRX.FindAllSubmatch(tail, -1)
+	if matches == nil {
+		return nil, errBadXref
+	}
+	off, _ := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+
+	x := &pdfXref{r: r, size: size, budget: budget, objStms: make(map[int]*objectStream)}
+	seen := make(map[int64]bool)
+	for len(x.sections) < maxXrefSections && off > 0 && off < size && !seen[off] {
+		seen[off] = true
+
+		section, trailer, err := x.readSection(off)
+		if err != nil {
+			return nil, err
+		}
+		x.sections = append(x.sections, section)
+
+		// Hybrid files keep the entries for compressed objects in a stream.
+		if m := xrefStmRX.FindSubmatch(trailer); m != nil {
+			stmOff, _ := strconv.ParseInt(string(m[1]), 10, 64)
+			if stm, _, err := x.readStreamSection(stmOff); err == nil {
+				x.sections = append(x.sections, stm)
+			}
+		}
+
+		if x.root == 0 {
+			if m := rootRX.FindSubmatch(trailer); m != nil {
+				x.root, _ = strconv.Atoi(string(m[1]))
+			}
+		}
+
+		m := prevRX.FindSubmatch(trailer)
+		if m == nil {
+			break
+		}
+		off, _ = strconv.ParseInt(string(m[1]), 10, 64)
+	}
+
+	if x.root == 0 || len(x.sections) == 0 {
+		return nil, errBadXref
+	}
+	return x, nil
+}
+
+// readSection parses the cross-reference table or stream at off and returns
+// it with its trailer dictionary.
+func (x *pdfXref) readSection(off int64) (xrefSection, []byte, error) {
+	head := make([]byte, 4)
+	if _, err := x.r.ReadAt(head, off); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if string(head) == "xref" {
+		return x.readTable(off)
+	}
+	return x.readStreamSection(off)
+}
+
+// xrefTable is a classic cross-reference table. Only the position of each
+// subsection is kept; entries are fixed-width and read when looked up.
+type xrefTable struct {
+	r           io.ReaderAt
+	subsections []xrefSubsection
+}
+
+type xrefSubsection struct {
+	first, count int
+	at           int64
+}
+
+func (x *pdfXref) readTable(off int64) (xrefSection, []byte, error) {
+	br := bufio.NewReader(io.NewSectionReader(x.r, off, x.size-off))
+	pos := off
+	table := &xrefTable{r: x.r}
+	trailerStart := ""
+
+	line, err := br.ReadString('\n')
+	pos += int64(len(line))
+	if err != nil || strings.TrimSpace(line) != "xref" {
+		return nil, nil, errBadXref
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		pos += int64(len(line))
+		if err != nil {
+			return nil, nil, errBadXref
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "trailer"); ok {
+			trailerStart = rest
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, errBadXref
+		}
+		first, err1 := strconv.Atoi(fields[0])
+		count, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil || first < 0 || count < 0 || int64(count)*20 > x.size-pos {
+			return nil, nil, errBadXref
+		}
+		table.subsections = append(table.subsections, xrefSubsection{first: first, count: count, at: pos})
+
+		if _, err := br.Discard(count * 20); err != nil {
+			return nil, nil, errBadXref
+		}
+		pos += int64(count) * 20
+	}
+
+	trailer := make([]byte, pdfTailBytes)
+	n, _ := io.ReadFull(br, trailer)
+	trailer = append([]byte(trailerStart+"\n"), trailer[:n]...)
+	if end := bytes.Index(trailer, []byte("startxref")); end >= 0 {
+		trailer = trailer[:end]
+	}
+	return table, trailer, nil
+}
+
+func (t *xrefTable) lookup(num int) (xrefEntry, bool) {
+	for _, sub := range t.subsections {
+		if num < sub.first || num >= sub.first+sub.count {
+			continue
+		}
+		raw := make([]byte, 20)
+		if _, err := t.r.ReadAt(raw, sub.at+int64(num-sub.first)*20); err != nil {
+			return xrefEntry{}, false
+		}
+		fields := strings.Fields(string(raw))
+		if len(fields) < 3 {
+			return xrefEntry{}, false
+		}
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return xrefEntry{}, false
+		}
+		return xrefEntry{offset: offset, free: fields[2] != "n"}, true
+	}
+	return xrefEntry{}, false
+}
+
+// xrefStream is a cross-reference stream (PDF 1.5+): rows of fixed-width
+// binary fields.
+type xrefStream struct {
+	widths [3]int
+	index  []int // pairs of first object number and count
+	rows   []byte
+}
+
+func (x *pdfXref) readStreamSection(off int64) (xrefSection, []byte, error) {
+	dict, data, err := x.stream(-1, off)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Contains(dict, []byte("/XRef")) {
+		return nil, nil, errBadXref
+	}
+
+	stm := &xrefStream{}
+	m := widthsRX.FindSubmatch(dict)
+	if m == nil {
+		return nil, nil, errBadXref
+	}
+	rowLen := 0
+	for i := range stm.widths {
+		stm.widths[i], _ = strconv.Atoi(string(m[i+1]))
+		if stm.widths[i] > 8 {
+			return nil, nil, errBadXref
+		}
+		rowLen += stm.widths[i]
+	}
+	if rowLen == 0 {
+		return nil, nil, errBadXref
+	}
+
+	if m := indexRX.FindSubmatch(dict); m != nil {
+		for _, f := range strings.Fields(string(m[1])) {
+			n, _ := strconv.Atoi(f)
+			stm.index = append(stm.index, n)
+		}
+	} else if m := sizeRX.FindSubmatch(dict); m != nil {
+		n, _ := strconv.Atoi(string(m[1]))
+		stm.index = []int{0, n}
+	}
+	if len(stm.index)%2 != 0 {
+		return nil, nil, errBadXref
+	}
+
+	if m := predictorRX.FindSubmatch(dict); m != nil {
+		predictor, _ := strconv.Atoi(string(m[1]))
+		if predictor >= 10 {
+			columns := 1
+			if m := columnsRX.FindSubmatch(dict); m != nil {
+				columns, _ = strconv.Atoi(string(m[1]))
+			}
+			if data, err = unpredictPNG(data, columns); err != nil {
+				return nil, nil, err
+			}
+		} else if predictor != 1 {
+			return nil, nil, errBadXref
+		}
+	}
+	stm.rows = data
+
+	return stm, dict, nil
+}
+
+func (s *xrefStream) lookup(num int) (xrefEntry, bool) {
+	rowLen := s.widths[0] + s.widths[1] + s.widths[2]
+	row := 0
+	for i := 0; i+1 < len(s.index); i += 2 {
+		first, count := s.index[i], s.index[i+1]
+		if num < first || num >= first+count {
+			row += count
+			continue
+		}
+		start := (row + num - first) * rowLen
+		if start+rowLen > len(s.rows) {
+			return xrefEntry{}, false
+		}
+		b := s.rows[start : start+rowLen]
+
+		kind := int64(1) // a zero-width type field means "in use"
+		if s.widths[0] > 0 {
+			kind = beUint(b[:s.widths[0]])
+		}
+		f2 := beUint(b[s.widths[0] : s.widths[0]+s.widths[1]])
+		f3 := beUint(b[s.widths[0]+s.widths[1]:])
+
+		switch kind {
+		case 1:
+			return xrefEntry{offset: f2}, true
+		case 2:
+			return xrefEntry{inStream: true, stream: int(f2), index: int(f3)}, true
+		default:
+			return xrefEntry{free: true}, true
+		}
+	}
+	return xrefEntry{}, false
+}
+
+// beUint decodes a big-endian unsigned integer of up to 8 bytes.
+func beUint(b []byte) int64 {
+	var v int64
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// unpredictPNG reverses the PNG row filters that cross-reference streams
+// use, for rows of columns one-byte samples.
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	stride := columns + 1
+	if columns < 1 || len(data)%stride != 0 {
+		return nil, errBadXref
+	}
+
+	out := make([]byte, 0, len(data)/stride*columns)
+	prev := make([]byte, columns)
+	for i := 0; i < len(data); i += stride {
+		filter, row := data[i], data[i+1:i+stride]
+		for j := range row {
+			var left, upLeft byte
+			if j > 0 {
+				left, upLeft = row[j-1], prev[j-1]
+			}
+			up := prev[j]
+			switch filter {
+			case 0:
+			case 1:
+				row[j] += left
+			case 2:
+				row[j] += up
+			case 3:
+				row[j] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[j] += paeth(left, up, upLeft)
+			default:
+				return nil, errBadXref
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// lookup finds an object in the newest section that lists it.
+func (x *pdfXref) lookup(num int) (xrefEntry, bool) {
+	for _, s := range x.sections {
+		if e, ok := s.lookup(num); ok {
+			return e, true
+		}
+	}
+	return xrefEntry{}, false
+}
+
+// object returns the body of an object, up to any stream data: its
+// dictionary, for the objects we read.
+func (x *pdfXref) object(num int) ([]byte, error) {
+	e, ok := x.lookup(num)
+	if !ok || e.free {
+		return nil, errBadXref
+	}
+	if e.inStream {
+		return x.streamedObject(num, e.stream, e.index)
+	}
+
+	body, _, err := x.objectAt(num, e.offset)
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.Index(body, []byte("endobj")); end >= 0 {
+		body = body[:end]
+	}
+	if end := bytes.Index(body, []byte("stream")); end >= 0 {
+		body = body[:end]
+	}
+	return body, nil
+}
+
+// objectAt reads what follows the header of object num at off, checking
+// that the header is really there, and returns it with its file offset.
+// num < 0 accepts any object number.
+func (x *pdfXref) objectAt(num int, off int64) ([]byte, int64, error) {
+	if off <= 0 || off >= x.size {
+		return nil, 0, errBadXref
+	}
+	window := make([]byte, min(pdfObjectBytes, x.size-off))
+	n, err := x.r.ReadAt(window, off)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	window = window[:n]
+
+	m := objHeaderRX.FindSubmatchIndex(window)
+	if m == nil {
+		return nil, 0, errBadXref
+	}
+	if got, _ := strconv.Atoi(string(window[m[2]:m[3]])); num >= 0 && got != num {
+		return nil, 0, errBadXref
+	}
+	return window[m[1]:], off + int64(m[1]), nil
+}
+
+// stream returns the dictionary and inflated data of the stream object at
+// off. Only Flate-compressed streams are supported.
+func (x *pdfXref) stream(num int, off int64) ([]byte, []byte, error) {
+	body, bodyOff, err := x.objectAt(num, off)
+	if err != nil {
+		return nil, nil, err
+	}
+	at := bytes.Index(body, []byte("stream"))
+	if at < 0 {
+		return nil, nil, errBadXref
+	}
+	dict := body[:at]
+	if !bytes.Contains(dict, []byte("/FlateDecode")) {
+		return nil, nil, errBadXref
+	}
+
+	// The keyword is followed by CRLF or LF, then the data.
+	at += len("stream")
+	if at < len(body) && body[at] == '\r' {
+		at++
+	}
+	if at < len(body) && body[at] == '\n' {
+		at++
+	}
+
+	start := bodyOff + int64(at)
+	data, err := x.budget.inflate(io.NewSectionReader(x.r, start, x.size-start))
+	if err != nil {
+		return nil, nil, err
+	}
+	return dict, data, nil
+}
+
+// objectStream is a decoded object stream: objects stored back to back after
+// a header of object number and offset pairs.
+type objectStream struct {
+	nums    []int
+	offsets []int
+	data    []byte // the objects, after the header
+}
+
+// streamedObject returns object num, the index-th object of object stream
+// stm. Each object stream is decoded once.
+func (x *pdfXref) streamedObject(num, stm, index int) ([]byte, error) {
+	objs, ok := x.objStms[stm]
+	if !ok {
+		e, found := x.lookup(stm)
+		if !found || e.free || e.inStream {
+			return nil, errBadXref
+		}
+		dict, data, err := x.stream(stm, e.offset)
+		if err != nil {
+			return nil, err
+		}
+		if objs, err = parseObjectStream(dict, data); err != nil {
+			return nil, err
+		}
+		x.objStms[stm] = objs
+	}
+
+	if index < 0 || index >= len(objs.nums) || objs.nums[index] != num {
+		return nil, errBadXref
+	}
+	end := len(objs.data)
+	if index+1 < len(objs.offsets) {
+		end = objs.offsets[index+1]
+	}
+	start := objs.offsets[index]
+	if start > end || end > len(objs.data) {
+		return nil, errBadXref
+	}
+	return objs.data[start:end], nil
+}
+
+func parseObjectStream(dict, data []byte) (*objectStream, error) {
+	mn, mf := objCountRX.FindSubmatch(dict), firstRX.FindSubmatch(dict)
+	if mn == nil || mf == nil {
+		return nil, errBadXref
+	}
+	n, _ := strconv.Atoi(string(mn[1]))
+	first, _ := strconv.Atoi(string(mf[1]))
+	if first > len(data) {
+		return nil, errBadXref
+	}
+
+	header := strings.Fields(string(data[:first]))
+	if len(header) < 2*n {
+		return nil, errBadXref
+	}
+	objs := &objectStream{data: data[first:]}
+	for i := 0; i < n; i++ {
+		num, err1 := strconv.Atoi(header[2*i])
+		offset, err2 := strconv.Atoi(header[2*i+1])
+		if err1 != nil || err2 != nil {
+			return nil, errBadXref
+		}
+		objs.nums = append(objs.nums, num)
+		objs.offsets = append(objs.offsets, offset)
+	}
+	return objs, nil
+}
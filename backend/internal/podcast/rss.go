@@ -0,0 +1,156 @@
+// Package podcast renders RSS 2.0 feeds with the iTunes podcast extensions,
+// so a book's or roadmap's audio can be followed in any podcast player.
+package podcast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// Feed describes a podcast channel.
+type Feed struct {
+	Title       string
+	Link        string // web page of the book or roadmap
+	SelfURL     string // URL of the feed itself
+	Description string
+	Author      string
+	ImageURL    string
+	Language    string
+	Category    string
+	Episodes    []Episode
+}
+
+// Episode is a single audio item in a feed.
+type Episode struct {
+	GUID            string
+	Title           string
+	Description     string
+	URL             string
+	MimeType        string
+	SizeBytes       int64
+	DurationSeconds int
+	PublishedAt     time.Time
+	Number          int
+}
+
+type rss struct {
+	XMLName  xml.Name `xml:"rss"`
+	Version  string   `xml:"version,attr"`
+	ITunesNS string   `xml:"xmlns:itunes,attr"`
+	AtomNS   string   `xml:"xmlns:atom,attr"`
+	Channel  channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	AtomLink    atomLink     `xml:"atom:link"`
+	Description string       `xml:"description"`
+	Language    string       `xml:"language,omitempty"`
+	Author      string       `xml:"itunes:author,omitempty"`
+	Summary     string       `xml:"itunes:summary,omitempty"`
+	Type        string       `xml:"itunes:type"`
+	Explicit    string       `xml:"itunes:explicit"`
+	Image       *itunesImage `xml:"itunes:image,omitempty"`
+	Category    *category    `xml:"itunes:category,omitempty"`
+	Items       []item       `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type category struct {
+	Text string `xml:"text,attr"`
+}
+
+type item struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description,omitempty"`
+	GUID        guid      `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Enclosure   enclosure `xml:"enclosure"`
+	Duration    string    `xml:"itunes:duration,omitempty"`
+	Episode     int       `xml:"itunes:episode,omitempty"`
+	EpisodeType string    `xml:"itunes:episodeType"`
+}
+
+type guid struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Write renders the feed as RSS 2.0 XML.
+// Channels are serial: players list episodes in the order given.
+func (f *Feed) Write(w io.Writer) error {
+	ch := channel{
+		Title:       f.Title,
+		Link:        f.Link,
+		AtomLink:    atomLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+		Description: f.Description,
+		Language:    f.Language,
+		Author:      f.Author,
+		Summary:     f.Description,
+		Type:        "serial",
+		Explicit:    "false",
+	}
+	if f.ImageURL != "" {
+		ch.Image = &itunesImage{Href: f.ImageURL}
+	}
+	if f.Category != "" {
+		ch.Category = &category{Text: f.Category}
+	}
+
+	for _, e := range f.Episodes {
+		mime := e.MimeType
+		if mime == "" {
+			mime = "audio/mpeg"
+		}
+		it := item{
+			Title:       e.Title,
+			Description: e.Description,
+			GUID:        guid{Value: e.GUID},
+			PubDate:     e.PublishedAt.UTC().Format(time.RFC1123Z),
+			Enclosure:   enclosure{URL: e.URL, Length: e.SizeBytes, Type: mime},
+			Episode:     e.Number,
+			EpisodeType: "full",
+		}
+		if e.DurationSeconds > 0 {
+			it.Duration = formatDuration(e.DurationSeconds)
+		}
+		ch.Items = append(ch.Items, it)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(rss{
+		Version:  "2.0",
+		ITunesNS: itunesNS,
+		AtomNS:   "http://www.w3.org/2005/Atom",
+		Channel:  ch,
+	})
+}
+
+// formatDuration renders seconds as HH:MM:SS as expected by itunes:duration.
+func formatDuration(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrInvalidRange is returned when a requested byte range lies outside the object.
+var ErrInvalidRange = errors.New("storage: invalid range")
+
+// ErrNotFound is returned when the object does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object is an open object body with the headers needed to serve it.
+type Object struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	ContentRange  string // set for partial responses, e.g. "bytes 0-1023/52428800"
+	ETag          string
+	LastModified  time.Time
+}
+
+// KeyFromURL returns the object key for a URL on our public media domain.
+func (s *R2Service) KeyFromURL(url string) (string, bool) {
+	prefix := strings.TrimRight(s.PublicDomain, "/") + "/"
+	if s.PublicDomain == "" || !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, prefix)
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	return key, key != ""
+}
+
+// GetObject opens an object, optionally limited to an HTTP Range header value
+// ("bytes=0-1023"). The caller must close the body.
+func (s *R2Service) GetObject(ctx context.Context, key, byteRange string) (*Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+
+	out, err := s.Client.GetObject(ctx, input)
+	if err != nil {
+		var apiErr interface{ ErrorCode() string }
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "InvalidRange":
+				return nil, ErrInvalidRange
+			case "NoSuchKey", "NotFound":
+				return nil, ErrNotFound
+			}
+		}
+		return nil, err
+	}
+
+	return &Object{
+		Body:          out.Body,
+		ContentType:   aws.ToString(out.ContentType),
+		ContentLength: aws.ToInt64(out.ContentLength),
+		ContentRange:  aws.ToString(out.ContentRange),
+		ETag:          aws.ToString(out.ETag),
+		LastModified:  aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// PresignGet returns a URL that grants read access to a single object for ttl.
+// R2 honours Range requests on presigned URLs, so players can still seek.
+func (s *R2Service) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	presigner := s3.NewPresignClient(s.Client)
+
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
@@ -0,0 +1,194 @@
+// Package subtitles reads and writes WebVTT and SubRip (SRT) transcripts.
+package subtitles
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCues is returned when a file contains no usable cues.
+var ErrNoCues = errors.New("subtitles: no cues found")
+
+// Cue is a single timed line of a transcript.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Format names a subtitle file format.
+type Format string
+
+const (
+	VTT Format = "vtt"
+	SRT Format = "srt"
+)
+
+// Parse reads a WebVTT or SRT file; the format is detected from the header.
+// Cue settings, identifiers, NOTE/STYLE blocks and inline tags are dropped.
+func Parse(r io.Reader) ([]Cue, Format, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	format := SRT
+	var cues []Cue
+	var current *Cue
+	var text []string
+	skipBlock := false
+	first := true
+
+	flush := func() {
+		if current != nil && len(text) > 0 {
+			current.Text = stripTags(strings.Join(text, "\n"))
+			if current.Text != "" {
+				cues = append(cues, *current)
+			}
+		}
+		current, text, skipBlock = nil, nil, false
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+			if strings.HasPrefix(line, "WEBVTT") {
+				format = VTT
+				skipBlock = true // header block
+				continue
+			}
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if skipBlock {
+			continue
+		}
+
+		if current == nil {
+			if format == VTT && (strings.HasPrefix(line, "NOTE") || strings.HasPrefix(line, "STYLE") || strings.HasPrefix(line, "REGION")) {
+				skipBlock = true
+				continue
+			}
+			if !strings.Contains(line, "-->") {
+				continue // cue identifier / SRT counter
+			}
+			start, end, err := parseTiming(line)
+			if err != nil {
+				return nil, format, err
+			}
+			current = &Cue{Start: start, End: end}
+			continue
+		}
+
+		text = append(text, strings.TrimSpace(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, format, err
+	}
+	flush()
+
+	if len(cues) == 0 {
+		return nil, format, ErrNoCues
+	}
+	return cues, format, nil
+}
+
+// parseTiming reads "00:01:02.500 --> 00:01:05.000 align:start".
+func parseTiming(line string) (time.Duration, time.Duration, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	endField := strings.Fields(parts[1])
+	if len(endField) == 0 {
+		return 0, 0, fmt.Errorf("subtitles: missing end time in %q", line)
+	}
+	end, err := parseTimestamp(endField[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("subtitles: cue ends before it starts: %q", line)
+	}
+	return start, end, nil
+}
+
+// parseTimestamp accepts hh:mm:ss.mmm, mm:ss.mmm and the SRT comma form.
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+
+	var frac time.Duration
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		ms := (s[i+1:] + "000")[:3]
+		n, err := strconv.Atoi(ms)
+		if err != nil {
+			return 0, fmt.Errorf("subtitles: invalid timestamp %q", s)
+		}
+		frac = time.Duration(n) * time.Millisecond
+		s = s[:i]
+	}
+
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("subtitles: invalid timestamp %q", s)
+	}
+	var total time.Duration
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, fmt.Errorf("subtitles: invalid timestamp %q", s)
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total*time.Second + frac, nil
+}
+
+// stripTags removes WebVTT/SRT inline markup such as <i>, <v Speaker> or {\an8}.
+func stripTags(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '<' || r == '{':
+			depth++
+		case (r == '>' || r == '}') && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Write renders cues in the given format.
+func Write(w io.Writer, cues []Cue, format Format) error {
+	bw := bufio.NewWriter(w)
+	if format == VTT {
+		bw.WriteString("WEBVTT\n\n")
+	}
+	for i, c := range cues {
+		if format == SRT {
+			fmt.Fprintf(bw, "%d\n", i+1)
+		}
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n", formatTimestamp(c.Start, format), formatTimestamp(c.End, format), c.Text)
+	}
+	return bw.Flush()
+}
+
+func formatTimestamp(d time.Duration, format Format) string {
+	sep := "."
+	if format == SRT {
+		sep = ","
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,105 @@
+package youtube
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Chapter is one entry of a timestamp list found in a video description.
+type Chapter struct {
+	StartSeconds int    `json:"start_seconds"`
+	Title        string `json:"title"`
+}
+
+// timestampRe matches h:mm:ss or m:ss once digits have been normalized.
+// Long lectures run past 99 minutes without switching to hours.
+var timestampRe = regexp.MustCompile(`\b(\d{1,3}(?::\d{1,2}){1,2})`)
+
+// ParseChapters extracts a chapter list from a video description.
+// Lines may use Latin, Arabic-Indic (٠-٩) or Persian (۰-۹) digits, with the
+// timestamp before or after the title ("00:00 muqaddima", "باب الكلام - ١٢:٣٠").
+// A list needs at least two entries in ascending order; anything else is
+// treated as prose that happens to mention a time and nil is returned.
+func ParseChapters(description string) []Chapter {
+	var chapters []Chapter
+
+	for _, line := range strings.Split(description, "\n") {
+		line = normalizeDigits(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+
+		loc := timestampRe.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		start, ok := parseTimestamp(line[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+
+		title := cleanChapterTitle(line[:loc[0]] + " " + line[loc[1]:])
+		if title == "" {
+			continue
+		}
+
+		// A timestamp must move forward; restarts mean a second, unrelated list.
+		if n := len(chapters); n > 0 && start <= chapters[n-1].StartSeconds {
+			continue
+		}
+
+		chapters = append(chapters, Chapter{StartSeconds: start, Title: title})
+	}
+
+	if len(chapters) < 2 {
+		return nil
+	}
+	return chapters
+}
+
+// normalizeDigits maps Arabic-Indic and Persian digits and the Arabic
+// colon-like separators to their ASCII forms.
+func normalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '٠' && r <= '٩':
+			return '0' + (r - '٠')
+		case r >= '۰' && r <= '۹':
+			return '0' + (r - '۰')
+		case r == '：' || r == '∶':
+			return ':'
+		}
+		return r
+	}, s)
+}
+
+// parseTimestamp converts "h:mm:ss" or "m:ss" to seconds.
+func parseTimestamp(ts string) (int, bool) {
+	parts := strings.Split(ts, ":")
+	total := 0
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, false
+		}
+		// Minutes and seconds after the leading field must be below 60.
+		if i > 0 && n >= 60 {
+			return 0, false
+		}
+		total = total*60 + n
+	}
+	return total, true
+}
+
+const chapterSeparators = "-–—|:•▶►()[]{}.,،;*#>"
+
+// cleanChapterTitle strips the separators and bullets people put around timestamps.
+func cleanChapterTitle(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(chapterSeparators, r)
+	})
+}
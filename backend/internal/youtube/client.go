@@ -1,68 +1,248 @@
 package youtube
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/draqist/iqraa/backend/internal/cache"
+)
+
+const apiBase = "https://www.googleapis.com/youtube/v3"
+
+var (
+	// ErrQuotaExceeded is returned when the daily API budget has been spent.
+	ErrQuotaExceeded = errors.New("youtube: daily quota budget exceeded")
+
+	// ErrNotFound is returned when a playlist or video does not exist or is private.
+	ErrNotFound = errors.New("youtube: not found")
 )
 
 type PlaylistItem struct {
 	Snippet struct {
-		Title       string `json:"title"`
-		ResourceId  struct {
+		Title      string `json:"title"`
+		ResourceId struct {
 			VideoId string `json:"videoId"`
 		} `json:"resourceId"`
 		Position int `json:"position"`
 	} `json:"snippet"`
 }
 
+type VideoListResponse struct {
+	Items []struct {
+		ID      string `json:"id"`
+		Snippet struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		} `json:"snippet"`
+	} `json:"items"`
+}
+
 type PlaylistResponse struct {
 	Items         []PlaylistItem `json:"items"`
 	NextPageToken string         `json:"nextPageToken"`
 }
 
-// FetchPlaylistVideos grabs all videos from a playlist
-func FetchPlaylistVideos(playlistID string) ([]PlaylistItem, error) {
-	apiKey := os.Getenv("YOUTUBE_API_KEY")
-	if apiKey == "" {
-		// This log will show up in your Render/Local terminal
-		fmt.Println("CRITICAL ERROR: YOUTUBE_API_KEY is empty")
-		return nil, fmt.Errorf("YOUTUBE_API_KEY not set")
+// Client is the YouTube Data API surface used by the app.
+// Sync and import code depend on this interface so they can run against a fake.
+type Client interface {
+	PlaylistItems(ctx context.Context, playlistID string) ([]PlaylistItem, error)
+	VideoDescription(ctx context.Context, videoID string) (string, error)
+}
+
+// APIClient talks to the YouTube Data API v3.
+// Pages are cached in Redis and every request is counted against a daily
+// quota budget so a runaway sync cannot exhaust the project's quota.
+type APIClient struct {
+	APIKey      string
+	HTTP        *http.Client
+	Cache       *cache.Service
+	CacheTTL    time.Duration
+	DailyBudget int // quota units per day; 0 disables the check
+}
+
+// NewClient returns an APIClient with sensible defaults.
+// The default budget leaves headroom under YouTube's 10,000 units/day.
+func NewClient(apiKey string, cacheSvc *cache.Service) *APIClient {
+	return &APIClient{
+		APIKey:      apiKey,
+		HTTP:        &http.Client{Timeout: 15 * time.Second},
+		Cache:       cacheSvc,
+		CacheTTL:    10 * time.Minute,
+		DailyBudget: 8000,
 	}
+}
+
+// PlaylistItems grabs all videos from a playlist, following page tokens.
+func (c *APIClient) PlaylistItems(ctx context.Context, playlistID string) ([]PlaylistItem, error) {
 	var allItems []PlaylistItem
 	pageToken := ""
 
 	for {
-		// Build URL
-		apiUrl := fmt.Sprintf(
-			"https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&maxResults=50&playlistId=%s&key=%s&pageToken=%s",
-			playlistID, apiKey, pageToken,
-		)
-
-		resp, err := http.Get(apiUrl)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("YouTube API error: %d", resp.StatusCode)
+		var page PlaylistResponse
+		params := url.Values{
+			"part":       {"snippet"},
+			"maxResults": {"50"},
+			"playlistId": {playlistID},
+			"pageToken":  {pageToken},
 		}
-
-		var data PlaylistResponse
-		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		if err := c.get(ctx, "playlistItems", params, 1, &page); err != nil {
 			return nil, err
 		}
 
-		allItems = append(allItems, data.Items...)
+		allItems = append(allItems, page.Items...)
 
 		// Check for next page
-		if data.NextPageToken == "" {
+		if page.NextPageToken == "" {
 			break
 		}
-		pageToken = data.NextPageToken
+		pageToken = page.NextPageToken
 	}
 
 	return allItems, nil
-}
\ No newline at end of file
+}
+
+// VideoDescription returns the description text of a single video.
+func (c *APIClient) VideoDescription(ctx context.Context, videoID string) (string, error) {
+	var resp VideoListResponse
+	params := url.Values{
+		"part": {"snippet"},
+		"id":   {videoID},
+	}
+	if err := c.get(ctx, "videos", params, 1, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Items) == 0 {
+		return "", ErrNotFound
+	}
+	return resp.Items[0].Snippet.Description, nil
+}
+
+type noCacheKey struct{}
+
+// NoCache returns a context whose requests skip the page cache, for syncs a
+// user asked for explicitly and expects to see YouTube's current state.
+// The fresh responses still replace the cached ones.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// get performs a cached, quota-counted GET against an API endpoint.
+// cost is the quota price of the call as documented by Google.
+func (c *APIClient) get(ctx context.Context, endpoint string, params url.Values, cost int, dst any) error {
+	if c.APIKey == "" {
+		return fmt.Errorf("YOUTUBE_API_KEY not set")
+	}
+
+	cacheKey := fmt.Sprintf("youtube:%s:%s", endpoint, params.Encode())
+	if skip, _ := ctx.Value(noCacheKey{}).(bool); !skip && c.Cache.Get(ctx, cacheKey, dst) {
+		return nil
+	}
+
+	if err := c.spendQuota(ctx, cost); err != nil {
+		return err
+	}
+
+	params.Set("key", c.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBase+"/"+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusForbidden && isQuotaError(resp):
+		return ErrQuotaExceeded
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("YouTube API error: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return err
+	}
+
+	c.Cache.Set(ctx, cacheKey, dst, c.CacheTTL)
+	return nil
+}
+
+// spendQuota records cost units against today's budget (Pacific time, like Google's reset).
+// The check and the increment are one atomic step, so concurrent syncs on
+// several instances cannot overshoot the budget together. Day counters
+// expire once the day is over.
+// Without Redis the budget cannot be shared between instances, so it is not enforced.
+func (c *APIClient) spendQuota(ctx context.Context, cost int) error {
+	if c.DailyBudget <= 0 || c.Cache == nil {
+		return nil
+	}
+
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		loc = time.UTC
+	}
+	key := fmt.Sprintf("youtube:quota:%s", time.Now().In(loc).Format("2006-01-02"))
+
+	ok, err := c.Cache.IncrWithin(ctx, key, int64(cost), int64(c.DailyBudget), 48*time.Hour)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func isQuotaError(resp *http.Response) bool {
+	var body struct {
+		Error struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false
+	}
+	for _, e := range body.Error.Errors {
+		if strings.Contains(e.Reason, "quota") || e.Reason == "rateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// VideoIDFromURL extracts the video ID from watch, short and embed URLs.
+func VideoIDFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if v := u.Query().Get("v"); v != "" {
+		return v
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	path := strings.Trim(u.Path, "/")
+	switch {
+	case host == "youtu.be":
+		return path
+	case strings.HasPrefix(path, "embed/"), strings.HasPrefix(path, "shorts/"), strings.HasPrefix(path, "live/"):
+		return path[strings.Index(path, "/")+1:]
+	}
+	return ""
+}
+
+// WatchURL builds the canonical watch URL for a video ID.
+func WatchURL(videoID string) string {
+	return "https://www.youtube.com/watch?v=" + videoID
+}
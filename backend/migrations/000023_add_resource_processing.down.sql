@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_resources_processing_status;
+
+ALTER TABLE resources
+DROP COLUMN processed_at,
+DROP COLUMN thumbnail_url,
+DROP COLUMN duration_seconds,
+DROP COLUMN page_count,
+DROP COLUMN file_size_bytes,
+DROP COLUMN mime_type,
+DROP COLUMN processing_error,
+DROP COLUMN processing_status;
@@ -0,0 +1,18 @@
+-- Media processing results for uploaded PDFs and audio.
+-- Filled asynchronously by the background processor after a resource is created.
+ALTER TABLE resources
+ADD COLUMN processing_status TEXT NOT NULL DEFAULT 'pending' CHECK (processing_status IN ('pending', 'processing', 'completed', 'failed', 'skipped')),
+ADD COLUMN processing_error TEXT,
+ADD COLUMN mime_type TEXT,
+ADD COLUMN file_size_bytes BIGINT,
+ADD COLUMN page_count INT,
+ADD COLUMN duration_seconds INT,
+ADD COLUMN thumbnail_url TEXT,
+ADD COLUMN processed_at TIMESTAMP WITH TIME ZONE;
+
+-- Links and videos have nothing to inspect, so don't leave them queued forever.
+UPDATE resources
+SET processing_status = 'skipped'
+WHERE type NOT IN ('pdf', 'audio');
+
+CREATE INDEX idx_resources_processing_status ON resources(processing_status);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS resource_link_checks;
+
+DROP INDEX IF EXISTS idx_resources_link_checked_at;
+DROP INDEX IF EXISTS idx_resources_link_status;
+
+ALTER TABLE resources
+DROP COLUMN link_checked_at,
+DROP COLUMN link_failures,
+DROP COLUMN link_status;
@@ -0,0 +1,20 @@
+-- Link health for external resources (YouTube, web links, remote files)
+ALTER TABLE resources
+ADD COLUMN link_status TEXT NOT NULL DEFAULT 'unknown' CHECK (link_status IN ('unknown', 'ok', 'broken')),
+ADD COLUMN link_failures INT NOT NULL DEFAULT 0, -- consecutive failed probes
+ADD COLUMN link_checked_at TIMESTAMP WITH TIME ZONE;
+
+-- Probe history, one row per check
+CREATE TABLE IF NOT EXISTS resource_link_checks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    ok BOOLEAN NOT NULL,
+    status_code INT, -- NULL when the request never got a response
+    error TEXT,
+    latency_ms INT NOT NULL DEFAULT 0,
+    checked_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_link_checks_resource ON resource_link_checks(resource_id, checked_at DESC);
+CREATE INDEX idx_resources_link_status ON resources(link_status);
+CREATE INDEX idx_resources_link_checked_at ON resources(link_checked_at NULLS FIRST);
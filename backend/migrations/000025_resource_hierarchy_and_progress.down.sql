@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_resource_progress;
+DROP INDEX IF EXISTS idx_resources_parent;
+-- parent_id, sequence_index and created_by predate this migration on most
+-- databases, so they are intentionally left in place.
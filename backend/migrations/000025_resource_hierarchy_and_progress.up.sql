@@ -0,0 +1,20 @@
+-- Playlist hierarchy columns used by the app since playlists were introduced.
+-- IF NOT EXISTS keeps this safe on databases where they were added by hand.
+ALTER TABLE resources
+ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES resources(id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS sequence_index INT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_resources_parent ON resources(parent_id, sequence_index);
+
+-- Per-user listening/watching progress on individual resources
+CREATE TABLE IF NOT EXISTS user_resource_progress (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    position_seconds INT NOT NULL DEFAULT 0,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, resource_id)
+);
+
+CREATE INDEX idx_user_resource_progress_resource ON user_resource_progress(resource_id);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS playlist_sync_runs;
+
+DROP INDEX IF EXISTS idx_resources_parent_video;
+DROP INDEX IF EXISTS idx_resources_source_playlist;
+
+ALTER TABLE resources
+DROP COLUMN last_sync_attempt_at,
+DROP COLUMN last_synced_at,
+DROP COLUMN sync_enabled,
+DROP COLUMN source_removed,
+DROP COLUMN source_video_id,
+DROP COLUMN source_playlist_id;
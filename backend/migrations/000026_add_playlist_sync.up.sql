@@ -0,0 +1,25 @@
+-- Playlist-backed resource groups that can be re-synced from YouTube
+ALTER TABLE resources
+ADD COLUMN source_playlist_id TEXT, -- set on playlist parents
+ADD COLUMN source_video_id TEXT,    -- set on synced episodes
+ADD COLUMN source_removed BOOLEAN NOT NULL DEFAULT FALSE, -- video no longer in the source playlist
+ADD COLUMN sync_enabled BOOLEAN NOT NULL DEFAULT FALSE,   -- include in scheduled syncs
+ADD COLUMN last_synced_at TIMESTAMP WITH TIME ZONE,        -- last successful sync
+ADD COLUMN last_sync_attempt_at TIMESTAMP WITH TIME ZONE;  -- last sync, failed or not
+
+CREATE INDEX idx_resources_source_playlist ON resources(source_playlist_id) WHERE source_playlist_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_resources_parent_video ON resources(parent_id, source_video_id) WHERE source_video_id IS NOT NULL;
+
+-- One row per sync run, for the admin audit view
+CREATE TABLE IF NOT EXISTS playlist_sync_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    trigger TEXT NOT NULL CHECK (trigger IN ('manual', 'scheduled')),
+    added INT NOT NULL DEFAULT 0,
+    updated INT NOT NULL DEFAULT 0,
+    removed INT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_playlist_sync_runs_resource ON playlist_sync_runs(resource_id, created_at DESC);
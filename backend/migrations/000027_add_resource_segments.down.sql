@@ -0,0 +1,3 @@
+DELETE FROM resources WHERE is_segment;
+DROP INDEX IF EXISTS idx_resources_segments;
+ALTER TABLE resources DROP COLUMN is_segment;
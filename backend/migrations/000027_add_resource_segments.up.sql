@@ -0,0 +1,7 @@
+-- Timestamped segments (chapters) of a video, stored as child resources
+-- with media_start_seconds/media_end_seconds. They stay in pending_review
+-- until an admin publishes them.
+ALTER TABLE resources
+ADD COLUMN is_segment BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_resources_segments ON resources(parent_id, media_start_seconds) WHERE is_segment;
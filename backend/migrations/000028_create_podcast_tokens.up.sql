@@ -0,0 +1,8 @@
+-- Per-user secret for private podcast feed URLs.
+-- Only the SHA-256 hash is stored, like password reset tokens.
+CREATE TABLE IF NOT EXISTS podcast_tokens (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_books_search_ar;
+DROP TABLE IF EXISTS transcript_cues;
+DROP TABLE IF EXISTS transcripts;
+DROP FUNCTION IF EXISTS normalize_arabic(TEXT);
@@ -0,0 +1,46 @@
+-- 1. Arabic-aware normalization shared by every text search.
+-- Lowercases, strips harakat/tatweel/Quranic marks, unifies alef/ya/ta marbuta
+-- variants, maps Arabic-Indic digits to Latin and drops transliteration
+-- apostrophes so "fa'il", "faʿil" and "fail" all match.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE OR REPLACE FUNCTION normalize_arabic(input TEXT) RETURNS TEXT AS $$
+    SELECT btrim(regexp_replace(
+        translate(
+            regexp_replace(lower(input), '[\u064B-\u065F\u0670\u0640\u06D6-\u06ED]', '', 'g'),
+            'أإآٱىةؤئ٠١٢٣٤٥٦٧٨٩۰۱۲۳۴۵۶۷۸۹-ʿʾ''`’‘',
+            'اااايهوي01234567890123456789 '
+        ),
+        '\s+', ' ', 'g'))
+$$ LANGUAGE SQL IMMUTABLE STRICT PARALLEL SAFE;
+
+-- 2. Transcripts, reviewed like other content
+CREATE TABLE IF NOT EXISTS transcripts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    language TEXT NOT NULL DEFAULT 'ar',
+    source_format TEXT NOT NULL CHECK (source_format IN ('vtt', 'srt')),
+    status content_status NOT NULL DEFAULT 'pending_review',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewer_id UUID REFERENCES users(id),
+    version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (resource_id, language)
+);
+
+-- 3. One row per cue so search can point at a timestamp
+CREATE TABLE IF NOT EXISTS transcript_cues (
+    id BIGSERIAL PRIMARY KEY,
+    transcript_id UUID NOT NULL REFERENCES transcripts(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    start_ms INT NOT NULL,
+    end_ms INT NOT NULL,
+    text TEXT NOT NULL
+);
+
+CREATE INDEX idx_transcript_cues_transcript ON transcript_cues(transcript_id, seq);
+CREATE INDEX idx_transcript_cues_search ON transcript_cues USING gin (normalize_arabic(text) gin_trgm_ops);
+
+-- 4. Book search uses the same normalization
+CREATE INDEX idx_books_search_ar ON books USING gin (normalize_arabic(COALESCE(title_ar, '') || ' ' || COALESCE(author_ar, '')) gin_trgm_ops);
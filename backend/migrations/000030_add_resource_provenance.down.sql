@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_resources_proposals;
+ALTER TABLE resources DROP COLUMN provenance;
@@ -0,0 +1,6 @@
+-- Where an aggregated resource came from (e.g. Internet Archive item and file).
+-- Aggregator proposals are draft resources with provenance set.
+ALTER TABLE resources
+ADD COLUMN provenance JSONB;
+
+CREATE INDEX idx_resources_proposals ON resources(book_id, created_at DESC) WHERE provenance IS NOT NULL AND status = 'draft';
@@ -0,0 +1,13 @@
+-- Prerequisite edges between roadmap nodes: node_id unlocks once every
+-- prerequisite_id is completed. Both ends must belong to the same roadmap
+-- and the graph must stay acyclic; the API enforces both.
+CREATE TABLE IF NOT EXISTS roadmap_node_prerequisites (
+    node_id UUID NOT NULL REFERENCES roadmap_nodes(id) ON DELETE CASCADE,
+    prerequisite_id UUID NOT NULL REFERENCES roadmap_nodes(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (node_id, prerequisite_id),
+    CHECK (node_id <> prerequisite_id)
+);
+
+CREATE INDEX idx_roadmap_prerequisites_prerequisite ON roadmap_node_prerequisites(prerequisite_id);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_roadmap_nodes_upstream;
+DROP INDEX IF EXISTS idx_roadmaps_owner;
+
+ALTER TABLE roadmap_nodes DROP COLUMN upstream_node_id;
+
+ALTER TABLE roadmaps
+DROP COLUMN share_token,
+DROP COLUMN upstream_base,
+DROP COLUMN forked_from_id,
+DROP COLUMN owner_id;
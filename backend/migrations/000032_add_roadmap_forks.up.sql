@@ -0,0 +1,17 @@
+-- Personal roadmaps: a user's private copy of a curated roadmap.
+-- owner_id is NULL for curated roadmaps. upstream_base is the snapshot of the
+-- original's nodes the fork last synced with, used to diff upstream changes.
+ALTER TABLE roadmaps
+ADD COLUMN owner_id UUID REFERENCES users(id) ON DELETE CASCADE,
+ADD COLUMN forked_from_id UUID REFERENCES roadmaps(id) ON DELETE SET NULL,
+ADD COLUMN upstream_base JSONB,
+ADD COLUMN share_token TEXT UNIQUE;
+
+-- The upstream node a forked node was copied from. Deliberately not a
+-- foreign key: the link must survive the upstream node being deleted so the
+-- removal can still be offered as a change to merge.
+ALTER TABLE roadmap_nodes
+ADD COLUMN upstream_node_id UUID;
+
+CREATE INDEX idx_roadmaps_owner ON roadmaps(owner_id) WHERE owner_id IS NOT NULL;
+CREATE INDEX idx_roadmap_nodes_upstream ON roadmap_nodes(upstream_node_id) WHERE upstream_node_id IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Roadmap completion certificates. payload is the exact signed JSON document
+-- (kept as TEXT, since JSONB would reorder keys and break the signature).
+CREATE TABLE IF NOT EXISTS certificates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code TEXT UNIQUE NOT NULL, -- public verification code
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    roadmap_id UUID NOT NULL REFERENCES roadmaps(id) ON DELETE CASCADE,
+    payload TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    key_id TEXT NOT NULL, -- signing key, so rotated secrets still verify
+    issued_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE (user_id, roadmap_id)
+);
+
+CREATE INDEX idx_certificates_user ON certificates(user_id);
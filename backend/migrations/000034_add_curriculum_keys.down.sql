@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_roadmap_nodes_key;
+ALTER TABLE roadmap_nodes DROP COLUMN key;
+ALTER TABLE books DROP COLUMN slug;
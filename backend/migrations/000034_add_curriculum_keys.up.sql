@@ -0,0 +1,7 @@
+-- Stable identifiers for curriculum documents: books are referenced by slug
+-- (IDs differ between staging and production) and roadmap nodes by a key
+-- unique within their roadmap, so re-importing a document updates in place.
+ALTER TABLE books ADD COLUMN slug TEXT UNIQUE;
+
+ALTER TABLE roadmap_nodes ADD COLUMN key TEXT;
+CREATE UNIQUE INDEX idx_roadmap_nodes_key ON roadmap_nodes(roadmap_id, key) WHERE key IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS assessment_attempts;
+DROP TABLE IF EXISTS assessment_questions;
+DROP TABLE IF EXISTS node_assessments;
@@ -0,0 +1,52 @@
+-- Optional assessment gating completion of a roadmap node.
+-- kind: 'quiz' (graded from the question bank), 'recitation' (the student
+-- submits a recording, a reviewer scores it) or 'signoff' (a teacher
+-- confirms the student is ready).
+CREATE TABLE IF NOT EXISTS node_assessments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    node_id UUID UNIQUE NOT NULL REFERENCES roadmap_nodes(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('quiz', 'recitation', 'signoff')),
+    title TEXT NOT NULL,
+    instructions TEXT NOT NULL DEFAULT '',
+    pass_score INT NOT NULL DEFAULT 70 CHECK (pass_score BETWEEN 0 AND 100),
+    question_count INT NOT NULL DEFAULT 0, -- questions drawn per quiz attempt, 0 = all
+    cooldown_hours INT NOT NULL DEFAULT 24, -- wait after a failed attempt
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Multiple-choice question bank of a quiz.
+CREATE TABLE IF NOT EXISTS assessment_questions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    assessment_id UUID NOT NULL REFERENCES node_assessments(id) ON DELETE CASCADE,
+    prompt TEXT NOT NULL,
+    choices JSONB NOT NULL, -- array of strings
+    correct_index INT NOT NULL,
+    sequence_index INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_assessment_questions_assessment ON assessment_questions(assessment_id, sequence_index);
+
+-- status: 'in_progress' (quiz served), 'pending_review', 'passed', 'failed'.
+CREATE TABLE IF NOT EXISTS assessment_attempts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    assessment_id UUID NOT NULL REFERENCES node_assessments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    question_ids JSONB NOT NULL DEFAULT '[]',
+    answers JSONB NOT NULL DEFAULT '{}',
+    submission TEXT NOT NULL DEFAULT '',
+    score INT,
+    feedback TEXT NOT NULL DEFAULT '',
+    reviewer_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    submitted_at TIMESTAMP WITH TIME ZONE,
+    reviewed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_assessment_attempts_user ON assessment_attempts(assessment_id, user_id, started_at DESC);
+CREATE INDEX idx_assessment_attempts_pending ON assessment_attempts(submitted_at) WHERE status = 'pending_review';
+
+-- At most one open attempt per user and assessment.
+CREATE UNIQUE INDEX idx_assessment_attempts_open ON assessment_attempts(assessment_id, user_id)
+    WHERE status IN ('in_progress', 'pending_review');
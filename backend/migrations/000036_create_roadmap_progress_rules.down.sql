@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS roadmap_progress_events;
+DROP TABLE IF EXISTS roadmap_progress_rules;
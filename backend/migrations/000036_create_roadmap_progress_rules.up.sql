@@ -0,0 +1,31 @@
+-- Per-roadmap rules for moving nodes automatically. Roadmaps without a row
+-- use the defaults below.
+-- complete_on_finish: 'off', 'suggest' (ask the student) or 'auto'.
+CREATE TABLE IF NOT EXISTS roadmap_progress_rules (
+    roadmap_id UUID PRIMARY KEY REFERENCES roadmaps(id) ON DELETE CASCADE,
+    start_on_activity BOOLEAN NOT NULL DEFAULT true,
+    complete_on_finish TEXT NOT NULL DEFAULT 'suggest' CHECK (complete_on_finish IN ('off', 'suggest', 'auto')),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Audit trail of roadmap progress changes and their source
+-- ('manual', 'activity', 'reading'). Suggestions are events that were not
+-- applied; resolved_at is set once the student acts on them or dismisses them.
+CREATE TABLE IF NOT EXISTS roadmap_progress_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    node_id UUID NOT NULL REFERENCES roadmap_nodes(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    source TEXT NOT NULL,
+    applied BOOLEAN NOT NULL DEFAULT true,
+    detail JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_roadmap_progress_events_user ON roadmap_progress_events(user_id, created_at DESC);
+
+-- At most one open suggestion per user and node.
+CREATE UNIQUE INDEX idx_roadmap_progress_events_suggestion ON roadmap_progress_events(user_id, node_id)
+    WHERE NOT applied AND resolved_at IS NULL;
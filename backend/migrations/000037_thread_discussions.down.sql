@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS discussion_reactions;
+DROP TABLE IF EXISTS discussion_reply_revisions;
+DROP INDEX IF EXISTS idx_replies_thread_page;
+ALTER TABLE discussions DROP COLUMN IF EXISTS accepted_reply_id;
+ALTER TABLE discussion_replies
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS edited_at,
+    DROP COLUMN IF EXISTS child_count,
+    DROP COLUMN IF EXISTS depth,
+    DROP COLUMN IF EXISTS parent_id;
+ALTER TABLE discussions DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,37 @@
+-- Question threads can mark one reply as the accepted answer.
+ALTER TABLE discussions ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'discussion'
+    CHECK (kind IN ('discussion', 'question'));
+
+-- Nested replies. Deleted replies keep their row as a tombstone so their
+-- children stay in place.
+ALTER TABLE discussion_replies
+    ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES discussion_replies(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS child_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE discussions ADD COLUMN IF NOT EXISTS accepted_reply_id UUID
+    REFERENCES discussion_replies(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_replies_thread_page ON discussion_replies(discussion_id, parent_id, created_at, id);
+
+-- Previous bodies of edited replies.
+CREATE TABLE IF NOT EXISTS discussion_reply_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reply_id UUID NOT NULL REFERENCES discussion_replies(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    edited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reply_revisions_reply ON discussion_reply_revisions(reply_id, created_at);
+
+CREATE TABLE IF NOT EXISTS discussion_reactions (
+    reply_id UUID NOT NULL REFERENCES discussion_replies(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (reply_id, user_id, emoji)
+);
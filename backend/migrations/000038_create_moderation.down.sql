@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS blocked_terms;
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS user_sanctions;
+DROP TABLE IF EXISTS content_reports;
+ALTER TABLE notes DROP COLUMN IF EXISTS hidden_by, DROP COLUMN IF EXISTS hidden_at;
+ALTER TABLE discussion_replies DROP COLUMN IF EXISTS hidden_by, DROP COLUMN IF EXISTS hidden_at;
+ALTER TABLE discussions DROP COLUMN IF EXISTS hidden_by, DROP COLUMN IF EXISTS hidden_at;
@@ -0,0 +1,69 @@
+-- 1. Moderators can take content out of public view without deleting it
+ALTER TABLE discussions
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS hidden_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE discussion_replies
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS hidden_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS hidden_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- 2. User reports. A report without a reporter was filed by the blocked-term filter.
+CREATE TABLE IF NOT EXISTS content_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    reporter_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL CHECK (content_type IN ('discussion', 'reply', 'note')),
+    content_id UUID NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'abuse', 'inappropriate', 'misinformation', 'blocked_term', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_reports_reporter ON content_reports(reporter_id, content_type, content_id);
+CREATE INDEX IF NOT EXISTS idx_content_reports_queue ON content_reports(content_type, content_id) WHERE status = 'open';
+
+-- 3. Mutes stop a user from posting; bans also keep them out of chat rooms.
+-- A NULL expires_at never expires.
+CREATE TABLE IF NOT EXISTS user_sanctions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('mute', 'ban')),
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP(0) WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+    revoked_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sanctions_user ON user_sanctions(user_id) WHERE revoked_at IS NULL;
+
+-- 4. Audit trail of every moderator action. A NULL moderator is the system.
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    content_type TEXT,
+    content_id UUID,
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_created ON moderation_actions(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_target ON moderation_actions(target_user_id, created_at DESC);
+
+-- 5. Blocked terms, matched on normalize_arabic() text so diacritics,
+-- tatweel and letter variants do not slip past the filter.
+CREATE TABLE IF NOT EXISTS blocked_terms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    term TEXT NOT NULL,
+    normalized TEXT NOT NULL UNIQUE,
+    action TEXT NOT NULL DEFAULT 'reject' CHECK (action IN ('reject', 'review')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW()
+);
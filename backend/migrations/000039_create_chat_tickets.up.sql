@@ -0,0 +1,11 @@
+-- One-time tickets for opening a chat websocket, so the long-lived JWT never
+-- travels in a URL. Only the SHA-256 hash is stored, like podcast tokens.
+CREATE TABLE IF NOT EXISTS chat_tickets (
+    token_hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    room_id UUID NOT NULL REFERENCES discussions(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_tickets_expires ON chat_tickets(expires_at);
@@ -0,0 +1,3 @@
+DELETE FROM discussions WHERE context_type = 'circle';
+DROP TABLE IF EXISTS circle_members;
+DROP TABLE IF EXISTS study_circles;
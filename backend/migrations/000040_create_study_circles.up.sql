@@ -0,0 +1,31 @@
+-- Teacher-run study circles (halaqat). Unlike cohorts they are created by
+-- hand and joined with an invite code. Each circle studies at most one
+-- assigned book or roadmap and has its own private discussion room.
+CREATE TABLE IF NOT EXISTS study_circles (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    teacher_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id UUID REFERENCES books(id) ON DELETE SET NULL,
+    roadmap_id UUID REFERENCES roadmaps(id) ON DELETE SET NULL,
+    invite_code TEXT NOT NULL UNIQUE,
+    discussion_id UUID REFERENCES discussions(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT study_circles_one_assignment CHECK (book_id IS NULL OR roadmap_id IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_study_circles_teacher ON study_circles(teacher_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_study_circles_discussion ON study_circles(discussion_id);
+
+-- The teacher is a member too, so the roster and room checks need one table.
+CREATE TABLE IF NOT EXISTS circle_members (
+    circle_id UUID NOT NULL REFERENCES study_circles(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'student' CHECK (role IN ('teacher', 'assistant', 'student')),
+    joined_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (circle_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_members_user ON circle_members(user_id);
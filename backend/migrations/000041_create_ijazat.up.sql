@@ -0,0 +1,36 @@
+-- Ijazat: a teacher's attestation that a student completed a text. Each
+-- ijazah points at the teacher's own ijazah for the text (parent_id), so a
+-- student's sanad is the chain of parents.
+--
+-- Ijazat granted on the platform are verified: they have a public code and a
+-- signed payload. Links users record for teachers who are not on the
+-- platform are unverified; the links above such a teacher have no student
+-- account (student_id is NULL).
+CREATE TABLE IF NOT EXISTS ijazat (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code TEXT UNIQUE,
+    student_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    student_name TEXT NOT NULL,
+    teacher_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    teacher_name TEXT NOT NULL,
+    parent_id UUID REFERENCES ijazat(id) ON DELETE SET NULL,
+    book_id UUID REFERENCES books(id) ON DELETE SET NULL,
+    text_title TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('riwayah', 'tadris', 'tabarruk')),
+    completion TEXT NOT NULL CHECK (completion IN ('recitation', 'reading')),
+    granted_on DATE NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    payload TEXT,
+    signature TEXT,
+    key_id TEXT NOT NULL DEFAULT '', -- signing key; empty for unverified links
+    recorded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT ijazat_verified_signed CHECK (NOT verified OR (code IS NOT NULL AND payload IS NOT NULL AND signature IS NOT NULL AND key_id <> ''))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ijazat_student ON ijazat(student_id);
+CREATE INDEX IF NOT EXISTS idx_ijazat_teacher ON ijazat(teacher_id);
+CREATE INDEX IF NOT EXISTS idx_ijazat_parent ON ijazat(parent_id);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS partner_nudges;
+DROP TABLE IF EXISTS partner_checkins;
+
+DROP INDEX IF EXISTS idx_partners_pair;
+ALTER TABLE partners ADD CONSTRAINT unique_partnership UNIQUE (user_id_1, user_id_2);
+
+DELETE FROM partners WHERE status = 'declined';
+ALTER TABLE partners DROP CONSTRAINT IF EXISTS partners_status_check;
+ALTER TABLE partners ADD CONSTRAINT partners_status_check CHECK (status IN ('pending', 'accepted'));
+ALTER TABLE partners
+    DROP COLUMN IF EXISTS accepted_at,
+    DROP COLUMN IF EXISTS goal;
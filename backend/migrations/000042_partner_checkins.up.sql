@@ -0,0 +1,41 @@
+-- 1. Partnerships can be declined, carry a shared daily goal, and are unique
+-- per pair of users whichever of them sent the invite.
+ALTER TABLE partners DROP CONSTRAINT IF EXISTS partners_status_check;
+ALTER TABLE partners ADD CONSTRAINT partners_status_check CHECK (status IN ('pending', 'accepted', 'declined'));
+ALTER TABLE partners
+    ADD COLUMN IF NOT EXISTS goal TEXT NOT NULL DEFAULT 'Did you review today?',
+    ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE partners SET accepted_at = updated_at WHERE status = 'accepted' AND accepted_at IS NULL;
+
+-- Keep the oldest row of pairs that invited each other.
+DELETE FROM partners p
+USING partners q
+WHERE LEAST(p.user_id_1, p.user_id_2) = LEAST(q.user_id_1, q.user_id_2)
+  AND GREATEST(p.user_id_1, p.user_id_2) = GREATEST(q.user_id_1, q.user_id_2)
+  AND (p.created_at, p.id) > (q.created_at, q.id);
+
+ALTER TABLE partners DROP CONSTRAINT IF EXISTS unique_partnership;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_partners_pair ON partners (LEAST(user_id_1, user_id_2), GREATEST(user_id_1, user_id_2));
+
+-- 2. One check-in per partner per day: did they meet the partnership's goal?
+CREATE TABLE IF NOT EXISTS partner_checkins (
+    partnership_id UUID NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checkin_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    done BOOLEAN NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (partnership_id, user_id, checkin_date)
+);
+
+-- 3. Nudges sent for missed goals. The primary key lets every API instance
+-- run the nudger without sending the same nudge twice.
+CREATE TABLE IF NOT EXISTS partner_nudges (
+    partnership_id UUID NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    missed_on DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (partnership_id, user_id, missed_on)
+);
@@ -0,0 +1,8 @@
+-- Teachers approved by staff. Only they can open study circles and grant
+-- ijazat; users.role is about site administration and has no teacher role.
+CREATE TABLE IF NOT EXISTS teachers (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    approved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    approved_at TIMESTAMP(0) WITH TIME ZONE DEFAULT NOW()
+);